@@ -0,0 +1,325 @@
+// dbbench 对比 SQLite 调优前后的读写性能：
+//
+//	go run ./cmd/dbbench -rows 1000000
+//
+// 先用 SQLiteStorage 生成包含 rows 条活动记录和 rows 条键盘输入的数据库（调优配置），
+// 再用 VACUUM INTO 复制一份、删除二级索引并切回 rollback journal 作为基线，
+// 基线使用默认连接参数和调优前的 SQL 语句（不预编译），两边运行相同的查询和写入负载
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	rows       = flag.Int("rows", 1000000, "number of activities and keyboard inputs to generate")
+	dir        = flag.String("dir", "", "directory for the benchmark databases (default: a temp dir)")
+	iterations = flag.Int("n", 20, "iterations per query")
+	duration   = flag.Duration("concurrent", 3*time.Second, "duration of the concurrent read/write test")
+	keep       = flag.Bool("keep", false, "keep the generated databases")
+)
+
+var apps = []string{
+	"Safari", "Xcode", "Terminal", "Slack", "Mail", "Notes", "Finder", "Music", "Calendar", "Preview",
+	"Visual Studio Code", "Google Chrome", "WeChat", "Figma", "Zoom", "Pages", "Numbers", "Keynote",
+}
+
+// baselineIndexes 调优引入的二级索引，基线中删除
+var baselineIndexes = []string{
+	"idx_activities_timestamp", "idx_activities_app_name_timestamp", "idx_activities_type_timestamp",
+	"idx_keyboard_inputs_timestamp", "idx_keyboard_inputs_app_name_timestamp", "idx_ai_summaries_created_at",
+}
+
+func main() {
+	flag.Parse()
+
+	workDir := *dir
+	if workDir == "" {
+		tmp, err := os.MkdirTemp("", "yaml-dbbench-")
+		if err != nil {
+			log.Fatal(err)
+		}
+		workDir = tmp
+	}
+	if !*keep {
+		defer os.RemoveAll(workDir)
+	}
+
+	tunedPath := filepath.Join(workDir, "tuned.db")
+	baselinePath := filepath.Join(workDir, "baseline.db")
+
+	store, err := storage.NewSQLiteStorage(tunedPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	start := now.AddDate(-1, 0, 0)
+
+	fmt.Printf("Generating %d activities and %d keyboard inputs...\n", *rows, *rows)
+	began := time.Now()
+	if err := generate(store, *rows, start, now); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Generated in %s\n", time.Since(began).Round(time.Millisecond))
+
+	if err := makeBaseline(tunedPath, baselinePath); err != nil {
+		log.Fatal(err)
+	}
+	baseline, err := sql.Open("sqlite3", baselinePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer baseline.Close()
+
+	rangeFrom := now.AddDate(0, 0, -7)
+	rangeTo := now.AddDate(0, 0, -6)
+
+	fmt.Printf("\n%-32s %14s %14s %10s\n", "query (avg latency)", "baseline", "tuned", "speedup")
+	compare("recent activities", func() error {
+		return drain(baseline.Query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration
+			FROM activities ORDER BY timestamp DESC LIMIT ?`, 50))
+	}, func() error {
+		_, err := store.GetRecentActivities(50)
+		return err
+	})
+	compare("activities in time range", func() error {
+		return drain(baseline.Query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration
+			FROM activities WHERE timestamp >= ? AND timestamp < ? ORDER BY timestamp DESC, id DESC LIMIT ?`, rangeFrom, rangeTo, 51))
+	}, func() error {
+		_, _, err := store.QueryActivities(storage.ActivityQuery{From: rangeFrom, To: rangeTo, Limit: 50})
+		return err
+	})
+	compare("activities by app", func() error {
+		return drain(baseline.Query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration
+			FROM activities WHERE app_name = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, "Xcode", 51))
+	}, func() error {
+		_, _, err := store.QueryActivities(storage.ActivityQuery{AppName: "Xcode", Limit: 50})
+		return err
+	})
+	compare("keyboard inputs by app", func() error {
+		return drain(baseline.Query(`SELECT id, text, app_name, timestamp
+			FROM keyboard_inputs WHERE app_name = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, "Slack", 21))
+	}, func() error {
+		_, _, err := store.QueryKeyboardInputs(storage.KeyboardQuery{AppName: "Slack", Limit: 20})
+		return err
+	})
+	compare("most active app", func() error {
+		var app string
+		return baseline.QueryRow(`SELECT app_name FROM activities WHERE app_name IS NOT NULL AND app_name != ''
+			GROUP BY app_name ORDER BY COUNT(*) DESC, app_name ASC LIMIT 1`).Scan(&app)
+	}, func() error {
+		_, err := store.GetMostActiveApp()
+		return err
+	})
+
+	fmt.Printf("\n%-32s %14s %14s %10s\n", "ingest (rows/s)", "baseline", "tuned", "speedup")
+	baselineRate := ingestBaseline(baseline, 2000)
+	tunedRate := ingestTuned(store, 20000)
+	fmt.Printf("%-32s %14.0f %14.0f %9.1fx\n", "keyboard inputs", baselineRate, tunedRate, tunedRate/baselineRate)
+
+	fmt.Printf("\nConcurrent reads while writing for %s:\n", *duration)
+	concurrent("baseline", func() error {
+		_, err := baseline.Exec(`INSERT INTO keyboard_inputs (text, app_name, timestamp) VALUES (?, ?, ?)`, "x", "Xcode", time.Now())
+		return err
+	}, func() error {
+		return drain(baseline.Query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration
+			FROM activities WHERE timestamp >= ? AND timestamp < ? ORDER BY timestamp DESC, id DESC LIMIT ?`, rangeFrom, rangeTo, 51))
+	})
+	concurrent("tuned", func() error {
+		return store.SaveKeyboardInput(&models.KeyboardInput{Text: "x", AppName: "Xcode", Timestamp: time.Now()})
+	}, func() error {
+		_, _, err := store.QueryActivities(storage.ActivityQuery{From: rangeFrom, To: rangeTo, Limit: 50})
+		return err
+	})
+
+	if *keep {
+		fmt.Printf("\nDatabases kept in %s\n", workDir)
+	}
+}
+
+// generate 按时间顺序批量写入测试数据
+func generate(store *storage.SQLiteStorage, count int, start, end time.Time) error {
+	const batchSize = 5000
+	step := end.Sub(start) / time.Duration(count)
+	rng := rand.New(rand.NewSource(1))
+
+	for offset := 0; offset < count; offset += batchSize {
+		batch := &storage.Batch{}
+		for i := offset; i < offset+batchSize && i < count; i++ {
+			timestamp := start.Add(step * time.Duration(i))
+			app := apps[rng.Intn(len(apps))]
+			batch.Activities = append(batch.Activities, &models.Activity{
+				Type:        models.ActivityTypeApp,
+				Content:     "app_activation: " + app,
+				AppName:     app,
+				WindowTitle: fmt.Sprintf("%s window %d", app, rng.Intn(100)),
+				Timestamp:   timestamp,
+				Duration:    int64(rng.Intn(600)),
+			})
+			batch.KeyboardInputs = append(batch.KeyboardInputs, &models.KeyboardInput{
+				Text:      fmt.Sprintf("typed text %d", i),
+				AppName:   apps[rng.Intn(len(apps))],
+				Timestamp: timestamp,
+			})
+		}
+		if err := store.SaveBatch(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeBaseline 复制数据库并还原为调优前的配置
+func makeBaseline(tunedPath, baselinePath string) error {
+	db, err := sql.Open("sqlite3", tunedPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`VACUUM INTO ?`, baselinePath); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	baseline, err := sql.Open("sqlite3", baselinePath)
+	if err != nil {
+		return err
+	}
+	defer baseline.Close()
+
+	for _, index := range baselineIndexes {
+		if _, err := baseline.Exec(`DROP INDEX IF EXISTS ` + index); err != nil {
+			return err
+		}
+	}
+	_, err = baseline.Exec(`PRAGMA journal_mode=DELETE`)
+	return err
+}
+
+func drain(rows *sql.Rows, err error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// measure 运行 fn 若干次，返回平均耗时（第一次作为预热不计入）
+func measure(fn func() error) time.Duration {
+	if err := fn(); err != nil {
+		log.Fatal(err)
+	}
+
+	began := time.Now()
+	for i := 0; i < *iterations; i++ {
+		if err := fn(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return time.Since(began) / time.Duration(*iterations)
+}
+
+func compare(name string, baseline, tuned func() error) {
+	before := measure(baseline)
+	after := measure(tuned)
+	fmt.Printf("%-32s %14s %14s %9.1fx\n", name, before.Round(time.Microsecond), after.Round(time.Microsecond),
+		float64(before)/float64(after))
+}
+
+// ingestBaseline 调优前的写入方式：每条记录一次自动提交
+func ingestBaseline(db *sql.DB, count int) float64 {
+	began := time.Now()
+	for i := 0; i < count; i++ {
+		_, err := db.Exec(`INSERT INTO keyboard_inputs (text, app_name, timestamp) VALUES (?, ?, ?)`,
+			"benchmark", "Xcode", time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return float64(count) / time.Since(began).Seconds()
+}
+
+// ingestTuned 批量写入：每 200 条一个事务
+func ingestTuned(store *storage.SQLiteStorage, count int) float64 {
+	const batchSize = 200
+	began := time.Now()
+	for written := 0; written < count; written += batchSize {
+		batch := &storage.Batch{}
+		for i := 0; i < batchSize; i++ {
+			batch.KeyboardInputs = append(batch.KeyboardInputs, &models.KeyboardInput{
+				Text: "benchmark", AppName: "Xcode", Timestamp: time.Now(),
+			})
+		}
+		if err := store.SaveBatch(batch); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return float64(count) / time.Since(began).Seconds()
+}
+
+// concurrent 一个协程持续写入，同时测量查询延迟
+func concurrent(name string, write, read func() error) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var writes, writeErrors int
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := write(); err != nil {
+				writeErrors++
+			} else {
+				writes++
+			}
+		}
+	}()
+
+	var latencies []time.Duration
+	readErrors := 0
+	deadline := time.Now().Add(*duration)
+	for time.Now().Before(deadline) {
+		began := time.Now()
+		if err := read(); err != nil {
+			readErrors++
+			continue
+		}
+		latencies = append(latencies, time.Since(began))
+	}
+	close(stop)
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(float64(len(latencies)-1)*p)].Round(time.Microsecond)
+	}
+
+	fmt.Printf("%-10s reads: %6d (p50 %s, p99 %s, errors %d)  writes: %6d (errors %d)\n",
+		name, len(latencies), percentile(0.5), percentile(0.99), readErrors, writes, writeErrors)
+}
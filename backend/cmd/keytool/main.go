@@ -0,0 +1,211 @@
+// keytool 管理静态数据加密的密钥文件：
+//
+//	keytool init    创建口令保护的密钥文件
+//	keytool status  查看密钥文件和数据库中密文使用的密钥
+//	keytool rotate  生成新密钥并用它重新加密数据库中的所有加密字段
+//
+// 口令依次从 YAML_ENCRYPTION_PASSPHRASE（当前口令）、YAML_NEW_ENCRYPTION_PASSPHRASE（新口令）
+// 读取，未设置时从标准输入读取。轮换密钥前请先停止服务器。
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/internal/vault"
+	"yaml-backend/pkg/config"
+)
+
+// EnvNewPassphrase 轮换密钥时使用的新口令
+const EnvNewPassphrase = "YAML_NEW_ENCRYPTION_PASSPHRASE"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "config/config.yaml"
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+
+	dbPath, err := cfg.GetDatabasePath()
+	if err != nil {
+		log.Fatal("Failed to get database path:", err)
+	}
+	keyPath := cfg.GetKeyFilePath(dbPath)
+
+	switch os.Args[1] {
+	case "init":
+		err = initKey(keyPath)
+	case "status":
+		err = status(keyPath)
+	case "rotate":
+		err = rotate(cfg, dbPath, keyPath)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keytool <init|status|rotate>")
+	os.Exit(2)
+}
+
+// initKey 创建新的密钥文件，已存在时报错
+func initKey(keyPath string) error {
+	if _, err := os.Stat(keyPath); err == nil {
+		return fmt.Errorf("key file %s already exists, use rotate to replace it", keyPath)
+	}
+
+	passphrase, err := newPassphrase(vault.EnvPassphrase)
+	if err != nil {
+		return err
+	}
+
+	keyFile, err := vault.NewKeyFile(passphrase)
+	if err != nil {
+		return err
+	}
+	if err := keyFile.Save(keyPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created key file %s (key %s)\n", keyPath, keyFile.KeyID())
+	return nil
+}
+
+// status 输出密钥文件信息
+func status(keyPath string) error {
+	keyFile, err := vault.LoadKeyFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load key file: %w", err)
+	}
+
+	fmt.Printf("Key file:   %s\n", keyPath)
+	fmt.Printf("Key ID:     %s\n", keyFile.KeyID())
+	fmt.Printf("Created at: %s\n", keyFile.CreatedAt.Format(time.RFC3339))
+	return nil
+}
+
+// rotate 用新密钥重新加密所有加密字段。新密钥先写入 <key>.new，
+// 数据库事务提交后旧密钥文件备份为 <key>.bak-<时间戳>，新密钥文件替换原文件
+func rotate(cfg *config.Config, dbPath, keyPath string) error {
+	if !cfg.Database.Encryption.Enabled {
+		return fmt.Errorf("encryption is not enabled in the configuration")
+	}
+
+	oldVault, err := vault.Load(keyPath)
+	if err != nil {
+		return err
+	}
+	if oldVault.Locked() {
+		passphrase, err := prompt("Current passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := oldVault.Unlock(passphrase); err != nil {
+			return fmt.Errorf("failed to unlock key file: %w", err)
+		}
+	}
+
+	passphrase, err := newPassphrase(EnvNewPassphrase)
+	if err != nil {
+		return err
+	}
+	newKeyFile, err := vault.NewKeyFile(passphrase)
+	if err != nil {
+		return err
+	}
+	newVault, err := vault.NewFromKeyFile(newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	newKeyPath := keyPath + ".new"
+	if err := newKeyFile.Save(newKeyPath); err != nil {
+		return err
+	}
+
+	store, err := storage.NewSQLiteStorage(dbPath, storage.WithEncryption(oldVault, cfg.Database.Encryption.EncryptActivities))
+	if err != nil {
+		os.Remove(newKeyPath)
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	updated, err := store.Reencrypt(oldVault, newVault)
+	if err != nil {
+		os.Remove(newKeyPath)
+		return fmt.Errorf("failed to re-encrypt database, nothing was changed: %w", err)
+	}
+
+	// 旧密钥来自密钥文件时先备份，再换上新密钥文件
+	if _, err := os.Stat(keyPath); err == nil {
+		backupPath := keyPath + ".bak-" + time.Now().Format("20060102150405")
+		if err := os.Rename(keyPath, backupPath); err != nil {
+			return fmt.Errorf("database was re-encrypted with key %s but the key file could not be replaced, move %s to %s manually: %w",
+				newKeyFile.KeyID(), newKeyPath, keyPath, err)
+		}
+		fmt.Printf("Old key file backed up to %s\n", backupPath)
+	}
+	if err := os.Rename(newKeyPath, keyPath); err != nil {
+		return fmt.Errorf("database was re-encrypted with key %s, move %s to %s manually: %w",
+			newKeyFile.KeyID(), newKeyPath, keyPath, err)
+	}
+
+	fmt.Printf("Re-encrypted %d fields from key %s to key %s\n", updated, oldVault.KeyID(), newKeyFile.KeyID())
+	if os.Getenv(vault.EnvPrivateKey) != "" {
+		fmt.Printf("Unset %s, the server now has to use the new key file\n", vault.EnvPrivateKey)
+	}
+	return nil
+}
+
+// newPassphrase 从环境变量读取新口令，未设置时从标准输入读取两次并确认一致
+func newPassphrase(env string) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := prompt("New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := prompt("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", errors.New("passphrase cannot be empty")
+	}
+	return passphrase, nil
+}
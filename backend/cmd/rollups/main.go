@@ -0,0 +1,92 @@
+// rollups 维护小时和每日统计表：
+//
+//	rollups rebuild [from]  根据原始记录重建 from 之后的统计，from 为 2006-01-02 或 RFC3339 时间，
+//	                        省略时重建全部仍有原始记录的时间段，更早的统计来自已清理的数据，保持不变
+//
+// 统计在写入时增量维护，一般不需要重建；用于修复手工修改数据库或升级异常后的统计。
+// 可以在服务器运行时执行，重建在一个事务中完成。
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/internal/vault"
+	"yaml-backend/pkg/config"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "rebuild" || len(os.Args) > 3 {
+		usage()
+	}
+
+	var from time.Time
+	if len(os.Args) == 3 {
+		var err error
+		if from, err = parseFrom(os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "config/config.yaml"
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+	if cfg.Database.Type == "memory" {
+		log.Fatal("The memory database has no persistent rollups to rebuild")
+	}
+
+	dbPath, err := cfg.GetDatabasePath()
+	if err != nil {
+		log.Fatal("Failed to get database path:", err)
+	}
+
+	// 打开数据库时与服务器使用相同的加密配置，避免为加密列重建全文索引
+	var opts []storage.Option
+	if cfg.Database.Encryption.Enabled {
+		keyVault, err := vault.Load(cfg.GetKeyFilePath(dbPath))
+		if err != nil {
+			log.Fatal("Failed to load encryption key:", err)
+		}
+		opts = append(opts, storage.WithEncryption(keyVault, cfg.Database.Encryption.EncryptActivities))
+	}
+
+	store, err := storage.NewSQLiteStorage(dbPath, opts...)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer store.Close()
+
+	result, err := store.RebuildRollups(from)
+	if err != nil {
+		log.Fatal("Failed to rebuild rollups:", err)
+	}
+	if result.RawRecords == 0 && result.HourlyRows == 0 {
+		fmt.Println("No raw records to rebuild rollups from")
+		return
+	}
+	fmt.Printf("Rebuilt %d hourly rollups from %d raw records since %s, corrected %d daily rollups\n",
+		result.HourlyRows, result.RawRecords, result.From.Format(time.RFC3339), result.DailyRows)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: rollups rebuild [from]")
+	os.Exit(2)
+}
+
+func parseFrom(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid from time %q", value)
+}
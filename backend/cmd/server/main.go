@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -9,12 +10,26 @@ import (
 
 	"yaml-backend/internal/ai"
 	"yaml-backend/internal/api"
+	"yaml-backend/internal/backup"
+	"yaml-backend/internal/importer"
+	"yaml-backend/internal/ingest"
 	"yaml-backend/internal/monitor"
+	"yaml-backend/internal/retention"
+	"yaml-backend/internal/screenshot"
 	"yaml-backend/internal/storage"
+	"yaml-backend/internal/syncer"
+	"yaml-backend/internal/vault"
 	"yaml-backend/pkg/config"
 )
 
 func main() {
+	// 录制和回放监控事件，用于重现问题和演示
+	recordPath := flag.String("record", "", "record every monitor event to this JSONL file")
+	replayPath := flag.String("replay", "", "replay a recording instead of the configured event sources and start monitoring")
+	replaySpeed := flag.Float64("replay-speed", 1, "replay speed factor, 0 replays instantly")
+	replayRebase := flag.Bool("replay-rebase", true, "shift replayed timestamps so the recording starts now")
+	flag.Parse()
+
 	// 加载配置文件
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
@@ -34,21 +49,113 @@ func main() {
 	}
 	fmt.Printf("Database path: %s\n", dbPath)
 
-	// 初始化数据库
-	storage, err := storage.NewSQLiteStorage(dbPath)
+	// 加载加密密钥（未设置口令时以锁定状态启动，数据仍可写入）
+	var opts []storage.Option
+	var keyVault *vault.Vault
+	if cfg.Database.Encryption.Enabled {
+		keyVault, err = vault.Load(cfg.GetKeyFilePath(dbPath))
+		if err != nil {
+			log.Fatal("Failed to load encryption key:", err)
+		}
+		if cfg.Database.Type == "memory" {
+			fmt.Println("Warning: encryption is ignored for the memory database")
+			keyVault = nil
+		} else {
+			opts = append(opts, storage.WithEncryption(keyVault, cfg.Database.Encryption.EncryptActivities))
+			fmt.Printf("Encryption enabled (key %s, locked: %v)\n", keyVault.KeyID(), keyVault.Locked())
+		}
+	}
+
+	// 初始化数据库（database.type 为 memory 时使用内存存储）
+	store, err := storage.NewStore(cfg.Database.Type, dbPath, opts...)
 	if err != nil {
 		log.Fatal("Failed to initialize storage:", err)
 	}
-	defer storage.Close()
+	defer store.Close()
+
+	// 创建事件来源，指定 -replay 时只回放录制文件
+	var sources []monitor.EventSource
+	if *replayPath != "" {
+		source, err := monitor.NewReplaySource(*replayPath, monitor.ReplayOptions{
+			Speed:  *replaySpeed,
+			Rebase: *replayRebase,
+		})
+		if err != nil {
+			log.Fatal("Failed to create replay source:", err)
+		}
+		sources = append(sources, source)
+	} else {
+		for _, name := range cfg.GetMonitorSources() {
+			source, err := monitor.NewSource(name, monitor.SourceOptions{
+				Swift: monitor.SwiftOptions{
+					Binary:           cfg.Monitor.SwiftBinary,
+					HeartbeatTimeout: cfg.GetHeartbeatTimeout(),
+				},
+				SocketPath: cfg.GetSocketPath(dbPath),
+			})
+			if err != nil {
+				log.Fatal("Failed to create event source:", err)
+			}
+			sources = append(sources, source)
+		}
+	}
 
 	// 创建监控管理器
-	monitorManager := monitor.NewManager(storage)
+	monitorManager := monitor.NewManager(store, monitor.Options{
+		IdleTimeout: cfg.GetIdleTimeout(),
+		Typing: monitor.CoalescerOptions{
+			IdleTimeout: cfg.GetTypingIdleTimeout(),
+			MaxLength:   cfg.Monitor.TypingMaxLength,
+		},
+		Ingest: ingest.Options{
+			Capacity:      cfg.Monitor.KeyboardBufferSize,
+			BatchSize:     cfg.Monitor.FlushBatchSize,
+			FlushInterval: cfg.GetFlushInterval(),
+		},
+		Sources:   sources,
+		RecordDir: cfg.GetRecordingsDir(dbPath),
+	})
+
+	if *recordPath != "" {
+		if _, err := monitorManager.StartRecording(*recordPath); err != nil {
+			log.Fatal("Failed to start recording:", err)
+		}
+	}
+	if *replayPath != "" {
+		if err := monitorManager.StartAll(); err != nil {
+			log.Fatal("Failed to start replay:", err)
+		}
+	}
 
 	// 创建AI服务
-	aiService := ai.NewAIService(storage, cfg.AI.Gemini.APIKey, cfg.AI.Gemini.BaseURL, cfg.GetAITimeout())
+	aiService := ai.NewAIService(store, cfg.AI.Gemini.APIKey, cfg.AI.Gemini.BaseURL, cfg.GetAITimeout())
+
+	// 启动数据保留清理任务
+	retentionWorker := retention.NewWorker(store, cfg.Database.RetentionDays, retention.DefaultInterval)
+	retentionWorker.Start()
+
+	// 启动定时备份（内存存储不支持备份）
+	backupManager := backup.NewManager(store, cfg.GetBackupDir(dbPath), cfg.Database.Backup.Keep, cfg.GetBackupInterval())
+	backupManager.Start()
+
+	// 导入其他工具的历史数据
+	importManager := importer.NewManager(store)
+
+	// 启动多设备同步，定时从对端拉取变更
+	syncManager := syncer.NewManager(store, cfg.Sync.Peers, cfg.Sync.Token, cfg.GetSyncInterval())
+	syncManager.Start()
+	fmt.Printf("Device ID: %s\n", store.DeviceID())
+
+	// 截图按内容哈希保存在数据目录下，按保留天数和空间上限定期淘汰
+	screenshotManager := screenshot.NewManager(store, cfg.GetScreenshotDir(dbPath), screenshot.Options{
+		MaxBytes:      cfg.GetScreenshotMaxBytes(),
+		RetentionDays: cfg.Screenshots.RetentionDays,
+		MaxUpload:     cfg.GetScreenshotMaxUpload(),
+	})
+	screenshotManager.Start()
 
 	// 设置路由
-	router := api.SetupRoutes(storage, monitorManager, aiService, cfg)
+	router := api.SetupRoutes(store, monitorManager, aiService, retentionWorker, backupManager, importManager, syncManager, screenshotManager, keyVault, cfg)
 
 	// 启动服务器
 	port := os.Getenv("PORT")
@@ -63,11 +170,18 @@ func main() {
 	go func() {
 		<-c
 		fmt.Println("\nShutting down gracefully...")
-		monitorManager.StopAll()
+		monitorManager.Close() // 写入队列中剩余的事件
+		retentionWorker.Stop()
+		backupManager.Stop()
+		syncManager.Stop()
+		screenshotManager.Stop()
+		store.Close()
 		os.Exit(0)
 	}()
 
-	fmt.Printf("Starting YAML Backend Server on port %s...\n", port)
+	// 只监听 server.host，默认的 localhost 不接受其他机器的连接
+	addr := cfg.Server.Host + ":" + port
+	fmt.Printf("Starting YAML Backend Server on %s...\n", addr)
 	fmt.Printf("API endpoints available at: http://localhost:%s/api/v1\n", port)
 	fmt.Printf("Health check: http://localhost:%s/api/v1/health\n", port)
 	fmt.Printf("Monitor control: http://localhost:%s/api/v1/monitor/\n", port)
@@ -79,7 +193,7 @@ func main() {
 	fmt.Printf("- POST /api/v1/ai/summary/keyboard - 生成键盘输入总结\n")
 	fmt.Printf("- GET /api/v1/ai/summaries - 获取历史总结\n")
 
-	if err := router.Run(":" + port); err != nil {
+	if err := router.Run(addr); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
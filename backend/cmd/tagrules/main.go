@@ -0,0 +1,100 @@
+// tagrules 对历史活动记录重新应用自动打标签规则：
+//
+//	tagrules apply [from [to]]  删除 [from, to) 内活动记录上规则生成的关联，再按当前生效的规则重新关联，
+//	                            from/to 为 2006-01-02 或 RFC3339 时间，省略时处理全部记录
+//
+// 规则只对新写入的活动记录自动生效；新增或修改规则后用它处理已有的记录，手动关联保持不变。
+// 可以在服务器运行时执行，但服务器缓存的规则不会更新，修改规则请使用 API。
+// 启用了 encrypt_activities 时需要设置 YAML_ENCRYPTION_PASSPHRASE 以解密窗口标题和网址。
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/internal/vault"
+	"yaml-backend/pkg/config"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "apply" || len(os.Args) > 4 {
+		usage()
+	}
+
+	var from, to time.Time
+	var err error
+	if len(os.Args) >= 3 {
+		if from, err = parseTime(os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(os.Args) == 4 {
+		if to, err = parseTime(os.Args[3]); err != nil {
+			log.Fatal(err)
+		}
+		if !from.Before(to) {
+			log.Fatal("from must be before to")
+		}
+	}
+
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "config/config.yaml"
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+	if cfg.Database.Type == "memory" {
+		log.Fatal("The memory database has no persistent activities to tag")
+	}
+
+	dbPath, err := cfg.GetDatabasePath()
+	if err != nil {
+		log.Fatal("Failed to get database path:", err)
+	}
+
+	var opts []storage.Option
+	if cfg.Database.Encryption.Enabled {
+		keyVault, err := vault.Load(cfg.GetKeyFilePath(dbPath))
+		if err != nil {
+			log.Fatal("Failed to load encryption key:", err)
+		}
+		opts = append(opts, storage.WithEncryption(keyVault, cfg.Database.Encryption.EncryptActivities))
+	}
+
+	store, err := storage.NewSQLiteStorage(dbPath, opts...)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer store.Close()
+
+	result, err := store.ApplyTagRules(from, to)
+	if err != nil {
+		log.Fatal("Failed to apply tagging rules:", err)
+	}
+	if result.Rules == 0 {
+		fmt.Printf("No enabled rules, removed %d rule links from %d activities\n", result.Removed, result.Activities)
+		return
+	}
+	fmt.Printf("Applied %d rules to %d activities: removed %d and created %d rule links\n",
+		result.Rules, result.Activities, result.Removed, result.Linked)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: tagrules apply [from [to]]")
+	os.Exit(2)
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
@@ -13,13 +13,39 @@ import (
 	"yaml-backend/pkg/models"
 )
 
+// DefaultModel 默认使用的模型
+const DefaultModel = "gemini-2.5-flash"
+
+// 提示词模板版本，修改对应的提示词或记录格式时需要递增，随总结一起保存
+const (
+	ActivityPromptVersion = "activity-v1"
+	KeyboardPromptVersion = "keyboard-v1"
+)
+
+// 每次总结最多写入提示词的记录数
+const (
+	maxActivityRecords = 10
+	maxKeyboardRecords = 15
+)
+
 // GeminiClient Gemini AI客户端
 type GeminiClient struct {
 	APIKey  string
 	BaseURL string
+	Model   string
 	client  *http.Client
 }
 
+// Generation 一次生成的结果和用量
+type Generation struct {
+	Text             string
+	Model            string // 响应中的模型版本，未返回时为请求的模型
+	FinishReason     string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
 // GeminiRequest Gemini API请求结构
 type GeminiRequest struct {
 	Contents []Content `json:"contents"`
@@ -67,9 +93,11 @@ type GeminiAPIResponse struct {
 		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
 	UsageMetadata struct {
-		PromptTokenCount int `json:"promptTokenCount"`
-		TotalTokenCount  int `json:"totalTokenCount"`
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
 	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
 }
 
 // NewGeminiClient 创建新的Gemini客户端
@@ -77,14 +105,15 @@ func NewGeminiClient(apiKey, baseURL string, timeout time.Duration) *GeminiClien
 	return &GeminiClient{
 		APIKey:  apiKey,
 		BaseURL: baseURL,
+		Model:   DefaultModel,
 		client: &http.Client{
 			Timeout: timeout,
 		},
 	}
 }
 
-// SummarizeActivities 总结用户活动
-func (g *GeminiClient) SummarizeActivities(activities []*models.Activity) (string, error) {
+// SummarizeActivities 总结用户活动，只使用前 maxActivityRecords 条记录
+func (g *GeminiClient) SummarizeActivities(activities []*models.Activity) (*Generation, error) {
 	// 构建活动数据的文本描述
 	activityText := g.buildActivityText(activities)
 
@@ -103,8 +132,8 @@ func (g *GeminiClient) SummarizeActivities(activities []*models.Activity) (strin
 	return g.generateContent(prompt)
 }
 
-// SummarizeKeyboardInputs 总结键盘输入
-func (g *GeminiClient) SummarizeKeyboardInputs(inputs []*models.KeyboardInput) (string, error) {
+// SummarizeKeyboardInputs 总结键盘输入，只使用前 maxKeyboardRecords 条记录
+func (g *GeminiClient) SummarizeKeyboardInputs(inputs []*models.KeyboardInput) (*Generation, error) {
 	// 构建输入数据的文本描述
 	inputText := g.buildInputText(inputs)
 
@@ -125,7 +154,7 @@ func (g *GeminiClient) SummarizeKeyboardInputs(inputs []*models.KeyboardInput) (
 }
 
 // generateContent 调用Gemini API生成内容
-func (g *GeminiClient) generateContent(prompt string) (string, error) {
+func (g *GeminiClient) generateContent(prompt string) (*Generation, error) {
 	// 构建请求
 	request := GeminiRequest{
 		Contents: []Content{
@@ -147,16 +176,16 @@ func (g *GeminiClient) generateContent(prompt string) (string, error) {
 	// 序列化请求
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// 构建API URL - AiHubMix需要在URL中包含key参数
-	apiURL := fmt.Sprintf("%s/v1beta/models/gemini-2.5-flash:generateContent?key=%s", g.BaseURL, g.APIKey)
+	apiURL := fmt.Sprintf("%s/v1beta/models/%s:generateContent?key=%s", g.BaseURL, g.Model, g.APIKey)
 
 	// 创建HTTP请求
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// 设置请求头
@@ -165,54 +194,65 @@ func (g *GeminiClient) generateContent(prompt string) (string, error) {
 	// 发送请求
 	resp, err := g.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	// 解析响应
 	var geminiResp GeminiAPIResponse
 	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	// 提取生成的文本
 	if len(geminiResp.Candidates) == 0 {
-		return "", fmt.Errorf("no candidates in response")
+		return nil, fmt.Errorf("no candidates in response")
 	}
 
 	candidate := geminiResp.Candidates[0]
 	if len(candidate.Content.Parts) == 0 {
 		// 如果没有parts，可能是因为达到了最大token限制或其他原因
 		if candidate.FinishReason == "MAX_TOKENS" {
-			return "", fmt.Errorf("response truncated due to max tokens limit")
+			return nil, fmt.Errorf("response truncated due to max tokens limit")
 		}
-		return "", fmt.Errorf("no parts in candidate content, finish reason: %s", candidate.FinishReason)
+		return nil, fmt.Errorf("no parts in candidate content, finish reason: %s", candidate.FinishReason)
 	}
 
 	text := candidate.Content.Parts[0].Text
 	if text == "" {
-		return "", fmt.Errorf("empty text in response")
+		return nil, fmt.Errorf("empty text in response")
 	}
 
-	return text, nil
+	generation := &Generation{
+		Text:             text,
+		Model:            geminiResp.ModelVersion,
+		FinishReason:     candidate.FinishReason,
+		PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+	}
+	if generation.Model == "" {
+		generation.Model = g.Model
+	}
+	return generation, nil
 }
 
 // buildActivityText 构建活动数据的文本描述
 func (g *GeminiClient) buildActivityText(activities []*models.Activity) string {
 	var text string
 	for i, activity := range activities {
-		if i >= 10 { // 减少到最多分析10条记录
+		if i >= maxActivityRecords {
 			break
 		}
 		// 简化输出格式，减少token使用
@@ -229,7 +269,7 @@ func (g *GeminiClient) buildActivityText(activities []*models.Activity) string {
 func (g *GeminiClient) buildInputText(inputs []*models.KeyboardInput) string {
 	var text string
 	for i, input := range inputs {
-		if i >= 15 { // 限制最多分析15条记录
+		if i >= maxKeyboardRecords {
 			break
 		}
 		// 为了隐私保护，只显示输入长度和应用信息
@@ -276,7 +316,7 @@ func (g *GeminiClient) generateContentStream(prompt string) (<-chan string, <-ch
 		}
 
 		// 构建API URL
-		apiURL := fmt.Sprintf("%s/v1beta/models/gemini-2.5-flash:streamGenerateContent?key=%s", g.BaseURL, g.APIKey)
+		apiURL := fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?key=%s", g.BaseURL, g.Model, g.APIKey)
 
 		// 创建HTTP请求
 		req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
@@ -10,29 +10,29 @@ import (
 
 // AIService AI服务管理器
 type AIService struct {
-	storage      *storage.SQLiteStorage
+	storage      storage.Store
 	geminiClient *GeminiClient
 }
 
 // NewAIService 创建新的AI服务
-func NewAIService(storage *storage.SQLiteStorage, apiKey, baseURL string, timeout time.Duration) *AIService {
+func NewAIService(storage storage.Store, apiKey, baseURL string, timeout time.Duration) *AIService {
 	return &AIService{
 		storage:      storage,
 		geminiClient: NewGeminiClient(apiKey, baseURL, timeout),
 	}
 }
 
-// GenerateActivitySummary 生成活动总结
-func (s *AIService) GenerateActivitySummary(limit int) (*storage.SummaryResult, error) {
-	// 获取最近的活动数据
-	activities, err := s.storage.GetRecentActivities(limit)
+// GenerateActivitySummary 生成活动总结，query 指定分析的时间段和条数
+func (s *AIService) GenerateActivitySummary(query storage.ActivityQuery) (*storage.SummaryResult, error) {
+	// 获取时间段内的活动数据
+	activities, _, err := s.storage.QueryActivities(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activities: %w", err)
 	}
 
 	if len(activities) == 0 {
 		return &storage.SummaryResult{
-			Type:      "activity",
+			Type:      storage.SummaryTypeActivity,
 			Summary:   "暂无活动数据可供分析",
 			DataCount: 0,
 			CreatedAt: time.Now(),
@@ -40,18 +40,20 @@ func (s *AIService) GenerateActivitySummary(limit int) (*storage.SummaryResult,
 	}
 
 	// 调用AI生成总结
-	summary, err := s.geminiClient.SummarizeActivities(activities)
+	generation, err := s.geminiClient.SummarizeActivities(activities)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate summary: %w", err)
 	}
 
-	// 保存总结结果
-	result := &storage.SummaryResult{
-		Type:      "activity",
-		Summary:   summary,
-		DataCount: len(activities),
-		CreatedAt: time.Now(),
+	// 保存总结结果，来源记录为实际写入提示词的记录
+	result := newSummary(storage.SummaryTypeActivity, generation, ActivityPromptVersion, len(activities))
+	used := activities[:min(len(activities), maxActivityRecords)]
+	ids := make([]int64, len(used))
+	timestamps := make([]time.Time, len(used))
+	for i, activity := range used {
+		ids[i], timestamps[i] = activity.ID, activity.Timestamp
 	}
+	result.SetSource(ids, timestamps)
 
 	if err := s.saveSummary(result); err != nil {
 		fmt.Printf("Warning: failed to save summary: %v\n", err)
@@ -60,17 +62,17 @@ func (s *AIService) GenerateActivitySummary(limit int) (*storage.SummaryResult,
 	return result, nil
 }
 
-// GenerateKeyboardSummary 生成键盘输入总结
-func (s *AIService) GenerateKeyboardSummary(limit int) (*storage.SummaryResult, error) {
-	// 获取最近的键盘输入数据
-	inputs, err := s.storage.GetRecentKeyboardInputs(limit)
+// GenerateKeyboardSummary 生成键盘输入总结，query 指定分析的时间段和条数
+func (s *AIService) GenerateKeyboardSummary(query storage.KeyboardQuery) (*storage.SummaryResult, error) {
+	// 获取时间段内的键盘输入数据
+	inputs, _, err := s.storage.QueryKeyboardInputs(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get keyboard inputs: %w", err)
 	}
 
 	if len(inputs) == 0 {
 		return &storage.SummaryResult{
-			Type:      "keyboard",
+			Type:      storage.SummaryTypeKeyboard,
 			Summary:   "暂无键盘输入数据可供分析",
 			DataCount: 0,
 			CreatedAt: time.Now(),
@@ -78,18 +80,20 @@ func (s *AIService) GenerateKeyboardSummary(limit int) (*storage.SummaryResult,
 	}
 
 	// 调用AI生成总结
-	summary, err := s.geminiClient.SummarizeKeyboardInputs(inputs)
+	generation, err := s.geminiClient.SummarizeKeyboardInputs(inputs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate summary: %w", err)
 	}
 
-	// 保存总结结果
-	result := &storage.SummaryResult{
-		Type:      "keyboard",
-		Summary:   summary,
-		DataCount: len(inputs),
-		CreatedAt: time.Now(),
+	// 保存总结结果，来源记录为实际写入提示词的记录
+	result := newSummary(storage.SummaryTypeKeyboard, generation, KeyboardPromptVersion, len(inputs))
+	used := inputs[:min(len(inputs), maxKeyboardRecords)]
+	ids := make([]int64, len(used))
+	timestamps := make([]time.Time, len(used))
+	for i, input := range used {
+		ids[i], timestamps[i] = input.ID, input.Timestamp
 	}
+	result.SetSource(ids, timestamps)
 
 	if err := s.saveSummary(result); err != nil {
 		fmt.Printf("Warning: failed to save summary: %v\n", err)
@@ -98,11 +102,37 @@ func (s *AIService) GenerateKeyboardSummary(limit int) (*storage.SummaryResult,
 	return result, nil
 }
 
+// newSummary 根据生成结果构建总结，记录模型、提示词版本和用量
+func newSummary(summaryType string, generation *Generation, promptVersion string, dataCount int) *storage.SummaryResult {
+	return &storage.SummaryResult{
+		Type:             summaryType,
+		Summary:          generation.Text,
+		DataCount:        dataCount,
+		CreatedAt:        time.Now(),
+		Model:            generation.Model,
+		PromptVersion:    promptVersion,
+		FinishReason:     generation.FinishReason,
+		PromptTokens:     generation.PromptTokens,
+		CompletionTokens: generation.CompletionTokens,
+		TotalTokens:      generation.TotalTokens,
+	}
+}
+
 // GetRecentSummaries 获取最近的总结
 func (s *AIService) GetRecentSummaries(limit int) ([]*storage.SummaryResult, error) {
 	return s.storage.GetRecentSummaries(limit)
 }
 
+// QuerySummaries 按类型和创建时间范围查询总结
+func (s *AIService) QuerySummaries(query storage.SummaryQuery) ([]*storage.SummaryResult, error) {
+	return s.storage.QuerySummaries(query)
+}
+
+// GetSummaryRecords 获取总结及生成时使用的来源记录，总结不存在时返回 nil
+func (s *AIService) GetSummaryRecords(id int64) (*storage.SummaryRecords, error) {
+	return s.storage.GetSummaryRecords(id)
+}
+
 // saveSummary 保存总结到数据库
 func (s *AIService) saveSummary(summary *storage.SummaryResult) error {
 	return s.storage.SaveSummary(summary)
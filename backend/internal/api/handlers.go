@@ -1,49 +1,94 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"yaml-backend/internal/ai"
+	"yaml-backend/internal/backup"
+	"yaml-backend/internal/export"
+	"yaml-backend/internal/importer"
 	"yaml-backend/internal/monitor"
+	"yaml-backend/internal/retention"
+	"yaml-backend/internal/screenshot"
 	"yaml-backend/internal/storage"
+	"yaml-backend/internal/syncer"
+	"yaml-backend/internal/vault"
 	"yaml-backend/pkg/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
-	storage   *storage.SQLiteStorage
+	storage   storage.Store
 	monitor   *monitor.Manager
 	aiService *ai.AIService
+	retention *retention.Worker
+	backup    *backup.Manager
+	importer  *importer.Manager
+	syncer    *syncer.Manager
+	shots     *screenshot.Manager
+	vault     *vault.Vault // 未启用加密时为 nil
+
+	changeWaiters atomic.Int32 // 正在长轮询等待变更的请求数
 }
 
-func NewHandler(storage *storage.SQLiteStorage, monitor *monitor.Manager, aiService *ai.AIService) *Handler {
+func NewHandler(storage storage.Store, monitor *monitor.Manager, aiService *ai.AIService, retention *retention.Worker, backup *backup.Manager, importer *importer.Manager, syncer *syncer.Manager, shots *screenshot.Manager, vault *vault.Vault) *Handler {
 	return &Handler{
 		storage:   storage,
 		monitor:   monitor,
 		aiService: aiService,
+		retention: retention,
+		backup:    backup,
+		importer:  importer,
+		syncer:    syncer,
+		shots:     shots,
+		vault:     vault,
+	}
+}
+
+// errorStatus 将存储层错误映射为HTTP状态码：锁定时返回 423，加密列过滤、无效的删除条件、同步记录
+// 和标签参数返回 400，标签或项目重名返回 409
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, vault.ErrLocked):
+		return http.StatusLocked
+	case errors.Is(err, storage.ErrEncryptedFilter), errors.Is(err, storage.ErrInvalidForget),
+		errors.Is(err, storage.ErrInvalidSync), errors.Is(err, storage.ErrInvalidLabel):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrDuplicateLabel):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
-// GetActivities 获取最近的活动记录
+// GetActivities 按时间范围和过滤条件分页获取活动记录
 func (h *Handler) GetActivities(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, err := strconv.Atoi(limitStr)
+	query, err := parseActivityQuery(c, "50")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	activities, err := h.storage.GetRecentActivities(limit)
+	activities, nextCursor, err := h.storage.QueryActivities(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"activities": activities,
-		"count":      len(activities),
+		"activities":  activities,
+		"count":       len(activities),
+		"next_cursor": nextCursor,
 	})
 }
 
@@ -63,24 +108,24 @@ func (h *Handler) PostActivity(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Activity saved successfully"})
 }
 
-// GetKeyboardInputs 获取键盘输入记录
+// GetKeyboardInputs 按时间范围和过滤条件分页获取键盘输入记录
 func (h *Handler) GetKeyboardInputs(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
+	query, err := parseKeyboardQuery(c, "20")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	inputs, err := h.storage.GetRecentKeyboardInputs(limit)
+	inputs, nextCursor, err := h.storage.QueryKeyboardInputs(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"keyboard_inputs": inputs,
 		"count":          len(inputs),
+		"next_cursor":    nextCursor,
 	})
 }
 
@@ -108,7 +153,7 @@ func (h *Handler) GetHealth(c *gin.Context) {
 	})
 }
 
-// GetStats 获取数据统计信息
+// GetStats 获取数据统计信息，全部来自预先汇总的每日统计，不扫描原始记录
 func (h *Handler) GetStats(c *gin.Context) {
 	// 获取活动总数
 	activityCount, err := h.storage.GetActivityCount()
@@ -138,96 +183,1390 @@ func (h *Handler) GetStats(c *gin.Context) {
 	})
 }
 
-// StartMonitoring 启动监控
-func (h *Handler) StartMonitoring(c *gin.Context) {
-	if err := h.monitor.StartAll(); err != nil {
+// GetDailyStats 获取按天按应用汇总的统计（包含已被清理的历史数据）
+func (h *Handler) GetDailyStats(c *gin.Context) {
+	stats, err := h.storage.GetDailyAppStats(c.Query("from"), c.Query("to"))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Monitoring started successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"daily_stats": stats,
+		"count":       len(stats),
+	})
 }
 
-// StopMonitoring 停止监控
-func (h *Handler) StopMonitoring(c *gin.Context) {
-	h.monitor.StopAll()
-	c.JSON(http.StatusOK, gin.H{"message": "Monitoring stopped successfully"})
+// GetHourlyStats 获取按小时按应用汇总的统计（from, to），未指定 from 时返回最近 24 小时
+func (h *Handler) GetHourlyStats(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-24 * time.Hour)
+		if !to.IsZero() && !from.Before(to) {
+			from = to.Add(-24 * time.Hour)
+		}
+	}
+
+	// to 不包含在范围内
+	toHour := ""
+	if !to.IsZero() {
+		toHour = storage.HourBucket(to.Add(-time.Nanosecond))
+	}
+	stats, err := h.storage.GetHourlyAppStats(storage.HourBucket(from), toHour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hourly_stats": stats,
+		"count":        len(stats),
+	})
 }
 
-// GetMonitorStatus 获取监控状态
-func (h *Handler) GetMonitorStatus(c *gin.Context) {
-	status := h.monitor.GetStatus()
+// GetAppUsage 获取应用前台使用会话和按应用汇总的使用时长（from, to, app, limit）
+func (h *Handler) GetAppUsage(c *gin.Context) {
+	limit, err := parseLimit(c, "100")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessions, err := h.storage.QueryAppUsage(storage.AppUsageQuery{
+		From:    from,
+		To:      to,
+		AppName: c.Query("app"),
+		Limit:   limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	totals, err := h.storage.GetAppUsageTotals(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status": status,
-		"running": h.monitor.IsRunning(),
+		"sessions": sessions,
+		"count":    len(sessions),
+		"totals":   totals,
+	})
+}
+
+// GetRetentionStatus 获取数据保留策略和最近一次清理结果
+func (h *Handler) GetRetentionStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":        h.retention.Enabled(),
+		"retention_days": h.retention.RetentionDays(),
+		"last_report":    h.retention.LastReport(),
 	})
 }
 
+// RunRetention 立即执行一次数据清理
+func (h *Handler) RunRetention(c *gin.Context) {
+	if !h.retention.Enabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Retention is disabled"})
+		return
+	}
+
+	report, err := h.retention.RunOnce()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
 
+	c.JSON(http.StatusOK, report)
+}
 
-// GenerateActivitySummary 生成活动总结
-func (h *Handler) GenerateActivitySummary(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
+// RebuildRollups 根据原始记录重建 from 之后的小时和每日统计，未指定 from 时重建全部仍有原始记录的时间段
+func (h *Handler) RebuildRollups(c *gin.Context) {
+	from, err := parseTimeParam(c, "from")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	summary, err := h.aiService.GenerateActivitySummary(limit)
+	result, err := h.storage.RebuildRollups(from)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, summary)
+	c.JSON(http.StatusOK, result)
 }
 
-// GenerateKeyboardSummary 生成键盘输入总结
-func (h *Handler) GenerateKeyboardSummary(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "15")
-	limit, err := strconv.Atoi(limitStr)
+// ForgetData 选择性删除数据：from, to, app, domain 同时满足的记录，data 指定数据集
+// （activities、keyboard、app_usage，逗号分隔），vacuum=true 时删除后重写数据库文件
+func (h *Handler) ForgetData(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	vacuum, err := strconv.ParseBool(c.DefaultQuery("vacuum", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vacuum parameter"})
+		return
+	}
+
+	var datasets []string
+	for _, name := range strings.Split(c.Query("data"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			datasets = append(datasets, name)
+		}
+	}
+
+	result, err := h.storage.Forget(storage.ForgetQuery{
+		From:     from,
+		To:       to,
+		AppName:  c.Query("app"),
+		Domain:   c.Query("domain"),
+		Datasets: datasets,
+		Vacuum:   vacuum,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetForgetLog 获取删除审计记录（不含被删除的内容和过滤值）
+func (h *Handler) GetForgetLog(c *gin.Context) {
+	limit, err := parseLimit(c, "50")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	summary, err := h.aiService.GenerateKeyboardSummary(limit)
+	audits, err := h.storage.GetForgetLog(limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, summary)
+	c.JSON(http.StatusOK, gin.H{
+		"audit_log": audits,
+		"count":     len(audits),
+	})
 }
 
-// GetAISummaries 获取AI总结历史
-func (h *Handler) GetAISummaries(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "10")
-	limit, err := strconv.Atoi(limitStr)
+// Search 全文搜索键盘输入、活动记录和AI总结
+func (h *Handler) Search(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing q parameter"})
+		return
+	}
+
+	limit, err := parseLimit(c, "20")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sources []string
+	if value := c.Query("sources"); value != "" {
+		for _, source := range strings.Split(value, ",") {
+			source = strings.TrimSpace(source)
+			if !storage.ValidSearchSource(source) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source: " + source})
+				return
+			}
+			sources = append(sources, source)
+		}
+	}
+
+	results, err := h.storage.Search(storage.SearchQuery{
+		Text:    text,
+		From:    from,
+		To:      to,
+		Sources: sources,
+		Limit:   limit,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GetEncryptionStatus 获取加密状态
+func (h *Handler) GetEncryptionStatus(c *gin.Context) {
+	if h.vault == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": true,
+		"locked":  h.vault.Locked(),
+		"key_id":  h.vault.KeyID(),
+	})
+}
+
+// UnlockRequest 解锁请求，passphrase 与 key（base64 私钥）二选一
+type UnlockRequest struct {
+	Passphrase string `json:"passphrase"`
+	Key        string `json:"key"`
+}
+
+// Unlock 解锁加密数据，解锁后才能读取明文
+func (h *Handler) Unlock(c *gin.Context) {
+	if h.vault == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Encryption is not enabled"})
+		return
+	}
+
+	var req UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var err error
+	switch {
+	case req.Key != "":
+		err = h.vault.UnlockWithKey(req.Key)
+	case req.Passphrase != "":
+		err = h.vault.Unlock(req.Passphrase)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing passphrase or key"})
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, vault.ErrWrongPassphrase) || errors.Is(err, vault.ErrWrongKey) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked", "key_id": h.vault.KeyID()})
+}
+
+// Lock 从内存中清除私钥，之后读取加密数据返回 423
+func (h *Handler) Lock(c *gin.Context) {
+	if h.vault == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Encryption is not enabled"})
+		return
+	}
+
+	h.vault.Lock()
+	c.JSON(http.StatusOK, gin.H{"message": "Locked"})
+}
+
+// RunBackup 立即生成一份数据库快照
+func (h *Handler) RunBackup(c *gin.Context) {
+	if !h.backup.Supported() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": backup.ErrUnsupported.Error()})
+		return
+	}
+
+	report, err := h.backup.RunOnce()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
 		return
 	}
 
-	summaries, err := h.aiService.GetRecentSummaries(limit)
+	c.JSON(http.StatusOK, report)
+}
+
+// ListBackups 列出备份文件和最近一次备份结果
+func (h *Handler) ListBackups(c *gin.Context) {
+	snapshots, err := h.backup.List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"summaries": summaries,
-		"count":     len(summaries),
+		"supported":      h.backup.Supported(),
+		"dir":            h.backup.Dir(),
+		"keep":           h.backup.Keep(),
+		"interval_hours": h.backup.Interval().Hours(),
+		"backups":        snapshots,
+		"count":          len(snapshots),
+		"last_report":    h.backup.LastReport(),
 	})
 }
 
-// StreamActivitySummary 流式生成活动总结
-func (h *Handler) StreamActivitySummary(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
+// RestoreRequest 恢复请求
+type RestoreRequest struct {
+	Name string `json:"name" binding:"required"` // 备份文件名，见 GET /admin/backups
+}
+
+// RestoreBackup 校验快照后在线恢复数据库，结构版本高于当前程序时返回 409
+func (h *Handler) RestoreBackup(c *gin.Context) {
+	if !h.backup.Supported() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": backup.ErrUnsupported.Error()})
+		return
+	}
+
+	var req RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshot, err := h.backup.Restore(req.Name)
+	if err != nil {
+		var tooNew *storage.SchemaTooNewError
+		switch {
+		case errors.As(err, &tooNew):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, os.ErrNotExist):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found: " + req.Name})
+		case errors.Is(err, storage.ErrInvalidSnapshot):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Database restored", "snapshot": snapshot})
+}
+
+// exportWriter 在写出第一个字节时才发送响应头，此前出错仍可返回 JSON 错误
+type exportWriter struct {
+	c       *gin.Context
+	opts    *export.Options
+	started bool
+}
+
+func (w *exportWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.c.Header("Content-Type", w.opts.ContentType())
+	w.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, w.opts.FileName(time.Now())))
+	w.c.Status(http.StatusOK)
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	w.start()
+	n, err := w.c.Writer.Write(p)
+	w.c.Writer.Flush()
+	return n, err
+}
+
+// Export 流式导出数据：format=jsonl|csv|ics，data 为数据集（activities, keyboard, app_usage, summaries），
+// 支持 from/to 时间范围。ICS 将应用使用会话和AI总结导出为日历事件
+func (h *Handler) Export(c *gin.Context) {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	datasets, err := export.ParseDatasets(c.Query("data"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := export.Options{Format: format, Datasets: datasets, From: from, To: to}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	writer := &exportWriter{c: c, opts: &opts}
+	if err := export.Write(writer, h.storage, opts); err != nil {
+		if !writer.started {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		// 响应头已发出，只能中断输出
+		fmt.Printf("[ERROR] Export interrupted: %v\n", err)
+		return
+	}
+	writer.start()
+}
+
+// StartImport 上传 ActivityWatch 导出的 JSON 或 RescueTime CSV（表单字段 file，可上传多个），
+// 每个文件创建一个后台导入任务；source 为空时根据文件内容识别
+func (h *Handler) StartImport(c *gin.Context) {
+	source, err := importer.ParseSource(c.PostForm("source"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+
+	var jobs []*importer.Job
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "jobs": jobs})
+			return
+		}
+		path, err := importer.SaveUpload(file)
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "jobs": jobs})
+			return
+		}
+		jobs = append(jobs, h.importer.Start(path, header.Filename, source))
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"jobs": jobs, "count": len(jobs)})
+}
+
+// GetImports 获取所有导入任务的进度和错误
+func (h *Handler) GetImports(c *gin.Context) {
+	jobs := h.importer.Jobs()
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "count": len(jobs)})
+}
+
+// GetImport 获取单个导入任务的进度和错误
+func (h *Handler) GetImport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import id"})
+		return
+	}
+
+	job := h.importer.Job(id)
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetSyncChanges 供对端拉取 since 之后的变更（明文），配置了 sync.token 时需要 Authorization: Bearer token，
+// 否则只接受本机的请求
+func (h *Handler) GetSyncChanges(c *gin.Context) {
+	if !h.syncer.Authorized(c.Request) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid sync token"})
+		return
+	}
+
+	since, err := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil || since < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since"})
+		return
+	}
+	limit, err := parseLimit(c, strconv.Itoa(storage.DefaultSyncPageSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := h.storage.GetChanges(since, limit)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// RunSync 立即从所有对端拉取变更
+func (h *Handler) RunSync(c *gin.Context) {
+	if !h.syncer.Enabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sync is disabled (no sync.peers configured)"})
+		return
+	}
+
+	reports, err := h.syncer.RunOnce()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "reports": reports})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// GetSyncStatus 获取本机设备ID、各对端的水位和最近一次同步结果
+func (h *Handler) GetSyncStatus(c *gin.Context) {
+	peers, err := h.storage.GetSyncPeers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id":        h.storage.DeviceID(),
+		"enabled":          h.syncer.Enabled(),
+		"interval_seconds": h.syncer.Interval().Seconds(),
+		"peers":            peers,
+		"last_reports":     h.syncer.LastReports(),
+	})
+}
+
+// GetChangeLog 获取 since 之后的变更。wait 为秒数时长轮询：没有新变更就等待，
+// 直到出现变更或超时，超时返回空列表；同时等待的请求超过 maxChangeWaiters 时返回 429。
+// 消费方保存 next，重启后从该位置继续
+func (h *Handler) GetChangeLog(c *gin.Context) {
+	since, err := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil || since < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since"})
+		return
+	}
+	limit, err := parseLimit(c, strconv.Itoa(storage.DefaultChangePageSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wait, err := parseWait(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := h.storage.GetChangeLog(since, limit)
+	if err == nil && wait > 0 && len(changes.Changes) == 0 && !changes.Reset {
+		if h.changeWaiters.Add(1) > maxChangeWaiters {
+			h.changeWaiters.Add(-1)
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many clients waiting for changes"})
+			return
+		}
+		defer h.changeWaiters.Add(-1)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+		err = h.storage.WaitForChange(ctx, since)
+		if err == nil {
+			changes, err = h.storage.GetChangeLog(since, limit)
+		} else if ctx.Err() != nil {
+			// 等待超时或客户端断开
+			err = nil
+		}
+		cancel()
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// UploadScreenshot 上传一张截图（表单字段 file），timestamp、app、title、analysis 为可选的元数据。
+// 内容相同的图片只保存一份，duplicate 表示已有相同内容的图片
+func (h *Handler) UploadScreenshot(c *gin.Context) {
+	maxUpload := h.shots.Options().MaxUpload
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUpload+1<<20)
+
+	timestamp, err := parseTimeValue("timestamp", c.PostForm("timestamp"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+	if header.Size > maxUpload {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": screenshot.ErrTooLarge.Error()})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shot := &models.Screenshot{
+		Timestamp:   timestamp,
+		AppName:     c.PostForm("app"),
+		WindowTitle: c.PostForm("title"),
+		Analysis:    c.PostForm("analysis"),
+	}
+	duplicate, err := h.shots.Save(data, shot)
+	if err != nil {
+		switch {
+		case errors.Is(err, screenshot.ErrUnsupportedFormat):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, screenshot.ErrTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		default:
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"screenshot": shot, "duplicate": duplicate})
+}
+
+// GetScreenshots 按时间倒序列出截图元数据，附带占用空间和最近一次淘汰结果
+func (h *Handler) GetScreenshots(c *gin.Context) {
+	query, err := parseScreenshotQuery(c, "50")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shots, err := h.storage.QueryScreenshots(query)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	usage, err := h.storage.GetScreenshotUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"screenshots": shots,
+		"count":       len(shots),
+		"usage":       usage,
+		"last_report": h.shots.LastReport(),
+	})
+}
+
+// screenshotParam 按路径参数 id 获取截图，出错时已写入响应并返回 nil
+func (h *Handler) screenshotParam(c *gin.Context) *models.Screenshot {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid screenshot id"})
+		return nil
+	}
+	shot, err := h.storage.GetScreenshot(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return nil
+	}
+	if shot == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Screenshot not found"})
+		return nil
+	}
+	return shot
+}
+
+// GetScreenshot 获取单张截图的元数据
+func (h *Handler) GetScreenshot(c *gin.Context) {
+	if shot := h.screenshotParam(c); shot != nil {
+		c.JSON(http.StatusOK, shot)
+	}
+}
+
+// GetScreenshotImage 获取截图原图
+func (h *Handler) GetScreenshotImage(c *gin.Context) {
+	shot := h.screenshotParam(c)
+	if shot == nil {
+		return
+	}
+	c.Header("Content-Type", "image/"+shot.Format)
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.File(h.shots.ImagePath(shot))
+}
+
+// GetScreenshotThumbnail 获取长边不超过 size 像素（默认 256）的 JPEG 缩略图
+func (h *Handler) GetScreenshotThumbnail(c *gin.Context) {
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(screenshot.DefaultThumbnailSize)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size parameter"})
+		return
+	}
+	shot := h.screenshotParam(c)
+	if shot == nil {
+		return
+	}
+
+	path, err := h.shots.ThumbnailPath(shot, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.File(path)
+}
+
+// ScreenshotAnalysisRequest 截图分析结果
+type ScreenshotAnalysisRequest struct {
+	Analysis string `json:"analysis"`
+}
+
+// UpdateScreenshotAnalysis 写入截图的AI分析结果
+func (h *Handler) UpdateScreenshotAnalysis(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid screenshot id"})
+		return
+	}
+	var req ScreenshotAnalysisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shot, err := h.storage.UpdateScreenshotAnalysis(id, req.Analysis)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if shot == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Screenshot not found"})
+		return
+	}
+	c.JSON(http.StatusOK, shot)
+}
+
+// DeleteScreenshot 删除截图，图片文件不再被其他截图引用时一并删除
+func (h *Handler) DeleteScreenshot(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid screenshot id"})
+		return
+	}
+
+	shot, err := h.shots.Delete(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if shot == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Screenshot not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Screenshot deleted", "id": id})
+}
+
+// EvictScreenshots 立即按保留天数和空间上限淘汰截图
+func (h *Handler) EvictScreenshots(c *gin.Context) {
+	report, err := h.shots.RunOnce()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetTags 获取全部标签
+func (h *Handler) GetTags(c *gin.Context) {
+	tags, err := h.storage.ListTags()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags, "count": len(tags)})
+}
+
+// CreateTag 创建标签
+func (h *Handler) CreateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tag.ID = 0
+
+	if _, err := h.storage.SaveTag(&tag); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag 修改标签的名称和颜色
+func (h *Handler) UpdateTag(c *gin.Context) {
+	id, err := parseIDParam(c, "id", "tag")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var tag models.Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tag.ID = id
+
+	found, err := h.storage.SaveTag(&tag)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag 删除标签，同时删除它的关联和规则
+func (h *Handler) DeleteTag(c *gin.Context) {
+	id, err := parseIDParam(c, "id", "tag")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := h.storage.DeleteTag(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted", "id": id})
+}
+
+// GetProjects 获取全部项目
+func (h *Handler) GetProjects(c *gin.Context) {
+	projects, err := h.storage.ListProjects()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": projects, "count": len(projects)})
+}
+
+// CreateProject 创建项目
+func (h *Handler) CreateProject(c *gin.Context) {
+	var project models.Project
+	if err := c.ShouldBindJSON(&project); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project.ID = 0
+
+	if _, err := h.storage.SaveProject(&project); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, project)
+}
+
+// UpdateProject 修改项目，归档的项目不再被规则关联
+func (h *Handler) UpdateProject(c *gin.Context) {
+	id, err := parseIDParam(c, "id", "project")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var project models.Project
+	if err := c.ShouldBindJSON(&project); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project.ID = id
+
+	found, err := h.storage.SaveProject(&project)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject 删除项目，同时删除它的关联和规则
+func (h *Handler) DeleteProject(c *gin.Context) {
+	id, err := parseIDParam(c, "id", "project")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := h.storage.DeleteProject(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Project deleted", "id": id})
+}
+
+// GetProjectTotals 按项目汇总 from/to 内关联的活动和应用使用时长
+func (h *Handler) GetProjectTotals(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	totals, err := h.storage.GetProjectTotals(from, to)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": totals, "count": len(totals)})
+}
+
+// LinkRequest 关联的目标记录
+type LinkRequest struct {
+	Target string `json:"target" binding:"required"` // activity、app_usage 或 summary
+	ID     int64  `json:"id" binding:"required"`
+}
+
+// AddTagLink 手动给记录打标签
+func (h *Handler) AddTagLink(c *gin.Context) {
+	h.addLink(c, storage.LabelTag)
+}
+
+// RemoveTagLink 取消记录的标签
+func (h *Handler) RemoveTagLink(c *gin.Context) {
+	h.removeLink(c, storage.LabelTag)
+}
+
+// AddProjectLink 手动把记录归属到项目
+func (h *Handler) AddProjectLink(c *gin.Context) {
+	h.addLink(c, storage.LabelProject)
+}
+
+// RemoveProjectLink 取消记录与项目的关联
+func (h *Handler) RemoveProjectLink(c *gin.Context) {
+	h.removeLink(c, storage.LabelProject)
+}
+
+func (h *Handler) addLink(c *gin.Context, label string) {
+	labelID, err := parseIDParam(c, "id", label)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req LinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	link := storage.Link{Label: label, LabelID: labelID, Target: req.Target, TargetID: req.ID}
+	found, err := h.storage.AddLink(link)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s or %s not found", label, req.Target)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Linked", label + "_id": labelID, "target": req.Target, "id": req.ID})
+}
+
+func (h *Handler) removeLink(c *gin.Context, label string) {
+	labelID, err := parseIDParam(c, "id", label)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targetID, err := parseIDParam(c, "target_id", c.Param("target"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	link := storage.Link{Label: label, LabelID: labelID, Target: c.Param("target"), TargetID: targetID}
+	found, err := h.storage.RemoveLink(link)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unlinked", label + "_id": labelID, "target": link.Target, "id": targetID})
+}
+
+// GetLabels 获取一条记录（activity、app_usage 或 summary）关联的标签和项目
+func (h *Handler) GetLabels(c *gin.Context) {
+	id, err := parseIDParam(c, "id", c.Param("target"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	labels, err := h.storage.GetLabels(c.Param("target"), id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, labels)
+}
+
+// TagRuleRequest 创建或修改自动打标签规则，enabled 省略时为 true
+type TagRuleRequest struct {
+	Name      string           `json:"name"`
+	Field     models.RuleField `json:"field" binding:"required"` // app、title 或 domain
+	Pattern   string           `json:"pattern" binding:"required"`
+	TagID     int64            `json:"tag_id"`
+	ProjectID int64            `json:"project_id"`
+	Enabled   *bool            `json:"enabled"`
+}
+
+func (r *TagRuleRequest) rule(id int64) *models.TagRule {
+	rule := &models.TagRule{ID: id, Name: r.Name, Field: r.Field, Pattern: r.Pattern,
+		TagID: r.TagID, ProjectID: r.ProjectID, Enabled: true}
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+	return rule
+}
+
+// GetTagRules 获取全部自动打标签规则
+func (h *Handler) GetTagRules(c *gin.Context) {
+	rules, err := h.storage.ListTagRules()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "count": len(rules)})
+}
+
+// CreateTagRule 创建规则，只对之后写入的活动记录生效
+func (h *Handler) CreateTagRule(c *gin.Context) {
+	var req TagRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := req.rule(0)
+	if _, err := h.storage.SaveTagRule(rule); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateTagRule 修改规则
+func (h *Handler) UpdateTagRule(c *gin.Context) {
+	id, err := parseIDParam(c, "id", "rule")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req TagRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := req.rule(id)
+	found, err := h.storage.SaveTagRule(rule)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteTagRule 删除规则及其生成的关联
+func (h *Handler) DeleteTagRule(c *gin.Context) {
+	id, err := parseIDParam(c, "id", "rule")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := h.storage.DeleteTagRule(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted", "id": id})
+}
+
+// ApplyTagRules 对 from/to 内的历史活动记录重新应用规则，未指定时处理全部记录
+func (h *Handler) ApplyTagRules(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.storage.ApplyTagRules(from, to)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// StartMonitoring 启动监控
+func (h *Handler) StartMonitoring(c *gin.Context) {
+	if err := h.monitor.StartAll(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Monitoring started successfully"})
+}
+
+// StopMonitoring 停止监控
+func (h *Handler) StopMonitoring(c *gin.Context) {
+	h.monitor.StopAll()
+	c.JSON(http.StatusOK, gin.H{"message": "Monitoring stopped successfully"})
+}
+
+// GetMonitorStatus 获取监控状态
+func (h *Handler) GetMonitorStatus(c *gin.Context) {
+	status := h.monitor.GetStatus()
+	c.JSON(http.StatusOK, gin.H{
+		"status": status,
+		"running": h.monitor.IsRunning(),
+		"ingest":  h.monitor.IngestStats(),
+		"sources": h.monitor.SourceStatus(),
+		"recording": h.monitor.RecordingStatus(),
+	})
+}
+
+// RecordingRequest 开始录制的请求
+type RecordingRequest struct {
+	Name string `json:"name"` // 录制文件名，省略时按当前时间生成
+}
+
+// StartRecording 开始把所有事件来源的原始事件录制到录制目录
+func (h *Handler) StartRecording(c *gin.Context) {
+	var req RecordingRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = "recording-" + time.Now().Format("20060102-150405") + ".jsonl"
+	}
+
+	path, err := h.monitor.RecordingPath(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.monitor.StartRecording(path)
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recording started", "recording": status})
+}
+
+// StopRecording 结束录制
+func (h *Handler) StopRecording(c *gin.Context) {
+	status, err := h.monitor.StopRecording()
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recording stopped", "recording": status})
+}
+
+// ListRecordings 列出录制目录中的录制文件
+func (h *Handler) ListRecordings(c *gin.Context) {
+	recordings, err := h.monitor.ListRecordings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"recordings": recordings,
+		"count":      len(recordings),
+		"recording":  h.monitor.RecordingStatus(),
+	})
+}
+
+// ReplayRequest 回放请求
+type ReplayRequest struct {
+	Name   string   `json:"name" binding:"required"` // 录制文件名，见 GET /monitor/recordings
+	Speed  *float64 `json:"speed"`                   // 速度倍数，省略时为 1，0 表示立即回放
+	Rebase *bool    `json:"rebase"`                  // 是否把事件时间平移到当前时间，省略时为 true
+}
+
+// ReplayRecording 在运行中的监控里回放录制文件，监控未启动时返回 409
+func (h *Handler) ReplayRecording(c *gin.Context) {
+	var req ReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := monitor.ReplayOptions{Speed: 1, Rebase: true}
+	if req.Speed != nil {
+		opts.Speed = *req.Speed
+	}
+	if req.Rebase != nil {
+		opts.Rebase = *req.Rebase
+	}
+	if opts.Speed < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "speed must not be negative"})
+		return
+	}
+
+	path, err := h.monitor.RecordingPath(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source, err := h.monitor.Replay(path, opts)
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Replay started", "source": source})
+}
+
+// recordingErrorStatus 将录制和回放的错误映射为 HTTP 状态码
+func recordingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, monitor.ErrInvalidRecordingName):
+		return http.StatusBadRequest
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, monitor.ErrNotRunning), errors.Is(err, monitor.ErrAlreadyRecording),
+		errors.Is(err, monitor.ErrNotRecording), errors.Is(err, os.ErrExist):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+
+
+// GenerateActivitySummary 生成活动总结，可通过 from/to 等参数指定分析的时间段
+func (h *Handler) GenerateActivitySummary(c *gin.Context) {
+	query, err := parseActivityQuery(c, "20")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := h.aiService.GenerateActivitySummary(query)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GenerateKeyboardSummary 生成键盘输入总结，可通过 from/to 等参数指定分析的时间段
+func (h *Handler) GenerateKeyboardSummary(c *gin.Context) {
+	query, err := parseKeyboardQuery(c, "15")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := h.aiService.GenerateKeyboardSummary(query)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetAISummaries 获取AI总结历史，可按 type（activity/keyboard）和创建时间 from/to 过滤
+func (h *Handler) GetAISummaries(c *gin.Context) {
+	query, err := parseSummaryQuery(c, "10")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summaries, err := h.aiService.QuerySummaries(query)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"summaries": summaries,
+		"count":     len(summaries),
+	})
+}
+
+// GetAISummaryRecords 获取生成总结时使用的来源记录
+func (h *Handler) GetAISummaryRecords(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid summary id"})
+		return
+	}
+
+	records, err := h.aiService.GetSummaryRecords(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if records == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"summary":         records.Summary,
+		"activities":      records.Activities,
+		"keyboard_inputs": records.KeyboardInputs,
+		"count":           len(records.Activities) + len(records.KeyboardInputs),
+	})
+}
+
+// StreamActivitySummary 流式生成活动总结
+func (h *Handler) StreamActivitySummary(c *gin.Context) {
+	query, err := parseActivityQuery(c, "20")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -237,9 +1576,10 @@ func (h *Handler) StreamActivitySummary(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	// 获取最近的活动数据
-	activities, err := h.storage.GetRecentActivities(limit)
+	// 获取时间段内的活动数据
+	activities, _, err := h.storage.QueryActivities(query)
 	if err != nil {
+		c.Status(errorStatus(err))
 		c.SSEvent("error", gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeLayouts 查询参数支持的时间格式，不带时区的格式按本地时间解析
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTimeParam 解析时间查询参数，支持 RFC3339、本地日期时间和 Unix 秒，空字符串返回零值
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	return parseTimeValue(name, c.Query(name))
+}
+
+// parseTimeValue 按 parseTimeParam 的格式解析时间，name 只用于错误信息
+func parseTimeValue(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid %s parameter", name)
+}
+
+// parseTimeRange 解析 from/to 查询参数
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// maxLimit limit 查询参数的上限
+const maxLimit = 1000
+
+// parseLimit 解析 limit 查询参数，取值范围为 1 到 maxLimit
+func parseLimit(c *gin.Context, defaultLimit string) (int, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("Invalid limit parameter, must be between 1 and %d", maxLimit)
+	}
+	return limit, nil
+}
+
+// parseActivityQuery 从查询参数构造活动查询：from, to, type, app, url, title, cursor, limit
+func parseActivityQuery(c *gin.Context, defaultLimit string) (storage.ActivityQuery, error) {
+	limit, err := parseLimit(c, defaultLimit)
+	if err != nil {
+		return storage.ActivityQuery{}, err
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return storage.ActivityQuery{}, err
+	}
+
+	return storage.ActivityQuery{
+		From:                from,
+		To:                  to,
+		Type:                models.ActivityType(c.Query("type")),
+		AppName:             c.Query("app"),
+		URLContains:         c.Query("url"),
+		WindowTitleContains: c.Query("title"),
+		Cursor:              c.Query("cursor"),
+		Limit:               limit,
+	}, nil
+}
+
+// parseKeyboardQuery 从查询参数构造键盘输入查询：from, to, app, text, cursor, limit
+func parseKeyboardQuery(c *gin.Context, defaultLimit string) (storage.KeyboardQuery, error) {
+	limit, err := parseLimit(c, defaultLimit)
+	if err != nil {
+		return storage.KeyboardQuery{}, err
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return storage.KeyboardQuery{}, err
+	}
+
+	return storage.KeyboardQuery{
+		From:         from,
+		To:           to,
+		AppName:      c.Query("app"),
+		TextContains: c.Query("text"),
+		Cursor:       c.Query("cursor"),
+		Limit:        limit,
+	}, nil
+}
+
+// parseSummaryQuery 从查询参数构造AI总结查询：type, from, to（按创建时间）, limit
+func parseSummaryQuery(c *gin.Context, defaultLimit string) (storage.SummaryQuery, error) {
+	limit, err := parseLimit(c, defaultLimit)
+	if err != nil {
+		return storage.SummaryQuery{}, err
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return storage.SummaryQuery{}, err
+	}
+	summaryType, err := storage.ParseSummaryType(c.Query("type"))
+	if err != nil {
+		return storage.SummaryQuery{}, err
+	}
+
+	return storage.SummaryQuery{
+		Type:  summaryType,
+		From:  from,
+		To:    to,
+		Limit: limit,
+	}, nil
+}
+
+// parseScreenshotQuery 从查询参数构造截图查询：from, to, app, limit
+func parseScreenshotQuery(c *gin.Context, defaultLimit string) (storage.ScreenshotQuery, error) {
+	limit, err := parseLimit(c, defaultLimit)
+	if err != nil {
+		return storage.ScreenshotQuery{}, err
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return storage.ScreenshotQuery{}, err
+	}
+
+	return storage.ScreenshotQuery{
+		From:    from,
+		To:      to,
+		AppName: c.Query("app"),
+		Limit:   limit,
+	}, nil
+}
+
+// 长轮询的最长等待时间和同时等待的请求数上限
+const (
+	maxChangeWait    = 60 * time.Second
+	maxChangeWaiters = 64
+)
+
+// parseWait 解析长轮询等待秒数，默认不等待，超过上限时取上限
+func parseWait(c *gin.Context) (time.Duration, error) {
+	seconds, err := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("Invalid wait parameter")
+	}
+	return min(time.Duration(seconds)*time.Second, maxChangeWait), nil
+}
+
+// parseIDParam 解析路径参数中的记录 ID，what 只用于错误信息
+func parseIDParam(c *gin.Context, name, what string) (int64, error) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("Invalid %s id", what)
+	}
+	return id, nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?"+query, nil)
+	return c
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{query: "", want: 50},
+		{query: "limit=1", want: 1},
+		{query: "limit=1000", want: 1000},
+		{query: "limit=0", wantErr: true},
+		{query: "limit=-1", wantErr: true},
+		{query: "limit=1001", wantErr: true},
+		{query: "limit=10000000", wantErr: true},
+		{query: "limit=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLimit(testContext(tt.query), "50")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseLimit(%q) = %d, %v, want %d (error %v)", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseWait(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{query: "", want: 0},
+		{query: "wait=30", want: 30 * time.Second},
+		{query: "wait=3600", want: maxChangeWait},
+		{query: "wait=-1", wantErr: true},
+		{query: "wait=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWait(testContext(tt.query))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseWait(%q) = %v, %v, want %v (error %v)", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -2,15 +2,21 @@ package api
 
 import (
 	"yaml-backend/internal/ai"
+	"yaml-backend/internal/backup"
+	"yaml-backend/internal/importer"
 	"yaml-backend/internal/monitor"
+	"yaml-backend/internal/retention"
+	"yaml-backend/internal/screenshot"
 	"yaml-backend/internal/storage"
+	"yaml-backend/internal/syncer"
+	"yaml-backend/internal/vault"
 	"yaml-backend/pkg/config"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(storage *storage.SQLiteStorage, monitorManager *monitor.Manager, aiService *ai.AIService, cfg *config.Config) *gin.Engine {
+func SetupRoutes(storage storage.Store, monitorManager *monitor.Manager, aiService *ai.AIService, retentionWorker *retention.Worker, backupManager *backup.Manager, importManager *importer.Manager, syncManager *syncer.Manager, screenshotManager *screenshot.Manager, keyVault *vault.Vault, cfg *config.Config) *gin.Engine {
 	r := gin.Default()
 
 	// CORS 配置
@@ -21,7 +27,7 @@ func SetupRoutes(storage *storage.SQLiteStorage, monitorManager *monitor.Manager
 	r.Use(cors.New(corsConfig))
 
 	// 创建处理器
-	handler := NewHandler(storage, monitorManager, aiService)
+	handler := NewHandler(storage, monitorManager, aiService, retentionWorker, backupManager, importManager, syncManager, screenshotManager, keyVault)
 
 	// API 路由组
 	api := r.Group("/api/v1")
@@ -31,6 +37,9 @@ func SetupRoutes(storage *storage.SQLiteStorage, monitorManager *monitor.Manager
 		
 		// 统计信息
 		api.GET("/stats", handler.GetStats)
+		api.GET("/stats/daily", handler.GetDailyStats)
+		api.GET("/stats/hourly", handler.GetHourlyStats)
+		api.GET("/stats/app-usage", handler.GetAppUsage)
 
 		// 活动记录相关
 		api.GET("/activities", handler.GetActivities)
@@ -40,17 +49,87 @@ func SetupRoutes(storage *storage.SQLiteStorage, monitorManager *monitor.Manager
 		api.GET("/keyboard", handler.GetKeyboardInputs)
 		api.POST("/keyboard", handler.PostKeyboardInput)
 
+		// 全文搜索
+		api.GET("/search", handler.Search)
+
+		// 数据导出
+		api.GET("/export", handler.Export)
+
+		// 选择性删除
+		api.DELETE("/data", handler.ForgetData)
+		api.GET("/data/audit", handler.GetForgetLog)
+
+		// 数据导入
+		api.POST("/import", handler.StartImport)
+		api.GET("/import", handler.GetImports)
+		api.GET("/import/:id", handler.GetImport)
+
+		// 截图
+		api.POST("/screenshots", handler.UploadScreenshot)
+		api.GET("/screenshots", handler.GetScreenshots)
+		api.GET("/screenshots/:id", handler.GetScreenshot)
+		api.GET("/screenshots/:id/image", handler.GetScreenshotImage)
+		api.GET("/screenshots/:id/thumbnail", handler.GetScreenshotThumbnail)
+		api.PUT("/screenshots/:id/analysis", handler.UpdateScreenshotAnalysis)
+		api.DELETE("/screenshots/:id", handler.DeleteScreenshot)
+
+		// 标签、项目和自动打标签规则
+		api.GET("/tags", handler.GetTags)
+		api.POST("/tags", handler.CreateTag)
+		api.PUT("/tags/:id", handler.UpdateTag)
+		api.DELETE("/tags/:id", handler.DeleteTag)
+		api.POST("/tags/:id/links", handler.AddTagLink)
+		api.DELETE("/tags/:id/links/:target/:target_id", handler.RemoveTagLink)
+		api.GET("/projects", handler.GetProjects)
+		api.POST("/projects", handler.CreateProject)
+		api.GET("/projects/totals", handler.GetProjectTotals)
+		api.PUT("/projects/:id", handler.UpdateProject)
+		api.DELETE("/projects/:id", handler.DeleteProject)
+		api.POST("/projects/:id/links", handler.AddProjectLink)
+		api.DELETE("/projects/:id/links/:target/:target_id", handler.RemoveProjectLink)
+		api.GET("/labels/:target/:id", handler.GetLabels)
+		api.GET("/rules", handler.GetTagRules)
+		api.POST("/rules", handler.CreateTagRule)
+		api.POST("/rules/apply", handler.ApplyTagRules)
+		api.PUT("/rules/:id", handler.UpdateTagRule)
+		api.DELETE("/rules/:id", handler.DeleteTagRule)
+
+		// 多设备同步
+		api.GET("/sync/changes", handler.GetSyncChanges)
+		api.POST("/sync/run", handler.RunSync)
+		api.GET("/sync/status", handler.GetSyncStatus)
+
+		// 变更日志
+		api.GET("/changes", handler.GetChangeLog)
+
 		// 监控相关
 		api.POST("/monitor/start", handler.StartMonitoring)
 		api.POST("/monitor/stop", handler.StopMonitoring)
 		api.GET("/monitor/status", handler.GetMonitorStatus)
+		api.GET("/monitor/recordings", handler.ListRecordings)
+		api.POST("/monitor/recording/start", handler.StartRecording)
+		api.POST("/monitor/recording/stop", handler.StopRecording)
+		api.POST("/monitor/replay", handler.ReplayRecording)
 
 		// AI总结相关
 		api.POST("/ai/summary/activity", handler.GenerateActivitySummary)
 		api.POST("/ai/summary/keyboard", handler.GenerateKeyboardSummary)
 		api.GET("/ai/summaries", handler.GetAISummaries)
+		api.GET("/ai/summaries/:id/records", handler.GetAISummaryRecords)
 		// 流式AI总结
 		api.GET("/ai/stream/activity", handler.StreamActivitySummary)
+
+		// 数据管理相关
+		api.GET("/admin/retention", handler.GetRetentionStatus)
+		api.POST("/admin/retention/run", handler.RunRetention)
+		api.POST("/admin/rollups/rebuild", handler.RebuildRollups)
+		api.GET("/admin/encryption", handler.GetEncryptionStatus)
+		api.POST("/admin/unlock", handler.Unlock)
+		api.POST("/admin/lock", handler.Lock)
+		api.POST("/admin/backup", handler.RunBackup)
+		api.GET("/admin/backups", handler.ListBackups)
+		api.POST("/admin/restore", handler.RestoreBackup)
+		api.POST("/admin/screenshots/evict", handler.EvictScreenshots)
 	}
 
 	return r
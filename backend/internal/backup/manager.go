@@ -0,0 +1,323 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+)
+
+// 默认参数
+const (
+	DefaultInterval = 24 * time.Hour
+	DefaultKeep     = 7
+	filePrefix      = "yaml-"
+	fileSuffix      = ".db"
+	timeLayout      = "20060102-150405"
+)
+
+// ErrUnsupported 存储后端不支持备份（内存存储）
+var ErrUnsupported = errors.New("backup is only supported for the sqlite database")
+
+// backuper 支持在线备份和恢复的存储后端（SQLiteStorage）
+type backuper interface {
+	Backup(path string) error
+	Restore(path string) error
+}
+
+// Snapshot 一份备份文件
+type Snapshot struct {
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	SchemaVersion int       `json:"schema_version,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Report 一次备份的执行报告
+type Report struct {
+	Snapshot   *Snapshot `json:"snapshot,omitempty"`
+	Rotated    []string  `json:"rotated,omitempty"` // 轮换删除的旧备份
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Manager 定期和按需生成数据库快照，只保留最近 keep 份
+type Manager struct {
+	store    backuper
+	dir      string
+	keep     int
+	interval time.Duration
+
+	mu         sync.RWMutex
+	runMu      sync.Mutex // 备份和恢复互斥
+	lastReport *Report
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+// NewManager 创建备份管理器，interval <= 0 时不定时备份，keep <= 0 时使用 DefaultKeep
+func NewManager(store storage.Store, dir string, keep int, interval time.Duration) *Manager {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	m := &Manager{
+		dir:      dir,
+		keep:     keep,
+		interval: interval,
+	}
+	if b, ok := store.(backuper); ok {
+		m.store = b
+	}
+	return m
+}
+
+// Supported 存储后端是否支持备份
+func (m *Manager) Supported() bool {
+	return m.store != nil
+}
+
+// Dir 备份目录
+func (m *Manager) Dir() string {
+	return m.dir
+}
+
+// Keep 保留的备份份数
+func (m *Manager) Keep() int {
+	return m.keep
+}
+
+// Interval 定时备份间隔，0 表示不定时备份
+func (m *Manager) Interval() time.Duration {
+	return m.interval
+}
+
+// Start 启动定时备份
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.Supported() || m.interval <= 0 || m.stopCh != nil {
+		return
+	}
+
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+	go m.loop(m.stopCh, m.doneCh)
+
+	fmt.Printf("Backup scheduler started: every %s into %s, keeping %d copies\n", m.interval, m.dir, m.keep)
+}
+
+// Stop 停止定时备份并等待正在执行的备份结束
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	stopCh, doneCh := m.stopCh, m.doneCh
+	m.stopCh, m.doneCh = nil, nil
+	m.mu.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func (m *Manager) loop(stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if _, err := m.RunOnce(); err != nil {
+				fmt.Printf("[ERROR] Scheduled backup failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// RunOnce 立即生成一份快照并轮换旧备份
+func (m *Manager) RunOnce() (*Report, error) {
+	if !m.Supported() {
+		return nil, ErrUnsupported
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	report := &Report{StartedAt: time.Now()}
+	snapshot, err := m.backup(report.StartedAt)
+	if err == nil {
+		report.Snapshot = snapshot
+		report.Rotated, err = m.rotate()
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.FinishedAt = time.Now()
+
+	m.mu.Lock()
+	m.lastReport = report
+	m.mu.Unlock()
+
+	if err == nil {
+		fmt.Printf("Database backed up to %s (%d bytes)\n", snapshot.Path, snapshot.Size)
+	}
+	return report, err
+}
+
+// backup 生成一份快照，不轮换旧备份
+func (m *Manager) backup(now time.Time) (*Snapshot, error) {
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := filePrefix + now.Format(timeLayout) + fileSuffix
+	path := filepath.Join(m.dir, name)
+	if err := m.store.Backup(path); err != nil {
+		return nil, err
+	}
+
+	return inspect(path)
+}
+
+// rotate 删除超出保留份数的旧备份
+func (m *Manager) rotate() ([]string, error) {
+	snapshots, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for i := m.keep; i < len(snapshots); i++ {
+		if err := os.Remove(snapshots[i].Path); err != nil {
+			return rotated, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		rotated = append(rotated, snapshots[i].Name)
+	}
+	return rotated, nil
+}
+
+// List 按时间倒序列出备份文件
+func (m *Manager) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(timeLayout,
+			strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, &Snapshot{
+			Name:      name,
+			Path:      filepath.Join(m.dir, name),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// Restore 校验并恢复指定的备份。恢复前先为当前数据库生成一份快照，
+// 快照的结构版本高于当前程序支持的版本时拒绝恢复
+func (m *Manager) Restore(name string) (*Snapshot, error) {
+	if !m.Supported() {
+		return nil, ErrUnsupported
+	}
+	if name != filepath.Base(name) || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+		return nil, fmt.Errorf("%w: invalid backup name %q", storage.ErrInvalidSnapshot, name)
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	snapshot, err := inspect(filepath.Join(m.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	if latest := storage.LatestSchemaVersion(); snapshot.SchemaVersion > latest {
+		return nil, &storage.SchemaTooNewError{DatabaseVersion: snapshot.SchemaVersion, SupportedVersion: latest}
+	}
+
+	// 先备份当前数据，恢复出错时可以找回。恢复成功后才轮换，
+	// 否则要恢复的快照正好是最旧的一份时会先被删除
+	if _, err := m.backup(time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to back up current database before restore: %w", err)
+	}
+
+	if err := m.store.Restore(snapshot.Path); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.rotate(); err != nil {
+		fmt.Printf("[ERROR] Failed to rotate backups after restore: %v\n", err)
+	}
+
+	fmt.Printf("Database restored from %s (schema version %d)\n", snapshot.Path, snapshot.SchemaVersion)
+	return snapshot, nil
+}
+
+// LastReport 获取最近一次备份的报告，尚未执行过时返回 nil
+func (m *Manager) LastReport() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastReport
+}
+
+// inspect 校验快照并读取文件信息
+func inspect(path string) (*Snapshot, error) {
+	version, err := storage.SnapshotSchemaVersion(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+	createdAt, err := time.ParseInLocation(timeLayout,
+		strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+	if err != nil {
+		createdAt = info.ModTime()
+	}
+
+	return &Snapshot{
+		Name:          name,
+		Path:          path,
+		Size:          info.Size(),
+		SchemaVersion: version,
+		CreatedAt:     createdAt,
+	}, nil
+}
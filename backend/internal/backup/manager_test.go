@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// 要恢复的快照是保留的最旧一份时，恢复前的快照不能把它轮换掉
+func TestRestoreOldestKeptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewSQLiteStorage(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	defer store.Close()
+
+	m := NewManager(store, filepath.Join(dir, "backups"), 2, 0)
+	start := time.Now().Add(-time.Hour)
+	var names []string
+	for i, text := range []string{"first", "second"} {
+		if err := store.SaveKeyboardInput(&models.KeyboardInput{Text: text, AppName: "Code", Timestamp: start}); err != nil {
+			t.Fatalf("SaveKeyboardInput: %v", err)
+		}
+		snapshot, err := m.backup(start.Add(time.Duration(i) * time.Minute))
+		if err != nil {
+			t.Fatalf("backup: %v", err)
+		}
+		names = append(names, snapshot.Name)
+	}
+
+	if _, err := m.Restore(names[0]); err != nil {
+		t.Fatalf("Restore(%s): %v", names[0], err)
+	}
+
+	inputs, err := store.GetRecentKeyboardInputs(10)
+	if err != nil {
+		t.Fatalf("GetRecentKeyboardInputs: %v", err)
+	}
+	if len(inputs) != 1 || inputs[0].Text != "first" {
+		t.Errorf("restored keyboard inputs = %d, want only the first", len(inputs))
+	}
+
+	snapshots, err := m.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[1].Name != names[1] {
+		t.Errorf("kept snapshots = %d, want the pre-restore snapshot and %s", len(snapshots), names[1])
+	}
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// csvTime CSV 中的时间统一使用 RFC3339，零值输出空字符串
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// writeCSV 第一行为列名，每条记录一行
+func writeCSV(w io.Writer, store storage.Store, opts Options) error {
+	writer := csv.NewWriter(w)
+
+	var err error
+	switch opts.Datasets[0] {
+	case DatasetActivities:
+		writer.Write([]string{"id", "type", "app_name", "window_title", "url", "content", "timestamp", "duration"})
+		err = store.EachActivity(opts.From, opts.To, func(activity *models.Activity) error {
+			return writer.Write([]string{
+				strconv.FormatInt(activity.ID, 10),
+				string(activity.Type),
+				activity.AppName,
+				activity.WindowTitle,
+				activity.URL,
+				activity.Content,
+				csvTime(activity.Timestamp),
+				strconv.FormatInt(activity.Duration, 10),
+			})
+		})
+	case DatasetKeyboardInputs:
+		writer.Write([]string{"id", "app_name", "text", "timestamp", "key_count", "corrections", "duration"})
+		err = store.EachKeyboardInput(opts.From, opts.To, func(input *models.KeyboardInput) error {
+			return writer.Write([]string{
+				strconv.FormatInt(input.ID, 10),
+				input.AppName,
+				input.Text,
+				csvTime(input.Timestamp),
+				strconv.FormatInt(input.KeyCount, 10),
+				strconv.FormatInt(input.Corrections, 10),
+				strconv.FormatInt(input.Duration, 10),
+			})
+		})
+	case DatasetAppUsage:
+		writer.Write([]string{"id", "app_name", "start_time", "end_time", "duration"})
+		err = store.EachAppUsage(opts.From, opts.To, func(usage *models.AppUsage) error {
+			return writer.Write([]string{
+				strconv.FormatInt(usage.ID, 10),
+				usage.AppName,
+				csvTime(usage.StartTime),
+				csvTime(usage.EndTime),
+				strconv.FormatInt(usage.Duration, 10),
+			})
+		})
+	default:
+		writer.Write([]string{"id", "type", "data_count", "created_at", "summary"})
+		err = store.EachSummary(opts.From, opts.To, func(summary *storage.SummaryResult) error {
+			return writer.Write([]string{
+				strconv.FormatInt(summary.ID, 10),
+				summary.Type,
+				strconv.Itoa(summary.DataCount),
+				csvTime(summary.CreatedAt),
+				summary.Summary,
+			})
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// Format 导出格式
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+	FormatICS   Format = "ics"
+)
+
+// Dataset 导出的数据集
+type Dataset string
+
+const (
+	DatasetActivities     Dataset = "activities"
+	DatasetKeyboardInputs Dataset = "keyboard"
+	DatasetAppUsage       Dataset = "app_usage"
+	DatasetSummaries      Dataset = "summaries"
+)
+
+// Datasets 支持的数据集
+var Datasets = []Dataset{DatasetActivities, DatasetKeyboardInputs, DatasetAppUsage, DatasetSummaries}
+
+// Options 导出参数
+type Options struct {
+	Format Format
+	// Datasets JSONL/CSV 只能导出一个数据集；ICS 可导出 app_usage 和 summaries，为空时两者都导出
+	Datasets []Dataset
+	From     time.Time // 起始时间（包含），零值表示不限
+	To       time.Time // 结束时间（不包含），零值表示不限
+}
+
+// ParseFormat 解析导出格式，空字符串表示 JSONL
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(value)); format {
+	case "":
+		return FormatJSONL, nil
+	case FormatJSONL, FormatCSV, FormatICS:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", value)
+	}
+}
+
+// ParseDatasets 解析逗号分隔的数据集列表
+func ParseDatasets(value string) ([]Dataset, error) {
+	var datasets []Dataset
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		dataset := Dataset(name)
+		if !validDataset(dataset) {
+			return nil, fmt.Errorf("unknown dataset: %s", name)
+		}
+		datasets = append(datasets, dataset)
+	}
+	return datasets, nil
+}
+
+func validDataset(dataset Dataset) bool {
+	for _, d := range Datasets {
+		if d == dataset {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查格式和数据集的组合，ICS 未指定数据集时补全默认值
+func (o *Options) Validate() error {
+	switch o.Format {
+	case FormatJSONL, FormatCSV:
+		if len(o.Datasets) != 1 {
+			return fmt.Errorf("%s export needs exactly one dataset", o.Format)
+		}
+	case FormatICS:
+		if len(o.Datasets) == 0 {
+			o.Datasets = []Dataset{DatasetAppUsage, DatasetSummaries}
+		}
+		for _, dataset := range o.Datasets {
+			if dataset != DatasetAppUsage && dataset != DatasetSummaries {
+				return fmt.Errorf("ics export only supports app_usage and summaries")
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported export format: %s", o.Format)
+	}
+	if !o.From.IsZero() && !o.To.IsZero() && !o.From.Before(o.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	return nil
+}
+
+// ContentType 导出格式对应的 MIME 类型
+func (o *Options) ContentType() string {
+	switch o.Format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatICS:
+		return "text/calendar; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// FileName 下载时的文件名，例如 yaml-activities-20250905.jsonl
+func (o *Options) FileName(now time.Time) string {
+	name := "yaml-calendar"
+	if o.Format != FormatICS {
+		name = "yaml-" + string(o.Datasets[0])
+	}
+	return fmt.Sprintf("%s-%s.%s", name, now.Format("20060102-150405"), o.Format)
+}
+
+// Write 逐行读取记录并写入 w，不在内存中保留整个结果集。
+// 出错时已写入的内容不会回滚，调用方需在写出第一个字节前检查错误
+func Write(w io.Writer, store storage.Store, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	buffered := bufio.NewWriterSize(w, 32*1024)
+	var err error
+	switch opts.Format {
+	case FormatJSONL:
+		err = writeJSONL(buffered, store, opts)
+	case FormatCSV:
+		err = writeCSV(buffered, store, opts)
+	case FormatICS:
+		err = writeICS(buffered, store, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// writeJSONL 每行一条 JSON 记录，字段与对应的查询接口一致
+func writeJSONL(w io.Writer, store storage.Store, opts Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	switch opts.Datasets[0] {
+	case DatasetActivities:
+		return store.EachActivity(opts.From, opts.To, func(activity *models.Activity) error {
+			return encoder.Encode(activity)
+		})
+	case DatasetKeyboardInputs:
+		return store.EachKeyboardInput(opts.From, opts.To, func(input *models.KeyboardInput) error {
+			return encoder.Encode(input)
+		})
+	case DatasetAppUsage:
+		return store.EachAppUsage(opts.From, opts.To, func(usage *models.AppUsage) error {
+			return encoder.Encode(usage)
+		})
+	default:
+		return store.EachSummary(opts.From, opts.To, func(summary *storage.SummaryResult) error {
+			return encoder.Encode(summary)
+		})
+	}
+}
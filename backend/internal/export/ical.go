@@ -0,0 +1,115 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// icsTimeLayout iCalendar UTC 时间格式
+const icsTimeLayout = "20060102T150405Z"
+
+// icsWriter 按 RFC 5545 输出日历：CRLF 换行，超过 75 字节的行折叠
+type icsWriter struct {
+	w     io.Writer
+	stamp string
+	err   error
+}
+
+func (c *icsWriter) line(name, value string) {
+	if c.err != nil {
+		return
+	}
+
+	content := name + ":" + value
+	var b strings.Builder
+	width := 0
+	for _, r := range content {
+		size := utf8.RuneLen(r)
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+
+	_, c.err = io.WriteString(c.w, b.String())
+}
+
+// event 输出一个 VEVENT，end 为零值时不输出 DTEND
+func (c *icsWriter) event(uid, summary, description, category string, start, end time.Time) error {
+	c.line("BEGIN", "VEVENT")
+	c.line("UID", uid)
+	c.line("DTSTAMP", c.stamp)
+	c.line("DTSTART", start.UTC().Format(icsTimeLayout))
+	if !end.IsZero() && end.After(start) {
+		c.line("DTEND", end.UTC().Format(icsTimeLayout))
+	}
+	c.line("SUMMARY", icsEscape(summary))
+	if description != "" {
+		c.line("DESCRIPTION", icsEscape(description))
+	}
+	c.line("CATEGORIES", icsEscape(category))
+	c.line("TRANSP", "TRANSPARENT")
+	c.line("END", "VEVENT")
+	return c.err
+}
+
+// icsEscape 转义 TEXT 类型的值
+func icsEscape(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(value)
+}
+
+// writeICS 应用使用会话导出为持续时间段事件，AI总结导出为创建时刻的事件
+func writeICS(w io.Writer, store storage.Store, opts Options) error {
+	calendar := &icsWriter{w: w, stamp: time.Now().UTC().Format(icsTimeLayout)}
+	calendar.line("BEGIN", "VCALENDAR")
+	calendar.line("VERSION", "2.0")
+	calendar.line("PRODID", "-//YAML//Activity Export//EN")
+	calendar.line("CALSCALE", "GREGORIAN")
+	calendar.line("X-WR-CALNAME", "YAML")
+	if calendar.err != nil {
+		return calendar.err
+	}
+
+	for _, dataset := range opts.Datasets {
+		var err error
+		switch dataset {
+		case DatasetAppUsage:
+			err = store.EachAppUsage(opts.From, opts.To, func(usage *models.AppUsage) error {
+				end := usage.EndTime
+				if end.IsZero() {
+					end = usage.StartTime.Add(time.Duration(usage.Duration) * time.Second)
+				}
+				return calendar.event(fmt.Sprintf("app-usage-%d@yaml", usage.ID),
+					usage.AppName, "", "App Usage", usage.StartTime, end)
+			})
+		case DatasetSummaries:
+			err = store.EachSummary(opts.From, opts.To, func(summary *storage.SummaryResult) error {
+				return calendar.event(fmt.Sprintf("summary-%d@yaml", summary.ID),
+					fmt.Sprintf("AI %s summary (%d records)", summary.Type, summary.DataCount),
+					summary.Summary, "AI Summary", summary.CreatedAt, time.Time{})
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	calendar.line("END", "VCALENDAR")
+	return calendar.err
+}
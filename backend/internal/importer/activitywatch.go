@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// awExport ActivityWatch 的桶导出格式（aw-server 的 /api/0/export 或单个桶的导出）
+type awExport struct {
+	Buckets map[string]*awBucket `json:"buckets"`
+}
+
+type awBucket struct {
+	ID       string     `json:"id"`
+	Type     string     `json:"type"`
+	Client   string     `json:"client"`
+	Hostname string     `json:"hostname"`
+	Events   []*awEvent `json:"events"`
+}
+
+type awEvent struct {
+	ID        *int64                 `json:"id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Duration  float64                `json:"duration"` // 秒
+	Data      map[string]interface{} `json:"data"`
+}
+
+// 支持的桶类型
+const (
+	awTypeWindow = "currentwindow"
+	awTypeAFK    = "afkstatus"
+	awTypeWeb    = "web.tab.current"
+)
+
+// bucketKind 根据桶类型判断数据种类，旧版导出没有 type 时按 client 名称判断
+func (b *awBucket) kind() string {
+	switch b.Type {
+	case awTypeWindow, awTypeAFK, awTypeWeb:
+		return b.Type
+	}
+	switch {
+	case strings.Contains(b.Client, "window"):
+		return awTypeWindow
+	case strings.Contains(b.Client, "afk"):
+		return awTypeAFK
+	case strings.Contains(b.Client, "web"):
+		return awTypeWeb
+	}
+	return ""
+}
+
+// key 事件在桶内的唯一标识，优先使用服务端分配的事件 ID
+func (e *awEvent) key(bucketID string) string {
+	if e.ID != nil {
+		return fmt.Sprintf("%s/%d", bucketID, *e.ID)
+	}
+	return fmt.Sprintf("%s@%s/%g", bucketID, e.Timestamp.UTC().Format(time.RFC3339Nano), e.Duration)
+}
+
+func (e *awEvent) end() time.Time {
+	return e.Timestamp.Add(time.Duration(e.Duration * float64(time.Second)))
+}
+
+func (e *awEvent) str(name string) string {
+	value, _ := e.Data[name].(string)
+	return value
+}
+
+// interval 一段时间 [start, end)
+type interval struct {
+	start, end time.Time
+}
+
+// parseActivityWatch 窗口事件映射为应用活动，扣除 AFK 时间后按午夜拆分为应用使用记录；
+// 网页事件映射为网页活动；AFK 事件只用于计算使用时长，本身不导入
+func parseActivityWatch(r io.Reader) (*parsed, error) {
+	var export awExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid ActivityWatch export: %w", err)
+	}
+	if len(export.Buckets) == 0 {
+		return nil, fmt.Errorf("invalid ActivityWatch export: no buckets")
+	}
+
+	// 按桶 ID 排序，保证每次导入的顺序一致
+	bucketIDs := make([]string, 0, len(export.Buckets))
+	for id := range export.Buckets {
+		bucketIDs = append(bucketIDs, id)
+	}
+	sort.Strings(bucketIDs)
+
+	result := &parsed{batch: &storage.ImportBatch{Source: SourceActivityWatch}}
+
+	var afk []interval
+	for _, id := range bucketIDs {
+		bucket := export.Buckets[id]
+		if bucket.kind() != awTypeAFK {
+			continue
+		}
+		for _, event := range bucket.Events {
+			result.total++
+			if event.str("status") == "afk" && event.Duration > 0 {
+				afk = append(afk, interval{event.Timestamp, event.end()})
+			}
+			result.ignored++
+		}
+	}
+	sort.Slice(afk, func(i, j int) bool { return afk[i].start.Before(afk[j].start) })
+
+	for _, id := range bucketIDs {
+		bucket := export.Buckets[id]
+		if bucket.ID == "" {
+			bucket.ID = id
+		}
+
+		switch bucket.kind() {
+		case awTypeAFK:
+			continue
+		case awTypeWindow:
+			for _, event := range bucket.Events {
+				result.total++
+				result.addWindowEvent(bucket, event, afk)
+			}
+		case awTypeWeb:
+			browser := webBrowserName(bucket)
+			for _, event := range bucket.Events {
+				result.total++
+				result.addWebEvent(bucket, event, browser)
+			}
+		default:
+			result.total += len(bucket.Events)
+			result.ignored += len(bucket.Events)
+			result.errorf("bucket %s: unsupported bucket type %q, %d events skipped", bucket.ID, bucket.Type, len(bucket.Events))
+		}
+	}
+
+	return result, nil
+}
+
+func (p *parsed) addWindowEvent(bucket *awBucket, event *awEvent, afk []interval) {
+	app := event.str("app")
+	if app == "" || event.Timestamp.IsZero() {
+		p.ignored++
+		p.errorf("bucket %s: window event at %s has no app or timestamp", bucket.ID, event.Timestamp.Format(time.RFC3339))
+		return
+	}
+
+	key := event.key(bucket.ID)
+	timestamp := event.Timestamp.Local()
+	p.batch.Activities = append(p.batch.Activities, storage.ImportedActivity{
+		Key: key,
+		Activity: &models.Activity{
+			Type:        models.ActivityTypeApp,
+			Content:     "app_activation: " + app,
+			AppName:     app,
+			WindowTitle: event.str("title"),
+			Timestamp:   timestamp,
+			Duration:    int64(event.Duration + 0.5),
+		},
+	})
+
+	for i, active := range splitAtMidnight(subtract(interval{timestamp, event.end().Local()}, afk)) {
+		duration := int64(active.end.Sub(active.start).Seconds() + 0.5)
+		if duration <= 0 {
+			continue
+		}
+		p.batch.AppUsage = append(p.batch.AppUsage, storage.ImportedAppUsage{
+			Key: fmt.Sprintf("%s#%d", key, i),
+			Usage: &models.AppUsage{
+				AppName:   app,
+				StartTime: active.start,
+				EndTime:   active.end,
+				Duration:  duration,
+			},
+		})
+	}
+}
+
+func (p *parsed) addWebEvent(bucket *awBucket, event *awEvent, browser string) {
+	url := event.str("url")
+	if url == "" || event.Timestamp.IsZero() {
+		p.ignored++
+		p.errorf("bucket %s: web event at %s has no url or timestamp", bucket.ID, event.Timestamp.Format(time.RFC3339))
+		return
+	}
+
+	p.batch.Activities = append(p.batch.Activities, storage.ImportedActivity{
+		Key: event.key(bucket.ID),
+		Activity: &models.Activity{
+			Type:        models.ActivityTypeWeb,
+			Content:     "web_visit: " + url,
+			AppName:     browser,
+			WindowTitle: event.str("title"),
+			URL:         url,
+			Timestamp:   event.Timestamp.Local(),
+			Duration:    int64(event.Duration + 0.5),
+		},
+	})
+}
+
+// webBrowserName 从桶 ID 推断浏览器名称，例如 aw-watcher-web-chrome_host -> chrome
+func webBrowserName(bucket *awBucket) string {
+	name := strings.TrimPrefix(bucket.ID, "aw-watcher-web-")
+	if bucket.Hostname != "" {
+		name = strings.TrimSuffix(name, "_"+bucket.Hostname)
+	}
+	if name == bucket.ID {
+		return ""
+	}
+	return name
+}
+
+// subtract 从时间段中扣除已按开始时间排序的 AFK 时间段
+func subtract(span interval, afk []interval) []interval {
+	result := []interval{span}
+	for _, away := range afk {
+		if !away.start.Before(span.end) {
+			break
+		}
+		if !away.end.After(span.start) {
+			continue
+		}
+
+		var next []interval
+		for _, part := range result {
+			if !away.start.Before(part.end) || !away.end.After(part.start) {
+				next = append(next, part)
+				continue
+			}
+			if away.start.After(part.start) {
+				next = append(next, interval{part.start, away.start})
+			}
+			if away.end.Before(part.end) {
+				next = append(next, interval{away.end, part.end})
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// splitAtMidnight 按本地午夜拆分时间段，与 SessionTracker 记录的会话一致
+func splitAtMidnight(spans []interval) []interval {
+	var result []interval
+	for _, span := range spans {
+		start := span.start
+		for start.Before(span.end) {
+			y, m, d := start.Date()
+			midnight := time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+			end := span.end
+			if midnight.Before(end) {
+				end = midnight
+			}
+			result = append(result, interval{start, end})
+			start = end
+		}
+	}
+	return result
+}
@@ -0,0 +1,298 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+)
+
+// 支持的导入来源，同时作为 import_source 写入数据库
+const (
+	SourceActivityWatch = "activitywatch"
+	SourceRescueTime    = "rescuetime"
+)
+
+// 任务状态
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+const (
+	chunkSize = 500 // 每个事务写入的记录数
+	maxErrors = 100 // 每个任务保留的错误信息条数
+	maxJobs   = 100 // 保留的任务数，超出后丢弃最早完成的任务
+)
+
+// ErrUnknownSource 无法识别的导入来源
+var ErrUnknownSource = errors.New("unknown import source")
+
+// Job 一个文件的导入任务
+type Job struct {
+	ID         int64      `json:"id"`
+	File       string     `json:"file"`
+	Source     string     `json:"source"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`     // 文件中的事件或行数
+	Records    int        `json:"records"`   // 映射出的活动和应用使用记录数
+	Processed  int        `json:"processed"` // 已写入数据库的记录数
+	Inserted   int        `json:"inserted"`
+	Skipped    int        `json:"skipped"` // 之前已导入过
+	Ignored    int        `json:"ignored"` // 无法映射或格式错误的事件
+	ErrorCount int        `json:"error_count"`
+	Errors     []string   `json:"errors,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// parsed 解析结果
+type parsed struct {
+	batch   *storage.ImportBatch
+	total   int
+	ignored int
+	errors  []string
+	errorN  int
+}
+
+func (p *parsed) errorf(format string, args ...interface{}) {
+	p.errorN++
+	if len(p.errors) < maxErrors {
+		p.errors = append(p.errors, fmt.Sprintf(format, args...))
+	}
+}
+
+// Manager 在后台逐个执行导入任务并记录每个文件的进度
+type Manager struct {
+	storage storage.Store
+
+	mu     sync.RWMutex
+	runMu  sync.Mutex // 任务依次执行，避免多个导入同时争用写连接
+	jobs   []*Job
+	nextID int64
+	wg     sync.WaitGroup
+}
+
+// NewManager 创建导入管理器
+func NewManager(storage storage.Store) *Manager {
+	return &Manager{storage: storage}
+}
+
+// ParseSource 解析来源名称，空字符串表示根据文件内容自动识别
+func ParseSource(value string) (string, error) {
+	switch source := strings.ToLower(strings.TrimSpace(value)); source {
+	case "", SourceActivityWatch, SourceRescueTime:
+		return source, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownSource, value)
+	}
+}
+
+// Start 创建导入任务并在后台执行。path 指向的文件在导入结束后删除（上传的临时文件），
+// source 为空时根据内容识别：JSON 为 ActivityWatch，其他为 RescueTime CSV
+func (m *Manager) Start(path, fileName, source string) *Job {
+	m.mu.Lock()
+	m.nextID++
+	job := &Job{
+		ID:        m.nextID,
+		File:      fileName,
+		Source:    source,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+	}
+	m.jobs = append(m.jobs, job)
+	m.trimJobs()
+	snapshot := *job
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer os.Remove(path)
+
+		m.runMu.Lock()
+		defer m.runMu.Unlock()
+
+		if err := m.run(job, path); err != nil {
+			fmt.Printf("[ERROR] Import of %s failed: %v\n", fileName, err)
+			m.update(job, func(job *Job) {
+				job.Status = StatusFailed
+				job.ErrorCount++
+				job.Errors = append(job.Errors, err.Error())
+			})
+		}
+		m.update(job, func(job *Job) {
+			if job.Status != StatusFailed {
+				job.Status = StatusCompleted
+			}
+			now := time.Now()
+			job.FinishedAt = &now
+		})
+	}()
+
+	return &snapshot
+}
+
+func (m *Manager) run(job *Job, path string) error {
+	m.update(job, func(job *Job) {
+		job.Status = StatusRunning
+		now := time.Now()
+		job.StartedAt = &now
+	})
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	source := job.Source
+	if source == "" {
+		source = detectSource(reader)
+		m.update(job, func(job *Job) { job.Source = source })
+	}
+
+	var result *parsed
+	switch source {
+	case SourceActivityWatch:
+		result, err = parseActivityWatch(reader)
+	case SourceRescueTime:
+		result, err = parseRescueTime(reader)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownSource, source)
+	}
+	if err != nil {
+		return err
+	}
+
+	batch := result.batch
+	m.update(job, func(job *Job) {
+		job.Total = result.total
+		job.Records = len(batch.Activities) + len(batch.AppUsage)
+		job.Ignored = result.ignored
+		job.ErrorCount = result.errorN
+		job.Errors = result.errors
+	})
+
+	// 分块写入，每块一个事务，写入后更新进度
+	inserted, skipped := 0, 0
+	for start := 0; start < len(batch.Activities) || start < len(batch.AppUsage); start += chunkSize {
+		chunk := &storage.ImportBatch{
+			Source:     batch.Source,
+			Activities: batch.Activities[min(start, len(batch.Activities)):min(start+chunkSize, len(batch.Activities))],
+			AppUsage:   batch.AppUsage[min(start, len(batch.AppUsage)):min(start+chunkSize, len(batch.AppUsage))],
+		}
+		saved, err := m.storage.SaveImport(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to save imported records: %w", err)
+		}
+		inserted += saved.Inserted
+		skipped += saved.Skipped
+		m.update(job, func(job *Job) {
+			job.Processed += len(chunk.Activities) + len(chunk.AppUsage)
+			job.Inserted += saved.Inserted
+			job.Skipped += saved.Skipped
+		})
+	}
+
+	fmt.Printf("Imported %s from %s: %d inserted, %d already imported, %d ignored\n",
+		job.File, source, inserted, skipped, result.ignored)
+	return nil
+}
+
+// detectSource 根据第一个非空白字符识别文件格式
+func detectSource(reader *bufio.Reader) string {
+	head, _ := reader.Peek(512)
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) > 0 && head[0] == '{' {
+		return SourceActivityWatch
+	}
+	return SourceRescueTime
+}
+
+// update 在锁内修改任务状态
+func (m *Manager) update(job *Job, fn func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(job)
+}
+
+// trimJobs 丢弃最早的已结束任务（调用方需持有写锁）
+func (m *Manager) trimJobs() {
+	for len(m.jobs) > maxJobs {
+		removed := false
+		for i, job := range m.jobs {
+			if job.Status == StatusCompleted || job.Status == StatusFailed {
+				m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			return
+		}
+	}
+}
+
+// Jobs 按创建时间倒序返回所有任务的副本
+func (m *Manager) Jobs() []*Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		copied := *m.jobs[i]
+		copied.Errors = append([]string(nil), copied.Errors...)
+		jobs = append(jobs, &copied)
+	}
+	return jobs
+}
+
+// Job 获取指定任务的副本，不存在时返回 nil
+func (m *Manager) Job(id int64) *Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, job := range m.jobs {
+		if job.ID == id {
+			copied := *job
+			copied.Errors = append([]string(nil), copied.Errors...)
+			return &copied
+		}
+	}
+	return nil
+}
+
+// Wait 等待所有任务结束
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// SaveUpload 将上传的文件保存为临时文件，返回临时文件路径
+func SaveUpload(r io.Reader) (string, error) {
+	file, err := os.CreateTemp("", "yaml-import-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
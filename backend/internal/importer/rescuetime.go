@@ -0,0 +1,184 @@
+package importer
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// rescueTimeLayouts RescueTime CSV 中出现过的时间格式，按本地时间解析
+var rescueTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+// rescueTimeColumns 列名（小写）到字段的映射，兼容网页导出和 API 导出的表头
+var rescueTimeColumns = map[string]string{
+	"date":                 "date",
+	"time":                 "date",
+	"start":                "date",
+	"time spent (seconds)": "seconds",
+	"seconds":              "seconds",
+	"duration":             "seconds",
+	"activity":             "activity",
+	"application":          "activity",
+	"category":             "category",
+	"productivity":         "productivity",
+	"document":             "document",
+}
+
+// parseRescueTime 每行映射为一条活动记录和一条应用使用记录，站点（如 github.com）记为网页活动。
+// 行的内容即为标识，重复导入时跳过相同的行
+func parseRescueTime(r io.Reader) (*parsed, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid RescueTime CSV: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := rescueTimeColumns[name]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	for _, required := range []string{"date", "seconds", "activity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("invalid RescueTime CSV: missing %s column", required)
+		}
+	}
+
+	result := &parsed{batch: &storage.ImportBatch{Source: SourceRescueTime}}
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		result.total++
+		if err != nil {
+			result.ignored++
+			result.errorf("line %d: %v", line, err)
+			continue
+		}
+
+		start, err := parseRescueTimeDate(field(row, "date"))
+		if err != nil {
+			result.ignored++
+			result.errorf("line %d: %v", line, err)
+			continue
+		}
+		seconds, err := strconv.ParseFloat(field(row, "seconds"), 64)
+		if err != nil || seconds < 0 {
+			result.ignored++
+			result.errorf("line %d: invalid duration %q", line, field(row, "seconds"))
+			continue
+		}
+		activityName := field(row, "activity")
+		if activityName == "" {
+			result.ignored++
+			result.errorf("line %d: empty activity", line)
+			continue
+		}
+
+		duration := int64(seconds + 0.5)
+		key := rowKey(row)
+		activity := &models.Activity{
+			Type:        models.ActivityTypeApp,
+			Content:     rescueTimeContent(field(row, "category"), field(row, "productivity")),
+			AppName:     activityName,
+			WindowTitle: field(row, "document"),
+			Timestamp:   start,
+			Duration:    duration,
+		}
+		if isDomain(activityName) {
+			activity.Type = models.ActivityTypeWeb
+			activity.URL = "https://" + activityName
+		}
+
+		result.batch.Activities = append(result.batch.Activities, storage.ImportedActivity{Key: key, Activity: activity})
+		if duration > 0 {
+			result.batch.AppUsage = append(result.batch.AppUsage, storage.ImportedAppUsage{
+				Key: key,
+				Usage: &models.AppUsage{
+					AppName:   activityName,
+					StartTime: start,
+					EndTime:   start.Add(time.Duration(duration) * time.Second),
+					Duration:  duration,
+				},
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func parseRescueTimeDate(value string) (time.Time, error) {
+	for _, layout := range rescueTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// rescueTimeContent 活动内容记录 RescueTime 的分类和效率评分
+func rescueTimeContent(category, productivity string) string {
+	content := "rescuetime"
+	if category != "" {
+		content += ": " + category
+	}
+	if productivity != "" {
+		content += " (productivity " + productivity + ")"
+	}
+	return content
+}
+
+// rowKey 以整行内容的哈希作为外部记录标识
+func rowKey(row []string) string {
+	sum := sha1.Sum([]byte(strings.Join(row, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// isDomain 判断活动名称是否为站点域名，RescueTime 用域名记录网页活动
+func isDomain(name string) bool {
+	if strings.ContainsAny(name, " /\\") || !strings.Contains(name, ".") {
+		return false
+	}
+	last := name[strings.LastIndex(name, ".")+1:]
+	if len(last) < 2 {
+		return false
+	}
+	for _, r := range last {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	// 可执行文件名（如 chrome.exe）不是域名
+	return last != "exe" && last != "app"
+}
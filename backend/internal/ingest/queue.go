@@ -0,0 +1,315 @@
+package ingest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// 默认参数
+const (
+	DefaultCapacity      = 1000
+	DefaultBatchSize     = 200
+	DefaultFlushInterval = time.Second
+	DefaultBlockTimeout  = 500 * time.Millisecond
+	maxFlushAttempts     = 3
+)
+
+// Options 队列参数，零值字段使用默认值
+type Options struct {
+	Capacity      int           // 队列容量（monitor.keyboard_buffer_size）
+	BatchSize     int           // 累积到该条数时立即写入
+	FlushInterval time.Duration // 最长等待该时长后写入
+	BlockTimeout  time.Duration // 队列满时最长等待时长，超时后丢弃
+}
+
+// Stats 队列运行统计
+type Stats struct {
+	Capacity     int       `json:"capacity"`
+	Depth        int       `json:"depth"`        // 当前排队的记录数
+	Pending      int       `json:"pending"`      // 已出队、等待写入的记录数
+	Enqueued     uint64    `json:"enqueued"`     // 累计入队
+	Written      uint64    `json:"written"`      // 累计写入
+	Dropped      uint64    `json:"dropped"`      // 队列满或写入多次失败而丢弃的记录数
+	Backpressure uint64    `json:"backpressure"` // 入队时因队列已满而等待的次数
+	Batches      uint64    `json:"batches"`      // 累计写入批次
+	FlushErrors  uint64    `json:"flush_errors"` // 写入失败次数
+	LastFlushAt  time.Time `json:"last_flush_at,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// item 队列中的一条记录，只有一个字段非空
+type item struct {
+	activity *models.Activity
+	input    *models.KeyboardInput
+	usage    *models.AppUsage
+	duration *storage.ActivityDuration
+}
+
+// Queue 位于监控事件和存储之间的有界队列：后台协程按条数或时间间隔在一个事务中批量写入，
+// 队列满时入队方最多等待 BlockTimeout，超时则丢弃并计数；Close 会写入所有剩余记录
+type Queue struct {
+	store storage.Store
+	opts  Options
+
+	items    chan item
+	flushReq chan chan struct{}
+	done     chan struct{}
+
+	closeMu sync.RWMutex // 入队持有读锁，Close 持有写锁，保证关闭后不再有记录进入
+	closed  bool
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// NewQueue 创建队列并启动后台写入协程
+func NewQueue(store storage.Store, opts Options) *Queue {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultCapacity
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.BatchSize > opts.Capacity {
+		opts.BatchSize = opts.Capacity
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = DefaultBlockTimeout
+	}
+
+	q := &Queue{
+		store:    store,
+		opts:     opts,
+		items:    make(chan item, opts.Capacity),
+		flushReq: make(chan chan struct{}),
+		done:     make(chan struct{}),
+		stats:    Stats{Capacity: opts.Capacity},
+	}
+	go q.run()
+	return q
+}
+
+// AddActivity 活动记录入队，写入后回填 activity.ID
+func (q *Queue) AddActivity(activity *models.Activity) bool {
+	return q.enqueue(item{activity: activity})
+}
+
+// AddKeyboardInput 键盘输入入队
+func (q *Queue) AddKeyboardInput(input *models.KeyboardInput) bool {
+	return q.enqueue(item{input: input})
+}
+
+// AddAppUsage 应用使用记录入队
+func (q *Queue) AddAppUsage(usage *models.AppUsage) bool {
+	return q.enqueue(item{usage: usage})
+}
+
+// SetActivityDuration 回填活动记录的持续时间。activity 必须先经 AddActivity 入队，
+// 队列按先进先出顺序写入，因此写入时 activity 已经有了 ID
+func (q *Queue) SetActivityDuration(activity *models.Activity, duration int64) bool {
+	return q.enqueue(item{duration: &storage.ActivityDuration{Activity: activity, Duration: duration}})
+}
+
+func (q *Queue) enqueue(it item) bool {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+
+	if q.closed {
+		q.drop(1, "queue is closed")
+		return false
+	}
+
+	select {
+	case q.items <- it:
+		q.addEnqueued()
+		return true
+	default:
+	}
+
+	// 队列已满：等待写入协程腾出空间
+	q.statsMu.Lock()
+	q.stats.Backpressure++
+	q.statsMu.Unlock()
+
+	timer := time.NewTimer(q.opts.BlockTimeout)
+	defer timer.Stop()
+
+	select {
+	case q.items <- it:
+		q.addEnqueued()
+		return true
+	case <-timer.C:
+		q.drop(1, "queue is full")
+		return false
+	}
+}
+
+func (q *Queue) addEnqueued() {
+	q.statsMu.Lock()
+	q.stats.Enqueued++
+	q.statsMu.Unlock()
+}
+
+// drop 丢弃记录并计数，每 100 条打印一次警告避免刷屏
+func (q *Queue) drop(count int, reason string) {
+	q.statsMu.Lock()
+	before := q.stats.Dropped
+	q.stats.Dropped += uint64(count)
+	after := q.stats.Dropped
+	q.statsMu.Unlock()
+
+	if before/100 != after/100 || before == 0 {
+		fmt.Printf("[WARN] Ingest queue dropped %d records (%s), %d dropped in total\n", count, reason, after)
+	}
+}
+
+// Flush 同步写入当前排队的所有记录
+func (q *Queue) Flush() {
+	ack := make(chan struct{})
+	select {
+	case q.flushReq <- ack:
+		<-ack
+	case <-q.done:
+	}
+}
+
+// Close 停止接收新记录，写入所有剩余记录后返回
+func (q *Queue) Close() {
+	q.closeMu.Lock()
+	if q.closed {
+		q.closeMu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.items)
+	q.closeMu.Unlock()
+
+	<-q.done
+}
+
+// Stats 获取运行统计
+func (q *Queue) Stats() Stats {
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+
+	stats := q.stats
+	stats.Depth = len(q.items)
+	return stats
+}
+
+// run 后台写入循环
+func (q *Queue) run() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := &storage.Batch{}
+	attempts := 0
+
+	flush := func() {
+		if batch.Len() == 0 {
+			return
+		}
+		if q.write(batch) {
+			batch, attempts = &storage.Batch{}, 0
+			return
+		}
+		// 写入失败时保留批次，下次再试；多次失败后丢弃，避免无限堆积
+		attempts++
+		if attempts >= maxFlushAttempts {
+			q.setPending(0)
+			q.drop(batch.Len(), "write failed repeatedly")
+			batch, attempts = &storage.Batch{}, 0
+		}
+	}
+
+	for {
+		select {
+		case it, ok := <-q.items:
+			if !ok {
+				// 已关闭：写入剩余记录，失败时重试
+				for i := 0; i < maxFlushAttempts && batch.Len() > 0; i++ {
+					flush()
+				}
+				return
+			}
+			add(batch, it)
+			q.setPending(batch.Len())
+			if batch.Len() >= q.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case ack := <-q.flushReq:
+			q.drain(batch)
+			for i := 0; i < maxFlushAttempts && batch.Len() > 0; i++ {
+				flush()
+			}
+			close(ack)
+		}
+	}
+}
+
+// drain 取出当前排队的所有记录，不等待新记录
+func (q *Queue) drain(batch *storage.Batch) {
+	for {
+		select {
+		case it, ok := <-q.items:
+			if !ok {
+				return
+			}
+			add(batch, it)
+		default:
+			return
+		}
+	}
+}
+
+func add(batch *storage.Batch, it item) {
+	switch {
+	case it.activity != nil:
+		batch.Activities = append(batch.Activities, it.activity)
+	case it.input != nil:
+		batch.KeyboardInputs = append(batch.KeyboardInputs, it.input)
+	case it.usage != nil:
+		batch.AppUsage = append(batch.AppUsage, it.usage)
+	case it.duration != nil:
+		batch.ActivityDurations = append(batch.ActivityDurations, *it.duration)
+	}
+}
+
+// write 在一个事务中写入批次并更新统计
+func (q *Queue) write(batch *storage.Batch) bool {
+	err := q.store.SaveBatch(batch)
+
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+
+	if err != nil {
+		q.stats.FlushErrors++
+		q.stats.LastError = err.Error()
+		q.stats.Pending = batch.Len()
+		fmt.Printf("[ERROR] Error writing batch of %d records: %v\n", batch.Len(), err)
+		return false
+	}
+
+	q.stats.Written += uint64(batch.Len())
+	q.stats.Batches++
+	q.stats.LastFlushAt = time.Now()
+	q.stats.Pending = 0
+	return true
+}
+
+func (q *Queue) setPending(pending int) {
+	q.statsMu.Lock()
+	q.stats.Pending = pending
+	q.statsMu.Unlock()
+}
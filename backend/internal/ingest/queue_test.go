@@ -0,0 +1,184 @@
+package ingest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// fakeStore 前 failures 次 SaveBatch 失败；gate 非空时每次写入先等待放行
+type fakeStore struct {
+	storage.Store
+	gate    chan struct{}
+	entered chan struct{} // 每次开始写入时通知
+
+	mu       sync.Mutex
+	failures int
+	calls    int
+	saved    int
+}
+
+func (s *fakeStore) SaveBatch(batch *storage.Batch) error {
+	if s.entered != nil {
+		s.entered <- struct{}{}
+	}
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.failures {
+		return errors.New("disk is full")
+	}
+	s.saved += batch.Len()
+	return nil
+}
+
+func (s *fakeStore) savedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saved
+}
+
+func input(text string) *models.KeyboardInput {
+	return &models.KeyboardInput{Text: text, AppName: "Code", Timestamp: time.Now()}
+}
+
+// waitStats 轮询统计直到满足条件
+func waitStats(t *testing.T, q *Queue, what string, cond func(Stats) bool) Stats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := q.Stats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s: %+v", what, stats)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+// 队列满时入队方等待 BlockTimeout，超时后丢弃并计数，不影响已入队的记录
+func TestQueueDropsAfterBlockTimeout(t *testing.T) {
+	store := &fakeStore{gate: make(chan struct{}), entered: make(chan struct{}, 10)}
+	q := NewQueue(store, Options{Capacity: 2, BatchSize: 1, FlushInterval: time.Hour, BlockTimeout: 20 * time.Millisecond})
+
+	// 第一条被写入协程取出后阻塞在写入中，之后两条填满队列
+	q.AddKeyboardInput(input("1"))
+	<-store.entered
+	for _, text := range []string{"2", "3"} {
+		if !q.AddKeyboardInput(input(text)) {
+			t.Fatalf("input %s was dropped before the queue was full", text)
+		}
+	}
+
+	started := time.Now()
+	if q.AddKeyboardInput(input("4")) {
+		t.Fatal("input was queued while the queue was full")
+	}
+	if waited := time.Since(started); waited < 20*time.Millisecond {
+		t.Errorf("enqueue gave up after %v, want the block timeout", waited)
+	}
+	stats := q.Stats()
+	if stats.Dropped != 1 || stats.Backpressure != 1 || stats.Enqueued != 3 || stats.Depth != 2 {
+		t.Errorf("stats = %+v, want 1 dropped, 1 backpressure, 3 enqueued, depth 2", stats)
+	}
+
+	close(store.gate)
+	q.Close()
+	if saved := store.savedCount(); saved != 3 {
+		t.Errorf("saved %d inputs, want 3", saved)
+	}
+	if stats := q.Stats(); stats.Written != 3 || stats.Dropped != 1 {
+		t.Errorf("stats after Close = %+v, want 3 written and 1 dropped", stats)
+	}
+}
+
+func TestQueueRetriesFailedWrites(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		written  uint64
+		dropped  uint64
+	}{
+		{name: "succeeds on the last attempt", failures: maxFlushAttempts - 1, written: 2},
+		{name: "dropped after repeated failures", failures: maxFlushAttempts, dropped: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{failures: tt.failures}
+			q := NewQueue(store, Options{BatchSize: 2, FlushInterval: 5 * time.Millisecond})
+			defer q.Close()
+
+			q.AddKeyboardInput(input("1"))
+			q.AddKeyboardInput(input("2"))
+			stats := waitStats(t, q, "the batch to be written or dropped", func(s Stats) bool {
+				return s.Written+s.Dropped == 2
+			})
+			if stats.Written != tt.written || stats.Dropped != tt.dropped || stats.FlushErrors != uint64(tt.failures) {
+				t.Errorf("stats = %+v, want %d written, %d dropped, %d flush errors", stats, tt.written, tt.dropped, tt.failures)
+			}
+			if stats.LastError == "" || stats.Pending != 0 {
+				t.Errorf("LastError = %q, Pending = %d, want the write error and nothing pending", stats.LastError, stats.Pending)
+			}
+			if saved := store.savedCount(); uint64(saved) != tt.written {
+				t.Errorf("saved %d inputs, want %d", saved, tt.written)
+			}
+
+			// 丢弃失败的批次后继续写入新记录
+			q.AddKeyboardInput(input("3"))
+			q.Flush()
+			if saved := store.savedCount(); uint64(saved) != tt.written+1 {
+				t.Errorf("saved %d inputs after the failures, want %d", saved, tt.written+1)
+			}
+		})
+	}
+}
+
+// Close 写入所有剩余记录，之后入队的记录被丢弃
+func TestQueueFlushesOnClose(t *testing.T) {
+	store := &fakeStore{}
+	q := NewQueue(store, Options{BatchSize: 100, FlushInterval: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		q.AddKeyboardInput(input("pending"))
+	}
+	q.AddActivity(&models.Activity{Type: models.ActivityTypeApp, AppName: "Code", Timestamp: time.Now()})
+	if saved := store.savedCount(); saved != 0 {
+		t.Fatalf("saved %d records before the batch was full", saved)
+	}
+
+	q.Close()
+	if saved := store.savedCount(); saved != 6 {
+		t.Errorf("saved %d records on Close, want 6", saved)
+	}
+	if q.AddKeyboardInput(input("late")) {
+		t.Error("input was queued after Close")
+	}
+	if stats := q.Stats(); stats.Written != 6 || stats.Dropped != 1 || stats.Batches != 1 {
+		t.Errorf("stats = %+v, want 6 written in 1 batch and 1 dropped", stats)
+	}
+	q.Close()
+}
+
+// Close 时写入失败也按次数重试，多次失败后丢弃
+func TestQueueCloseDropsAfterRepeatedFailures(t *testing.T) {
+	store := &fakeStore{failures: maxFlushAttempts}
+	q := NewQueue(store, Options{BatchSize: 100, FlushInterval: time.Hour})
+
+	q.AddKeyboardInput(input("1"))
+	q.AddKeyboardInput(input("2"))
+	q.Close()
+
+	if stats := q.Stats(); stats.Written != 0 || stats.Dropped != 2 || stats.FlushErrors != maxFlushAttempts {
+		t.Errorf("stats = %+v, want 2 dropped after %d flush errors", stats, maxFlushAttempts)
+	}
+}
@@ -0,0 +1,225 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"yaml-backend/internal/ingest"
+	"yaml-backend/pkg/models"
+)
+
+// 输入片段的默认参数
+const (
+	DefaultTypingIdleTimeout = 10 * time.Second
+	DefaultTypingMaxLength   = 500
+)
+
+// macOS 虚拟键码
+const (
+	keyReturn        = 36
+	keyDelete        = 51 // 退格
+	keyKeypadEnter   = 76
+	keyForwardDelete = 117
+)
+
+// CGEventFlags 中的修饰键
+const (
+	flagControl = 1 << 18
+	flagOption  = 1 << 19
+	flagCommand = 1 << 20
+)
+
+// CoalescerOptions 输入片段的拆分参数，零值字段使用默认值
+type CoalescerOptions struct {
+	IdleTimeout time.Duration // 两次按键间隔超过该时长时关闭片段
+	MaxLength   int           // 片段文本达到该字符数时关闭
+}
+
+// typingSegment 正在输入的文本片段
+type typingSegment struct {
+	appName     string
+	text        []rune
+	start       time.Time // 第一次按键
+	last        time.Time // 最近一次按键
+	received    time.Time // 收到最近一次按键的本机时间，用于空闲计时
+	keys        int64
+	corrections int64
+}
+
+// Coalescer 将 Swift 监控程序逐键发送的键盘事件合并为输入片段：在同一个应用中连续输入的文本
+// 合并为一条键盘输入，切换应用、空闲超时、按下回车或达到最大长度时关闭片段并经队列写入。
+// 退格删除片段中的最后一个字符（Option 时删除一个单词，Command 时删除整行），
+// Command 和 Control 组合键是快捷键，不计入文本
+type Coalescer struct {
+	queue   *ingest.Queue
+	opts    CoalescerOptions
+	mu      sync.Mutex
+	current *typingSegment
+	timer   *time.Timer // 空闲超时后即使没有新的按键也关闭片段
+}
+
+// NewCoalescer 创建输入片段合并器
+func NewCoalescer(queue *ingest.Queue, opts CoalescerOptions) *Coalescer {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultTypingIdleTimeout
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = DefaultTypingMaxLength
+	}
+	return &Coalescer{
+		queue: queue,
+		opts:  opts,
+	}
+}
+
+// Key 处理一次按键，text 是按键产生的字符（可能为空）
+func (c *Coalescer) Key(appName, text string, keyCode int, modifiers uint64, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	segment := c.current
+	if segment != nil && (segment.appName != appName || at.Sub(segment.last) > c.opts.IdleTimeout) {
+		c.finish()
+		segment = nil
+	}
+
+	switch {
+	case keyCode == keyDelete || keyCode == keyForwardDelete:
+		// 片段之外的删除修改的是已经保存的文本，无法应用
+		if segment == nil {
+			return
+		}
+		segment.keys++
+		segment.corrections++
+		segment.last = at
+		// 只跟踪末尾输入的文本，向后删除不改变文本
+		if keyCode == keyDelete {
+			segment.backspace(modifiers)
+		}
+	case modifiers&(flagCommand|flagControl) != 0:
+		return
+	case keyCode == keyReturn || keyCode == keyKeypadEnter:
+		if segment != nil {
+			segment.keys++
+			segment.last = at
+			c.finish()
+		}
+		return
+	default:
+		typed := printable(text)
+		if typed == "" {
+			// 方向键、Esc、功能键等不产生文本
+			return
+		}
+		if segment == nil {
+			segment = &typingSegment{appName: appName, start: at}
+			c.current = segment
+		}
+		segment.text = append(segment.text, []rune(typed)...)
+		segment.keys++
+		segment.last = at
+		if len(segment.text) >= c.opts.MaxLength {
+			c.finish()
+			return
+		}
+	}
+	segment.received = time.Now()
+	c.schedule(c.opts.IdleTimeout)
+}
+
+// SwitchApp 应用切换到前台，关闭其他应用中的片段
+func (c *Coalescer) SwitchApp(appName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil && c.current.appName != appName {
+		c.finish()
+	}
+}
+
+// Flush 停止监控时关闭当前片段
+func (c *Coalescer) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.finish()
+}
+
+// schedule 在 after 之后检查片段是否空闲（调用方需持有锁）
+func (c *Coalescer) schedule(after time.Duration) {
+	if c.timer == nil {
+		c.timer = time.AfterFunc(after, c.expire)
+		return
+	}
+	c.timer.Reset(after)
+}
+
+func (c *Coalescer) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current == nil {
+		return
+	}
+	// 计时期间又收到了按键，按剩余时间重新计时
+	if idle := time.Since(c.current.received); idle < c.opts.IdleTimeout {
+		c.schedule(c.opts.IdleTimeout - idle)
+		return
+	}
+	c.finish()
+}
+
+// finish 关闭当前片段，文本全部被删除时丢弃（调用方需持有锁）
+func (c *Coalescer) finish() {
+	segment := c.current
+	if segment == nil {
+		return
+	}
+	c.current = nil
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if len(segment.text) == 0 {
+		return
+	}
+
+	c.queue.AddKeyboardInput(&models.KeyboardInput{
+		Text:        string(segment.text),
+		AppName:     segment.appName,
+		Timestamp:   segment.start,
+		KeyCount:    segment.keys,
+		Corrections: segment.corrections,
+		Duration:    int64(segment.last.Sub(segment.start) / time.Second),
+	})
+}
+
+// backspace 删除末尾的一个字符，Option 时删除一个单词，Command 时删除整个片段
+func (s *typingSegment) backspace(modifiers uint64) {
+	switch {
+	case modifiers&flagCommand != 0:
+		s.text = s.text[:0]
+	case modifiers&flagOption != 0:
+		end := len(s.text)
+		for end > 0 && unicode.IsSpace(s.text[end-1]) {
+			end--
+		}
+		for end > 0 && !unicode.IsSpace(s.text[end-1]) {
+			end--
+		}
+		s.text = s.text[:end]
+	case len(s.text) > 0:
+		s.text = s.text[:len(s.text)-1]
+	}
+}
+
+// printable 去掉控制字符和方向键等功能键对应的私有区字符
+func printable(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || unicode.IsGraphic(r) {
+			return r
+		}
+		return -1
+	}, text)
+}
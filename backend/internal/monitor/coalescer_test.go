@@ -0,0 +1,214 @@
+package monitor
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"yaml-backend/internal/ingest"
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// recordingStore 记录队列写入的键盘输入，其余方法不应被调用
+type recordingStore struct {
+	storage.Store
+	mu     sync.Mutex
+	inputs []models.KeyboardInput
+}
+
+func (s *recordingStore) SaveBatch(batch *storage.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, input := range batch.KeyboardInputs {
+		s.inputs = append(s.inputs, *input)
+	}
+	return nil
+}
+
+func (s *recordingStore) saved() []models.KeyboardInput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.KeyboardInput(nil), s.inputs...)
+}
+
+var typingStart = time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+
+// typingAt 输入开始后 seconds 秒
+func typingAt(seconds float64) time.Time {
+	return typingStart.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+// typeText 在 app 中从 from 秒开始每秒输入一个字符，返回下一次按键的秒数
+func typeText(c *Coalescer, app, text string, from float64) float64 {
+	for _, r := range text {
+		c.Key(app, string(r), 0, 0, typingAt(from))
+		from++
+	}
+	return from
+}
+
+func TestCoalescer(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  CoalescerOptions
+		keys  func(c *Coalescer)
+		saved []models.KeyboardInput
+	}{
+		{
+			name: "switch app",
+			keys: func(c *Coalescer) {
+				typeText(c, "Code", "hi", 0)
+				c.SwitchApp("Code") // 切换到同一个应用不关闭片段
+				typeText(c, "Code", "!", 2)
+				c.SwitchApp("Safari")
+				typeText(c, "Safari", "go", 10)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "hi!", AppName: "Code", Timestamp: typingAt(0), KeyCount: 3, Duration: 2},
+				{Text: "go", AppName: "Safari", Timestamp: typingAt(10), KeyCount: 2, Duration: 1},
+			},
+		},
+		{
+			name: "key in another app",
+			keys: func(c *Coalescer) {
+				typeText(c, "Code", "ab", 0)
+				typeText(c, "Notes", "cd", 2)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "ab", AppName: "Code", Timestamp: typingAt(0), KeyCount: 2, Duration: 1},
+				{Text: "cd", AppName: "Notes", Timestamp: typingAt(2), KeyCount: 2, Duration: 1},
+			},
+		},
+		{
+			name: "idle gap",
+			opts: CoalescerOptions{IdleTimeout: 5 * time.Second},
+			keys: func(c *Coalescer) {
+				typeText(c, "Code", "ab", 0)
+				typeText(c, "Code", "c", 6) // 距上次按键 5 秒，不超时
+				typeText(c, "Code", "d", 11.5)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "abc", AppName: "Code", Timestamp: typingAt(0), KeyCount: 3, Duration: 6},
+				{Text: "d", AppName: "Code", Timestamp: typingAt(11.5), KeyCount: 1},
+			},
+		},
+		{
+			name: "backspace",
+			keys: func(c *Coalescer) {
+				next := typeText(c, "Code", "helk", 0)
+				c.Key("Code", "\x7f", keyDelete, 0, typingAt(next))
+				typeText(c, "Code", "lo", next+1)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "hello", AppName: "Code", Timestamp: typingAt(0), KeyCount: 7, Corrections: 1, Duration: 6},
+			},
+		},
+		{
+			name: "option backspace deletes a word",
+			keys: func(c *Coalescer) {
+				next := typeText(c, "Code", "foo bar ", 0)
+				c.Key("Code", "\x7f", keyDelete, flagOption, typingAt(next))
+			},
+			saved: []models.KeyboardInput{
+				{Text: "foo ", AppName: "Code", Timestamp: typingAt(0), KeyCount: 9, Corrections: 1, Duration: 8},
+			},
+		},
+		{
+			name: "command backspace deletes the segment",
+			keys: func(c *Coalescer) {
+				next := typeText(c, "Code", "secret", 0)
+				c.Key("Code", "\x7f", keyDelete, flagCommand, typingAt(next))
+				c.SwitchApp("Safari")
+			},
+		},
+		{
+			name: "deletes outside a segment and forward delete",
+			keys: func(c *Coalescer) {
+				c.Key("Code", "\x7f", keyDelete, 0, typingAt(0))
+				next := typeText(c, "Code", "ab", 1)
+				c.Key("Code", "", keyForwardDelete, 0, typingAt(next))
+			},
+			saved: []models.KeyboardInput{
+				{Text: "ab", AppName: "Code", Timestamp: typingAt(1), KeyCount: 3, Corrections: 1, Duration: 2},
+			},
+		},
+		{
+			name: "shortcuts and function keys",
+			keys: func(c *Coalescer) {
+				next := typeText(c, "Code", "a", 0)
+				c.Key("Code", "c", 8, flagCommand, typingAt(next))
+				c.Key("Code", "\x03", 8, flagControl, typingAt(next+1))
+				c.Key("Code", "", 126, 0, typingAt(next+2)) // 上方向键
+				typeText(c, "Code", "b", next+3)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "ab", AppName: "Code", Timestamp: typingAt(0), KeyCount: 2, Duration: 4},
+			},
+		},
+		{
+			name: "return",
+			keys: func(c *Coalescer) {
+				next := typeText(c, "Terminal", "ls", 0)
+				c.Key("Terminal", "\r", keyReturn, 0, typingAt(next))
+				c.Key("Terminal", "\r", keyReturn, 0, typingAt(next+1)) // 空片段上的回车不产生记录
+				typeText(c, "Terminal", "pwd", next+2)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "ls", AppName: "Terminal", Timestamp: typingAt(0), KeyCount: 3, Duration: 2},
+				{Text: "pwd", AppName: "Terminal", Timestamp: typingAt(4), KeyCount: 3, Duration: 2},
+			},
+		},
+		{
+			name: "max length",
+			opts: CoalescerOptions{MaxLength: 4},
+			keys: func(c *Coalescer) {
+				typeText(c, "Code", "abcdef", 0)
+			},
+			saved: []models.KeyboardInput{
+				{Text: "abcd", AppName: "Code", Timestamp: typingAt(0), KeyCount: 4, Duration: 3},
+				{Text: "ef", AppName: "Code", Timestamp: typingAt(4), KeyCount: 2, Duration: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordingStore{}
+			queue := ingest.NewQueue(store, ingest.Options{})
+			defer queue.Close()
+
+			// 空闲计时使用本机时间，默认超时足够长，不会在测试期间关闭片段
+			c := NewCoalescer(queue, tt.opts)
+			tt.keys(c)
+			c.Flush()
+			queue.Flush()
+
+			if saved := store.saved(); !reflect.DeepEqual(saved, tt.saved) {
+				t.Errorf("saved inputs:\n got %+v\nwant %+v", saved, tt.saved)
+			}
+		})
+	}
+}
+
+// 没有新的按键时，空闲超时后片段也会关闭
+func TestCoalescerIdleTimer(t *testing.T) {
+	store := &recordingStore{}
+	queue := ingest.NewQueue(store, ingest.Options{FlushInterval: 10 * time.Millisecond})
+	defer queue.Close()
+
+	c := NewCoalescer(queue, CoalescerOptions{IdleTimeout: 50 * time.Millisecond})
+	c.Key("Code", "hi", 0, 0, typingAt(0))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.saved()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("segment was not closed after the idle timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if saved := store.saved(); len(saved) != 1 || saved[0].Text != "hi" {
+		t.Errorf("saved inputs = %+v, want the idle segment", saved)
+	}
+}
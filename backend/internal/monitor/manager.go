@@ -1,23 +1,66 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"yaml-backend/internal/ingest"
 	"yaml-backend/internal/storage"
 )
 
+// Options 监控管理器的可选配置，零值字段使用默认值
+type Options struct {
+	IdleTimeout time.Duration    // 空闲阈值，超过后拆分应用使用会话
+	Typing      CoalescerOptions // 按键合并为输入片段的参数
+	Ingest      ingest.Options   // 事件写入队列参数
+	Sources     []EventSource    // 事件来源，启动监控时全部启动
+	RecordDir   string           // 通过名称录制和回放的录制文件所在目录
+}
+
+// 录制和回放的错误
+var (
+	ErrNotRunning           = errors.New("monitors are not running")
+	ErrAlreadyRecording     = errors.New("a recording is already in progress")
+	ErrNotRecording         = errors.New("no recording in progress")
+	ErrInvalidRecordingName = errors.New("invalid recording name")
+)
+
+// RecordingFile 录制目录中的录制文件
+type RecordingFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// Manager 管理事件来源，把所有来源的事件汇入同一个处理流程
 type Manager struct {
-	storage     *storage.SQLiteStorage
+	storage     storage.Store
 	realManager *RealMonitorManager
+	queue       *ingest.Queue
+	sources     []EventSource
+	replays     []EventSource  // 监控运行中通过 Replay 加入的回放，停止监控时移除
+	pumps       sync.WaitGroup // 每个来源一个转发事件的协程
 	mu          sync.RWMutex
 	isRunning   bool
+	recordDir   string
+	recordMu    sync.Mutex
+	recorder    *Recorder // 正在录制时非空，所有来源的事件先写入录制文件再处理
 }
 
-func NewManager(storage *storage.SQLiteStorage) *Manager {
+func NewManager(storage storage.Store, opts Options) *Manager {
+	queue := ingest.NewQueue(storage, opts.Ingest)
 	return &Manager{
 		storage:     storage,
-		realManager: NewRealMonitorManager(storage),
+		realManager: NewRealMonitorManager(storage, queue, opts),
+		queue:       queue,
+		sources:     opts.Sources,
+		recordDir:   opts.RecordDir,
 	}
 }
 
@@ -34,6 +77,18 @@ func (m *Manager) StartAll() error {
 		return fmt.Errorf("failed to start real monitors: %w", err)
 	}
 
+	for i, source := range m.sources {
+		if err := source.Start(); err != nil {
+			// 停止已经启动的来源，不留下部分运行的监控
+			m.stopSources(m.sources[:i])
+			m.realManager.StopAll()
+			return fmt.Errorf("failed to start %s event source: %w", source.Name(), err)
+		}
+		m.pumps.Add(1)
+		go m.pump(source.Name(), source.Events())
+		fmt.Printf("Event source %s started\n", source.Name())
+	}
+
 	m.isRunning = true
 	fmt.Println("All monitors started successfully")
 	return nil
@@ -48,6 +103,9 @@ func (m *Manager) StopAll() {
 	}
 
 	fmt.Println("Stopping all monitors...")
+	// 先处理完来源已经产生的事件，再关闭输入片段和应用会话
+	m.stopSources(append(m.sources[:len(m.sources):len(m.sources)], m.replays...))
+	m.replays = nil
 	m.realManager.StopAll()
 	m.isRunning = false
 	fmt.Println("All monitors stopped")
@@ -65,5 +123,179 @@ func (m *Manager) GetStatus() map[string]bool {
 
 	status := m.realManager.GetStatus()
 	status["mode"] = true // 始终为真实监控模式
+	// 配置的事件来源异常退出或正在重启时整体状态不正常
+	for _, source := range m.sources {
+		if !source.Health().Running {
+			status["overall"] = false
+		}
+	}
 	return status
 }
+
+// SourceStatus 获取各事件来源的运行状态
+func (m *Manager) SourceStatus() []SourceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := make([]SourceStatus, 0, len(m.sources)+len(m.replays))
+	for _, source := range append(m.sources[:len(m.sources):len(m.sources)], m.replays...) {
+		status = append(status, SourceStatus{Name: source.Name(), SourceHealth: source.Health()})
+	}
+	return status
+}
+
+// Replay 在运行中的监控里回放录制文件，回放的事件与其他来源的事件一起处理
+func (m *Manager) Replay(path string, opts ReplayOptions) (SourceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isRunning {
+		return SourceStatus{}, ErrNotRunning
+	}
+
+	source, err := NewReplaySource(path, opts)
+	if err != nil {
+		return SourceStatus{}, err
+	}
+	if err := source.Start(); err != nil {
+		return SourceStatus{}, err
+	}
+
+	// 只保留仍在回放的来源
+	replays := m.replays[:0]
+	for _, replay := range m.replays {
+		if replay.Health().Running {
+			replays = append(replays, replay)
+		}
+	}
+	m.replays = append(replays, source)
+
+	m.pumps.Add(1)
+	go m.pump(source.Name(), source.Events())
+	return SourceStatus{Name: source.Name(), SourceHealth: source.Health()}, nil
+}
+
+// StartRecording 开始把所有来源的原始事件录制到 path
+func (m *Manager) StartRecording(path string) (RecordingStatus, error) {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+
+	if m.recorder != nil {
+		return RecordingStatus{}, ErrAlreadyRecording
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return RecordingStatus{}, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		return RecordingStatus{}, err
+	}
+	m.recorder = recorder
+	fmt.Printf("Recording monitor events to %s\n", path)
+	return recorder.Status(), nil
+}
+
+// StopRecording 结束录制
+func (m *Manager) StopRecording() (RecordingStatus, error) {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+
+	if m.recorder == nil {
+		return RecordingStatus{}, ErrNotRecording
+	}
+	status := m.recorder.Close()
+	m.recorder = nil
+	fmt.Printf("Recorded %d monitor events to %s\n", status.Events, status.Path)
+	return status, nil
+}
+
+// RecordingStatus 获取录制状态
+func (m *Manager) RecordingStatus() RecordingStatus {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+
+	if m.recorder == nil {
+		return RecordingStatus{}
+	}
+	return m.recorder.Status()
+}
+
+// RecordingPath 返回录制目录中名为 name 的录制文件路径，name 不能包含目录，没有扩展名时补上 .jsonl
+func (m *Manager) RecordingPath(name string) (string, error) {
+	if m.recordDir == "" || name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", ErrInvalidRecordingName
+	}
+	if filepath.Ext(name) == "" {
+		name += ".jsonl"
+	}
+	return filepath.Join(m.recordDir, name), nil
+}
+
+// ListRecordings 按修改时间倒序列出录制目录中的录制文件
+func (m *Manager) ListRecordings() ([]RecordingFile, error) {
+	files := []RecordingFile{}
+	if m.recordDir == "" {
+		return files, nil
+	}
+	entries, err := os.ReadDir(m.recordDir)
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, RecordingFile{Name: entry.Name(), Size: info.Size(), ModifiedAt: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModifiedAt.After(files[j].ModifiedAt)
+	})
+	return files, nil
+}
+
+// pump 把来源的事件交给处理流程，直到来源停止或异常退出时关闭通道
+func (m *Manager) pump(name string, events <-chan RealMonitorEvent) {
+	defer m.pumps.Done()
+	for event := range events {
+		m.record(name, event)
+		m.realManager.processEvent(event)
+	}
+}
+
+// record 正在录制时写入事件
+func (m *Manager) record(name string, event RealMonitorEvent) {
+	m.recordMu.Lock()
+	recorder := m.recorder
+	m.recordMu.Unlock()
+
+	if recorder != nil {
+		recorder.Record(name, event)
+	}
+}
+
+// stopSources 停止来源并等待转发协程处理完剩余的事件（调用方需持有锁）
+func (m *Manager) stopSources(sources []EventSource) {
+	for _, source := range sources {
+		source.Stop()
+	}
+	m.pumps.Wait()
+}
+
+// IngestStats 获取事件写入队列的统计
+func (m *Manager) IngestStats() ingest.Stats {
+	return m.queue.Stats()
+}
+
+// Close 停止监控和录制，并写入队列中的所有剩余事件，关闭存储前调用
+func (m *Manager) Close() {
+	m.StopAll()
+	m.StopRecording()
+	m.queue.Close()
+}
@@ -0,0 +1,371 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion 后端支持的最高事件协议版本
+const ProtocolVersion = 1
+
+// 事件类型
+const (
+	EventKeyboard       = "keyboard"
+	EventAppActivation  = "app_activation"
+	EventAppLaunch      = "app_launch"
+	EventAppTermination = "app_termination"
+
+	envelopeHello   = "hello"   // 采集程序启动时发送，声明支持的协议版本和事件类型
+	envelopeWelcome = "welcome" // 后端的回复，给出协商后的版本和接受的事件类型
+)
+
+// SupportedEventTypes 后端能处理的事件类型。新增类型只需加入这里：
+// 旧的采集程序不会声明新类型，不受影响；新的采集程序只发送握手时后端接受的类型
+var SupportedEventTypes = []string{EventKeyboard, EventAppActivation, EventAppLaunch, EventAppTermination}
+
+// 校验失败的原因
+const (
+	invalidJSON      = "malformed_json"
+	invalidVersion   = "unsupported_version"
+	invalidType      = "missing_type"
+	invalidSeq       = "missing_seq"
+	invalidTimestamp = "invalid_timestamp"
+	invalidPayload   = "invalid_payload"
+	invalidHello     = "invalid_hello"
+)
+
+// Envelope 事件协议的信封：每行一个 JSON 对象。
+// Seq 在同一个采集程序的一次运行（或一个连接）内从 1 开始单调递增，用于发现丢失的事件
+type Envelope struct {
+	Version   int             `json:"v"`
+	Collector string          `json:"collector"`
+	Seq       uint64          `json:"seq"`
+	Type      string          `json:"type"`
+	Timestamp string          `json:"ts"` // RFC3339
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Hello 握手时采集程序声明的能力
+type Hello struct {
+	Versions []int    `json:"versions"`
+	Types    []string `json:"types,omitempty"` // 省略时为 SupportedEventTypes
+}
+
+// Welcome 握手的回复
+type Welcome struct {
+	Version int      `json:"version"`
+	Types   []string `json:"types"`
+}
+
+// KeyboardPayload keyboard 事件的内容
+type KeyboardPayload struct {
+	AppName   string `json:"app_name"`
+	BundleID  string `json:"bundle_id,omitempty"`
+	Text      string `json:"text,omitempty"`
+	KeyCode   int    `json:"key_code"`
+	Modifiers uint64 `json:"modifiers,omitempty"`
+}
+
+// AppPayload app_activation、app_launch 和 app_termination 事件的内容
+type AppPayload struct {
+	AppName  string `json:"app_name"`
+	BundleID string `json:"bundle_id,omitempty"`
+	PID      int32  `json:"pid,omitempty"`
+}
+
+// ProtocolStats 事件协议的统计
+type ProtocolStats struct {
+	Version     int              `json:"version"`               // 最近一次握手协商的版本，0 表示还没有握手
+	Collector   string           `json:"collector,omitempty"`   // 最近一次握手的采集程序
+	Types       []string         `json:"types,omitempty"`       // 最近一次握手接受的事件类型
+	Accepted    int64            `json:"accepted"`              // 通过校验的事件
+	Legacy      int64            `json:"legacy"`                // 其中没有信封的旧格式事件
+	Invalid     map[string]int64 `json:"invalid,omitempty"`     // 按原因统计的校验失败
+	Unsupported map[string]int64 `json:"unsupported,omitempty"` // 按类型统计的未协商的事件
+	Gaps        int64            `json:"gaps"`                  // 按序号缺失的事件数
+	OutOfOrder  int64            `json:"out_of_order"`          // 序号重复或倒退而丢弃的事件数
+	LastInvalid string           `json:"last_invalid,omitempty"`
+}
+
+// protocolStats 一个事件来源的协议统计，同一来源的多个连接共用，并发安全
+type protocolStats struct {
+	mu    sync.Mutex
+	stats ProtocolStats
+}
+
+// reset 来源重新启动时清空统计
+func (p *protocolStats) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats = ProtocolStats{}
+}
+
+func (p *protocolStats) snapshot() *ProtocolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Types = append([]string(nil), p.stats.Types...)
+	stats.Invalid = copyCounts(p.stats.Invalid)
+	stats.Unsupported = copyCounts(p.stats.Unsupported)
+	return &stats
+}
+
+func (p *protocolStats) invalid(reason string, err error) {
+	fmt.Printf("[ERROR] Invalid event (%s): %v\n", reason, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stats.Invalid == nil {
+		p.stats.Invalid = make(map[string]int64)
+	}
+	p.stats.Invalid[reason]++
+	p.stats.LastInvalid = err.Error()
+}
+
+func (p *protocolStats) unsupported(eventType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stats.Unsupported == nil {
+		p.stats.Unsupported = make(map[string]int64)
+	}
+	p.stats.Unsupported[eventType]++
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	if counts == nil {
+		return nil
+	}
+	copied := make(map[string]int64, len(counts))
+	for key, count := range counts {
+		copied[key] = count
+	}
+	return copied
+}
+
+// protocolDecoder 解析一个事件流（一次进程运行或一个连接）：完成握手、校验信封并检查序号
+type protocolDecoder struct {
+	stats     *protocolStats
+	collector string
+	types     map[string]bool
+	lastSeq   uint64
+}
+
+func newProtocolDecoder(stats *protocolStats) *protocolDecoder {
+	return &protocolDecoder{stats: stats, types: eventTypeSet(SupportedEventTypes)}
+}
+
+// hello 处理握手，协商版本和事件类型，重新开始检查序号
+func (d *protocolDecoder) hello(env Envelope) (Welcome, error) {
+	if env.Collector == "" {
+		return Welcome{}, errors.New("hello must include a collector id")
+	}
+	var hello Hello
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &hello); err != nil {
+			return Welcome{}, fmt.Errorf("invalid hello payload: %w", err)
+		}
+	}
+
+	version := 0
+	for _, v := range hello.Versions {
+		if v <= ProtocolVersion && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		return Welcome{}, fmt.Errorf("no supported protocol version in %v (backend supports up to %d)", hello.Versions, ProtocolVersion)
+	}
+
+	welcome := Welcome{Version: version, Types: []string{}}
+	if len(hello.Types) == 0 {
+		welcome.Types = append(welcome.Types, SupportedEventTypes...)
+	} else {
+		supported := eventTypeSet(SupportedEventTypes)
+		for _, eventType := range hello.Types {
+			if supported[eventType] {
+				welcome.Types = append(welcome.Types, eventType)
+			}
+		}
+	}
+	sort.Strings(welcome.Types)
+
+	d.collector = env.Collector
+	d.types = eventTypeSet(welcome.Types)
+	d.lastSeq = 0
+
+	d.stats.mu.Lock()
+	d.stats.stats.Version = version
+	d.stats.stats.Collector = env.Collector
+	d.stats.stats.Types = welcome.Types
+	d.stats.mu.Unlock()
+	return welcome, nil
+}
+
+// decode 解析一行事件。信封为 hello 时完成握手并返回需要回复的 welcome；
+// 没有 "v" 字段的行按旧格式（RealMonitorEvent）处理。返回 ok 为 false 时没有事件（已计数）
+func (d *protocolDecoder) decode(line []byte) (event RealMonitorEvent, welcome *Welcome, ok bool) {
+	var env Envelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		d.stats.invalid(invalidJSON, err)
+		return RealMonitorEvent{}, nil, false
+	}
+
+	if env.Version == 0 {
+		return d.decodeLegacy(line)
+	}
+	// 更新的采集程序也用 hello 声明它支持的所有版本，由后端选择
+	if env.Type == envelopeHello {
+		w, err := d.hello(env)
+		if err != nil {
+			d.stats.invalid(invalidHello, err)
+			return RealMonitorEvent{}, nil, false
+		}
+		return RealMonitorEvent{}, &w, false
+	}
+	if env.Version > ProtocolVersion {
+		d.stats.invalid(invalidVersion, fmt.Errorf("unsupported protocol version %d", env.Version))
+		return RealMonitorEvent{}, nil, false
+	}
+	if env.Type == "" {
+		d.stats.invalid(invalidType, errors.New("event without type"))
+		return RealMonitorEvent{}, nil, false
+	}
+	if env.Seq == 0 {
+		d.stats.invalid(invalidSeq, fmt.Errorf("%s event without seq", env.Type))
+		return RealMonitorEvent{}, nil, false
+	}
+	// 先检查序号，之后被丢弃的事件不计为缺失
+	if !d.checkSeq(env) {
+		return RealMonitorEvent{}, nil, false
+	}
+
+	if !d.types[env.Type] {
+		// 未协商的类型（例如比后端更新的采集程序发送的新类型）直接丢弃
+		d.stats.unsupported(env.Type)
+		return RealMonitorEvent{}, nil, false
+	}
+	if _, err := time.Parse(time.RFC3339, env.Timestamp); err != nil {
+		d.stats.invalid(invalidTimestamp, fmt.Errorf("seq %d: %w", env.Seq, err))
+		return RealMonitorEvent{}, nil, false
+	}
+
+	event, err := envelopeEvent(env)
+	if err != nil {
+		d.stats.invalid(invalidPayload, fmt.Errorf("seq %d: %w", env.Seq, err))
+		return RealMonitorEvent{}, nil, false
+	}
+
+	d.stats.mu.Lock()
+	d.stats.stats.Accepted++
+	d.stats.mu.Unlock()
+	return event, nil, true
+}
+
+// decodeLegacy 解析没有信封的旧格式事件
+func (d *protocolDecoder) decodeLegacy(line []byte) (RealMonitorEvent, *Welcome, bool) {
+	var event RealMonitorEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		d.stats.invalid(invalidJSON, err)
+		return RealMonitorEvent{}, nil, false
+	}
+	if event.Type == "" {
+		d.stats.invalid(invalidType, errors.New("event without type"))
+		return RealMonitorEvent{}, nil, false
+	}
+	if !eventTypeSet(SupportedEventTypes)[event.Type] {
+		d.stats.unsupported(event.Type)
+		return RealMonitorEvent{}, nil, false
+	}
+
+	d.stats.mu.Lock()
+	d.stats.stats.Accepted++
+	d.stats.stats.Legacy++
+	d.stats.mu.Unlock()
+	return event, nil, true
+}
+
+// checkSeq 检查序号：跳过的序号计为缺失，重复或倒退的事件丢弃
+func (d *protocolDecoder) checkSeq(env Envelope) bool {
+	if env.Collector != d.collector {
+		// 没有握手的采集程序，从它的第一个事件开始检查
+		d.collector = env.Collector
+		d.lastSeq = env.Seq - 1
+	}
+
+	d.stats.mu.Lock()
+	defer d.stats.mu.Unlock()
+
+	switch {
+	case env.Seq <= d.lastSeq:
+		d.stats.stats.OutOfOrder++
+		return false
+	case env.Seq > d.lastSeq+1:
+		missing := env.Seq - d.lastSeq - 1
+		d.stats.stats.Gaps += int64(missing)
+		fmt.Printf("[ERROR] Collector %s skipped %d events before seq %d\n", env.Collector, missing, env.Seq)
+	}
+	d.lastSeq = env.Seq
+	return true
+}
+
+// envelopeEvent 把信封中的事件转换为处理流程使用的 RealMonitorEvent
+func envelopeEvent(env Envelope) (RealMonitorEvent, error) {
+	event := RealMonitorEvent{Type: env.Type, Timestamp: env.Timestamp}
+	switch env.Type {
+	case EventKeyboard:
+		var payload KeyboardPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			return event, err
+		}
+		if payload.AppName == "" {
+			return event, errors.New("keyboard event without app_name")
+		}
+		event.AppName = payload.AppName
+		event.BundleID = payload.BundleID
+		event.Text = payload.Text
+		event.KeyCode = payload.KeyCode
+		event.Modifiers = payload.Modifiers
+	case EventAppActivation, EventAppLaunch, EventAppTermination:
+		var payload AppPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			return event, err
+		}
+		if payload.AppName == "" {
+			return event, fmt.Errorf("%s event without app_name", env.Type)
+		}
+		event.AppName = payload.AppName
+		event.BundleID = payload.BundleID
+		event.PID = payload.PID
+	default:
+		return event, fmt.Errorf("no payload schema for %s", env.Type)
+	}
+	return event, nil
+}
+
+// welcomeLine 编码握手回复
+func welcomeLine(welcome Welcome) []byte {
+	payload, _ := json.Marshal(welcome)
+	line, _ := json.Marshal(Envelope{
+		Version:   welcome.Version,
+		Collector: "backend",
+		Type:      envelopeWelcome,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Payload:   payload,
+	})
+	return append(line, '\n')
+}
+
+func eventTypeSet(types []string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, eventType := range types {
+		set[eventType] = true
+	}
+	return set
+}
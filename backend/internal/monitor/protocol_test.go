@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTimestamp = "2025-09-01T10:00:00Z"
+
+// helloLine 采集程序 c1 的握手信封，types 为空时省略
+func helloLine(versions string, types string) string {
+	payload := `{"versions":` + versions
+	if types != "" {
+		payload += `,"types":` + types
+	}
+	return `{"v":1,"collector":"c1","type":"hello","ts":"` + testTimestamp + `","payload":` + payload + `}}`
+}
+
+// keyLine 采集程序 c1 的 keyboard 事件，文本为 "k<seq>"
+func keyLine(version int, seq uint64) string {
+	return fmt.Sprintf(`{"v":%d,"collector":"c1","seq":%d,"type":"keyboard","ts":"%s","payload":{"app_name":"Code","text":"k%d","key_code":1}}`,
+		version, seq, testTimestamp, seq)
+}
+
+// appLine 采集程序 c1 的 app_activation 事件
+func appLine(seq uint64) string {
+	return fmt.Sprintf(`{"v":1,"collector":"c1","seq":%d,"type":"app_activation","ts":"%s","payload":{"app_name":"Safari","pid":42}}`,
+		seq, testTimestamp)
+}
+
+func TestProtocolDecoder(t *testing.T) {
+	allTypes := []string{EventAppActivation, EventAppLaunch, EventAppTermination, EventKeyboard}
+	tests := []struct {
+		name     string
+		lines    []string
+		events   []string   // 按顺序通过校验的事件：keyboard 为文本，其他为应用名
+		welcomes []*Welcome // 每个 hello 的回复，握手失败时为 nil
+		stats    ProtocolStats
+	}{
+		{
+			name:     "in order",
+			lines:    []string{helloLine("[1]", ""), keyLine(1, 1), keyLine(1, 2), appLine(3)},
+			events:   []string{"k1", "k2", "Safari"},
+			welcomes: []*Welcome{{Version: 1, Types: allTypes}},
+			stats:    ProtocolStats{Version: 1, Collector: "c1", Types: allTypes, Accepted: 3},
+		},
+		{
+			name:   "gap",
+			lines:  []string{keyLine(1, 1), keyLine(1, 4), keyLine(1, 5)},
+			events: []string{"k1", "k4", "k5"},
+			stats:  ProtocolStats{Accepted: 3, Gaps: 2},
+		},
+		{
+			name:   "duplicate",
+			lines:  []string{keyLine(1, 1), keyLine(1, 2), keyLine(1, 2), keyLine(1, 3)},
+			events: []string{"k1", "k2", "k3"},
+			stats:  ProtocolStats{Accepted: 3, OutOfOrder: 1},
+		},
+		{
+			name:   "out of order",
+			lines:  []string{keyLine(1, 1), keyLine(1, 3), keyLine(1, 2), keyLine(1, 4)},
+			events: []string{"k1", "k3", "k4"},
+			stats:  ProtocolStats{Accepted: 3, Gaps: 1, OutOfOrder: 1},
+		},
+		{
+			name:   "unknown version",
+			lines:  []string{keyLine(2, 1), keyLine(1, 2)},
+			events: []string{"k2"},
+			stats:  ProtocolStats{Accepted: 1, Invalid: map[string]int64{invalidVersion: 1}},
+		},
+		{
+			name: "legacy line",
+			lines: []string{
+				`{"type":"keyboard","text":"old","app_name":"Code","timestamp":"` + testTimestamp + `","key_code":1}`,
+				`{"type":"clipboard","app_name":"Code","timestamp":"` + testTimestamp + `"}`,
+			},
+			events: []string{"old"},
+			stats:  ProtocolStats{Accepted: 1, Legacy: 1, Unsupported: map[string]int64{"clipboard": 1}},
+		},
+		{
+			name:     "no common version",
+			lines:    []string{helloLine("[2,3]", ""), keyLine(1, 1)},
+			events:   []string{"k1"},
+			welcomes: []*Welcome{nil},
+			stats:    ProtocolStats{Accepted: 1, Invalid: map[string]int64{invalidHello: 1}},
+		},
+		{
+			name:     "event type not negotiated",
+			lines:    []string{helloLine("[1,2]", `["keyboard","clipboard"]`), keyLine(1, 1), appLine(2), keyLine(1, 3)},
+			events:   []string{"k1", "k3"},
+			welcomes: []*Welcome{{Version: 1, Types: []string{EventKeyboard}}},
+			stats: ProtocolStats{Version: 1, Collector: "c1", Types: []string{EventKeyboard}, Accepted: 2,
+				Unsupported: map[string]int64{EventAppActivation: 1}},
+		},
+		{
+			name:     "hello restarts seq",
+			lines:    []string{helloLine("[1]", ""), keyLine(1, 1), keyLine(1, 2), helloLine("[1]", ""), keyLine(1, 1)},
+			events:   []string{"k1", "k2", "k1"},
+			welcomes: []*Welcome{{Version: 1, Types: allTypes}, {Version: 1, Types: allTypes}},
+			stats:    ProtocolStats{Version: 1, Collector: "c1", Types: allTypes, Accepted: 3},
+		},
+		{
+			name:  "malformed lines",
+			lines: []string{`not json`, `{"v":1,"collector":"c1","type":"keyboard","ts":"` + testTimestamp + `"}`, `{"v":1,"collector":"c1","seq":1,"ts":"` + testTimestamp + `"}`},
+			stats: ProtocolStats{Invalid: map[string]int64{invalidJSON: 1, invalidSeq: 1, invalidType: 1}},
+		},
+		{
+			name: "invalid timestamp and payload",
+			lines: []string{
+				`{"v":1,"collector":"c1","seq":1,"type":"keyboard","ts":"yesterday","payload":{"app_name":"Code"}}`,
+				`{"v":1,"collector":"c1","seq":2,"type":"keyboard","ts":"` + testTimestamp + `","payload":{"text":"no app"}}`,
+			},
+			stats: ProtocolStats{Invalid: map[string]int64{invalidTimestamp: 1, invalidPayload: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats protocolStats
+			decoder := newProtocolDecoder(&stats)
+
+			var events []string
+			var welcomes []*Welcome
+			for _, line := range tt.lines {
+				event, welcome, ok := decoder.decode([]byte(line))
+				if strings.Contains(line, `"type":"hello"`) {
+					welcomes = append(welcomes, welcome)
+				} else if welcome != nil {
+					t.Errorf("decode(%s) returned a welcome", line)
+				}
+				if !ok {
+					continue
+				}
+				if event.Type == EventKeyboard {
+					events = append(events, event.Text)
+				} else {
+					events = append(events, event.AppName)
+				}
+			}
+
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %q, want %q", events, tt.events)
+			}
+			if !reflect.DeepEqual(welcomes, tt.welcomes) {
+				t.Errorf("welcomes = %+v, want %+v", welcomes, tt.welcomes)
+			}
+
+			got := stats.snapshot()
+			if (got.LastInvalid != "") != (len(tt.stats.Invalid) > 0) {
+				t.Errorf("LastInvalid = %q with invalid counts %v", got.LastInvalid, got.Invalid)
+			}
+			got.LastInvalid = ""
+			if !reflect.DeepEqual(*got, tt.stats) {
+				t.Errorf("stats = %+v, want %+v", *got, tt.stats)
+			}
+		})
+	}
+}
+
+// welcomeLine 的回复是一行可以解析的 welcome 信封
+func TestWelcomeLine(t *testing.T) {
+	want := Welcome{Version: 1, Types: []string{EventKeyboard}}
+	line := welcomeLine(want)
+	if !strings.HasSuffix(string(line), "\n") {
+		t.Fatalf("welcome line %q does not end with a newline", line)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		t.Fatalf("unmarshal envelope: %v", err)
+	}
+	var got Welcome
+	if err := json.Unmarshal(env.Payload, &got); err != nil {
+		t.Fatalf("unmarshal welcome: %v", err)
+	}
+	if env.Type != envelopeWelcome || env.Version != want.Version || !reflect.DeepEqual(got, want) {
+		t.Errorf("welcome envelope = %+v with %+v, want %+v", env, got, want)
+	}
+}
@@ -1,23 +1,17 @@
 package monitor
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
+	"yaml-backend/internal/ingest"
 	"yaml-backend/internal/storage"
 	"yaml-backend/pkg/models"
 )
 
-// RealMonitorEvent 表示从Swift监控程序接收的事件
+// RealMonitorEvent 表示事件来源产生的监控事件
 type RealMonitorEvent struct {
 	Type      string    `json:"type"`
 	Text      string    `json:"text,omitempty"`
@@ -31,7 +25,7 @@ type RealMonitorEvent struct {
 
 // RealKeyboardMonitor 真实键盘监控器
 type RealKeyboardMonitor struct {
-	storage   *storage.SQLiteStorage
+	storage   storage.Store
 	isRunning bool
 	cancel    context.CancelFunc
 	mu        sync.RWMutex
@@ -39,43 +33,48 @@ type RealKeyboardMonitor struct {
 
 // RealAppMonitor 真实应用监控器
 type RealAppMonitor struct {
-	storage   *storage.SQLiteStorage
+	storage   storage.Store
 	isRunning bool
 	cancel    context.CancelFunc
 	mu        sync.RWMutex
 }
 
-// RealMonitorManager 真实监控管理器
+// RealMonitorManager 真实监控管理器，处理各事件来源产生的事件
 type RealMonitorManager struct {
-	storage         *storage.SQLiteStorage
+	storage         storage.Store
 	keyboardMonitor *RealKeyboardMonitor
 	appMonitor      *RealAppMonitor
-	swiftProcess    *exec.Cmd
+	queue           *ingest.Queue
+	sessions        *SessionTracker
+	typing          *Coalescer
 	mu              sync.RWMutex
 	isRunning       bool
-	cancel          context.CancelFunc
 }
 
 // NewRealKeyboardMonitor 创建真实键盘监控器
-func NewRealKeyboardMonitor(storage *storage.SQLiteStorage) *RealKeyboardMonitor {
+func NewRealKeyboardMonitor(storage storage.Store) *RealKeyboardMonitor {
 	return &RealKeyboardMonitor{
 		storage: storage,
 	}
 }
 
 // NewRealAppMonitor 创建真实应用监控器
-func NewRealAppMonitor(storage *storage.SQLiteStorage) *RealAppMonitor {
+func NewRealAppMonitor(storage storage.Store) *RealAppMonitor {
 	return &RealAppMonitor{
 		storage: storage,
 	}
 }
 
 // NewRealMonitorManager 创建真实监控管理器
-func NewRealMonitorManager(storage *storage.SQLiteStorage) *RealMonitorManager {
+// 事件经 queue 批量写入存储
+func NewRealMonitorManager(storage storage.Store, queue *ingest.Queue, opts Options) *RealMonitorManager {
 	return &RealMonitorManager{
 		storage:         storage,
 		keyboardMonitor: NewRealKeyboardMonitor(storage),
 		appMonitor:      NewRealAppMonitor(storage),
+		queue:           queue,
+		sessions:        NewSessionTracker(queue, opts.IdleTimeout),
+		typing:          NewCoalescer(queue, opts.Typing),
 	}
 }
 
@@ -168,26 +167,6 @@ func (rmm *RealMonitorManager) StartAll() error {
 
 	fmt.Println("[DEBUG] Starting all real monitors...")
 
-	// 编译Swift监控程序
-	fmt.Println("[DEBUG] Compiling Swift monitor...")
-	if err := rmm.compileSwiftMonitor(); err != nil {
-		fmt.Printf("[ERROR] Failed to compile Swift monitor: %v\n", err)
-		return fmt.Errorf("failed to compile Swift monitor: %w", err)
-	}
-	fmt.Println("[DEBUG] Swift monitor compiled successfully")
-
-	// 启动Swift监控进程
-	fmt.Println("[DEBUG] Creating context for Swift process...")
-	ctx, cancel := context.WithCancel(context.Background())
-	rmm.cancel = cancel
-
-	fmt.Println("[DEBUG] Starting Swift monitor process...")
-	if err := rmm.startSwiftProcess(ctx); err != nil {
-		fmt.Printf("[ERROR] Failed to start Swift monitor process: %v\n", err)
-		return fmt.Errorf("failed to start Swift monitor process: %w", err)
-	}
-	fmt.Println("[DEBUG] Swift monitor process started")
-
 	// 启动各个监控器
 	fmt.Println("[DEBUG] Starting keyboard monitor...")
 	if err := rmm.keyboardMonitor.Start(); err != nil {
@@ -224,14 +203,10 @@ func (rmm *RealMonitorManager) StopAll() {
 	rmm.keyboardMonitor.Stop()
 	rmm.appMonitor.Stop()
 
-	// 停止Swift进程
-	if rmm.cancel != nil {
-		rmm.cancel()
-	}
-
-	if rmm.swiftProcess != nil && rmm.swiftProcess.Process != nil {
-		rmm.swiftProcess.Process.Kill()
-	}
+	// 关闭当前输入片段和应用会话，并写入队列中的所有记录
+	rmm.typing.Flush()
+	rmm.sessions.Flush(time.Now())
+	rmm.queue.Flush()
 
 	rmm.isRunning = false
 	fmt.Println("All real monitors stopped")
@@ -256,161 +231,9 @@ func (rmm *RealMonitorManager) GetStatus() map[string]bool {
 	}
 }
 
-// compileSwiftMonitor 编译Swift监控程序
-func (rmm *RealMonitorManager) compileSwiftMonitor() error {
-	// 获取当前工作目录
-	wd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get working directory: %w", err)
-	}
-
-	// 构建Swift源文件路径（相对于当前工作目录）
-	swiftFile := filepath.Join(wd, "internal", "monitor", "real_monitor.swift")
-	outputFile := filepath.Join(wd, "internal", "monitor", "real_monitor")
-
-	// 检查Swift文件是否存在
-	if _, err := os.Stat(swiftFile); os.IsNotExist(err) {
-		return fmt.Errorf("Swift monitor file not found: %s", swiftFile)
-	}
-
-	// 检查是否已经编译过
-	if _, err := os.Stat(outputFile); err == nil {
-		fmt.Println("Swift monitor already compiled, skipping compilation")
-		return nil
-	}
-
-	// 编译Swift程序
-	cmd := exec.Command("swiftc", "-o", outputFile, swiftFile)
-	cmd.Dir = wd
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Swift compilation failed: %s\nOutput: %s", err, string(output))
-	}
-
-	fmt.Println("Swift monitor compiled successfully")
-	return nil
-}
-
-// startSwiftProcess 启动Swift监控进程
-func (rmm *RealMonitorManager) startSwiftProcess(ctx context.Context) error {
-	fmt.Println("[DEBUG] Starting Swift process setup...")
-	
-	// 获取当前工作目录
-	wd, err := os.Getwd()
-	if err != nil {
-		fmt.Printf("[ERROR] Failed to get working directory: %v\n", err)
-		return fmt.Errorf("failed to get working directory: %w", err)
-	}
-	fmt.Printf("[DEBUG] Working directory: %s\n", wd)
-
-	monitorPath := filepath.Join(wd, "internal", "monitor", "real_monitor")
-	fmt.Printf("[DEBUG] Swift monitor path: %s\n", monitorPath)
-
-	// 检查编译后的文件是否存在
-	if _, err := os.Stat(monitorPath); os.IsNotExist(err) {
-		fmt.Printf("[ERROR] Swift monitor not found: %s\n", monitorPath)
-		return fmt.Errorf("compiled Swift monitor not found: %s", monitorPath)
-	}
-	fmt.Println("[DEBUG] Swift monitor executable found")
-
-	// 启动Swift监控进程
-	fmt.Println("[DEBUG] Creating Swift command...")
-	rmm.swiftProcess = exec.CommandContext(ctx, monitorPath)
-	rmm.swiftProcess.Dir = wd
-	
-	// 设置环境变量，确保输出不被缓冲
-	rmm.swiftProcess.Env = append(os.Environ(), "NSUnbufferedIO=YES")
-	fmt.Println("[DEBUG] Environment variables set")
-
-	// 获取输出管道
-	fmt.Println("[DEBUG] Setting up stdout pipe...")
-	stdout, err := rmm.swiftProcess.StdoutPipe()
-	if err != nil {
-		fmt.Printf("[ERROR] Failed to get stdout pipe: %v\n", err)
-		return fmt.Errorf("failed to get stdout pipe: %w", err)
-	}
-
-	fmt.Println("[DEBUG] Setting up stderr pipe...")
-	stderr, err := rmm.swiftProcess.StderrPipe()
-	if err != nil {
-		fmt.Printf("[ERROR] Failed to get stderr pipe: %v\n", err)
-		return fmt.Errorf("failed to get stderr pipe: %w", err)
-	}
-
-	// 启动进程
-	fmt.Println("[DEBUG] Starting Swift process...")
-	if err := rmm.swiftProcess.Start(); err != nil {
-		fmt.Printf("[ERROR] Failed to start Swift process: %v\n", err)
-		return fmt.Errorf("failed to start Swift process: %w", err)
-	}
-	
-	fmt.Printf("[DEBUG] Swift process started with PID: %d\n", rmm.swiftProcess.Process.Pid)
-
-	// 启动输出处理协程
-	fmt.Println("[DEBUG] Starting output handlers...")
-	go rmm.handleSwiftOutput(stdout)
-	go rmm.handleSwiftErrors(stderr)
-
-	fmt.Println("[SUCCESS] Swift monitor process started successfully")
-	return nil
-}
-
-// handleSwiftOutput 处理Swift程序的输出
-func (rmm *RealMonitorManager) handleSwiftOutput(stdout io.ReadCloser) {
-	fmt.Println("[DEBUG] Starting Swift output handler")
-	scanner := bufio.NewScanner(stdout)
-	lineCount := 0
-	
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineCount++
-		fmt.Printf("[DEBUG] Swift output line %d: %s\n", lineCount, line)
-		
-		// 查找事件数据
-		if strings.HasPrefix(line, "YAML_EVENT: ") {
-			eventJSON := strings.TrimPrefix(line, "YAML_EVENT: ")
-			fmt.Printf("[DEBUG] Found YAML event: %s\n", eventJSON)
-			rmm.processEvent(eventJSON)
-		} else {
-			// 普通日志输出
-			fmt.Printf("Swift Monitor: %s\n", line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("[ERROR] Error reading Swift output: %v\n", err)
-	}
-	
-	fmt.Printf("[DEBUG] Swift output handler finished, processed %d lines\n", lineCount)
-}
-
-// handleSwiftErrors 处理Swift程序的错误输出
-func (rmm *RealMonitorManager) handleSwiftErrors(stderr io.ReadCloser) {
-	scanner := bufio.NewScanner(stderr)
-	for scanner.Scan() {
-		line := scanner.Text()
-		fmt.Printf("Swift Monitor Error: %s\n", line)
-	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading Swift errors: %v\n", err)
-	}
-}
-
-// processEvent 处理从Swift程序接收的事件
-func (rmm *RealMonitorManager) processEvent(eventJSON string) {
-	fmt.Printf("[DEBUG] Processing event JSON: %s\n", eventJSON)
-	
-	var event RealMonitorEvent
-	if err := json.Unmarshal([]byte(eventJSON), &event); err != nil {
-		fmt.Printf("[ERROR] Error parsing event JSON: %v\n", err)
-		fmt.Printf("[ERROR] Raw JSON: %s\n", eventJSON)
-		return
-	}
-
-	fmt.Printf("[DEBUG] Parsed event: Type=%s, AppName=%s\n", event.Type, event.AppName)
-
+// processEvent 处理事件来源产生的事件。不逐条打印事件：按键码和顺序足以还原输入内容，
+// 事件数量见来源状态中的计数
+func (rmm *RealMonitorManager) processEvent(event RealMonitorEvent) {
 	// 解析时间戳
 	timestamp, err := time.Parse(time.RFC3339, event.Timestamp)
 	if err != nil {
@@ -430,43 +253,33 @@ func (rmm *RealMonitorManager) processEvent(eventJSON string) {
 
 // handleKeyboardEvent 处理键盘事件
 func (rmm *RealMonitorManager) handleKeyboardEvent(event RealMonitorEvent, timestamp time.Time) {
-	fmt.Printf("[DEBUG] Handling keyboard event: Text=%s, AppName=%s, Timestamp=%s\n", event.Text, event.AppName, timestamp.Format(time.RFC3339))
-	
-	input := &models.KeyboardInput{
-		Text:      event.Text,
-		AppName:   event.AppName,
-		Timestamp: timestamp,
-	}
-
-	fmt.Printf("[DEBUG] Saving keyboard input to database...\n")
-	if err := rmm.storage.SaveKeyboardInput(input); err != nil {
-		fmt.Printf("[ERROR] Error saving keyboard input: %v\n", err)
-	} else {
-		fmt.Printf("[SUCCESS] Keyboard input saved successfully\n")
-	}
+	// 按键先合并为输入片段，片段关闭时才写入
+	rmm.typing.Key(event.AppName, event.Text, event.KeyCode, event.Modifiers, timestamp)
+	rmm.sessions.Touch(event.AppName, timestamp)
 }
 
 // handleAppEvent 处理应用事件
 func (rmm *RealMonitorManager) handleAppEvent(event RealMonitorEvent, timestamp time.Time) {
-	fmt.Printf("[DEBUG] Handling app event: Type=%s, AppName=%s, Timestamp=%s\n", event.Type, event.AppName, timestamp.Format(time.RFC3339))
-	
 	activityType := models.ActivityTypeApp
 	content := fmt.Sprintf("%s: %s", event.Type, event.AppName)
 
-	fmt.Printf("[DEBUG] Creating activity: Type=%s, Content=%s\n", activityType, content)
-	
 	activity := &models.Activity{
 		Type:      activityType,
 		Content:   content,
 		AppName:   event.AppName,
 		Timestamp: timestamp,
-		Duration:  0, // 实时事件，持续时间为0
+		Duration:  0, // 会话结束后由 SessionTracker 回填
 	}
 
-	fmt.Printf("[DEBUG] Saving app activity to database...\n")
-	if err := rmm.storage.SaveActivity(activity); err != nil {
-		fmt.Printf("[ERROR] Error saving app activity: %v\n", err)
-	} else {
-		fmt.Printf("[SUCCESS] App activity saved successfully\n")
+	if !rmm.queue.AddActivity(activity) {
+		activity = nil
+	}
+
+	switch event.Type {
+	case "app_activation":
+		rmm.typing.SwitchApp(event.AppName)
+		rmm.sessions.Activate(event.AppName, activity, timestamp)
+	case "app_termination":
+		rmm.sessions.End(event.AppName, timestamp)
 	}
 }
\ No newline at end of file
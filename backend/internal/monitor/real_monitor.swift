@@ -14,6 +14,13 @@ class RealMonitor {
     private var appObserver: NSWorkspace?
     private var isRunning = false
     private let outputPipe = Pipe()
+    private var heartbeatTimer: Timer?
+    
+    // 事件协议：版本、本程序能产生的事件类型、后端在 welcome 中接受的类型（收到前发送全部类型）和事件序号
+    private let protocolVersion = 1
+    private let supportedTypes = ["keyboard", "app_activation", "app_launch", "app_termination"]
+    private var acceptedTypes: Set<String>?
+    private var sequence: UInt64 = 0
     
     init() {
         self.appObserver = NSWorkspace.shared
@@ -34,6 +41,9 @@ class RealMonitor {
         print("[DEBUG] Current user: \(NSUserName())")
         fflush(stdout)
         
+        // 与后端握手，协商协议版本和事件类型
+        startHandshake()
+        
         // 启动键盘监控
         print("[DEBUG] Initializing keyboard monitoring...")
         fflush(stdout)
@@ -44,6 +54,9 @@ class RealMonitor {
         fflush(stdout)
         startAppMonitoring()
         
+        // 定时输出心跳，后端据此发现停滞的进程
+        startHeartbeat()
+        
         print("[DEBUG] All monitors initialized, entering run loop...")
         fflush(stdout)
         // 保持程序运行
@@ -52,6 +65,8 @@ class RealMonitor {
     
     func stopMonitoring() {
         isRunning = false
+        heartbeatTimer?.invalidate()
+        heartbeatTimer = nil
         
         // 停止键盘监控
         if let eventTap = keyboardEventTap {
@@ -63,6 +78,42 @@ class RealMonitor {
         print("Real monitoring stopped")
     }
     
+    private func startHandshake() {
+        // 后端经标准输入回复 welcome
+        FileHandle.standardInput.readabilityHandler = { [weak self] handle in
+            let data = handle.availableData
+            guard !data.isEmpty, let text = String(data: data, encoding: .utf8) else {
+                handle.readabilityHandler = nil
+                return
+            }
+            for line in text.split(separator: "\n") {
+                guard let message = try? JSONSerialization.jsonObject(with: Data(line.utf8)) as? [String: Any],
+                      message["type"] as? String == "welcome",
+                      let payload = message["payload"] as? [String: Any],
+                      let types = payload["types"] as? [String] else {
+                    continue
+                }
+                DispatchQueue.main.async {
+                    self?.acceptedTypes = Set(types)
+                    print("[DEBUG] Backend accepted event types: \(types)")
+                    fflush(stdout)
+                }
+            }
+        }
+        
+        writeEnvelope(type: "hello", seq: 0, timestamp: ISO8601DateFormatter().string(from: Date()), payload: [
+            "versions": [protocolVersion],
+            "types": supportedTypes
+        ])
+    }
+    
+    private func startHeartbeat() {
+        heartbeatTimer = Timer.scheduledTimer(withTimeInterval: 5, repeats: true) { _ in
+            print("YAML_HEARTBEAT")
+            fflush(stdout)
+        }
+    }
+    
     private func startKeyboardMonitoring() {
         print("[DEBUG] Checking accessibility permissions...")
         
@@ -170,23 +221,17 @@ class RealMonitor {
         // 获取按键信息
         let keyCode = event.getIntegerValueField(.keyboardEventKeycode)
         let flags = event.flags
-        print("[DEBUG] Key code: \(keyCode), flags: \(flags.rawValue)")
         
         // 获取当前活跃应用
         let frontmostApp = NSWorkspace.shared.frontmostApplication
         let appName = frontmostApp?.localizedName ?? "Unknown"
         print("[DEBUG] Current app: \(appName)")
         
-        // 尝试获取输入的字符
-        var inputText = ""
-        if let cgEventSource = CGEventSource(stateID: .hidSystemState) {
-            let keyboardEvent = CGEvent(keyboardEventSource: cgEventSource, virtualKey: CGKeyCode(keyCode), keyDown: true)
-            if let eventString = keyboardEvent?.keyboardGetUnicodeString(maxStringLength: 10, actualStringLength: nil, unicodeString: nil) {
-                // 这里需要更复杂的字符提取逻辑
-                inputText = "Key: \(keyCode)"
-            }
-        }
-        print("[DEBUG] Input text: \(inputText)")
+        // 按键在当前键盘布局下产生的字符，方向键等功能键为私有区字符，由后端过滤
+        var length = 0
+        var chars = [UniChar](repeating: 0, count: 8)
+        event.keyboardGetUnicodeString(maxStringLength: chars.count, actualStringLength: &length, unicodeString: &chars)
+        let inputText = String(utf16CodeUnits: chars, count: length)
         
         // 输出键盘事件数据（JSON格式）
         let keyboardData: [String: Any] = [
@@ -262,15 +307,36 @@ class RealMonitor {
         }
     }
     
+    // outputEvent 把事件数据包装成协议信封输出，type 和 timestamp 之外的字段作为 payload
+    // 事件内容包含输入的文本，不能写入调试日志
     private func outputEvent(data: [String: Any]) {
-        print("[DEBUG] Preparing to output event data: \(data)")
-        fflush(stdout)
+        var payload = data
+        let type = payload.removeValue(forKey: "type") as? String ?? ""
+        let timestamp = payload.removeValue(forKey: "timestamp") as? String ?? ISO8601DateFormatter().string(from: Date())
+        
+        if let accepted = acceptedTypes, !accepted.contains(type) {
+            print("[DEBUG] Backend does not accept \(type) events, skipping")
+            fflush(stdout)
+            return
+        }
+        
+        sequence += 1
+        writeEnvelope(type: type, seq: sequence, timestamp: timestamp, payload: payload)
+    }
+    
+    private func writeEnvelope(type: String, seq: UInt64, timestamp: String, payload: [String: Any]) {
+        let envelope: [String: Any] = [
+            "v": protocolVersion,
+            "collector": "swift",
+            "seq": seq,
+            "type": type,
+            "ts": timestamp,
+            "payload": payload
+        ]
         
         do {
-            let jsonData = try JSONSerialization.data(withJSONObject: data, options: [])
+            let jsonData = try JSONSerialization.data(withJSONObject: envelope, options: [])
             if let jsonString = String(data: jsonData, encoding: .utf8) {
-                print("[DEBUG] JSON serialized successfully: \(jsonString)")
-                fflush(stdout)
                 print("YAML_EVENT: \(jsonString)")
                 fflush(stdout)
                 print("[DEBUG] Event output completed")
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedEvent 录制文件中的一行：事件来源产生的原始事件及其接收时间
+type RecordedEvent struct {
+	At     time.Time        `json:"at"`
+	Source string           `json:"source"`
+	Event  RealMonitorEvent `json:"event"`
+}
+
+// RecordingStatus 录制状态
+type RecordingStatus struct {
+	Recording bool      `json:"recording"`
+	Path      string    `json:"path,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	Events    int64     `json:"events"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Recorder 把事件逐行写入 JSONL 录制文件，供 ReplaySource 回放。
+// 录制文件包含明文的输入文本，权限为 0600
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	status RecordingStatus
+}
+
+// NewRecorder 创建录制文件并开始录制，文件已存在时返回错误
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	return &Recorder{
+		file: file,
+		enc:  json.NewEncoder(file),
+		status: RecordingStatus{
+			Recording: true,
+			Path:      path,
+			StartedAt: time.Now(),
+		},
+	}, nil
+}
+
+// Record 写入一个事件，写入失败时停止录制
+func (r *Recorder) Record(source string, event RealMonitorEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	if err := r.enc.Encode(RecordedEvent{At: time.Now(), Source: source, Event: event}); err != nil {
+		fmt.Printf("[ERROR] Failed to write recording %s: %v\n", r.status.Path, err)
+		r.status.LastError = err.Error()
+		r.close()
+		return
+	}
+	r.status.Events++
+}
+
+// Close 结束录制并关闭文件
+func (r *Recorder) Close() RecordingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.close()
+	return r.status
+}
+
+// Status 录制状态
+func (r *Recorder) Status() RecordingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// close 关闭文件（调用方需持有锁）
+func (r *Recorder) close() {
+	if r.file == nil {
+		return
+	}
+	if err := r.file.Close(); err != nil && r.status.LastError == "" {
+		r.status.LastError = err.Error()
+	}
+	r.file = nil
+	r.status.Recording = false
+}
@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReplayOptions 回放参数
+type ReplayOptions struct {
+	Speed  float64 // 回放速度倍数，1 为原速，0 表示不等待、立即回放全部事件
+	Rebase bool    // 把事件时间整体平移，使第一个事件发生在回放开始时；否则保留录制时的时间
+}
+
+// ReplaySource 回放 Recorder 录制的事件：按录制时的间隔（除以速度倍数）逐个产生事件，
+// 回放完毕后关闭事件通道。可以在没有 Swift 监控程序的机器上重现问题或演示界面
+type ReplaySource struct {
+	path   string
+	opts   ReplayOptions
+	health sourceHealth
+	mu     sync.Mutex
+	file   *os.File
+	events chan RealMonitorEvent
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// NewReplaySource 创建回放 path 的事件来源
+func NewReplaySource(path string, opts ReplayOptions) (*ReplaySource, error) {
+	if opts.Speed < 0 {
+		return nil, fmt.Errorf("replay speed must not be negative")
+	}
+	return &ReplaySource{path: path, opts: opts}, nil
+}
+
+// Name 来源名称，包含录制文件名
+func (s *ReplaySource) Name() string {
+	return SourceReplay + ":" + filepath.Base(s.path)
+}
+
+// Start 打开录制文件并开始回放
+func (s *ReplaySource) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		return fmt.Errorf("replay is already running")
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		s.health.failed(err)
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	s.file = file
+	s.events = make(chan RealMonitorEvent)
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	s.health.started()
+
+	go s.replay(file, s.events, s.quit, s.done)
+
+	fmt.Printf("Replaying %s (speed %gx, rebase %v)\n", s.path, s.opts.Speed, s.opts.Rebase)
+	return nil
+}
+
+// Stop 中止回放
+func (s *ReplaySource) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return
+	}
+	close(s.quit)
+	<-s.done
+	s.file = nil
+}
+
+// Events 本次回放的事件通道
+func (s *ReplaySource) Events() <-chan RealMonitorEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+// Health 回放状态，回放完毕后 Running 为 false
+func (s *ReplaySource) Health() SourceHealth {
+	return s.health.snapshot()
+}
+
+// replay 逐行读取录制文件并按录制时的间隔发送事件
+func (s *ReplaySource) replay(file *os.File, events chan<- RealMonitorEvent, quit, done chan struct{}) {
+	defer close(done)
+	defer close(events)
+	defer s.health.stopped()
+	defer file.Close()
+
+	start := time.Now()
+	var first time.Time      // 第一个事件的接收时间，用于计算回放间隔
+	var offset time.Duration // 事件时间的平移量，使第一个事件发生在回放开始时
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxSocketLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var recorded RecordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &recorded); err != nil {
+			fmt.Printf("[ERROR] Invalid event on line %d of %s: %v\n", line, s.path, err)
+			s.health.failed(fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		if first.IsZero() {
+			first = recorded.At
+			offset = start.Sub(eventTime(recorded))
+		}
+
+		// 按录制时的间隔等待
+		elapsed := recorded.At.Sub(first)
+		if s.opts.Speed > 0 {
+			if wait := time.Until(start.Add(time.Duration(float64(elapsed) / s.opts.Speed))); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-quit:
+					timer.Stop()
+					return
+				}
+			}
+		}
+
+		event := recorded.Event
+		if s.opts.Rebase {
+			event.Timestamp = eventTime(recorded).Add(offset).Format(time.RFC3339Nano)
+		}
+
+		select {
+		case events <- event:
+			s.health.received()
+		case <-quit:
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("[ERROR] Error reading recording %s: %v\n", s.path, err)
+		s.health.failed(err)
+		return
+	}
+	fmt.Printf("Replay of %s finished\n", s.path)
+}
+
+// eventTime 事件发生的时间，事件时间无法解析时以接收时间为准
+func eventTime(recorded RecordedEvent) time.Time {
+	at, err := time.Parse(time.RFC3339, recorded.Event.Timestamp)
+	if err != nil {
+		return recorded.At
+	}
+	return at
+}
@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"yaml-backend/internal/ingest"
+	"yaml-backend/pkg/models"
+)
+
+// DefaultIdleTimeout 两次输入事件间隔超过该时长视为空闲，空闲时间不计入使用时长
+const DefaultIdleTimeout = 5 * time.Minute
+
+// appSession 当前前台应用的会话
+type appSession struct {
+	appName  string
+	activity *models.Activity // 打开会话的 app_activation 活动记录，nil 表示没有
+	start    time.Time        // 当前片段的开始时间
+	lastSeen time.Time        // 最近一次事件的时间
+	active   time.Duration    // 已关闭片段的累计时长
+}
+
+// SessionTracker 将连续的 app_activation 事件转换为应用使用会话：
+// 切换应用、应用退出或停止监控时关闭会话，会话在空闲间隔和午夜处拆分后经队列写入 app_usage，
+// 并把会话的有效时长回填到打开它的活动记录的 Duration
+type SessionTracker struct {
+	queue       *ingest.Queue
+	idleTimeout time.Duration
+	mu          sync.Mutex
+	current     *appSession
+}
+
+// NewSessionTracker 创建会话跟踪器，idleTimeout <= 0 时使用 DefaultIdleTimeout
+func NewSessionTracker(queue *ingest.Queue, idleTimeout time.Duration) *SessionTracker {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &SessionTracker{
+		queue:       queue,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Activate 应用切换到前台：关闭上一个会话并为 appName 打开新会话
+func (t *SessionTracker) Activate(appName string, activity *models.Activity, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current != nil && t.current.appName == appName {
+		t.touch(at)
+		return
+	}
+
+	t.finish(at)
+	t.current = &appSession{appName: appName, activity: activity, start: at, lastSeen: at}
+}
+
+// Touch 记录前台应用中的用户输入，用于检测空闲间隔。
+// 还没有会话时（例如监控启动时应用已在前台）以 appName 打开一个新会话
+func (t *SessionTracker) Touch(appName string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		if appName != "" {
+			t.current = &appSession{appName: appName, start: at, lastSeen: at}
+		}
+		return
+	}
+	t.touch(at)
+}
+
+// End 应用退出，如果它是当前前台应用则关闭会话
+func (t *SessionTracker) End(appName string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current != nil && t.current.appName == appName {
+		t.finish(at)
+	}
+}
+
+// Flush 停止监控时关闭当前会话
+func (t *SessionTracker) Flush(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finish(at)
+}
+
+// touch 更新最近事件时间，距上次事件超过空闲阈值时先关闭当前片段再开始新片段（调用方需持有锁）
+func (t *SessionTracker) touch(at time.Time) {
+	session := t.current
+	if at.Before(session.lastSeen) {
+		return
+	}
+
+	if at.Sub(session.lastSeen) > t.idleTimeout {
+		t.closeSegment(session, session.lastSeen)
+		session.start = at
+	}
+	session.lastSeen = at
+}
+
+// finish 关闭当前会话并回填活动记录的持续时间（调用方需持有锁）
+func (t *SessionTracker) finish(at time.Time) {
+	session := t.current
+	if session == nil {
+		return
+	}
+	t.current = nil
+
+	// 最后一次事件之后空闲过久时，会话在最后一次事件处结束
+	end := at
+	if end.Sub(session.lastSeen) > t.idleTimeout {
+		end = session.lastSeen
+	}
+	t.closeSegment(session, end)
+
+	if session.activity != nil {
+		t.queue.SetActivityDuration(session.activity, int64(session.active/time.Second))
+	}
+}
+
+// closeSegment 将 [session.start, end) 按本地午夜拆分后写入 app_usage
+func (t *SessionTracker) closeSegment(session *appSession, end time.Time) {
+	start := session.start
+	for start.Before(end) {
+		pieceEnd := end
+		if midnight := nextMidnight(start); midnight.Before(end) {
+			pieceEnd = midnight
+		}
+
+		duration := pieceEnd.Sub(start)
+		session.active += duration
+
+		t.queue.AddAppUsage(&models.AppUsage{
+			AppName:   session.appName,
+			StartTime: start,
+			EndTime:   pieceEnd,
+			Duration:  int64(duration / time.Second),
+		})
+
+		start = pieceEnd
+	}
+	session.start = end
+}
+
+// nextMidnight 返回 t 之后的下一个本地午夜
+func nextMidnight(t time.Time) time.Time {
+	local := t.In(time.Local)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, time.Local)
+}
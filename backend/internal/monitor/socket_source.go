@@ -0,0 +1,305 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 套接字协议参数
+const (
+	socketFileMode         = 0o600 // 只有运行后端的用户可以连接
+	socketHandshakeTimeout = 5 * time.Second
+	maxSocketLine          = 1 << 20 // 单行事件的最大字节数
+)
+
+// socketHandshake 旧版客户端连接后发送的第一行，不协商协议
+type socketHandshake struct {
+	Client string `json:"client"`
+}
+
+// socketReply 服务端对握手的回复
+type socketReply struct {
+	OK    bool   `json:"ok,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SocketSource 在本地 Unix 套接字上接收外部采集程序（浏览器助手、编辑器插件、shell 钩子等）推送的事件。
+// 客户端连接后先发送 hello 信封，收到 welcome 后逐行发送事件信封（见 Envelope）；
+// 旧版客户端发送 {"client":"名称"}，收到 {"ok":true} 后逐行发送 RealMonitorEvent JSON。
+// 套接字文件权限为 0600，只有运行后端的用户可以连接。
+// 事件通道不带缓冲，写入队列已满时读取随之暂停，背压经套接字传递给客户端
+type SocketSource struct {
+	path     string
+	health   sourceHealth
+	protocol protocolStats
+	mu       sync.Mutex
+	listener net.Listener
+	events   chan RealMonitorEvent
+	quit     chan struct{}
+	conns    map[net.Conn]string // 连接 -> 客户端名称
+	wg       sync.WaitGroup      // 接受连接和处理连接的协程
+}
+
+// NewSocketSource 创建监听 path 的套接字事件来源
+func NewSocketSource(path string) *SocketSource {
+	return &SocketSource{path: path}
+}
+
+// Name 来源名称
+func (s *SocketSource) Name() string {
+	return SourceSocket
+}
+
+// Start 创建套接字文件并开始接受连接
+func (s *SocketSource) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return fmt.Errorf("socket source is already running")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := removeStaleSocket(s.path); err != nil {
+		s.health.failed(err)
+		return err
+	}
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		s.health.failed(err)
+		return fmt.Errorf("failed to listen on %s: %w", s.path, err)
+	}
+	if err := os.Chmod(s.path, socketFileMode); err != nil {
+		listener.Close()
+		s.health.failed(err)
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	s.listener = listener
+	s.events = make(chan RealMonitorEvent)
+	s.quit = make(chan struct{})
+	s.conns = make(map[net.Conn]string)
+	s.health.started()
+	s.protocol.reset()
+
+	s.wg.Add(1)
+	go s.accept(listener)
+
+	fmt.Printf("Listening for collector events on %s\n", s.path)
+	return nil
+}
+
+// Stop 停止接受连接，断开所有客户端，关闭监听时删除套接字文件
+func (s *SocketSource) Stop() {
+	s.mu.Lock()
+	if s.listener == nil {
+		s.mu.Unlock()
+		return
+	}
+	close(s.quit)
+	s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.listener = nil
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	close(s.events)
+	s.health.stopped()
+}
+
+// Events 本次运行的事件通道
+func (s *SocketSource) Events() <-chan RealMonitorEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+// Health 套接字的运行状态，Clients 为当前连接的客户端名称
+func (s *SocketSource) Health() SourceHealth {
+	health := s.health.snapshot()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		for _, client := range s.conns {
+			if client != "" {
+				health.Clients = append(health.Clients, client)
+			}
+		}
+		sort.Strings(health.Clients)
+	}
+	health.Protocol = s.protocol.snapshot()
+	return health
+}
+
+// removeStaleSocket 删除上次运行遗留的套接字文件，套接字仍在使用或路径不是套接字时返回错误
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// accept 接受连接直到监听关闭
+func (s *SocketSource) accept(listener net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+			default:
+				fmt.Printf("[ERROR] Failed to accept collector connection: %v\n", err)
+				s.health.failed(err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		select {
+		case <-s.quit:
+			s.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conns[conn] = ""
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// serve 处理一个客户端连接：握手后逐行读取事件
+func (s *SocketSource) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxSocketLine)
+
+	client, decoder, err := s.handshake(conn, scanner)
+	if err != nil {
+		fmt.Printf("[ERROR] Collector handshake failed: %v\n", err)
+		json.NewEncoder(conn).Encode(socketReply{Error: err.Error()})
+		return
+	}
+
+	fmt.Printf("Collector %s connected\n", client)
+	defer fmt.Printf("Collector %s disconnected\n", client)
+
+	for scanner.Scan() {
+		event, welcome, ok := decoder.decode(scanner.Bytes())
+		if welcome != nil {
+			// 连接中重新握手
+			conn.Write(welcomeLine(*welcome))
+		}
+		if !ok {
+			continue
+		}
+		s.health.received()
+
+		select {
+		case s.events <- event:
+		case <-s.quit:
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		select {
+		case <-s.quit:
+		default:
+			fmt.Printf("[ERROR] Error reading events from %s: %v\n", client, err)
+			s.health.failed(fmt.Errorf("%s: %w", client, err))
+		}
+	}
+}
+
+// handshake 读取 hello 信封并回复 welcome，旧版客户端读取客户端名称并回复确认
+func (s *SocketSource) handshake(conn net.Conn, scanner *bufio.Scanner) (string, *protocolDecoder, error) {
+	conn.SetReadDeadline(time.Now().Add(socketHandshakeTimeout))
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", nil, err
+		}
+		return "", nil, errors.New("connection closed before handshake")
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var env Envelope
+	if err := json.Unmarshal(scanner.Bytes(), &env); err != nil {
+		s.protocol.invalid(invalidHello, err)
+		return "", nil, fmt.Errorf("invalid handshake: %w", err)
+	}
+
+	decoder := newProtocolDecoder(&s.protocol)
+	var client string
+	var reply []byte
+	if env.Version == 0 {
+		var handshake socketHandshake
+		json.Unmarshal(scanner.Bytes(), &handshake)
+		if handshake.Client == "" {
+			s.protocol.invalid(invalidHello, errors.New("handshake without client name"))
+			return "", nil, errors.New("handshake must include a client name")
+		}
+		client = handshake.Client
+		reply, _ = json.Marshal(socketReply{OK: true})
+		reply = append(reply, '\n')
+	} else {
+		if env.Type != envelopeHello {
+			s.protocol.invalid(invalidHello, fmt.Errorf("first message is %q", env.Type))
+			return "", nil, errors.New("first message must be a hello")
+		}
+		welcome, err := decoder.hello(env)
+		if err != nil {
+			s.protocol.invalid(invalidHello, err)
+			return "", nil, err
+		}
+		client = env.Collector
+		reply = welcomeLine(welcome)
+	}
+
+	if _, err := conn.Write(reply); err != nil {
+		return "", nil, err
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = client
+	s.mu.Unlock()
+	return client, decoder, nil
+}
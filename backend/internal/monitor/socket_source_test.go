@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startSocket 在临时目录的套接字上启动来源，测试结束时停止。
+// 套接字路径有长度限制，不使用 t.TempDir 较长的路径
+func startSocket(t *testing.T) (*SocketSource, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "yaml-sock")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "events.sock")
+	s := NewSocketSource(path)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	return s, path
+}
+
+// dialSocket 连接套接字，发送握手行并返回回复
+func dialSocket(t *testing.T, path, handshake string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte(handshake + "\n")); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read handshake reply: %v", err)
+	}
+	return conn, reader, reply
+}
+
+// receive 从来源读取一个事件
+func receive(t *testing.T, s *SocketSource) RealMonitorEvent {
+	t.Helper()
+	select {
+	case event := <-s.Events():
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return RealMonitorEvent{}
+	}
+}
+
+func TestSocketSourceEnvelope(t *testing.T) {
+	s, path := startSocket(t)
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Lstat: %v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != socketFileMode {
+		t.Errorf("socket mode = %v, want a socket with %v", info.Mode(), os.FileMode(socketFileMode))
+	}
+
+	conn, reader, reply := dialSocket(t, path, helloLine("[1]", `["keyboard"]`))
+	var env Envelope
+	var welcome Welcome
+	if err := json.Unmarshal([]byte(reply), &env); err != nil || env.Type != envelopeWelcome {
+		t.Fatalf("handshake reply = %q, want a welcome envelope", reply)
+	}
+	if err := json.Unmarshal(env.Payload, &welcome); err != nil || !reflect.DeepEqual(welcome, Welcome{Version: 1, Types: []string{EventKeyboard}}) {
+		t.Errorf("welcome = %+v, want version 1 with keyboard events", welcome)
+	}
+
+	if _, err := conn.Write([]byte(keyLine(1, 1) + "\n")); err != nil {
+		t.Fatalf("write event: %v", err)
+	}
+	if event := receive(t, s); event.Type != EventKeyboard || event.Text != "k1" || event.AppName != "Code" {
+		t.Errorf("event = %+v, want the keyboard event k1", event)
+	}
+
+	health := s.Health()
+	if !health.Running || health.Events != 1 || !reflect.DeepEqual(health.Clients, []string{"c1"}) {
+		t.Errorf("health = running %v, %d events, clients %v; want running, 1 event, client c1", health.Running, health.Events, health.Clients)
+	}
+	if health.Protocol.Accepted != 1 || health.Protocol.Collector != "c1" {
+		t.Errorf("protocol stats = %+v, want 1 accepted event from c1", *health.Protocol)
+	}
+
+	s.Stop()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still exists after Stop: %v", err)
+	}
+	if _, open := <-s.Events(); open {
+		t.Error("events channel is still open after Stop")
+	}
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Error("client connection is still open after Stop")
+	}
+	if health := s.Health(); health.Running || len(health.Clients) != 0 {
+		t.Errorf("health after Stop = running %v, clients %v", health.Running, health.Clients)
+	}
+}
+
+func TestSocketSourceLegacyHandshake(t *testing.T) {
+	s, path := startSocket(t)
+
+	conn, _, reply := dialSocket(t, path, `{"client":"shell"}`)
+	if reply != `{"ok":true}`+"\n" {
+		t.Fatalf("handshake reply = %q, want ok", reply)
+	}
+
+	line := `{"type":"app_activation","app_name":"Terminal","timestamp":"` + testTimestamp + `"}`
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatalf("write event: %v", err)
+	}
+	if event := receive(t, s); event.Type != EventAppActivation || event.AppName != "Terminal" {
+		t.Errorf("event = %+v, want the legacy app activation", event)
+	}
+
+	health := s.Health()
+	if !reflect.DeepEqual(health.Clients, []string{"shell"}) || health.Protocol.Legacy != 1 {
+		t.Errorf("clients %v with %d legacy events, want client shell with 1", health.Clients, health.Protocol.Legacy)
+	}
+}
+
+func TestSocketSourceRejectsInvalidHandshake(t *testing.T) {
+	s, path := startSocket(t)
+
+	for _, handshake := range []string{`{}`, keyLine(1, 1), helloLine("[9]", "")} {
+		_, reader, reply := dialSocket(t, path, handshake)
+		var r socketReply
+		if err := json.Unmarshal([]byte(reply), &r); err != nil || r.OK || r.Error == "" {
+			t.Errorf("reply to %s = %q, want an error", handshake, reply)
+		}
+		if _, err := reader.ReadString('\n'); err == nil {
+			t.Errorf("connection stays open after handshake %s", handshake)
+		}
+	}
+
+	if invalid := s.Health().Protocol.Invalid[invalidHello]; invalid != 3 {
+		t.Errorf("invalid hellos = %d, want 3", invalid)
+	}
+}
+
+// 上次运行遗留的套接字文件被删除后重新监听，正在使用的套接字不能被抢占
+func TestSocketSourceStaleSocket(t *testing.T) {
+	s, path := startSocket(t)
+
+	if err := NewSocketSource(path).Start(); err == nil {
+		t.Error("started a second source on a socket in use")
+	}
+
+	s.Stop()
+	// 模拟异常退出留下的套接字文件
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	restarted := NewSocketSource(path)
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start over a stale socket: %v", err)
+	}
+	restarted.Stop()
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 事件来源名称，对应配置中的 monitor.sources
+const (
+	SourceSwift  = "swift"  // macOS Swift 监控程序
+	SourceSocket = "socket" // 本地 Unix 套接字，接收外部采集程序推送的事件
+	SourceReplay = "replay" // 回放录制文件，只能通过 API 或命令行参数启用
+)
+
+// SourceOptions 创建事件来源的参数
+type SourceOptions struct {
+	Swift      SwiftOptions // swift 来源的进程参数
+	SocketPath string       // socket 来源监听的套接字文件路径
+}
+
+// EventSource 监控事件的来源。Manager 启动监控时依次启动所有来源，
+// 把各来源 Events 通道中的事件汇入同一个处理流程（输入片段、应用会话和写入队列）
+type EventSource interface {
+	// Name 来源名称，用于日志和状态
+	Name() string
+	// Start 开始产生事件，返回后 Events 返回本次运行的事件通道
+	Start() error
+	// Stop 停止产生事件，返回前关闭事件通道，通道中已有的事件仍可读出
+	Stop()
+	// Events 事件通道，来源停止或异常退出时关闭
+	Events() <-chan RealMonitorEvent
+	// Health 来源的运行状态
+	Health() SourceHealth
+}
+
+// SourceHealth 事件来源的运行状态
+type SourceHealth struct {
+	Running   bool           `json:"running"`
+	Events    int64          `json:"events"`               // 本次启动以来产生的事件数
+	LastEvent time.Time      `json:"last_event,omitempty"` // 最近一次事件的接收时间
+	LastError string         `json:"last_error,omitempty"` // 最近一次异常，重新启动时清空
+	Clients   []string       `json:"clients,omitempty"`    // 当前连接的客户端（socket 来源）
+	Process   *ProcessHealth `json:"process,omitempty"`    // 监控子进程的状态（swift 来源）
+	Protocol  *ProtocolStats `json:"protocol,omitempty"`   // 事件协议的握手和校验统计（swift 和 socket 来源）
+}
+
+// SourceStatus 带名称的事件来源状态
+type SourceStatus struct {
+	Name string `json:"name"`
+	SourceHealth
+}
+
+// NewSource 按名称创建事件来源
+func NewSource(name string, opts SourceOptions) (EventSource, error) {
+	switch name {
+	case SourceSwift:
+		return NewSwiftSource(opts.Swift), nil
+	case SourceSocket:
+		if opts.SocketPath == "" {
+			return nil, fmt.Errorf("socket event source requires a socket path")
+		}
+		return NewSocketSource(opts.SocketPath), nil
+	default:
+		return nil, fmt.Errorf("unknown event source %q", name)
+	}
+}
+
+// sourceHealth 供事件来源记录运行状态，并发安全
+type sourceHealth struct {
+	mu     sync.Mutex
+	health SourceHealth
+}
+
+// started 来源启动，清空上次运行的统计
+func (h *sourceHealth) started() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.health = SourceHealth{Running: true}
+}
+
+// received 记录一个事件
+func (h *sourceHealth) received() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.health.Events++
+	h.health.LastEvent = time.Now()
+}
+
+// failed 记录异常，不改变运行状态
+func (h *sourceHealth) failed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.health.LastError = err.Error()
+}
+
+// stopped 来源停止
+func (h *sourceHealth) stopped() {
+	h.running(false)
+}
+
+// running 更新运行状态，不清空统计（例如子进程重启）
+func (h *sourceHealth) running(running bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.health.Running = running
+}
+
+func (h *sourceHealth) snapshot() SourceHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.health
+}
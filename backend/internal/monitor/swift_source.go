@@ -0,0 +1,449 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Swift 监控进程的默认参数
+const (
+	DefaultHeartbeatTimeout = 30 * time.Second
+	DefaultMinBackoff       = time.Second
+	DefaultMaxBackoff       = time.Minute
+	swiftEventBuffer        = 256 // 事件通道的容量
+	maxStderrLines          = 20  // 保留的最近错误输出行数
+)
+
+// Swift 监控程序输出的行前缀
+const (
+	swiftEventPrefix = "YAML_EVENT: "
+	swiftHeartbeat   = "YAML_HEARTBEAT"
+)
+
+// SwiftOptions Swift 监控进程的参数，零值字段使用默认值
+type SwiftOptions struct {
+	Dir              string        // 后端目录，Swift 源文件位于其下的 internal/monitor，为空时使用启动时的工作目录
+	Binary           string        // 直接运行的监控程序，设置后不编译 Swift 源文件（例如测试用的假程序）
+	HeartbeatTimeout time.Duration // 超过该时长没有心跳和事件时结束进程并重启
+	MinBackoff       time.Duration // 第一次重启前的等待时长，之后每次加倍
+	MaxBackoff       time.Duration // 重启等待时长的上限，进程连续运行超过该时长后等待时长恢复为 MinBackoff
+}
+
+// ProcessHealth 监控子进程的运行状态
+type ProcessHealth struct {
+	PID           int       `json:"pid,omitempty"`
+	StartedAt     time.Time `json:"started_at,omitempty"`
+	LastHeartbeat time.Time `json:"last_heartbeat,omitempty"` // 最近一次收到心跳或事件的时间
+	Restarts      int       `json:"restarts"`
+	LastExitCode  *int      `json:"last_exit_code,omitempty"` // 被信号结束时为 -1
+	LastExitAt    time.Time `json:"last_exit_at,omitempty"`
+	NextRestartAt time.Time `json:"next_restart_at,omitempty"` // 等待重启时非零
+	Stderr        []string  `json:"stderr,omitempty"`          // 最近的错误输出
+}
+
+// SwiftSource 编译并运行 macOS Swift 监控程序，解析其标准输出中以 "YAML_EVENT: " 开头的事件行：
+// 进程启动时输出 hello 信封，后端经标准输入回复 welcome，之后每行一个事件信封（旧版程序直接输出 RealMonitorEvent）。
+// 进程异常退出或超过 HeartbeatTimeout 没有输出心跳和事件时，按指数退避重启进程
+type SwiftSource struct {
+	opts     SwiftOptions
+	health   sourceHealth
+	protocol protocolStats
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	events   chan RealMonitorEvent
+	done     chan struct{} // 监督协程退出后关闭
+
+	procMu sync.Mutex
+	proc   ProcessHealth
+}
+
+// NewSwiftSource 创建 Swift 事件来源
+func NewSwiftSource(opts SwiftOptions) *SwiftSource {
+	if opts.HeartbeatTimeout <= 0 {
+		opts.HeartbeatTimeout = DefaultHeartbeatTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(DefaultMaxBackoff, opts.MinBackoff)
+	}
+	return &SwiftSource{opts: opts}
+}
+
+// Name 来源名称
+func (s *SwiftSource) Name() string {
+	return SourceSwift
+}
+
+// Start 编译（源文件有更新时）并启动 Swift 监控进程，之后由监督协程在进程退出时重启
+func (s *SwiftSource) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return fmt.Errorf("swift source is already running")
+	}
+
+	dir := s.opts.Dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		dir = wd
+	}
+
+	binary := s.opts.Binary
+	if binary == "" {
+		// 编译Swift监控程序
+		fmt.Println("[DEBUG] Compiling Swift monitor...")
+		if err := compileSwiftMonitor(dir); err != nil {
+			fmt.Printf("[ERROR] Failed to compile Swift monitor: %v\n", err)
+			s.health.failed(err)
+			return fmt.Errorf("failed to compile Swift monitor: %w", err)
+		}
+		binary = filepath.Join(dir, "internal", "monitor", "real_monitor")
+	}
+
+	s.procMu.Lock()
+	s.proc = ProcessHealth{}
+	s.procMu.Unlock()
+	s.protocol.reset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.events = make(chan RealMonitorEvent, swiftEventBuffer)
+	run, err := s.launch(ctx, binary, dir)
+	if err != nil {
+		cancel()
+		fmt.Printf("[ERROR] Failed to start Swift monitor process: %v\n", err)
+		s.health.failed(err)
+		return fmt.Errorf("failed to start Swift monitor process: %w", err)
+	}
+	s.health.started()
+
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.supervise(ctx, binary, dir, run)
+
+	fmt.Println("[SUCCESS] Swift monitor process started successfully")
+	return nil
+}
+
+// Stop 结束 Swift 监控进程并停止重启，等待已输出的事件处理完
+func (s *SwiftSource) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+}
+
+// Events 本次运行的事件通道，进程重启时不变
+func (s *SwiftSource) Events() <-chan RealMonitorEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+// Health Swift 监控进程的运行状态，等待重启时 Running 为 false
+func (s *SwiftSource) Health() SourceHealth {
+	health := s.health.snapshot()
+
+	s.procMu.Lock()
+	defer s.procMu.Unlock()
+	proc := s.proc
+	proc.Stderr = append([]string(nil), s.proc.Stderr...)
+	health.Process = &proc
+	health.Protocol = s.protocol.snapshot()
+	return health
+}
+
+// compileSwiftMonitor 编译Swift监控程序
+func compileSwiftMonitor(dir string) error {
+	// 构建Swift源文件路径（相对于后端目录）
+	swiftFile := filepath.Join(dir, "internal", "monitor", "real_monitor.swift")
+	outputFile := filepath.Join(dir, "internal", "monitor", "real_monitor")
+
+	// 检查Swift文件是否存在
+	if _, err := os.Stat(swiftFile); os.IsNotExist(err) {
+		return fmt.Errorf("Swift monitor file not found: %s", swiftFile)
+	}
+
+	// 检查是否已经编译过，源文件更新后重新编译
+	if info, err := os.Stat(outputFile); err == nil {
+		if source, err := os.Stat(swiftFile); err == nil && !source.ModTime().After(info.ModTime()) {
+			fmt.Println("Swift monitor already compiled, skipping compilation")
+			return nil
+		}
+	}
+
+	// 编译Swift程序
+	cmd := exec.Command("swiftc", "-o", outputFile, swiftFile)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Swift compilation failed: %s\nOutput: %s", err, string(output))
+	}
+
+	fmt.Println("Swift monitor compiled successfully")
+	return nil
+}
+
+// swiftRun 一次运行的监控进程
+type swiftRun struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser // 握手回复
+	stdout  io.Reader
+	stderr  io.Reader
+	started time.Time
+}
+
+// launch 启动一次监控进程
+func (s *SwiftSource) launch(ctx context.Context, binary, dir string) (*swiftRun, error) {
+	// 检查监控程序是否存在
+	if _, err := os.Stat(binary); err != nil {
+		return nil, fmt.Errorf("Swift monitor not found: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Dir = dir
+
+	// 设置环境变量，确保输出不被缓冲
+	cmd.Env = append(os.Environ(), "NSUnbufferedIO=YES")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start Swift process: %w", err)
+	}
+	fmt.Printf("[DEBUG] Swift process started with PID: %d\n", cmd.Process.Pid)
+
+	now := time.Now()
+	s.procMu.Lock()
+	s.proc.PID = cmd.Process.Pid
+	s.proc.StartedAt = now
+	s.proc.LastHeartbeat = now
+	s.proc.NextRestartAt = time.Time{}
+	s.procMu.Unlock()
+	s.health.running(true)
+
+	return &swiftRun{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr, started: now}, nil
+}
+
+// supervise 等待监控进程退出，停止前按指数退避重启
+func (s *SwiftSource) supervise(ctx context.Context, binary, dir string, run *swiftRun) {
+	defer close(s.done)
+	defer close(s.events)
+	defer func() {
+		s.procMu.Lock()
+		s.proc.PID = 0
+		s.proc.NextRestartAt = time.Time{}
+		s.procMu.Unlock()
+		s.health.running(false)
+	}()
+
+	backoff := s.opts.MinBackoff
+	for {
+		if run != nil {
+			s.wait(ctx, run)
+			if ctx.Err() != nil {
+				return
+			}
+			// 稳定运行一段时间后的退出不累积等待时长
+			if time.Since(run.started) >= s.opts.MaxBackoff {
+				backoff = s.opts.MinBackoff
+			}
+		}
+
+		s.procMu.Lock()
+		s.proc.NextRestartAt = time.Now().Add(backoff)
+		s.procMu.Unlock()
+		fmt.Printf("[ERROR] Swift monitor stopped, restarting in %v\n", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		backoff = min(backoff*2, s.opts.MaxBackoff)
+
+		s.procMu.Lock()
+		s.proc.Restarts++
+		s.procMu.Unlock()
+
+		var err error
+		if run, err = s.launch(ctx, binary, dir); err != nil {
+			fmt.Printf("[ERROR] Failed to restart Swift monitor: %v\n", err)
+			s.health.failed(err)
+		}
+	}
+}
+
+// wait 处理进程的输出直到进程退出，超过心跳超时没有输出心跳和事件时结束进程
+func (s *SwiftSource) wait(ctx context.Context, run *swiftRun) {
+	beats := make(chan struct{}, 1)
+	exited := make(chan struct{})
+	var stalled atomic.Bool
+
+	// 心跳检测
+	go func() {
+		timer := time.NewTimer(s.opts.HeartbeatTimeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-beats:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(s.opts.HeartbeatTimeout)
+			case <-timer.C:
+				stalled.Store(true)
+				fmt.Printf("[ERROR] No heartbeat from Swift monitor for %v, killing it\n", s.opts.HeartbeatTimeout)
+				run.cmd.Process.Kill()
+				return
+			case <-exited:
+				return
+			}
+		}
+	}()
+
+	// stderr 先读完，再由 Wait 关闭管道
+	var stderrDone sync.WaitGroup
+	stderrDone.Add(1)
+	go func() {
+		defer stderrDone.Done()
+		s.handleErrors(run.stderr)
+	}()
+
+	s.handleOutput(ctx, run, beats)
+	stderrDone.Wait()
+	err := run.cmd.Wait()
+	close(exited)
+
+	if ctx.Err() != nil {
+		// 停止时进程被结束属于正常退出
+		return
+	}
+
+	code := run.cmd.ProcessState.ExitCode()
+	s.procMu.Lock()
+	s.proc.PID = 0
+	s.proc.LastExitCode = &code
+	s.proc.LastExitAt = time.Now()
+	s.procMu.Unlock()
+	s.health.running(false)
+
+	switch {
+	case stalled.Load():
+		s.health.failed(fmt.Errorf("no heartbeat for %v", s.opts.HeartbeatTimeout))
+	case err != nil:
+		fmt.Printf("[ERROR] Swift monitor exited: %v\n", err)
+		s.health.failed(err)
+	default:
+		s.health.failed(errors.New("swift monitor exited"))
+	}
+}
+
+// handleOutput 处理Swift程序的输出，把事件行解析后发送到事件通道，心跳和事件都通知 beats
+func (s *SwiftSource) handleOutput(ctx context.Context, run *swiftRun, beats chan<- struct{}) {
+	// 每次启动的进程重新握手，序号从头开始
+	decoder := newProtocolDecoder(&s.protocol)
+	scanner := bufio.NewScanner(run.stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == swiftHeartbeat {
+			s.beat(beats)
+			continue
+		}
+		// 其他输出是监控程序的调试日志，可能带有事件内容，不转发到服务器日志
+		if !strings.HasPrefix(line, swiftEventPrefix) {
+			continue
+		}
+
+		s.beat(beats)
+		event, welcome, ok := decoder.decode([]byte(strings.TrimPrefix(line, swiftEventPrefix)))
+		if welcome != nil {
+			if _, err := run.stdin.Write(welcomeLine(*welcome)); err != nil {
+				fmt.Printf("[ERROR] Failed to send welcome to Swift monitor: %v\n", err)
+			}
+		}
+		if !ok {
+			continue
+		}
+		s.health.received()
+
+		select {
+		case s.events <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		fmt.Printf("[ERROR] Error reading Swift output: %v\n", err)
+		s.health.failed(err)
+	}
+}
+
+// beat 记录心跳
+func (s *SwiftSource) beat(beats chan<- struct{}) {
+	s.procMu.Lock()
+	s.proc.LastHeartbeat = time.Now()
+	s.procMu.Unlock()
+
+	select {
+	case beats <- struct{}{}:
+	default:
+	}
+}
+
+// handleErrors 处理Swift程序的错误输出，保留最近的若干行
+func (s *SwiftSource) handleErrors(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Printf("Swift Monitor Error: %s\n", line)
+
+		s.procMu.Lock()
+		s.proc.Stderr = append(s.proc.Stderr, line)
+		if len(s.proc.Stderr) > maxStderrLines {
+			s.proc.Stderr = s.proc.Stderr[len(s.proc.Stderr)-maxStderrLines:]
+		}
+		s.procMu.Unlock()
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Error reading Swift errors: %v\n", err)
+	}
+}
@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChild 写入代替 Swift 监控程序运行的 shell 脚本
+func fakeChild(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fake_monitor")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("write fake child: %v", err)
+	}
+	return path
+}
+
+// startFake 用假程序启动 Swift 来源，测试结束时停止
+func startFake(t *testing.T, opts SwiftOptions) *SwiftSource {
+	t.Helper()
+	opts.Dir = t.TempDir()
+	s := NewSwiftSource(opts)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// waitProcess 轮询进程状态直到满足条件，超时则失败
+func waitProcess(t *testing.T, s *SwiftSource, what string, cond func(SourceHealth, ProcessHealth) bool) ProcessHealth {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		health := s.Health()
+		if cond(health, *health.Process) {
+			return *health.Process
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s: %+v", what, *health.Process)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+// 进程崩溃后按指数退避重启，状态中记录退出码、错误输出和重启次数
+func TestSwiftSourceRestartsCrashedChildWithBackoff(t *testing.T) {
+	const minBackoff = 20 * time.Millisecond
+	s := startFake(t, SwiftOptions{
+		Binary:     fakeChild(t, "echo crashed >&2\nexit 3"),
+		MinBackoff: minBackoff,
+		MaxBackoff: time.Second,
+	})
+
+	// 记录每次启动的时间，第 i 次重启前至少等待 minBackoff << (i-1)
+	starts := []time.Time{s.Health().Process.StartedAt}
+	waitProcess(t, s, "three restarts", func(_ SourceHealth, proc ProcessHealth) bool {
+		if !proc.StartedAt.Equal(starts[len(starts)-1]) {
+			starts = append(starts, proc.StartedAt)
+		}
+		return proc.Restarts >= 3
+	})
+	for i := 1; i < len(starts); i++ {
+		if gap, want := starts[i].Sub(starts[i-1]), minBackoff<<(i-1); gap < want {
+			t.Errorf("restart %d came %v after the previous start, want at least %v", i, gap, want)
+		}
+	}
+
+	proc := waitProcess(t, s, "a pending restart", func(health SourceHealth, proc ProcessHealth) bool {
+		return !health.Running && proc.PID == 0 && !proc.NextRestartAt.IsZero()
+	})
+	if proc.LastExitCode == nil || *proc.LastExitCode != 3 {
+		t.Errorf("LastExitCode = %v, want 3", proc.LastExitCode)
+	}
+	if proc.LastExitAt.IsZero() || proc.NextRestartAt.Before(proc.LastExitAt) {
+		t.Errorf("NextRestartAt %v should follow LastExitAt %v", proc.NextRestartAt, proc.LastExitAt)
+	}
+	if len(proc.Stderr) == 0 || proc.Stderr[len(proc.Stderr)-1] != "crashed" {
+		t.Errorf("Stderr = %q, want the child's error output", proc.Stderr)
+	}
+	if health := s.Health(); health.LastError == "" {
+		t.Error("LastError is empty after the child crashed")
+	}
+}
+
+// 进程停止输出心跳后被结束并重启
+func TestSwiftSourceRestartsStalledChild(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	s := startFake(t, SwiftOptions{
+		Binary:           fakeChild(t, "echo "+swiftHeartbeat+"\nexec sleep 30"),
+		HeartbeatTimeout: timeout,
+		MinBackoff:       10 * time.Millisecond,
+		MaxBackoff:       time.Second,
+	})
+	started := s.Health().Process.StartedAt
+
+	proc := waitProcess(t, s, "a restart after the heartbeat stalled", func(_ SourceHealth, proc ProcessHealth) bool {
+		return proc.Restarts >= 1 && proc.PID != 0
+	})
+	if proc.LastExitCode == nil || *proc.LastExitCode != -1 {
+		t.Errorf("LastExitCode = %v, want -1 for a killed process", proc.LastExitCode)
+	}
+	if lived := proc.LastExitAt.Sub(started); lived < timeout {
+		t.Errorf("stalled child was killed after %v, want at least the heartbeat timeout %v", lived, timeout)
+	}
+	if health := s.Health(); !strings.Contains(health.LastError, "no heartbeat") {
+		t.Errorf("LastError = %q, want a heartbeat timeout", health.LastError)
+	}
+}
+
+// 持续输出心跳的进程不重启，状态中有进程号、启动时间和最近心跳；停止后进程号清零
+func TestSwiftSourceReportsHealthyChild(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	s := startFake(t, SwiftOptions{
+		Binary:           fakeChild(t, "while true; do echo "+swiftHeartbeat+"; sleep 0.02; done"),
+		HeartbeatTimeout: timeout,
+		MinBackoff:       10 * time.Millisecond,
+	})
+
+	time.Sleep(3 * timeout)
+	health := s.Health()
+	proc := *health.Process
+	if !health.Running || proc.PID == 0 {
+		t.Errorf("Running = %v, PID = %d, want a running child", health.Running, proc.PID)
+	}
+	if proc.Restarts != 0 || proc.LastExitCode != nil {
+		t.Errorf("Restarts = %d, LastExitCode = %v, want no restarts", proc.Restarts, proc.LastExitCode)
+	}
+	if !proc.LastHeartbeat.After(proc.StartedAt) || time.Since(proc.LastHeartbeat) > timeout {
+		t.Errorf("LastHeartbeat %v is stale, started at %v", proc.LastHeartbeat, proc.StartedAt)
+	}
+
+	s.Stop()
+	health = s.Health()
+	if health.Running || health.Process.PID != 0 || !health.Process.NextRestartAt.IsZero() {
+		t.Errorf("after Stop: Running = %v, PID = %d, NextRestartAt = %v", health.Running, health.Process.PID, health.Process.NextRestartAt)
+	}
+	if _, open := <-s.Events(); open {
+		t.Error("events channel is still open after Stop")
+	}
+}
@@ -0,0 +1,158 @@
+package retention
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+)
+
+// DefaultInterval 默认的清理周期
+const DefaultInterval = time.Hour
+
+// vacuumer 支持回收磁盘空间的存储后端（SQLiteStorage）
+type vacuumer interface {
+	Vacuum() error
+}
+
+// Report 一次清理任务的执行报告
+type Report struct {
+	*storage.PruneResult
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Vacuumed   bool      `json:"vacuumed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Worker 按 database.retention_days 定期清理过期数据的后台任务
+type Worker struct {
+	storage       storage.Store
+	retentionDays int
+	interval      time.Duration
+
+	mu         sync.RWMutex
+	runMu      sync.Mutex
+	lastReport *Report
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+// NewWorker 创建清理任务，retentionDays <= 0 表示永久保留
+func NewWorker(storage storage.Store, retentionDays int, interval time.Duration) *Worker {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Worker{
+		storage:       storage,
+		retentionDays: retentionDays,
+		interval:      interval,
+	}
+}
+
+// Enabled 是否配置了保留期限
+func (w *Worker) Enabled() bool {
+	return w.retentionDays > 0
+}
+
+// RetentionDays 数据保留天数
+func (w *Worker) RetentionDays() int {
+	return w.retentionDays
+}
+
+// Start 启动后台定时清理，启动时立即执行一次
+func (w *Worker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.Enabled() || w.stopCh != nil {
+		return
+	}
+
+	w.stopCh = make(chan struct{})
+	w.doneCh = make(chan struct{})
+	go w.loop(w.stopCh, w.doneCh)
+
+	fmt.Printf("Retention worker started: keeping %d days, checking every %s\n", w.retentionDays, w.interval)
+}
+
+// Stop 停止后台清理并等待正在执行的任务结束
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	stopCh, doneCh := w.stopCh, w.doneCh
+	w.stopCh, w.doneCh = nil, nil
+	w.mu.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func (w *Worker) loop(stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.RunOnce(); err != nil {
+			fmt.Printf("[ERROR] Retention run failed: %v\n", err)
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 立即执行一次清理：删除过期的原始记录（统计数据保留），有数据被删除时回收空间
+func (w *Worker) RunOnce() (*Report, error) {
+	if !w.Enabled() {
+		return nil, fmt.Errorf("retention is disabled (database.retention_days <= 0)")
+	}
+
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	report := &Report{StartedAt: time.Now()}
+	cutoff := report.StartedAt.AddDate(0, 0, -w.retentionDays)
+
+	result, err := w.storage.PruneBefore(cutoff)
+	if err != nil {
+		report.PruneResult = &storage.PruneResult{Cutoff: cutoff}
+		report.Error = err.Error()
+	} else {
+		report.PruneResult = result
+		if v, ok := w.storage.(vacuumer); ok && result.ActivitiesDeleted+result.KeyboardInputsDeleted > 0 {
+			if vacuumErr := v.Vacuum(); vacuumErr != nil {
+				err = fmt.Errorf("vacuum failed: %w", vacuumErr)
+				report.Error = err.Error()
+			} else {
+				report.Vacuumed = true
+			}
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	w.mu.Lock()
+	w.lastReport = report
+	w.mu.Unlock()
+
+	if err == nil && report.ActivitiesDeleted+report.KeyboardInputsDeleted > 0 {
+		fmt.Printf("Retention pruned %d activities and %d keyboard inputs before %s\n",
+			report.ActivitiesDeleted, report.KeyboardInputsDeleted, cutoff.Format("2006-01-02 15:04:05"))
+	}
+
+	return report, err
+}
+
+// LastReport 获取最近一次清理的报告，尚未执行过时返回 nil
+func (w *Worker) LastReport() *Report {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.lastReport
+}
@@ -0,0 +1,177 @@
+package screenshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // 注册 PNG 解码器
+	"os"
+	"path/filepath"
+)
+
+// 缩略图参数
+const (
+	DefaultThumbnailSize = 256
+	MinThumbnailSize     = 32
+	MaxThumbnailSize     = 1024
+	thumbnailQuality     = 80
+)
+
+// BlobStore 按内容哈希保存图片文件：<dir>/<hash 前两位>/<hash>，内容相同的图片只保存一份。
+// 缩略图按需生成并缓存在 <dir>/thumbs/<hash>-<size>.jpg
+type BlobStore struct {
+	dir string
+}
+
+// NewBlobStore 创建图片存储，目录在第一次写入时创建
+func NewBlobStore(dir string) *BlobStore {
+	return &BlobStore{dir: dir}
+}
+
+// Dir 图片存储目录
+func (b *BlobStore) Dir() string {
+	return b.dir
+}
+
+// Path 图片文件路径
+func (b *BlobStore) Path(hash string) string {
+	return filepath.Join(b.dir, hash[:2], hash)
+}
+
+func (b *BlobStore) thumbnailPath(hash string, size int) string {
+	return filepath.Join(b.dir, "thumbs", fmt.Sprintf("%s-%d.jpg", hash, size))
+}
+
+// Put 保存图片内容，返回内容哈希；已有相同内容时不重复写入，created 为 false
+func (b *BlobStore) Put(data []byte) (hash string, created bool, err error) {
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+
+	path := b.Path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, false, nil
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", false, fmt.Errorf("failed to store screenshot: %w", err)
+	}
+	return hash, true, nil
+}
+
+// Remove 删除图片文件和它的缩略图
+func (b *BlobStore) Remove(hash string) error {
+	if err := os.Remove(b.Path(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	thumbs, err := filepath.Glob(filepath.Join(b.dir, "thumbs", hash+"-*.jpg"))
+	if err != nil {
+		return err
+	}
+	for _, thumb := range thumbs {
+		if err := os.Remove(thumb); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Thumbnail 返回长边不超过 size 像素的 JPEG 缩略图路径，第一次请求时生成
+func (b *BlobStore) Thumbnail(hash string, size int) (string, error) {
+	path := b.thumbnailPath(hash, size)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	file, err := os.Open(b.Path(hash))
+	if err != nil {
+		return "", err
+	}
+	src, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+
+	tmp, err := createTemp(path)
+	if err != nil {
+		return "", err
+	}
+	if err := jpeg.Encode(tmp, downscale(src, size), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := commitTemp(tmp, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，中断时不会留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	return commitTemp(tmp, path)
+}
+
+func createTemp(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(filepath.Dir(path), ".tmp-*")
+}
+
+func commitTemp(tmp *os.File, path string) error {
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// downscale 按区域平均缩小图片，使长边不超过 size，不放大
+func downscale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	long := max(w, h)
+	if long <= size {
+		return src
+	}
+	tw, th := max(1, w*size/long), max(1, h*size/long)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
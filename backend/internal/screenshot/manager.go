@@ -0,0 +1,296 @@
+package screenshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 注册 JPEG 解码器
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+	"yaml-backend/pkg/models"
+)
+
+// DefaultInterval 默认的淘汰检查周期
+const DefaultInterval = time.Hour
+
+// evictBatch 每次查询待淘汰截图的条数
+const evictBatch = 200
+
+// DefaultMaxUploadBytes 默认的单张截图大小上限
+const DefaultMaxUploadBytes = 20 << 20
+
+var (
+	// ErrUnsupportedFormat 上传的内容不是 PNG 或 JPEG 图片
+	ErrUnsupportedFormat = errors.New("screenshot must be a PNG or JPEG image")
+	// ErrTooLarge 单张截图超过上传上限或空间上限
+	ErrTooLarge = errors.New("screenshot is too large")
+)
+
+// Options 截图存储的淘汰策略
+type Options struct {
+	MaxBytes      int64         // 图片文件总大小上限，超出后从最早的截图开始删除，<= 0 表示不限
+	RetentionDays int           // 截图保留天数，<= 0 表示永久保留
+	Interval      time.Duration // 定期淘汰的周期，<= 0 时使用 DefaultInterval
+	MaxUpload     int64         // 单张截图大小上限，<= 0 时使用 DefaultMaxUploadBytes
+}
+
+// Report 一次淘汰的执行报告
+type Report struct {
+	Expired      int64     `json:"expired"`       // 超过保留天数被删除的截图
+	Evicted      int64     `json:"evicted"`       // 超过空间上限被删除的截图
+	BlobsRemoved int64     `json:"blobs_removed"` // 不再被引用而删除的图片文件
+	Bytes        int64     `json:"bytes"`         // 淘汰后图片文件总大小
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Manager 保存截图的图片文件和元数据，并按保留天数和空间上限定期淘汰
+type Manager struct {
+	storage storage.Store
+	blobs   *BlobStore
+	opts    Options
+
+	blobMu     sync.Mutex // 保存和删除互斥，避免删除最后一个引用时与相同内容的新截图交错
+	mu         sync.RWMutex
+	runMu      sync.Mutex
+	lastReport *Report
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+// NewManager 创建截图管理器，图片文件保存在 dir 下
+func NewManager(store storage.Store, dir string, opts Options) *Manager {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.MaxUpload <= 0 {
+		opts.MaxUpload = DefaultMaxUploadBytes
+	}
+	return &Manager{
+		storage: store,
+		blobs:   NewBlobStore(dir),
+		opts:    opts,
+	}
+}
+
+// Dir 图片存储目录
+func (m *Manager) Dir() string {
+	return m.blobs.Dir()
+}
+
+// Options 淘汰策略
+func (m *Manager) Options() Options {
+	return m.opts
+}
+
+// Save 校验图片格式后按内容哈希保存图片，并写入元数据；duplicate 表示已有内容相同的图片文件。
+// 保存后超出空间上限时立即淘汰最早的截图
+func (m *Manager) Save(data []byte, shot *models.Screenshot) (duplicate bool, err error) {
+	if int64(len(data)) > m.opts.MaxUpload || (m.opts.MaxBytes > 0 && int64(len(data)) > m.opts.MaxBytes) {
+		return false, ErrTooLarge
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return false, ErrUnsupportedFormat
+	}
+	shot.Format, shot.Width, shot.Height, shot.Size = format, config.Width, config.Height, int64(len(data))
+	if shot.Timestamp.IsZero() {
+		shot.Timestamp = time.Now()
+	}
+
+	m.blobMu.Lock()
+	hash, created, err := m.blobs.Put(data)
+	if err == nil {
+		shot.Hash = hash
+		err = m.storage.SaveScreenshot(shot)
+		if err != nil && created {
+			m.blobs.Remove(hash)
+		}
+	}
+	m.blobMu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	if m.opts.MaxBytes > 0 {
+		if _, err := m.RunOnce(); err != nil {
+			fmt.Printf("[ERROR] Screenshot eviction failed: %v\n", err)
+		}
+	}
+	return !created, nil
+}
+
+// ImagePath 截图的图片文件路径
+func (m *Manager) ImagePath(shot *models.Screenshot) string {
+	return m.blobs.Path(shot.Hash)
+}
+
+// ThumbnailPath 截图的缩略图路径，size 超出范围时取最近的边界值
+func (m *Manager) ThumbnailPath(shot *models.Screenshot, size int) (string, error) {
+	if size <= 0 {
+		size = DefaultThumbnailSize
+	}
+	size = min(max(size, MinThumbnailSize), MaxThumbnailSize)
+	return m.blobs.Thumbnail(shot.Hash, size)
+}
+
+// Delete 删除截图，图片文件不再被其他截图引用时一并删除；截图不存在时返回 nil
+func (m *Manager) Delete(id int64) (*models.Screenshot, error) {
+	shot, _, err := m.delete(id)
+	return shot, err
+}
+
+func (m *Manager) delete(id int64) (*models.Screenshot, bool, error) {
+	m.blobMu.Lock()
+	defer m.blobMu.Unlock()
+
+	shot, orphaned, err := m.storage.DeleteScreenshot(id)
+	if err != nil || shot == nil || !orphaned {
+		return shot, false, err
+	}
+	if err := m.blobs.Remove(shot.Hash); err != nil {
+		return shot, false, fmt.Errorf("failed to remove screenshot file: %w", err)
+	}
+	return shot, true, nil
+}
+
+// Start 启动定期淘汰，启动时立即执行一次
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if (m.opts.RetentionDays <= 0 && m.opts.MaxBytes <= 0) || m.stopCh != nil {
+		return
+	}
+
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+	go m.loop(m.stopCh, m.doneCh)
+
+	fmt.Printf("Screenshot eviction started: keeping %d days and %d bytes in %s\n",
+		m.opts.RetentionDays, m.opts.MaxBytes, m.blobs.Dir())
+}
+
+// Stop 停止定期淘汰并等待正在执行的淘汰结束
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	stopCh, doneCh := m.stopCh, m.doneCh
+	m.stopCh, m.doneCh = nil, nil
+	m.mu.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func (m *Manager) loop(stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.RunOnce(); err != nil {
+			fmt.Printf("[ERROR] Screenshot eviction failed: %v\n", err)
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 立即执行一次淘汰：先删除超过保留天数的截图，再从最早的截图开始删除直到不超过空间上限
+func (m *Manager) RunOnce() (*Report, error) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	report := &Report{StartedAt: time.Now()}
+	err := m.evict(report)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	m.lastReport = report
+	m.mu.Unlock()
+
+	if err == nil && report.Expired+report.Evicted > 0 {
+		fmt.Printf("Screenshot eviction removed %d expired and %d over-quota screenshots (%d files)\n",
+			report.Expired, report.Evicted, report.BlobsRemoved)
+	}
+	return report, err
+}
+
+func (m *Manager) evict(report *Report) error {
+	if m.opts.RetentionDays > 0 {
+		cutoff := report.StartedAt.AddDate(0, 0, -m.opts.RetentionDays)
+		for {
+			shots, err := m.storage.QueryScreenshots(storage.ScreenshotQuery{To: cutoff, Oldest: true, Limit: evictBatch})
+			if err != nil {
+				return err
+			}
+			if len(shots) == 0 {
+				break
+			}
+			for _, shot := range shots {
+				if _, removed, err := m.delete(shot.ID); err != nil {
+					return err
+				} else if removed {
+					report.BlobsRemoved++
+				}
+				report.Expired++
+			}
+		}
+	}
+
+	usage, err := m.storage.GetScreenshotUsage()
+	if err != nil {
+		return err
+	}
+	report.Bytes = usage.Bytes
+	if m.opts.MaxBytes <= 0 {
+		return nil
+	}
+
+	for report.Bytes > m.opts.MaxBytes {
+		shots, err := m.storage.QueryScreenshots(storage.ScreenshotQuery{Oldest: true, Limit: evictBatch})
+		if err != nil {
+			return err
+		}
+		if len(shots) == 0 {
+			break
+		}
+		for _, shot := range shots {
+			_, removed, err := m.delete(shot.ID)
+			if err != nil {
+				return err
+			}
+			report.Evicted++
+			if removed {
+				report.BlobsRemoved++
+				report.Bytes -= shot.Size
+				if report.Bytes <= m.opts.MaxBytes {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LastReport 获取最近一次淘汰的报告，尚未执行过时返回 nil
+func (m *Manager) LastReport() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastReport
+}
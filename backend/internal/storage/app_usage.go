@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// AppUsageQuery 应用使用记录查询条件，按开始时间过滤，零值字段表示不过滤
+type AppUsageQuery struct {
+	From    time.Time // 起始时间（包含）
+	To      time.Time // 结束时间（不包含）
+	AppName string    // 应用名，精确匹配
+	Limit   int       // 最多返回条数，<= 0 时使用 DefaultPageSize
+}
+
+// SaveAppUsage 保存一段应用使用记录，成功后回填 usage.ID
+func (s *SQLiteStorage) SaveAppUsage(usage *models.AppUsage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seq, err := s.reserveSyncSeq(tx, 1)
+	if err != nil {
+		return err
+	}
+	stmt, err := s.writeStmts.txStmt(tx, insertAppUsageSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(usage.AppName, dbTime(usage.StartTime), dbTime(usage.EndTime), usage.Duration, s.deviceID, seq)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	usage.ID = id
+	usage.DeviceID = s.deviceID
+	return nil
+}
+
+// UpdateActivityDuration 回填活动记录的持续时间（秒），同时修正统计中的时长
+func (s *SQLiteStorage) UpdateActivityDuration(id int64, duration int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	selectStmt, err := s.writeStmts.txStmt(tx, selectActivityRollupSQL)
+	if err != nil {
+		return err
+	}
+	defer selectStmt.Close()
+
+	delta := make(rollupDelta)
+	if err := activityDurationDelta(selectStmt, id, duration, delta); err == sql.ErrNoRows {
+		return fmt.Errorf("activity %d not found", id)
+	} else if err != nil {
+		return err
+	}
+
+	seq, err := s.reserveSyncSeq(tx, 1)
+	if err != nil {
+		return err
+	}
+	updateStmt, err := s.writeStmts.txStmt(tx, updateActivityDurationSQL)
+	if err != nil {
+		return err
+	}
+	defer updateStmt.Close()
+
+	if _, err := updateStmt.Exec(duration, seq, id); err != nil {
+		return err
+	}
+	if err := s.applyRollups(tx, delta); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueryAppUsage 按开始时间倒序查询应用使用记录
+func (s *SQLiteStorage) QueryAppUsage(q AppUsageQuery) ([]*models.AppUsage, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("start_time", q.From, q.To, nil)
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+
+	query := `SELECT id, app_name, start_time, end_time, duration, device_id FROM app_usage` +
+		where.String() + ` ORDER BY start_time DESC, id DESC LIMIT ?`
+
+	rows, err := s.readStmts.query(query, append(where.args, pageSize(q.Limit))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []*models.AppUsage
+	for rows.Next() {
+		usage := &models.AppUsage{}
+		var endTime sql.NullTime
+		if err := rows.Scan(&usage.ID, &usage.AppName, &usage.StartTime, &endTime, &usage.Duration, &usage.DeviceID); err != nil {
+			return nil, err
+		}
+		usage.EndTime = endTime.Time
+		usages = append(usages, usage)
+	}
+
+	return usages, rows.Err()
+}
+
+// GetAppUsageTotals 按应用汇总时间段内的使用时长，按时长倒序排列
+func (s *SQLiteStorage) GetAppUsageTotals(from, to time.Time) ([]*models.AppUsageTotal, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("start_time", from, to, nil)
+
+	query := `SELECT app_name, COUNT(*), COALESCE(SUM(duration), 0) FROM app_usage` +
+		where.String() + ` GROUP BY app_name ORDER BY SUM(duration) DESC, app_name ASC`
+
+	rows, err := s.readStmts.query(query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []*models.AppUsageTotal
+	for rows.Next() {
+		total := &models.AppUsageTotal{}
+		if err := rows.Scan(&total.AppName, &total.Sessions, &total.Duration); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+
+	return totals, rows.Err()
+}
+
+func (m *MemoryStorage) SaveAppUsage(usage *models.AppUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.insertAppUsage(usage)
+	usage.ID, usage.DeviceID = stored.ID, stored.DeviceID
+	return nil
+}
+
+// insertAppUsage 保存应用使用记录的副本，不修改调用方的结构体（调用方需持有写锁）
+func (m *MemoryStorage) insertAppUsage(usage *models.AppUsage) *models.AppUsage {
+	stored := *usage
+	stored.ID = m.allocID("app_usage")
+	stored.DeviceID = m.deviceID
+	stored.StartTime = stored.StartTime.Round(0)
+	stored.EndTime = stored.EndTime.Round(0)
+	m.appUsage = append(m.appUsage, &stored)
+	m.stampSync("app_usage", stored.ID, m.deviceID, 0)
+	return &stored
+}
+
+func (m *MemoryStorage) UpdateActivityDuration(id int64, duration int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, activity := range m.activities {
+		if activity.ID == id {
+			m.setActivityDuration(activity, duration)
+			return nil
+		}
+	}
+	return fmt.Errorf("activity %d not found", id)
+}
+
+// setActivityDuration 更新持续时间并修正统计（调用方需持有写锁）
+func (m *MemoryStorage) setActivityDuration(activity *models.Activity, duration int64) {
+	delta := make(rollupDelta)
+	delta.get(activity.Timestamp, activity.AppName).Duration += duration - activity.Duration
+	m.applyRollups(delta)
+	if activity.Duration != duration {
+		m.logChange("activities", ChangeUpdate, activity.ID)
+	}
+	activity.Duration = duration
+	m.touchSync("activities", activity.ID)
+}
+
+func (m *MemoryStorage) QueryAppUsage(q AppUsageQuery) ([]*models.AppUsage, error) {
+	m.mu.RLock()
+	var usages []*models.AppUsage
+	for _, usage := range m.appUsage {
+		if !inRange(usage.StartTime, q.From, q.To) || (q.AppName != "" && usage.AppName != q.AppName) {
+			continue
+		}
+		copied := *usage
+		usages = append(usages, &copied)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(usages, func(i, j int) bool {
+		if !usages[i].StartTime.Equal(usages[j].StartTime) {
+			return usages[i].StartTime.After(usages[j].StartTime)
+		}
+		return usages[i].ID > usages[j].ID
+	})
+
+	return usages[:applyLimit(len(usages), pageSize(q.Limit))], nil
+}
+
+func (m *MemoryStorage) GetAppUsageTotals(from, to time.Time) ([]*models.AppUsageTotal, error) {
+	m.mu.RLock()
+	byApp := make(map[string]*models.AppUsageTotal)
+	for _, usage := range m.appUsage {
+		if !inRange(usage.StartTime, from, to) {
+			continue
+		}
+		total, ok := byApp[usage.AppName]
+		if !ok {
+			total = &models.AppUsageTotal{AppName: usage.AppName}
+			byApp[usage.AppName] = total
+		}
+		total.Sessions++
+		total.Duration += usage.Duration
+	}
+	m.mu.RUnlock()
+
+	var totals []*models.AppUsageTotal
+	for _, total := range byApp {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Duration != totals[j].Duration {
+			return totals[i].Duration > totals[j].Duration
+		}
+		return totals[i].AppName < totals[j].AppName
+	})
+
+	return totals, nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrInvalidSnapshot 快照文件损坏或不是本程序的数据库
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Backup 用 VACUUM INTO 生成一致的数据库快照，写入期间不阻塞读取。
+// 先写入临时文件，完成后重命名，中途失败不会留下不完整的快照
+func (s *SQLiteStorage) Backup(path string) error {
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+
+	if _, err := s.db.Exec(`VACUUM INTO ?`, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+	return nil
+}
+
+// SnapshotSchemaVersion 校验快照文件的完整性并返回其结构版本
+func SnapshotSchemaVersion(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var check string
+	if err := db.QueryRow(`PRAGMA quick_check`).Scan(&check); err != nil {
+		return 0, fmt.Errorf("%w: not a valid SQLite database: %v", ErrInvalidSnapshot, err)
+	}
+	if check != "ok" {
+		return 0, fmt.Errorf("%w: integrity check failed: %s", ErrInvalidSnapshot, check)
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, fmt.Errorf("%w: no schema version: %v", ErrInvalidSnapshot, err)
+	}
+	if version < 1 {
+		return 0, fmt.Errorf("%w: no applied migrations", ErrInvalidSnapshot)
+	}
+	return version, nil
+}
+
+// Restore 用 SQLite 在线备份 API 将快照复制到当前数据库，在线替换全部内容。
+// 快照的结构版本必须不高于当前程序支持的版本，较旧的快照复制后会自动升级
+func (s *SQLiteStorage) Restore(path string) error {
+	version, err := SnapshotSchemaVersion(path)
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return &SchemaTooNewError{DatabaseVersion: version, SupportedVersion: latest}
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// 恢复后才发现无法打开会留下不可用的数据库，复制前检查
+	if !s.ftsEnabled {
+		if err := checkNoSearchIndex(src); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	changeSeq, err := latestChangeSeq(s.db)
+	if err != nil {
+		return err
+	}
+
+	// 占用唯一的写连接，复制期间其他写入排队等待
+	destConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			dest, ok := destDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", destDriver)
+			}
+			source, ok := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", srcDriver)
+			}
+
+			backup, err := dest.Backup("main", source, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	destConn.Close()
+
+	// 表结构可能已变化，丢弃缓存的语句并重新执行升级和索引检查
+	s.readStmts.close()
+	s.writeStmts.close()
+
+	if err := s.migrate(); err != nil {
+		return fmt.Errorf("failed to migrate restored database: %w", err)
+	}
+	// 恢复后自增 ID 和变更序号回退，使用新的设备ID，对端按新设备从头同步
+	if err := s.loadDeviceID(true); err != nil {
+		return fmt.Errorf("failed to rotate device id: %w", err)
+	}
+	if err := s.resetChangeLog(changeSeq); err != nil {
+		return fmt.Errorf("failed to reset change log: %w", err)
+	}
+	if err := s.loadRules(); err != nil {
+		return fmt.Errorf("failed to load tagging rules: %w", err)
+	}
+	if err := s.ensureSearchIndex(); err != nil {
+		return fmt.Errorf("failed to set up search index: %w", err)
+	}
+	if err := s.setupEncryption(); err != nil {
+		return fmt.Errorf("failed to set up encryption: %w", err)
+	}
+	return s.writeStmts.warm(insertActivitySQL, insertKeyboardInputSQL,
+		insertAppUsageSQL, updateActivityDurationSQL, selectActivityRollupSQL,
+		upsertHourlyStatsSQL, upsertDailyStatsSQL, reserveSyncSeqSQL)
+}
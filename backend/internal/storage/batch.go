@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"yaml-backend/pkg/models"
+)
+
+// ErrInvalidBatch 批次中有无效的记录，整个批次都不写入
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// Batch 一次批量写入的数据，在一个事务中按 Activities、KeyboardInputs、AppUsage、
+// ActivityDurations 的顺序写入，因此 ActivityDurations 可以引用同一批次中新插入的活动记录
+type Batch struct {
+	Activities        []*models.Activity
+	KeyboardInputs    []*models.KeyboardInput
+	AppUsage          []*models.AppUsage
+	ActivityDurations []ActivityDuration
+}
+
+// ActivityDuration 回填活动记录的持续时间，Activity 在写入前可能还没有 ID
+type ActivityDuration struct {
+	Activity *models.Activity
+	Duration int64 // 持续时间（秒）
+}
+
+// 批量写入和单条写入共用的语句，打开数据库时预编译
+const (
+	insertActivitySQL = `INSERT INTO activities (type, content, app_name, window_title, url, timestamp, duration,
+		device_id, sync_seq) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertKeyboardInputSQL = `INSERT INTO keyboard_inputs (text, app_name, timestamp, keystrokes, corrections, duration,
+		device_id, sync_seq) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	insertAppUsageSQL = `INSERT INTO app_usage (app_name, start_time, end_time, duration, device_id, sync_seq)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	// 修改持续时间时递增修订号，同步时修订号较大的版本生效
+	updateActivityDurationSQL = `UPDATE activities SET duration = ?, revision = revision + 1, sync_seq = ? WHERE id = ?`
+)
+
+// Len 批次中的记录数
+func (b *Batch) Len() int {
+	return len(b.Activities) + len(b.KeyboardInputs) + len(b.AppUsage) + len(b.ActivityDurations)
+}
+
+// validateBatch 写入前校验整个批次，两种存储对同一个无效批次都不写入任何记录
+func validateBatch(batch *Batch) error {
+	for i, activity := range batch.Activities {
+		if activity == nil {
+			return fmt.Errorf("%w: activity %d is nil", ErrInvalidBatch, i)
+		}
+	}
+	for i, input := range batch.KeyboardInputs {
+		if input == nil {
+			return fmt.Errorf("%w: keyboard input %d is nil", ErrInvalidBatch, i)
+		}
+	}
+	for i, usage := range batch.AppUsage {
+		if usage == nil {
+			return fmt.Errorf("%w: app usage %d is nil", ErrInvalidBatch, i)
+		}
+		if usage.EndTime.Before(usage.StartTime) {
+			return fmt.Errorf("%w: app usage %d ends before it starts", ErrInvalidBatch, i)
+		}
+	}
+	for i, update := range batch.ActivityDurations {
+		if update.Activity == nil {
+			return fmt.Errorf("%w: activity duration %d has no activity", ErrInvalidBatch, i)
+		}
+	}
+	return nil
+}
+
+// SaveBatch 在一个事务中写入整个批次并累加统计，提交成功后回填各记录的 ID
+func (s *SQLiteStorage) SaveBatch(batch *Batch) error {
+	if err := validateBatch(batch); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	delta := make(rollupDelta)
+	seq, err := s.reserveSyncSeq(tx, batch.Len())
+	if err != nil {
+		return err
+	}
+
+	// 事务提交前不修改调用方的结构体，失败重试时不会留下无效的 ID
+	activityIDs := make([]int64, len(batch.Activities))
+	if len(batch.Activities) > 0 {
+		stmt, err := s.writeStmts.txStmt(tx, insertActivitySQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, activity := range batch.Activities {
+			content, windowTitle, url, err := s.sealActivity(activity)
+			if err != nil {
+				return err
+			}
+			result, err := stmt.Exec(activity.Type, content, activity.AppName,
+				windowTitle, url, dbTime(activity.Timestamp), activity.Duration, s.deviceID, seq)
+			if err != nil {
+				return err
+			}
+			seq++
+			if activityIDs[i], err = result.LastInsertId(); err != nil {
+				return err
+			}
+			if err := s.tagActivity(tx, activityIDs[i], activity); err != nil {
+				return err
+			}
+			delta.addActivity(activity)
+		}
+	}
+
+	inputIDs := make([]int64, len(batch.KeyboardInputs))
+	if len(batch.KeyboardInputs) > 0 {
+		stmt, err := s.writeStmts.txStmt(tx, insertKeyboardInputSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, input := range batch.KeyboardInputs {
+			text, err := s.seal(input.Text)
+			if err != nil {
+				return err
+			}
+			count := inputKeystrokes(input)
+			result, err := stmt.Exec(text, input.AppName, dbTime(input.Timestamp), count, input.Corrections, input.Duration,
+				s.deviceID, seq)
+			if err != nil {
+				return err
+			}
+			seq++
+			if inputIDs[i], err = result.LastInsertId(); err != nil {
+				return err
+			}
+			delta.addKeyboardInput(input.AppName, input.Timestamp, count)
+		}
+	}
+
+	usageIDs := make([]int64, len(batch.AppUsage))
+	if len(batch.AppUsage) > 0 {
+		stmt, err := s.writeStmts.txStmt(tx, insertAppUsageSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, usage := range batch.AppUsage {
+			result, err := stmt.Exec(usage.AppName, dbTime(usage.StartTime), dbTime(usage.EndTime), usage.Duration, s.deviceID, seq)
+			if err != nil {
+				return err
+			}
+			seq++
+			if usageIDs[i], err = result.LastInsertId(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(batch.ActivityDurations) > 0 {
+		selectStmt, err := s.writeStmts.txStmt(tx, selectActivityRollupSQL)
+		if err != nil {
+			return err
+		}
+		defer selectStmt.Close()
+
+		stmt, err := s.writeStmts.txStmt(tx, updateActivityDurationSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, update := range batch.ActivityDurations {
+			id := batchActivityID(batch, activityIDs, update.Activity)
+			if id == 0 {
+				continue
+			}
+			// 与 SQL UPDATE 相同，记录不存在（例如已被清理）时忽略
+			if err := activityDurationDelta(selectStmt, id, update.Duration, delta); err == sql.ErrNoRows {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if _, err := stmt.Exec(update.Duration, seq, id); err != nil {
+				return err
+			}
+			seq++
+		}
+	}
+
+	if err := s.applyRollups(tx, delta); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, activity := range batch.Activities {
+		activity.ID = activityIDs[i]
+		activity.DeviceID = s.deviceID
+	}
+	for i, input := range batch.KeyboardInputs {
+		input.ID = inputIDs[i]
+		input.DeviceID = s.deviceID
+	}
+	for i, usage := range batch.AppUsage {
+		usage.ID = usageIDs[i]
+		usage.DeviceID = s.deviceID
+	}
+	for _, update := range batch.ActivityDurations {
+		update.Activity.Duration = update.Duration
+	}
+	return nil
+}
+
+// batchActivityID 返回活动记录的 ID：同一批次中新插入的记录使用事务内分配的 ID，
+// 之前批次写入的记录使用已回填的 ID，从未写入成功的记录返回 0
+func batchActivityID(batch *Batch, activityIDs []int64, activity *models.Activity) int64 {
+	for i, inserted := range batch.Activities {
+		if inserted == activity {
+			return activityIDs[i]
+		}
+	}
+	return activity.ID
+}
+
+// SaveBatch 与 SQLiteStorage 的写入顺序一致。整个批次在一次加锁内写入，
+// 校验失败时不写入任何记录，全部写入后才回填调用方结构体中的 ID
+func (m *MemoryStorage) SaveBatch(batch *Batch) error {
+	if err := validateBatch(batch); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	activityIDs := make([]int64, len(batch.Activities))
+	for i, activity := range batch.Activities {
+		activityIDs[i] = m.insertActivity(activity).ID
+	}
+	inputIDs := make([]int64, len(batch.KeyboardInputs))
+	for i, input := range batch.KeyboardInputs {
+		inputIDs[i] = m.insertKeyboardInput(input).ID
+	}
+	usageIDs := make([]int64, len(batch.AppUsage))
+	for i, usage := range batch.AppUsage {
+		usageIDs[i] = m.insertAppUsage(usage).ID
+	}
+
+	// 与 SQL UPDATE 相同，记录不存在（例如已被清理）时忽略
+	for _, update := range batch.ActivityDurations {
+		id := batchActivityID(batch, activityIDs, update.Activity)
+		if id == 0 {
+			continue
+		}
+		for _, activity := range m.activities {
+			if activity.ID == id {
+				m.setActivityDuration(activity, update.Duration)
+				break
+			}
+		}
+	}
+
+	for i, activity := range batch.Activities {
+		activity.ID = activityIDs[i]
+		activity.DeviceID = m.deviceID
+	}
+	for i, input := range batch.KeyboardInputs {
+		input.ID = inputIDs[i]
+		input.DeviceID = m.deviceID
+	}
+	for i, usage := range batch.AppUsage {
+		usage.ID = usageIDs[i]
+		usage.DeviceID = m.deviceID
+	}
+	for _, update := range batch.ActivityDurations {
+		update.Activity.Duration = update.Duration
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 基准测试的数据规模：benchRows 条活动记录和键盘输入，均匀分布在 benchSpan 内
+const (
+	benchRows      = 20000
+	benchSpan      = 30 * 24 * time.Hour
+	benchBatchSize = 100
+)
+
+var benchApps = []string{"Safari", "Xcode", "Terminal", "Slack", "Mail", "Notes", "Finder", "Visual Studio Code"}
+
+var benchStart = time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+// benchBatch 生成从 offset 开始的 count 条活动记录和键盘输入
+func benchBatch(rng *rand.Rand, offset, count int) *Batch {
+	step := benchSpan / benchRows
+	batch := &Batch{}
+	for i := offset; i < offset+count; i++ {
+		timestamp := benchStart.Add(step * time.Duration(i%benchRows))
+		app := benchApps[rng.Intn(len(benchApps))]
+		batch.Activities = append(batch.Activities, &models.Activity{
+			Type:        models.ActivityTypeApp,
+			Content:     "app_activation: " + app,
+			AppName:     app,
+			WindowTitle: fmt.Sprintf("%s window %d", app, 100+rng.Intn(900)),
+			Timestamp:   timestamp,
+			Duration:    int64(rng.Intn(600)),
+		})
+		batch.KeyboardInputs = append(batch.KeyboardInputs, &models.KeyboardInput{
+			Text:      fmt.Sprintf("typed text %d", i),
+			AppName:   benchApps[rng.Intn(len(benchApps))],
+			Timestamp: timestamp,
+		})
+	}
+	return batch
+}
+
+// benchStore 创建写入了 rows 条测试数据的 SQLite 存储
+func benchStore(b *testing.B, rows int) *SQLiteStorage {
+	b.Helper()
+	store, err := NewSQLiteStorage(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+
+	rng := rand.New(rand.NewSource(1))
+	for offset := 0; offset < rows; offset += 5000 {
+		if err := store.SaveBatch(benchBatch(rng, offset, min(5000, rows-offset))); err != nil {
+			b.Fatalf("SaveBatch: %v", err)
+		}
+	}
+	return store
+}
+
+func BenchmarkSaveBatch(b *testing.B) {
+	store := benchStore(b, 0)
+	rng := rand.New(rand.NewSource(1))
+	batches := make([]*Batch, b.N)
+	for i := range batches {
+		batches[i] = benchBatch(rng, i*benchBatchSize, benchBatchSize)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.SaveBatch(batches[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(2*benchBatchSize*b.N)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func BenchmarkQueryActivitiesRange(b *testing.B) {
+	store := benchStore(b, benchRows)
+	rng := rand.New(rand.NewSource(2))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		from := benchStart.Add(time.Duration(rng.Int63n(int64(benchSpan - time.Hour))))
+		if _, _, err := store.QueryActivities(ActivityQuery{From: from, To: from.Add(time.Hour)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryKeyboardInputsByApp(b *testing.B) {
+	store := benchStore(b, benchRows)
+	rng := rand.New(rand.NewSource(3))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		from := benchStart.Add(time.Duration(rng.Int63n(int64(benchSpan - 24*time.Hour))))
+		q := KeyboardQuery{From: from, To: from.Add(24 * time.Hour), AppName: benchApps[i%len(benchApps)]}
+		if _, _, err := store.QueryKeyboardInputs(q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearch 使用 -tags sqlite_fts5 编译时测量全文索引，否则测量子串匹配
+func BenchmarkSearch(b *testing.B) {
+	store := benchStore(b, benchRows)
+	rng := rand.New(rand.NewSource(4))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 每个词至少 3 个字符，FTS5 才会使用全文索引
+		q := SearchQuery{Text: fmt.Sprintf("%s window %d", benchApps[rng.Intn(len(benchApps))], 100+rng.Intn(900)), Limit: 20}
+		if _, err := store.Search(q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 变更日志中的操作
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update" // 活动记录的持续时间被回填或在同步中被修改
+	ChangeDelete = "delete"
+)
+
+// ChangeKindSummary AI总结在变更日志中的类型，其余类型与同步记录类型相同
+const ChangeKindSummary = "summary"
+
+// 变更日志分页大小
+const (
+	DefaultChangePageSize = 500
+	MaxChangePageSize     = 5000
+)
+
+// changePollInterval 等待新变更时读取最新变更序号的间隔
+const changePollInterval = 250 * time.Millisecond
+
+// changeTimeFormat 与触发器中 strftime('%Y-%m-%d %H:%M:%f', 'now') 的格式一致（UTC）
+const changeTimeFormat = "2006-01-02 15:04:05.000"
+
+// changeKinds 表对应的变更类型
+var changeKinds = map[string]string{
+	"activities":      SyncKindActivity,
+	"keyboard_inputs": SyncKindKeyboardInput,
+	"app_usage":       SyncKindAppUsage,
+	"ai_summaries":    ChangeKindSummary,
+}
+
+// Change 变更日志中的一条记录。新增和修改附带记录的当前内容（明文），
+// 记录在读取前已被删除时内容为空，稍后的变更中会有对应的删除
+type Change struct {
+	Seq           int64                 `json:"seq"`
+	Kind          string                `json:"kind"`
+	Op            string                `json:"op"`
+	RecordID      int64                 `json:"record_id"`
+	ChangedAt     time.Time             `json:"changed_at"`
+	Activity      *models.Activity      `json:"activity,omitempty"`
+	KeyboardInput *models.KeyboardInput `json:"keyboard_input,omitempty"`
+	AppUsage      *models.AppUsage      `json:"app_usage,omitempty"`
+	Summary       *SummaryResult        `json:"summary,omitempty"`
+}
+
+// ChangeLog 一页变更，Next 是下一页请求的 since，也是消费方保存的位置。
+// Reset 表示 since 之后的部分变更已随数据清理删除，或数据库已从备份恢复，消费方需要重新全量读取
+type ChangeLog struct {
+	Changes []*Change `json:"changes"`
+	Next    int64     `json:"next"`
+	HasMore bool      `json:"has_more"`
+	Reset   bool      `json:"reset,omitempty"`
+}
+
+func changePageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultChangePageSize
+	}
+	return min(limit, MaxChangePageSize)
+}
+
+// pageChanges 截取一页变更。变更序号连续分配，since 的下一个序号不存在而最新序号更大时说明有变更缺失
+func pageChanges(since, latest int64, changes []*Change, limit int) *ChangeLog {
+	log := &ChangeLog{Changes: changes, Next: since}
+	if len(changes) > limit {
+		log.Changes, log.HasMore = changes[:limit], true
+	}
+	if len(log.Changes) > 0 {
+		log.Next = log.Changes[len(log.Changes)-1].Seq
+		log.Reset = log.Changes[0].Seq > since+1
+	} else if since != latest {
+		log.Next, log.Reset = latest, true
+	}
+	if log.Changes == nil {
+		log.Changes = []*Change{}
+	}
+	return log
+}
+
+// latestChangeSeq 最后分配的变更序号，变更日志被清理后仍然保留
+func latestChangeSeq(q queryer) (int64, error) {
+	var seq sql.NullInt64
+	err := q.QueryRow(`SELECT seq FROM sqlite_sequence WHERE name = 'change_log'`).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq.Int64, err
+}
+
+// GetChangeLog 按变更序号获取 since 之后的变更，所有查询在同一个读事务中执行
+func (s *SQLiteStorage) GetChangeLog(since int64, limit int) (*ChangeLog, error) {
+	limit = changePageSize(limit)
+
+	tx, err := s.readDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latest, err := latestChangeSeq(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT seq, kind, op, record_id, changed_at FROM change_log
+		WHERE seq > ? ORDER BY seq LIMIT ?`, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*Change
+	for rows.Next() {
+		change := &Change{}
+		if err := rows.Scan(&change.Seq, &change.Kind, &change.Op, &change.RecordID, &change.ChangedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	log := pageChanges(since, latest, changes, limit)
+	if len(log.Changes) > 0 {
+		if err := s.loadChangeRecords(tx, log.Changes[0].Seq, log.Next, log.Changes); err != nil {
+			return nil, err
+		}
+	}
+	return log, nil
+}
+
+// loadChangeRecords 读取 [first, last] 内新增和修改的记录的当前内容
+func (s *SQLiteStorage) loadChangeRecords(tx *sql.Tx, first, last int64, changes []*Change) error {
+	const changed = ` WHERE id IN (SELECT record_id FROM change_log
+		WHERE seq BETWEEN ? AND ? AND kind = ? AND op != 'delete')`
+
+	activities := make(map[int64]*models.Activity)
+	rows, err := tx.Query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration, device_id
+		FROM activities`+changed, first, last, SyncKindActivity)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		activity := &models.Activity{}
+		if err := rows.Scan(&activity.ID, &activity.Type, &activity.Content, &activity.AppName,
+			&activity.WindowTitle, &activity.URL, &activity.Timestamp, &activity.Duration, &activity.DeviceID); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := s.openActivity(activity); err != nil {
+			rows.Close()
+			return err
+		}
+		activities[activity.ID] = activity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	inputs := make(map[int64]*models.KeyboardInput)
+	rows, err = tx.Query(`SELECT `+keyboardInputColumns+` FROM keyboard_inputs`+changed,
+		first, last, SyncKindKeyboardInput)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		input, err := scanKeyboardInput(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if err := s.openKeyboardInput(input); err != nil {
+			rows.Close()
+			return err
+		}
+		inputs[input.ID] = input
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	usages := make(map[int64]*models.AppUsage)
+	rows, err = tx.Query(`SELECT id, app_name, start_time, end_time, duration, device_id FROM app_usage`+changed,
+		first, last, SyncKindAppUsage)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		usage := &models.AppUsage{}
+		var endTime sql.NullTime
+		if err := rows.Scan(&usage.ID, &usage.AppName, &usage.StartTime, &endTime, &usage.Duration, &usage.DeviceID); err != nil {
+			rows.Close()
+			return err
+		}
+		usage.EndTime = endTime.Time
+		usages[usage.ID] = usage
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	summaries := make(map[int64]*SummaryResult)
+	rows, err = tx.Query(`SELECT `+summaryColumns+` FROM ai_summaries`+changed, first, last, ChangeKindSummary)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		summary, err := scanSummary(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		summaries[summary.ID] = summary
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.Op == ChangeDelete {
+			continue
+		}
+		switch change.Kind {
+		case SyncKindActivity:
+			change.Activity = activities[change.RecordID]
+		case SyncKindKeyboardInput:
+			change.KeyboardInput = inputs[change.RecordID]
+		case SyncKindAppUsage:
+			change.AppUsage = usages[change.RecordID]
+		case ChangeKindSummary:
+			change.Summary = summaries[change.RecordID]
+		}
+	}
+	return nil
+}
+
+// WaitForChange 等待 since 之后出现新的变更，ctx 结束时返回 ctx.Err()。
+// 变更日志由触发器写入，同一数据库上其他进程的写入也要能发现，因此定期读取最新序号
+func (s *SQLiteStorage) WaitForChange(ctx context.Context, since int64) error {
+	ticker := time.NewTicker(changePollInterval)
+	defer ticker.Stop()
+
+	for {
+		latest, err := latestChangeSeq(s.readDB)
+		if err != nil {
+			return err
+		}
+		// 序号回退（从备份恢复）时也立即返回，由 GetChangeLog 报告 Reset
+		if latest != since {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneChangeLog 删除 cutoff 之前写入的变更。变更序号和写入时间同时递增，
+// 从最早的变更开始删除到第一条保留的变更为止，不需要为写入时间建索引
+func pruneChangeLog(tx *sql.Tx, cutoff time.Time) (int64, error) {
+	res, err := tx.Exec(`DELETE FROM change_log WHERE seq < COALESCE(
+		(SELECT seq FROM change_log WHERE changed_at >= ? ORDER BY seq LIMIT 1),
+		(SELECT MAX(seq) + 1 FROM change_log))`, cutoff.UTC().Format(changeTimeFormat))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// resetChangeLog 从备份恢复后清空变更日志，并让下一个变更序号越过恢复前已分配的序号，
+// 消费方继续读取时会发现缺口并重新全量读取
+func (s *SQLiteStorage) resetChangeLog(before int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	restored, err := latestChangeSeq(tx)
+	if err != nil {
+		return err
+	}
+	seq := max(before, restored) + 1
+
+	if _, err := tx.Exec(`DELETE FROM change_log`); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE sqlite_sequence SET seq = ? WHERE name = 'change_log'`, seq)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := tx.Exec(`INSERT INTO sqlite_sequence (name, seq) VALUES ('change_log', ?)`, seq); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// logChange 追加一条变更并唤醒等待中的读取方（调用方需持有写锁）
+func (m *MemoryStorage) logChange(table, op string, id int64) {
+	m.changeSeq++
+	m.changeLog = append(m.changeLog, &Change{
+		Seq:       m.changeSeq,
+		Kind:      changeKinds[table],
+		Op:        op,
+		RecordID:  id,
+		ChangedAt: time.Now().UTC().Truncate(time.Millisecond),
+	})
+	close(m.changeCh)
+	m.changeCh = make(chan struct{})
+}
+
+// GetChangeLog 与 SQLiteStorage 相同：按变更序号获取 since 之后的变更
+func (m *MemoryStorage) GetChangeLog(since int64, limit int) (*ChangeLog, error) {
+	limit = changePageSize(limit)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := sort.Search(len(m.changeLog), func(i int) bool { return m.changeLog[i].Seq > since })
+	var changes []*Change
+	for _, change := range m.changeLog[i:min(i+limit+1, len(m.changeLog))] {
+		copied := *change
+		changes = append(changes, &copied)
+	}
+
+	log := pageChanges(since, m.changeSeq, changes, limit)
+	for _, change := range log.Changes {
+		if change.Op == ChangeDelete {
+			continue
+		}
+		switch change.Kind {
+		case SyncKindActivity:
+			for _, activity := range m.activities {
+				if activity.ID == change.RecordID {
+					copied := *activity
+					change.Activity = &copied
+					break
+				}
+			}
+		case SyncKindKeyboardInput:
+			for _, input := range m.keyboardInputs {
+				if input.ID == change.RecordID {
+					copied := *input
+					change.KeyboardInput = &copied
+					break
+				}
+			}
+		case SyncKindAppUsage:
+			for _, usage := range m.appUsage {
+				if usage.ID == change.RecordID {
+					copied := *usage
+					change.AppUsage = &copied
+					break
+				}
+			}
+		case ChangeKindSummary:
+			for _, summary := range m.summaries {
+				if summary.ID == change.RecordID {
+					change.Summary = copySummary(summary)
+					break
+				}
+			}
+		}
+	}
+	return log, nil
+}
+
+// WaitForChange 与 SQLiteStorage 相同，所有写入都在进程内，由 logChange 直接唤醒
+func (m *MemoryStorage) WaitForChange(ctx context.Context, since int64) error {
+	for {
+		m.mu.RLock()
+		latest, changed := m.changeSeq, m.changeCh
+		m.mu.RUnlock()
+
+		if latest != since {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// pruneChangeLog 删除 cutoff 之前写入的变更（调用方需持有写锁）
+func (m *MemoryStorage) pruneChangeLog(cutoff time.Time) int64 {
+	i := sort.Search(len(m.changeLog), func(i int) bool { return !m.changeLog[i].ChangedAt.Before(cutoff) })
+	m.changeLog = append([]*Change(nil), m.changeLog[i:]...)
+	return int64(i)
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// 连接参数
+const (
+	busyTimeoutMillis = 5000
+	maxCachedStmts    = 256
+)
+
+// writerDSN 写连接：WAL 模式下写入不阻塞读取，synchronous=NORMAL 在 WAL 下仍能保证一致性，
+// 事务以 IMMEDIATE 开始，避免读事务升级为写事务时出现 SQLITE_BUSY
+func writerDSN(dbPath string) string {
+	return fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d&_synchronous=NORMAL&_txlock=immediate",
+		dbPath, busyTimeoutMillis)
+}
+
+// readerDSN 只读连接
+func readerDSN(dbPath string) string {
+	return fmt.Sprintf("%s?_busy_timeout=%d&_query_only=true", dbPath, busyTimeoutMillis)
+}
+
+// isMemoryDSN 内存数据库的每个连接都是独立的库，不能拆分读写连接池
+func isMemoryDSN(dbPath string) bool {
+	return dbPath == ":memory:" || strings.HasPrefix(dbPath, "file::memory:")
+}
+
+// openPools 打开读写分离的连接池：SQLite 同时只允许一个写入者，写连接池只保留一个连接，
+// 写入在连接池内排队而不是在 busy_timeout 中自旋；读连接池允许多个并发读取
+func openPools(dbPath string) (*sql.DB, *sql.DB, error) {
+	if isMemoryDSN(dbPath) {
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		db.SetMaxOpenConns(1)
+		return db, db, nil
+	}
+
+	writer, err := sql.Open("sqlite3", writerDSN(dbPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
+
+	// 先建立写连接，确保数据库文件已创建并切换到 WAL 模式
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, nil, err
+	}
+
+	reader, err := sql.Open("sqlite3", readerDSN(dbPath))
+	if err != nil {
+		writer.Close()
+		return nil, nil, err
+	}
+	readers := runtime.NumCPU()
+	if readers < 4 {
+		readers = 4
+	}
+	reader.SetMaxOpenConns(readers)
+	reader.SetMaxIdleConns(readers)
+
+	return writer, reader, nil
+}
+
+// stmtCache 按 SQL 文本缓存预编译语句。查询条件由 whereBuilder 拼接，语句形态有限；
+// 超过 maxCachedStmts 后不再缓存，直接执行
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// get 返回缓存的预编译语句，无法缓存时返回 nil。
+// 预编译时不持有锁：写连接可能正被事务占用，持锁等待会阻塞该事务中的 txStmt
+func (c *stmtCache) get(query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	full := len(c.stmts) >= maxCachedStmts
+	c.mu.Unlock()
+
+	if ok {
+		return stmt, nil
+	}
+	if full {
+		return nil, nil
+	}
+
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return existing, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (c *stmtCache) query(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := c.get(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return c.db.Query(query, args...)
+	}
+	return stmt.Query(args...)
+}
+
+func (c *stmtCache) queryRow(query string, args ...interface{}) *sql.Row {
+	stmt, err := c.get(query)
+	if err != nil || stmt == nil {
+		// 预编译失败时由 QueryRow 返回同样的错误
+		return c.db.QueryRow(query, args...)
+	}
+	return stmt.QueryRow(args...)
+}
+
+func (c *stmtCache) exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := c.get(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return c.db.Exec(query, args...)
+	}
+	return stmt.Exec(args...)
+}
+
+// txStmt 返回绑定到事务的缓存语句。写连接池只有一个连接且已被事务占用，
+// 这里不能再向连接池预编译，未缓存的语句直接在事务上预编译
+func (c *stmtCache) txStmt(tx *sql.Tx, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	c.mu.Unlock()
+
+	if !ok {
+		return tx.Prepare(query)
+	}
+	return tx.Stmt(stmt), nil
+}
+
+// warm 预编译常用语句
+func (c *stmtCache) warm(queries ...string) error {
+	for _, query := range queries {
+		if _, err := c.get(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close 关闭所有缓存的语句，结构变更（例如删除全文索引）后也需要调用
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for query, stmt := range c.stmts {
+		stmt.Close()
+		delete(c.stmts, query)
+	}
+}
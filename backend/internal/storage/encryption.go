@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"yaml-backend/internal/vault"
+	"yaml-backend/pkg/models"
+)
+
+// ErrEncryptedFilter 加密字段无法在数据库中做子串过滤
+var ErrEncryptedFilter = errors.New("substring filters are not available on encrypted columns")
+
+// encryptedColumns 返回需要加密的表和列
+func (s *SQLiteStorage) encryptedColumns() map[string][]string {
+	if s.vault == nil {
+		return nil
+	}
+	columns := map[string][]string{
+		"keyboard_inputs": {"text"},
+	}
+	if s.encryptActivities {
+		columns["activities"] = []string{"content", "window_title", "url"}
+	}
+	return columns
+}
+
+// WithEncryption 启用字段加密：keyboard_inputs.text 始终加密，encryptActivities 时同时加密
+// activities.content/window_title/url。这些列不再建立全文索引，已有的明文数据会在打开时加密
+func WithEncryption(v *vault.Vault, encryptActivities bool) Option {
+	return func(s *SQLiteStorage) {
+		s.vault = v
+		s.encryptActivities = encryptActivities
+	}
+}
+
+// setupEncryption 删除加密列的全文索引并加密已有明文
+func (s *SQLiteStorage) setupEncryption() error {
+	if s.vault == nil {
+		return nil
+	}
+
+	if err := s.dropEncryptedSearchIndexes(); err != nil {
+		return err
+	}
+
+	encrypted, err := s.Reencrypt(nil, s.vault)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt existing rows: %w", err)
+	}
+	if encrypted > 0 {
+		fmt.Printf("Encrypted %d existing plaintext fields\n", encrypted)
+	}
+	return nil
+}
+
+// Encrypted 是否启用了字段加密
+func (s *SQLiteStorage) Encrypted() bool {
+	return s.vault != nil
+}
+
+// dropEncryptedSearchIndexes 删除加密列的全文索引，避免明文残留在索引中
+func (s *SQLiteStorage) dropEncryptedSearchIndexes() error {
+	columns := s.encryptedColumns()
+	for _, source := range searchSources {
+		if _, ok := columns[source.name]; !ok {
+			continue
+		}
+		if !s.ftsEnabled {
+			// 没有 FTS5 时无法删除索引表，明确报错，不能把明文留在索引中
+			exists, err := searchIndexExists(s.db, source)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("search index %s holds plaintext and can only be removed by a build with -tags sqlite_fts5", source.ftsTable)
+			}
+			continue
+		}
+		statements := append(source.dropTriggerStatements(), fmt.Sprintf(`DROP TABLE IF EXISTS %s`, source.ftsTable))
+		for _, statement := range statements {
+			if _, err := s.db.Exec(statement); err != nil {
+				return fmt.Errorf("failed to drop search index %s: %w", source.ftsTable, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Reencrypt 将所有加密列用 to 重新加密，整个过程在一个事务中完成。
+// from 为 nil 时只加密明文数据（只需要公钥）；否则先用 from 解密（from 必须已解锁）
+func (s *SQLiteStorage) Reencrypt(from, to *vault.Vault) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var updated int64
+	for table, columns := range s.encryptedColumns() {
+		for _, column := range columns {
+			rows, err := tx.Query(fmt.Sprintf(`SELECT id, %s FROM %s WHERE %s IS NOT NULL AND %s != ''`, column, table, column, column))
+			if err != nil {
+				return 0, err
+			}
+
+			pending := make(map[int64]string)
+			for rows.Next() {
+				var id int64
+				var value string
+				if err := rows.Scan(&id, &value); err != nil {
+					rows.Close()
+					return 0, err
+				}
+
+				if vault.IsEncrypted(value) {
+					if from == nil || vault.CiphertextKeyID(value) == to.KeyID() {
+						continue
+					}
+					if value, err = from.Decrypt(value); err != nil {
+						rows.Close()
+						return 0, fmt.Errorf("failed to decrypt %s.%s id %d: %w", table, column, id, err)
+					}
+				}
+
+				if pending[id], err = to.Encrypt(value); err != nil {
+					rows.Close()
+					return 0, err
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return 0, err
+			}
+
+			for id, value := range pending {
+				if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table, column), value, id); err != nil {
+					return 0, err
+				}
+			}
+			updated += int64(len(pending))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// seal 加密单个字段，未启用加密时原样返回
+func (s *SQLiteStorage) seal(value string) (string, error) {
+	if s.vault == nil {
+		return value, nil
+	}
+	return s.vault.Encrypt(value)
+}
+
+// open 解密单个字段，锁定时返回 vault.ErrLocked
+func (s *SQLiteStorage) open(value string) (string, error) {
+	if s.vault == nil {
+		return value, nil
+	}
+	return s.vault.Decrypt(value)
+}
+
+// sealActivity 返回加密后的 content、window_title、url
+func (s *SQLiteStorage) sealActivity(activity *models.Activity) (string, string, string, error) {
+	if !s.encryptActivities {
+		return activity.Content, activity.WindowTitle, activity.URL, nil
+	}
+
+	content, err := s.seal(activity.Content)
+	if err != nil {
+		return "", "", "", err
+	}
+	windowTitle, err := s.seal(activity.WindowTitle)
+	if err != nil {
+		return "", "", "", err
+	}
+	url, err := s.seal(activity.URL)
+	if err != nil {
+		return "", "", "", err
+	}
+	return content, windowTitle, url, nil
+}
+
+// openActivity 原地解密活动记录的加密字段
+func (s *SQLiteStorage) openActivity(activity *models.Activity) error {
+	var err error
+	for _, field := range []*string{&activity.Content, &activity.WindowTitle, &activity.URL} {
+		if *field, err = s.open(*field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openKeyboardInput 原地解密键盘输入
+func (s *SQLiteStorage) openKeyboardInput(input *models.KeyboardInput) error {
+	var err error
+	input.Text, err = s.open(input.Text)
+	return err
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 导出按时间正序逐行读取，fn 返回错误时停止遍历并返回该错误。
+// SQLite 遍历期间占用一个读连接，WAL 模式下不阻塞写入
+
+// EachActivity 按时间正序遍历 [from, to) 内的活动记录，零值表示不限
+func (s *SQLiteStorage) EachActivity(from, to time.Time, fn func(*models.Activity) error) error {
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", from, to, nil)
+
+	rows, err := s.readStmts.query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration, device_id
+		FROM activities`+where.String()+` ORDER BY timestamp ASC, id ASC`, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		activity := &models.Activity{}
+		err := rows.Scan(&activity.ID, &activity.Type, &activity.Content,
+			&activity.AppName, &activity.WindowTitle, &activity.URL,
+			&activity.Timestamp, &activity.Duration, &activity.DeviceID)
+		if err != nil {
+			return err
+		}
+		if err := s.openActivity(activity); err != nil {
+			return err
+		}
+		if err := fn(activity); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachKeyboardInput 按时间正序遍历 [from, to) 内的键盘输入，零值表示不限
+func (s *SQLiteStorage) EachKeyboardInput(from, to time.Time, fn func(*models.KeyboardInput) error) error {
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", from, to, nil)
+
+	rows, err := s.readStmts.query(`SELECT `+keyboardInputColumns+`
+		FROM keyboard_inputs`+where.String()+` ORDER BY timestamp ASC, id ASC`, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		input, err := scanKeyboardInput(rows)
+		if err != nil {
+			return err
+		}
+		if err := s.openKeyboardInput(input); err != nil {
+			return err
+		}
+		if err := fn(input); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachAppUsage 按开始时间正序遍历 [from, to) 内开始的应用使用记录，零值表示不限
+func (s *SQLiteStorage) EachAppUsage(from, to time.Time, fn func(*models.AppUsage) error) error {
+	where := &whereBuilder{}
+	where.addTimeRange("start_time", from, to, nil)
+
+	rows, err := s.readStmts.query(`SELECT id, app_name, start_time, end_time, duration, device_id
+		FROM app_usage`+where.String()+` ORDER BY start_time ASC, id ASC`, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		usage := &models.AppUsage{}
+		var endTime sql.NullTime
+		if err := rows.Scan(&usage.ID, &usage.AppName, &usage.StartTime, &endTime, &usage.Duration, &usage.DeviceID); err != nil {
+			return err
+		}
+		usage.EndTime = endTime.Time
+		if err := fn(usage); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachSummary 按创建时间正序遍历 [from, to) 内创建的AI总结，零值表示不限
+func (s *SQLiteStorage) EachSummary(from, to time.Time, fn func(*SummaryResult) error) error {
+	where := &whereBuilder{}
+	where.addTimeRange("created_at", from, to, nil)
+
+	rows, err := s.readStmts.query(`SELECT `+summaryColumns+`
+		FROM ai_summaries`+where.String()+` ORDER BY created_at ASC, id ASC`, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		summary, err := scanSummary(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(summary); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// 内存存储的数据本来就在内存中，复制匹配的记录后在锁外回调
+
+func (m *MemoryStorage) EachActivity(from, to time.Time, fn func(*models.Activity) error) error {
+	m.mu.RLock()
+	var activities []*models.Activity
+	for _, activity := range m.activities {
+		if inRange(activity.Timestamp, from, to) {
+			copied := *activity
+			activities = append(activities, &copied)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].Timestamp.Equal(activities[j].Timestamp) {
+			return activities[i].Timestamp.Before(activities[j].Timestamp)
+		}
+		return activities[i].ID < activities[j].ID
+	})
+	for _, activity := range activities {
+		if err := fn(activity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) EachKeyboardInput(from, to time.Time, fn func(*models.KeyboardInput) error) error {
+	m.mu.RLock()
+	var inputs []*models.KeyboardInput
+	for _, input := range m.keyboardInputs {
+		if inRange(input.Timestamp, from, to) {
+			copied := *input
+			inputs = append(inputs, &copied)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(inputs, func(i, j int) bool {
+		if !inputs[i].Timestamp.Equal(inputs[j].Timestamp) {
+			return inputs[i].Timestamp.Before(inputs[j].Timestamp)
+		}
+		return inputs[i].ID < inputs[j].ID
+	})
+	for _, input := range inputs {
+		if err := fn(input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) EachAppUsage(from, to time.Time, fn func(*models.AppUsage) error) error {
+	m.mu.RLock()
+	var usages []*models.AppUsage
+	for _, usage := range m.appUsage {
+		if inRange(usage.StartTime, from, to) {
+			copied := *usage
+			usages = append(usages, &copied)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(usages, func(i, j int) bool {
+		if !usages[i].StartTime.Equal(usages[j].StartTime) {
+			return usages[i].StartTime.Before(usages[j].StartTime)
+		}
+		return usages[i].ID < usages[j].ID
+	})
+	for _, usage := range usages {
+		if err := fn(usage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) EachSummary(from, to time.Time, fn func(*SummaryResult) error) error {
+	m.mu.RLock()
+	var summaries []*SummaryResult
+	for _, summary := range m.summaries {
+		if inRange(summary.CreatedAt, from, to) {
+			summaries = append(summaries, copySummary(summary))
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].CreatedAt.Equal(summaries[j].CreatedAt) {
+			return summaries[i].CreatedAt.Before(summaries[j].CreatedAt)
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+	for _, summary := range summaries {
+		if err := fn(summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,549 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 可以选择性删除的数据集，名称与导出接口一致
+const (
+	DataActivities = "activities"
+	DataKeyboard   = "keyboard"
+	DataAppUsage   = "app_usage"
+)
+
+// ErrInvalidForget 删除条件无效，例如没有任何过滤条件
+var ErrInvalidForget = errors.New("invalid forget request")
+
+// ForgetQuery 选择性删除的条件，各条件同时满足的记录才会被删除
+type ForgetQuery struct {
+	From     time.Time // 起始时间（包含），应用使用记录按开始时间匹配
+	To       time.Time // 结束时间（不包含）
+	AppName  string    // 应用名，精确匹配
+	Domain   string    // 网址域名，同时匹配子域名，只适用于活动记录
+	Datasets []string  // 要删除的数据集，为空时删除全部适用的数据集
+	Vacuum   bool      // 删除后执行 VACUUM 重写数据库文件
+}
+
+// ForgetResult 一次选择性删除的结果
+type ForgetResult struct {
+	AuditID               int64 `json:"audit_id"`
+	ActivitiesDeleted     int64 `json:"activities_deleted"`
+	KeyboardInputsDeleted int64 `json:"keyboard_inputs_deleted"`
+	AppUsageDeleted       int64 `json:"app_usage_deleted"`
+	Vacuumed              bool  `json:"vacuumed"`
+	Checkpointed          bool  `json:"checkpointed"` // WAL 已截断，删除前的页面不再留在 WAL 文件中
+}
+
+// ForgetAudit 删除审计记录，只保存时间范围、使用的过滤条件种类和删除数量，
+// 不保存应用名、域名或被删除的内容，避免审计日志本身泄露用户想要忘记的信息
+type ForgetAudit struct {
+	ID                    int64      `json:"id"`
+	RequestedAt           time.Time  `json:"requested_at"`
+	From                  *time.Time `json:"from,omitempty"`
+	To                    *time.Time `json:"to,omitempty"`
+	Filters               []string   `json:"filters"` // 使用的过滤条件：time、app、domain
+	Datasets              []string   `json:"datasets"`
+	ActivitiesDeleted     int64      `json:"activities_deleted"`
+	KeyboardInputsDeleted int64      `json:"keyboard_inputs_deleted"`
+	AppUsageDeleted       int64      `json:"app_usage_deleted"`
+	Vacuumed              bool       `json:"vacuumed"`
+}
+
+// normalize 校验删除条件并补全默认的数据集
+func (q *ForgetQuery) normalize() error {
+	if q.From.IsZero() && q.To.IsZero() && q.AppName == "" && q.Domain == "" {
+		return fmt.Errorf("%w: at least one of from, to, app or domain is required", ErrInvalidForget)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidForget)
+	}
+
+	if q.Domain != "" {
+		q.Domain = normalizeDomain(q.Domain)
+		if q.Domain == "" {
+			return fmt.Errorf("%w: invalid domain", ErrInvalidForget)
+		}
+	}
+
+	if len(q.Datasets) == 0 {
+		if q.Domain != "" {
+			q.Datasets = []string{DataActivities}
+		} else {
+			q.Datasets = []string{DataActivities, DataKeyboard, DataAppUsage}
+		}
+		return nil
+	}
+	for _, dataset := range q.Datasets {
+		switch dataset {
+		case DataActivities:
+		case DataKeyboard, DataAppUsage:
+			if q.Domain != "" {
+				return fmt.Errorf("%w: domain only applies to activities, not %s", ErrInvalidForget, dataset)
+			}
+		default:
+			return fmt.Errorf("%w: unknown dataset %s", ErrInvalidForget, dataset)
+		}
+	}
+	return nil
+}
+
+func (q *ForgetQuery) includes(dataset string) bool {
+	for _, name := range q.Datasets {
+		if name == dataset {
+			return true
+		}
+	}
+	return false
+}
+
+// audit 生成不含内容的审计记录
+func (q *ForgetQuery) audit(result *ForgetResult) *ForgetAudit {
+	audit := &ForgetAudit{
+		RequestedAt:           time.Now(),
+		Filters:               []string{},
+		Datasets:              append([]string(nil), q.Datasets...),
+		ActivitiesDeleted:     result.ActivitiesDeleted,
+		KeyboardInputsDeleted: result.KeyboardInputsDeleted,
+		AppUsageDeleted:       result.AppUsageDeleted,
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		audit.Filters = append(audit.Filters, "time")
+	}
+	if !q.From.IsZero() {
+		from := q.From
+		audit.From = &from
+	}
+	if !q.To.IsZero() {
+		to := q.To
+		audit.To = &to
+	}
+	if q.AppName != "" {
+		audit.Filters = append(audit.Filters, "app")
+	}
+	if q.Domain != "" {
+		audit.Filters = append(audit.Filters, "domain")
+	}
+	return audit
+}
+
+// normalizeDomain 接受 example.com、*.example.com 或完整网址
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if strings.Contains(domain, "://") {
+		if parsed, err := url.Parse(domain); err == nil {
+			domain = parsed.Hostname()
+		}
+	}
+	return strings.Trim(strings.TrimPrefix(domain, "*."), ".")
+}
+
+// matchDomain 判断网址的主机名是否为 domain 或其子域名
+func matchDomain(rawURL, domain string) bool {
+	if rawURL == "" {
+		return false
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		// 没有协议的网址（例如 github.com/foo）
+		if parsed, err = url.Parse("https://" + rawURL); err != nil {
+			return false
+		}
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Forget 在一个事务中删除匹配的活动、键盘输入和应用使用记录，同步扣减统计数据并写入审计日志。
+// 删除期间开启 secure_delete，被释放的页面用零覆盖；全文索引随触发器同步删除后再合并段，
+// 最后截断 WAL，使删除前的页面不再留在 WAL 文件中
+func (s *SQLiteStorage) Forget(q ForgetQuery) (*ForgetResult, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
+	}
+
+	var secureDelete int
+	if err := s.db.QueryRow(`PRAGMA secure_delete`).Scan(&secureDelete); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return nil, fmt.Errorf("failed to enable secure_delete: %w", err)
+	}
+	defer s.db.Exec(fmt.Sprintf(`PRAGMA secure_delete = %d`, secureDelete))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ForgetResult{}
+	delta := make(rollupDelta)
+	var tombstones []syncIdentity
+
+	if q.includes(DataActivities) {
+		if result.ActivitiesDeleted, err = s.forgetActivities(tx, &q, delta, &tombstones); err != nil {
+			return nil, fmt.Errorf("failed to delete activities: %w", err)
+		}
+	}
+	if q.includes(DataKeyboard) {
+		if result.KeyboardInputsDeleted, err = forgetKeyboardInputs(tx, &q, delta, &tombstones); err != nil {
+			return nil, fmt.Errorf("failed to delete keyboard inputs: %w", err)
+		}
+	}
+	if q.includes(DataAppUsage) {
+		if result.AppUsageDeleted, err = forgetAppUsage(tx, &q, &tombstones); err != nil {
+			return nil, fmt.Errorf("failed to delete app usage: %w", err)
+		}
+	}
+
+	if err := s.applyRollups(tx, delta); err != nil {
+		return nil, err
+	}
+	if err := s.addTombstones(tx, tombstones); err != nil {
+		return nil, fmt.Errorf("failed to write sync tombstones: %w", err)
+	}
+	for _, table := range []string{"hourly_app_stats", "daily_app_stats"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table + `
+			WHERE activity_count = 0 AND keyboard_count = 0 AND keystrokes = 0 AND duration = 0`); err != nil {
+			return nil, err
+		}
+	}
+
+	audit := q.audit(result)
+	res, err := tx.Exec(`INSERT INTO forget_log (requested_at, from_time, to_time, filters, datasets,
+		activities_deleted, keyboard_inputs_deleted, app_usage_deleted) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		dbTime(audit.RequestedAt), nullTime(q.From), nullTime(q.To), strings.Join(audit.Filters, ","),
+		strings.Join(audit.Datasets, ","), result.ActivitiesDeleted, result.KeyboardInputsDeleted, result.AppUsageDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write forget audit log: %w", err)
+	}
+	if result.AuditID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// 合并全文索引的段，被删除的词条不再留在旧段中
+	if s.ftsEnabled && (result.ActivitiesDeleted > 0 || result.KeyboardInputsDeleted > 0) {
+		if err := s.optimizeSearchIndexes(); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Vacuum {
+		if _, err := s.db.Exec(`VACUUM`); err != nil {
+			return nil, fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		if _, err := s.db.Exec(`UPDATE forget_log SET vacuumed = 1 WHERE id = ?`, result.AuditID); err != nil {
+			return nil, err
+		}
+		result.Vacuumed = true
+	}
+
+	// 有读取者持有旧快照时无法截断，返回 checkpointed = false
+	var busy, logFrames, checkpointed int
+	if err := s.db.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+	result.Checkpointed = busy == 0
+
+	return result, nil
+}
+
+// forgetActivities 删除匹配的活动记录。按域名删除时逐条解密网址后匹配，
+// 被删除记录的全局标识追加到 tombstones，删除随同步传播到其他设备
+func (s *SQLiteStorage) forgetActivities(tx *sql.Tx, q *ForgetQuery, delta rollupDelta, tombstones *[]syncIdentity) (int64, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", q.From, q.To, nil)
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+
+	rows, err := tx.Query(`SELECT id, COALESCE(app_name, ''), timestamp, COALESCE(duration, 0), COALESCE(url, ''),
+		device_id, COALESCE(origin_id, id) FROM activities`+where.String(), where.args...)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		activity := &models.Activity{}
+		identity := syncIdentity{kind: SyncKindActivity}
+		if err := rows.Scan(&activity.ID, &activity.AppName, &activity.Timestamp, &activity.Duration, &activity.URL,
+			&identity.deviceID, &identity.originID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if q.Domain != "" {
+			if activity.URL, err = s.open(activity.URL); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			if !matchDomain(activity.URL, q.Domain) {
+				continue
+			}
+		}
+		ids = append(ids, activity.ID)
+		*tombstones = append(*tombstones, identity)
+		delta.add(&models.HourlyAppStats{Hour: HourBucket(activity.Timestamp), AppName: activity.AppName,
+			ActivityCount: 1, Duration: activity.Duration}, -1)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return deleteByID(tx, "activities", ids)
+}
+
+func forgetKeyboardInputs(tx *sql.Tx, q *ForgetQuery, delta rollupDelta, tombstones *[]syncIdentity) (int64, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", q.From, q.To, nil)
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+
+	rows, err := tx.Query(`SELECT id, COALESCE(app_name, ''), timestamp, keystrokes, device_id, COALESCE(origin_id, id)
+		FROM keyboard_inputs`+where.String(), where.args...)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id, count int64
+		var appName string
+		var timestamp time.Time
+		identity := syncIdentity{kind: SyncKindKeyboardInput}
+		if err := rows.Scan(&id, &appName, &timestamp, &count, &identity.deviceID, &identity.originID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		*tombstones = append(*tombstones, identity)
+		delta.add(&models.HourlyAppStats{Hour: HourBucket(timestamp), AppName: appName,
+			KeyboardCount: 1, Keystrokes: count}, -1)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return deleteByID(tx, "keyboard_inputs", ids)
+}
+
+func forgetAppUsage(tx *sql.Tx, q *ForgetQuery, tombstones *[]syncIdentity) (int64, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("start_time", q.From, q.To, nil)
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+
+	rows, err := tx.Query(`DELETE FROM app_usage`+where.String()+` RETURNING device_id, COALESCE(origin_id, id)`, where.args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var deleted int64
+	for rows.Next() {
+		identity := syncIdentity{kind: SyncKindAppUsage}
+		if err := rows.Scan(&identity.deviceID, &identity.originID); err != nil {
+			return 0, err
+		}
+		*tombstones = append(*tombstones, identity)
+		deleted++
+	}
+	return deleted, rows.Err()
+}
+
+// deleteByID 逐条删除，全文索引的触发器按行同步
+func deleteByID(tx *sql.Tx, table string, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	stmt, err := tx.Prepare(`DELETE FROM ` + table + ` WHERE id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var deleted int64
+	for _, id := range ids {
+		res, err := stmt.Exec(id)
+		if err != nil {
+			return 0, err
+		}
+		affected, _ := res.RowsAffected()
+		deleted += affected
+	}
+	return deleted, nil
+}
+
+// optimizeSearchIndexes 合并活动记录和键盘输入的全文索引
+func (s *SQLiteStorage) optimizeSearchIndexes() error {
+	for _, source := range searchSources {
+		if source.name == SearchSourceSummaries {
+			continue
+		}
+		var exists int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, source.ftsTable).Scan(&exists); err != nil {
+			return err
+		}
+		if exists == 0 {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES('optimize')`, source.ftsTable)); err != nil {
+			return fmt.Errorf("failed to optimize search index %s: %w", source.ftsTable, err)
+		}
+	}
+	return nil
+}
+
+// nullTime 零值时间写入 NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: dbTime(t), Valid: !t.IsZero()}
+}
+
+// GetForgetLog 按时间倒序获取删除审计记录
+func (s *SQLiteStorage) GetForgetLog(limit int) ([]*ForgetAudit, error) {
+	rows, err := s.readStmts.query(`SELECT id, requested_at, from_time, to_time, filters, datasets,
+		activities_deleted, keyboard_inputs_deleted, app_usage_deleted, vacuumed
+		FROM forget_log ORDER BY id DESC LIMIT ?`, pageSize(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var audits []*ForgetAudit
+	for rows.Next() {
+		audit := &ForgetAudit{}
+		var from, to sql.NullTime
+		var filters, datasets string
+		if err := rows.Scan(&audit.ID, &audit.RequestedAt, &from, &to, &filters, &datasets,
+			&audit.ActivitiesDeleted, &audit.KeyboardInputsDeleted, &audit.AppUsageDeleted, &audit.Vacuumed); err != nil {
+			return nil, err
+		}
+		if from.Valid {
+			audit.From = &from.Time
+		}
+		if to.Valid {
+			audit.To = &to.Time
+		}
+		audit.Filters = splitList(filters)
+		audit.Datasets = splitList(datasets)
+		audits = append(audits, audit)
+	}
+	return audits, rows.Err()
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// Forget 与 SQLiteStorage 相同：删除匹配的记录、扣减统计并记录审计日志，内存存储没有需要回收的文件
+func (m *MemoryStorage) Forget(q ForgetQuery) (*ForgetResult, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &ForgetResult{Vacuumed: q.Vacuum, Checkpointed: true}
+	delta := make(rollupDelta)
+	forgotten := make(map[string]map[int64]bool)
+	forget := func(table string, id int64) {
+		if forgotten[table] == nil {
+			forgotten[table] = make(map[int64]bool)
+		}
+		forgotten[table][id] = true
+	}
+
+	if q.includes(DataActivities) {
+		var kept []*models.Activity
+		for _, activity := range m.activities {
+			if !inRange(activity.Timestamp, q.From, q.To) || (q.AppName != "" && activity.AppName != q.AppName) ||
+				(q.Domain != "" && !matchDomain(activity.URL, q.Domain)) {
+				kept = append(kept, activity)
+				continue
+			}
+			delta.add(&models.HourlyAppStats{Hour: HourBucket(activity.Timestamp), AppName: activity.AppName,
+				ActivityCount: 1, Duration: activity.Duration}, -1)
+			forget("activities", activity.ID)
+			m.dropSync("activities", activity.ID, true)
+			m.dropLinks(LinkActivity, activity.ID)
+			result.ActivitiesDeleted++
+		}
+		m.activities = kept
+	}
+
+	if q.includes(DataKeyboard) {
+		var kept []*models.KeyboardInput
+		for _, input := range m.keyboardInputs {
+			if !inRange(input.Timestamp, q.From, q.To) || (q.AppName != "" && input.AppName != q.AppName) {
+				kept = append(kept, input)
+				continue
+			}
+			delta.add(&models.HourlyAppStats{Hour: HourBucket(input.Timestamp), AppName: input.AppName,
+				KeyboardCount: 1, Keystrokes: inputKeystrokes(input)}, -1)
+			m.dropSync("keyboard_inputs", input.ID, true)
+			result.KeyboardInputsDeleted++
+		}
+		m.keyboardInputs = kept
+	}
+
+	if q.includes(DataAppUsage) {
+		var kept []*models.AppUsage
+		for _, usage := range m.appUsage {
+			if !inRange(usage.StartTime, q.From, q.To) || (q.AppName != "" && usage.AppName != q.AppName) {
+				kept = append(kept, usage)
+				continue
+			}
+			forget("app_usage", usage.ID)
+			m.dropSync("app_usage", usage.ID, true)
+			m.dropLinks(LinkAppUsage, usage.ID)
+			result.AppUsageDeleted++
+		}
+		m.appUsage = kept
+	}
+
+	m.applyRollups(delta)
+
+	// 与 SQLite 中随记录删除的导入键一致，被删除的导入记录可以重新导入
+	for key, record := range m.importKeys {
+		if forgotten[record.table][record.id] {
+			delete(m.importKeys, key)
+		}
+	}
+
+	audit := q.audit(result)
+	audit.ID = m.allocID("forget_log")
+	audit.Vacuumed = q.Vacuum
+	m.forgetLog = append(m.forgetLog, audit)
+	result.AuditID = audit.ID
+	return result, nil
+}
+
+// GetForgetLog 按时间倒序获取删除审计记录
+func (m *MemoryStorage) GetForgetLog(limit int) ([]*ForgetAudit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	audits := make([]*ForgetAudit, 0, len(m.forgetLog))
+	for i := len(m.forgetLog) - 1; i >= 0; i-- {
+		copied := *m.forgetLog[i]
+		audits = append(audits, &copied)
+	}
+	return audits[:applyLimit(len(audits), pageSize(limit))], nil
+}
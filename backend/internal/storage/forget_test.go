@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+func TestForgetDeletesRequestedLocalHour(t *testing.T) {
+	withLocalZone(t, shanghai)
+	// 采集程序上报的时间为 UTC：01:30Z、02:30Z、03:30Z 即本地 09:30、10:30、11:30
+	times := []time.Time{
+		time.Date(2025, 9, 5, 1, 30, 0, 0, time.UTC),
+		time.Date(2025, 9, 5, 2, 30, 0, 0, time.UTC),
+		time.Date(2025, 9, 5, 3, 30, 0, 0, time.UTC),
+	}
+	from := time.Date(2025, 9, 5, 10, 0, 0, 0, shanghai)
+	to := time.Date(2025, 9, 5, 11, 0, 0, 0, shanghai)
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, at := range times {
+				label := at.In(shanghai).Format("15:04")
+				if err := store.SaveActivity(&models.Activity{Type: models.ActivityTypeApp, Content: label,
+					AppName: "Code", Timestamp: at}); err != nil {
+					t.Fatalf("SaveActivity: %v", err)
+				}
+				if err := store.SaveKeyboardInput(&models.KeyboardInput{Text: label, AppName: "Code", Timestamp: at}); err != nil {
+					t.Fatalf("SaveKeyboardInput: %v", err)
+				}
+				if err := store.SaveAppUsage(&models.AppUsage{AppName: label, StartTime: at,
+					EndTime: at.Add(10 * time.Minute), Duration: 600}); err != nil {
+					t.Fatalf("SaveAppUsage: %v", err)
+				}
+			}
+
+			result, err := store.Forget(ForgetQuery{From: from, To: to})
+			if err != nil {
+				t.Fatalf("Forget: %v", err)
+			}
+			if result.ActivitiesDeleted != 1 || result.KeyboardInputsDeleted != 1 || result.AppUsageDeleted != 1 {
+				t.Errorf("deleted %d activities, %d keyboard inputs, %d app usage; want 1 of each",
+					result.ActivitiesDeleted, result.KeyboardInputsDeleted, result.AppUsageDeleted)
+			}
+
+			want := []string{"11:30", "09:30"}
+			activities, _, err := store.QueryActivities(ActivityQuery{})
+			if err != nil {
+				t.Fatalf("QueryActivities: %v", err)
+			}
+			inputs, _, err := store.QueryKeyboardInputs(KeyboardQuery{})
+			if err != nil {
+				t.Fatalf("QueryKeyboardInputs: %v", err)
+			}
+			usage, err := store.QueryAppUsage(AppUsageQuery{})
+			if err != nil {
+				t.Fatalf("QueryAppUsage: %v", err)
+			}
+			var gotActivities, gotInputs, gotUsage []string
+			for _, activity := range activities {
+				gotActivities = append(gotActivities, activity.Content)
+			}
+			for _, input := range inputs {
+				gotInputs = append(gotInputs, input.Text)
+			}
+			for _, u := range usage {
+				gotUsage = append(gotUsage, u.AppName)
+			}
+			for kind, got := range map[string][]string{"activities": gotActivities, "keyboard inputs": gotInputs, "app usage": gotUsage} {
+				if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+					t.Errorf("remaining %s = %q, want %q", kind, got, want)
+				}
+			}
+
+			audits, err := store.GetForgetLog(1)
+			if err != nil {
+				t.Fatalf("GetForgetLog: %v", err)
+			}
+			if len(audits) != 1 || audits[0].From == nil || !audits[0].From.Equal(from) || !audits[0].To.Equal(to) {
+				t.Errorf("audit log = %+v, want range %v - %v", audits, from, to)
+			}
+		})
+	}
+}
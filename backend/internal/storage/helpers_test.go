@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// shanghai 测试用的非 UTC 本地时区
+var shanghai = time.FixedZone("CST", 8*3600)
+
+// withLocalZone 测试期间把本地时区设为 zone
+func withLocalZone(t *testing.T, zone *time.Location) {
+	t.Helper()
+	local := time.Local
+	time.Local = zone
+	t.Cleanup(func() { time.Local = local })
+}
+
+// testStores 返回数据文件在临时目录中的 SQLite 存储和内存存储，测试结束时关闭
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	sqlite, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	memory := NewMemoryStorage()
+	t.Cleanup(func() {
+		sqlite.Close()
+		memory.Close()
+	})
+	return map[string]Store{"sqlite": sqlite, "memory": memory}
+}
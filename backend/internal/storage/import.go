@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// ImportBatch 从其他工具导入的一批记录。Key 在同一 Source 内唯一标识一条外部记录，
+// 已导入过的 Key 会被跳过，重复导入同一文件不会产生重复数据
+type ImportBatch struct {
+	Source     string
+	Activities []ImportedActivity
+	AppUsage   []ImportedAppUsage
+}
+
+// ImportedActivity 带外部标识的活动记录
+type ImportedActivity struct {
+	Key      string
+	Activity *models.Activity
+}
+
+// ImportedAppUsage 带外部标识的应用使用记录
+type ImportedAppUsage struct {
+	Key   string
+	Usage *models.AppUsage
+}
+
+// ImportResult 一批导入记录的写入结果
+type ImportResult struct {
+	Inserted int `json:"inserted"`
+	Skipped  int `json:"skipped"` // 之前已导入过
+}
+
+const (
+	importActivitySQL = `INSERT OR IGNORE INTO activities
+		(type, content, app_name, window_title, url, timestamp, duration, import_source, import_key, device_id, sync_seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	importAppUsageSQL = `INSERT OR IGNORE INTO app_usage
+		(app_name, start_time, end_time, duration, import_source, import_key, device_id, sync_seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+)
+
+// SaveImport 在一个事务中写入导入的记录并累加统计，忽略已导入过的 Key，新插入的记录回填 ID
+func (s *SQLiteStorage) SaveImport(batch *ImportBatch) (*ImportResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{}
+	delta := make(rollupDelta)
+	// 按批次大小预留序号，被跳过的记录留下的空缺不影响同步
+	seq, err := s.reserveSyncSeq(tx, len(batch.Activities)+len(batch.AppUsage))
+	if err != nil {
+		return nil, err
+	}
+	activityIDs := make([]int64, len(batch.Activities))
+	if len(batch.Activities) > 0 {
+		stmt, err := s.writeStmts.txStmt(tx, importActivitySQL)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+
+		for i, imported := range batch.Activities {
+			activity := imported.Activity
+			content, windowTitle, url, err := s.sealActivity(activity)
+			if err != nil {
+				return nil, err
+			}
+			res, err := stmt.Exec(activity.Type, content, activity.AppName, windowTitle, url,
+				dbTime(activity.Timestamp), activity.Duration, batch.Source, imported.Key, s.deviceID, seq)
+			if err != nil {
+				return nil, err
+			}
+			seq++
+			if affected, _ := res.RowsAffected(); affected == 0 {
+				result.Skipped++
+				continue
+			}
+			if activityIDs[i], err = res.LastInsertId(); err != nil {
+				return nil, err
+			}
+			if err := s.tagActivity(tx, activityIDs[i], activity); err != nil {
+				return nil, err
+			}
+			delta.addActivity(activity)
+			result.Inserted++
+		}
+	}
+
+	usageIDs := make([]int64, len(batch.AppUsage))
+	if len(batch.AppUsage) > 0 {
+		stmt, err := s.writeStmts.txStmt(tx, importAppUsageSQL)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+
+		for i, imported := range batch.AppUsage {
+			usage := imported.Usage
+			res, err := stmt.Exec(usage.AppName, dbTime(usage.StartTime), dbTime(usage.EndTime), usage.Duration,
+				batch.Source, imported.Key, s.deviceID, seq)
+			if err != nil {
+				return nil, err
+			}
+			seq++
+			if affected, _ := res.RowsAffected(); affected == 0 {
+				result.Skipped++
+				continue
+			}
+			if usageIDs[i], err = res.LastInsertId(); err != nil {
+				return nil, err
+			}
+			result.Inserted++
+		}
+	}
+
+	if err := s.applyRollups(tx, delta); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for i, imported := range batch.Activities {
+		if activityIDs[i] != 0 {
+			imported.Activity.ID = activityIDs[i]
+			imported.Activity.DeviceID = s.deviceID
+		}
+	}
+	for i, imported := range batch.AppUsage {
+		if usageIDs[i] != 0 {
+			imported.Usage.ID = usageIDs[i]
+			imported.Usage.DeviceID = s.deviceID
+		}
+	}
+	return result, nil
+}
+
+// importKey 内存存储中导入记录的唯一键
+func importKey(table, source, key string) string {
+	return table + "\x00" + source + "\x00" + key
+}
+
+// importedRecord 内存存储中导入键对应的记录，清理或删除记录时一并删除导入键
+type importedRecord struct {
+	table     string
+	id        int64
+	timestamp time.Time
+}
+
+func (m *MemoryStorage) SaveImport(batch *ImportBatch) (*ImportResult, error) {
+	result := &ImportResult{}
+
+	// 记录导入键对应的记录，数据清理或删除时一并删除，与 SQLite 中随记录删除的行为一致
+	claim := func(table, key string, timestamp time.Time) *importedRecord {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		k := importKey(table, batch.Source, key)
+		if _, ok := m.importKeys[k]; ok {
+			return nil
+		}
+		record := &importedRecord{table: table, timestamp: timestamp}
+		m.importKeys[k] = record
+		return record
+	}
+	saved := func(record *importedRecord, id int64, key string) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		record.id = id
+		if meta := m.syncMeta[syncKey{record.table, id}]; meta != nil {
+			meta.importSource, meta.importKey = batch.Source, key
+		}
+	}
+
+	for _, imported := range batch.Activities {
+		record := claim("activities", imported.Key, imported.Activity.Timestamp)
+		if record == nil {
+			result.Skipped++
+			continue
+		}
+		if err := m.SaveActivity(imported.Activity); err != nil {
+			return nil, err
+		}
+		saved(record, imported.Activity.ID, imported.Key)
+		result.Inserted++
+	}
+	for _, imported := range batch.AppUsage {
+		record := claim("app_usage", imported.Key, imported.Usage.StartTime)
+		if record == nil {
+			result.Skipped++
+			continue
+		}
+		if err := m.SaveAppUsage(imported.Usage); err != nil {
+			return nil, err
+		}
+		saved(record, imported.Usage.ID, imported.Key)
+		result.Inserted++
+	}
+	return result, nil
+}
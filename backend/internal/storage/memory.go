@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"yaml-backend/pkg/models"
+)
+
+// MemoryStorage 内存存储实现，行为与 SQLiteStorage 保持一致，用于测试和演示
+type MemoryStorage struct {
+	mu             sync.RWMutex
+	activities     []*models.Activity
+	keyboardInputs []*models.KeyboardInput
+	summaries      []*SummaryResult
+	appUsage       []*models.AppUsage
+	screenshots    []*models.Screenshot
+	hourlyStats    map[rollupKey]*models.HourlyAppStats
+	dailyStats     map[rollupKey]*models.DailyAppStats
+	nextID         map[string]int64
+	importKeys     map[string]*importedRecord // 已导入的外部记录
+	forgetLog      []*ForgetAudit
+	deviceID       string
+	syncSeq        int64
+	syncMeta       map[syncKey]*syncMeta
+	syncIndex      map[syncIdentity]int64 // 全局标识到本机 ID
+	tombstones     map[syncIdentity]int64 // 删除标记及其变更序号
+	syncPeers      map[string]*SyncPeer
+	tags           []*models.Tag
+	projects       []*models.Project
+	tagRules       []*models.TagRule
+	rules          []*compiledRule // 生效的自动打标签规则
+	links          map[Link]int64  // 关联及生成它的规则 ID，手动关联为 0
+	changeLog      []*Change
+	changeSeq      int64
+	changeCh       chan struct{} // 追加变更时关闭并替换，唤醒等待中的读取方
+}
+
+// NewMemoryStorage 创建内存存储
+func NewMemoryStorage() *MemoryStorage {
+	deviceID, err := newDeviceID()
+	if err != nil {
+		panic(err)
+	}
+	return &MemoryStorage{
+		hourlyStats: make(map[rollupKey]*models.HourlyAppStats),
+		dailyStats:  make(map[rollupKey]*models.DailyAppStats),
+		nextID:      make(map[string]int64),
+		importKeys:  make(map[string]*importedRecord),
+		deviceID:    deviceID,
+		syncMeta:    make(map[syncKey]*syncMeta),
+		syncIndex:   make(map[syncIdentity]int64),
+		tombstones:  make(map[syncIdentity]int64),
+		syncPeers:   make(map[string]*SyncPeer),
+		links:       make(map[Link]int64),
+		changeCh:    make(chan struct{}),
+	}
+}
+
+// allocID 为指定表分配自增ID（调用方需持有写锁）
+func (m *MemoryStorage) allocID(table string) int64 {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+func (m *MemoryStorage) SaveActivity(activity *models.Activity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.insertActivity(activity)
+	activity.ID, activity.DeviceID = stored.ID, stored.DeviceID
+	return nil
+}
+
+// insertActivity 保存活动记录的副本，不修改调用方的结构体（调用方需持有写锁）
+func (m *MemoryStorage) insertActivity(activity *models.Activity) *models.Activity {
+	stored := *activity
+	stored.ID = m.allocID("activities")
+	stored.DeviceID = m.deviceID
+	stored.Timestamp = stored.Timestamp.Round(0)
+	m.activities = append(m.activities, &stored)
+	m.stampSync("activities", stored.ID, m.deviceID, 0)
+	m.tagActivity(&stored)
+	delta := make(rollupDelta)
+	delta.addActivity(&stored)
+	m.applyRollups(delta)
+	return &stored
+}
+
+func (m *MemoryStorage) SaveKeyboardInput(input *models.KeyboardInput) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.insertKeyboardInput(input)
+	input.ID, input.DeviceID = stored.ID, stored.DeviceID
+	return nil
+}
+
+// insertKeyboardInput 保存键盘输入的副本，不修改调用方的结构体（调用方需持有写锁）
+func (m *MemoryStorage) insertKeyboardInput(input *models.KeyboardInput) *models.KeyboardInput {
+	stored := *input
+	stored.ID = m.allocID("keyboard_inputs")
+	stored.DeviceID = m.deviceID
+	stored.Timestamp = stored.Timestamp.Round(0)
+	stored.KeyCount = inputKeystrokes(&stored)
+	m.keyboardInputs = append(m.keyboardInputs, &stored)
+	m.stampSync("keyboard_inputs", stored.ID, m.deviceID, 0)
+	delta := make(rollupDelta)
+	delta.addKeyboardInput(stored.AppName, stored.Timestamp, stored.KeyCount)
+	m.applyRollups(delta)
+	return &stored
+}
+
+func (m *MemoryStorage) GetRecentActivities(limit int) ([]*models.Activity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sorted := make([]*models.Activity, len(m.activities))
+	copy(sorted, m.activities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.After(sorted[j].Timestamp)
+	})
+
+	var activities []*models.Activity
+	for _, activity := range sorted[:applyLimit(len(sorted), limit)] {
+		copied := *activity
+		activities = append(activities, &copied)
+	}
+	return activities, nil
+}
+
+func (m *MemoryStorage) GetRecentKeyboardInputs(limit int) ([]*models.KeyboardInput, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sorted := make([]*models.KeyboardInput, len(m.keyboardInputs))
+	copy(sorted, m.keyboardInputs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.After(sorted[j].Timestamp)
+	})
+
+	var inputs []*models.KeyboardInput
+	for _, input := range sorted[:applyLimit(len(sorted), limit)] {
+		copied := *input
+		inputs = append(inputs, &copied)
+	}
+	return inputs, nil
+}
+
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// GetActivityCount 从每日统计获取活动记录总数
+func (m *MemoryStorage) GetActivityCount() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, stats := range m.dailyStats {
+		count += stats.ActivityCount
+	}
+	return int(count), nil
+}
+
+// GetKeyboardInputCount 从每日统计获取键盘输入总数
+func (m *MemoryStorage) GetKeyboardInputCount() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, stats := range m.dailyStats {
+		count += stats.KeyboardCount
+	}
+	return int(count), nil
+}
+
+// GetMostActiveApp 从每日统计获取最活跃的应用，计数相同时按应用名排序取第一个
+func (m *MemoryStorage) GetMostActiveApp() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, stats := range m.dailyStats {
+		if stats.AppName != "" {
+			counts[stats.AppName] += stats.ActivityCount
+		}
+	}
+
+	best, bestCount := "-", int64(0)
+	for appName, count := range counts {
+		if count > bestCount || (count == bestCount && count > 0 && appName < best) {
+			best, bestCount = appName, count
+		}
+	}
+	return best, nil
+}
+
+// applyLimit 按SQLite的LIMIT语义计算截取长度，负数表示不限制
+func applyLimit(total, limit int) int {
+	if limit < 0 || limit > total {
+		return total
+	}
+	return limit
+}
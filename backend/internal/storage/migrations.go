@@ -0,0 +1,558 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// migration 一次版本化的数据库结构升级
+type migration struct {
+	version     int
+	description string
+	statements  []string
+	// backfill 在同一事务中执行语句之后运行，用于无法用 SQL 完成的数据回填
+	backfill func(s *SQLiteStorage, tx *sql.Tx) error
+}
+
+// migrations 按版本号升序排列的全部升级步骤，只能追加，不能修改已发布的条目
+var migrations = []migration{
+	{
+		version:     1,
+		description: "initial schema",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS activities (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				type TEXT NOT NULL,
+				content TEXT,
+				app_name TEXT,
+				window_title TEXT,
+				url TEXT,
+				timestamp DATETIME NOT NULL,
+				duration INTEGER DEFAULT 0
+			)`,
+			`CREATE TABLE IF NOT EXISTS keyboard_inputs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				text TEXT NOT NULL,
+				app_name TEXT,
+				timestamp DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS app_usage (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				app_name TEXT NOT NULL,
+				start_time DATETIME NOT NULL,
+				end_time DATETIME,
+				duration INTEGER DEFAULT 0
+			)`,
+			`CREATE TABLE IF NOT EXISTS ai_summaries (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				type TEXT NOT NULL,
+				summary TEXT NOT NULL,
+				data_count INTEGER DEFAULT 0,
+				created_at DATETIME NOT NULL
+			)`,
+		},
+	},
+	{
+		version:     2,
+		description: "daily app stats rollups for retention",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS daily_app_stats (
+				day TEXT NOT NULL,
+				app_name TEXT NOT NULL,
+				activity_count INTEGER NOT NULL DEFAULT 0,
+				keyboard_count INTEGER NOT NULL DEFAULT 0,
+				duration INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (day, app_name)
+			)`,
+		},
+	},
+	{
+		version:     3,
+		description: "index app usage sessions by start time",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_app_usage_start_time ON app_usage (start_time)`,
+		},
+	},
+	{
+		version:     4,
+		description: "secondary indexes for time range, app and type queries",
+		statements: []string{
+			// 索引隐含 rowid，可以直接满足 ORDER BY timestamp DESC, id DESC
+			`CREATE INDEX IF NOT EXISTS idx_activities_timestamp ON activities (timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_activities_app_name_timestamp ON activities (app_name, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_activities_type_timestamp ON activities (type, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_keyboard_inputs_timestamp ON keyboard_inputs (timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_keyboard_inputs_app_name_timestamp ON keyboard_inputs (app_name, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_ai_summaries_created_at ON ai_summaries (created_at)`,
+			`ANALYZE`,
+		},
+	},
+	{
+		version:     5,
+		description: "import source keys for idempotent imports",
+		statements: []string{
+			// 本机采集的记录 import_source 为 NULL，部分唯一索引只约束导入的记录
+			`ALTER TABLE activities ADD COLUMN import_source TEXT`,
+			`ALTER TABLE activities ADD COLUMN import_key TEXT`,
+			`ALTER TABLE app_usage ADD COLUMN import_source TEXT`,
+			`ALTER TABLE app_usage ADD COLUMN import_key TEXT`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_activities_import ON activities (import_source, import_key)
+				WHERE import_source IS NOT NULL`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_app_usage_import ON app_usage (import_source, import_key)
+				WHERE import_source IS NOT NULL`,
+		},
+	},
+	{
+		version:     6,
+		description: "hourly and daily rollups maintained on insert",
+		statements: []string{
+			// 键盘输入的字符数在写入时根据明文计算，加密后重建统计无需解密
+			`ALTER TABLE keyboard_inputs ADD COLUMN keystrokes INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE daily_app_stats ADD COLUMN keystrokes INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE IF NOT EXISTS hourly_app_stats (
+				hour TEXT NOT NULL,
+				app_name TEXT NOT NULL,
+				activity_count INTEGER NOT NULL DEFAULT 0,
+				keyboard_count INTEGER NOT NULL DEFAULT 0,
+				keystrokes INTEGER NOT NULL DEFAULT 0,
+				duration INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (hour, app_name)
+			)`,
+		},
+		// 之前的 daily_app_stats 只包含已清理的数据，把现有的原始记录汇总进来
+		backfill: func(s *SQLiteStorage, tx *sql.Tx) error {
+			if err := s.backfillKeystrokes(tx); err != nil {
+				return err
+			}
+			_, err := s.rebuildRollups(tx, time.Time{})
+			return err
+		},
+	},
+	{
+		version:     7,
+		description: "audit log of selective deletions",
+		statements: []string{
+			// 只记录时间范围、使用了哪些过滤条件和删除数量，不记录应用名、域名或被删除的内容
+			`CREATE TABLE IF NOT EXISTS forget_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				requested_at DATETIME NOT NULL,
+				from_time DATETIME,
+				to_time DATETIME,
+				filters TEXT NOT NULL,
+				datasets TEXT NOT NULL,
+				activities_deleted INTEGER NOT NULL DEFAULT 0,
+				keyboard_inputs_deleted INTEGER NOT NULL DEFAULT 0,
+				app_usage_deleted INTEGER NOT NULL DEFAULT 0,
+				vacuumed INTEGER NOT NULL DEFAULT 0
+			)`,
+		},
+	},
+	{
+		version:     8,
+		description: "provenance and token usage of AI summaries",
+		statements: []string{
+			`ALTER TABLE ai_summaries ADD COLUMN source_from DATETIME`,
+			`ALTER TABLE ai_summaries ADD COLUMN source_to DATETIME`,
+			`ALTER TABLE ai_summaries ADD COLUMN first_record_id INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE ai_summaries ADD COLUMN last_record_id INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE ai_summaries ADD COLUMN model TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE ai_summaries ADD COLUMN prompt_version TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE ai_summaries ADD COLUMN finish_reason TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE ai_summaries ADD COLUMN prompt_tokens INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE ai_summaries ADD COLUMN completion_tokens INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE ai_summaries ADD COLUMN total_tokens INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX IF NOT EXISTS idx_ai_summaries_type_created_at ON ai_summaries (type, created_at)`,
+			// 生成总结时写入提示词的来源记录，record_id 指向 type 对应的表
+			`CREATE TABLE IF NOT EXISTS ai_summary_records (
+				summary_id INTEGER NOT NULL,
+				record_id INTEGER NOT NULL,
+				PRIMARY KEY (summary_id, record_id)
+			) WITHOUT ROWID`,
+		},
+	},
+	{
+		version:     9,
+		description: "device identity and change sequence for multi-device sync",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS sync_state (
+				id INTEGER PRIMARY KEY CHECK (id = 1),
+				device_id TEXT NOT NULL,
+				seq INTEGER NOT NULL DEFAULT 0
+			)`,
+			// 本机写入的记录 origin_id 为 NULL，在所有设备上以 (device_id, id) 标识；
+			// 从其他设备合并的记录保存来源设备上的 (device_id, origin_id)
+			`ALTER TABLE activities ADD COLUMN device_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE activities ADD COLUMN origin_id INTEGER`,
+			`ALTER TABLE activities ADD COLUMN revision INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE activities ADD COLUMN sync_seq INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE keyboard_inputs ADD COLUMN device_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE keyboard_inputs ADD COLUMN origin_id INTEGER`,
+			`ALTER TABLE keyboard_inputs ADD COLUMN sync_seq INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE app_usage ADD COLUMN device_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE app_usage ADD COLUMN origin_id INTEGER`,
+			`ALTER TABLE app_usage ADD COLUMN sync_seq INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE ai_summaries ADD COLUMN device_id TEXT NOT NULL DEFAULT ''`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_activities_origin ON activities (device_id, origin_id)
+				WHERE origin_id IS NOT NULL`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_keyboard_inputs_origin ON keyboard_inputs (device_id, origin_id)
+				WHERE origin_id IS NOT NULL`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_app_usage_origin ON app_usage (device_id, origin_id)
+				WHERE origin_id IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_activities_sync_seq ON activities (sync_seq)`,
+			`CREATE INDEX IF NOT EXISTS idx_keyboard_inputs_sync_seq ON keyboard_inputs (sync_seq)`,
+			`CREATE INDEX IF NOT EXISTS idx_app_usage_sync_seq ON app_usage (sync_seq)`,
+			// 删除标记：被选择性删除或在合并中被替换的记录，防止从其他设备重新同步回来
+			`CREATE TABLE IF NOT EXISTS sync_tombstones (
+				seq INTEGER PRIMARY KEY,
+				kind TEXT NOT NULL,
+				device_id TEXT NOT NULL,
+				origin_id INTEGER NOT NULL,
+				deleted_at DATETIME NOT NULL,
+				UNIQUE (kind, device_id, origin_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS sync_peers (
+				url TEXT PRIMARY KEY,
+				device_id TEXT NOT NULL DEFAULT '',
+				watermark INTEGER NOT NULL DEFAULT 0,
+				last_sync_at DATETIME,
+				last_error TEXT NOT NULL DEFAULT ''
+			)`,
+		},
+		// 现有记录都由本机采集：生成设备ID，并为现有记录分配变更序号，首次同步时全部发送
+		backfill: func(s *SQLiteStorage, tx *sql.Tx) error {
+			return backfillSync(tx)
+		},
+	},
+	{
+		version:     10,
+		description: "screenshot metadata",
+		statements: []string{
+			// 图片文件按内容哈希保存在数据目录下，内容相同的截图共用一个文件
+			`CREATE TABLE IF NOT EXISTS screenshots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				hash TEXT NOT NULL,
+				timestamp DATETIME NOT NULL,
+				app_name TEXT NOT NULL DEFAULT '',
+				window_title TEXT NOT NULL DEFAULT '',
+				analysis TEXT NOT NULL DEFAULT '',
+				format TEXT NOT NULL,
+				width INTEGER NOT NULL,
+				height INTEGER NOT NULL,
+				size INTEGER NOT NULL,
+				device_id TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_screenshots_timestamp ON screenshots (timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_screenshots_app_name_timestamp ON screenshots (app_name, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_screenshots_hash ON screenshots (hash)`,
+		},
+	},
+	{
+		version:     11,
+		description: "tags, projects and tagging rules",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				color TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS projects (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				description TEXT NOT NULL DEFAULT '',
+				color TEXT NOT NULL DEFAULT '',
+				archived INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS tag_rules (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL DEFAULT '',
+				field TEXT NOT NULL,
+				pattern TEXT NOT NULL,
+				tag_id INTEGER NOT NULL DEFAULT 0,
+				project_id INTEGER NOT NULL DEFAULT 0,
+				enabled INTEGER NOT NULL DEFAULT 1,
+				created_at DATETIME NOT NULL
+			)`,
+			// target 为 activity、app_usage 或 summary，target_id 指向对应表；
+			// rule_id 为 NULL 表示手动关联，重新应用规则时只替换规则生成的关联
+			`CREATE TABLE IF NOT EXISTS tag_links (
+				tag_id INTEGER NOT NULL,
+				target TEXT NOT NULL,
+				target_id INTEGER NOT NULL,
+				rule_id INTEGER,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (tag_id, target, target_id)
+			) WITHOUT ROWID`,
+			`CREATE TABLE IF NOT EXISTS project_links (
+				project_id INTEGER NOT NULL,
+				target TEXT NOT NULL,
+				target_id INTEGER NOT NULL,
+				rule_id INTEGER,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (project_id, target, target_id)
+			) WITHOUT ROWID`,
+			`CREATE INDEX IF NOT EXISTS idx_tag_links_target ON tag_links (target, target_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_project_links_target ON project_links (target, target_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_tag_links_rule ON tag_links (rule_id) WHERE rule_id IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_project_links_rule ON project_links (rule_id) WHERE rule_id IS NOT NULL`,
+			// 记录被清理、选择性删除或在同步中被替换时一并删除关联
+			`CREATE TRIGGER IF NOT EXISTS activities_links_ad AFTER DELETE ON activities BEGIN
+				DELETE FROM tag_links WHERE target = 'activity' AND target_id = old.id;
+				DELETE FROM project_links WHERE target = 'activity' AND target_id = old.id;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS app_usage_links_ad AFTER DELETE ON app_usage BEGIN
+				DELETE FROM tag_links WHERE target = 'app_usage' AND target_id = old.id;
+				DELETE FROM project_links WHERE target = 'app_usage' AND target_id = old.id;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS ai_summaries_links_ad AFTER DELETE ON ai_summaries BEGIN
+				DELETE FROM tag_links WHERE target = 'summary' AND target_id = old.id;
+				DELETE FROM project_links WHERE target = 'summary' AND target_id = old.id;
+			END`,
+		},
+	},
+	{
+		version:     12,
+		description: "append-only change log",
+		statements: []string{
+			// 由触发器记录每条新增和删除，供外部消费方按序号增量读取；AUTOINCREMENT 保证序号不会复用。
+			// changed_at 为 UTC 时间，清理原始数据时一并清理之前的变更
+			`CREATE TABLE IF NOT EXISTS change_log (
+				seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind TEXT NOT NULL,
+				op TEXT NOT NULL,
+				record_id INTEGER NOT NULL,
+				changed_at DATETIME NOT NULL
+			)`,
+			`CREATE TRIGGER IF NOT EXISTS activities_changes_ai AFTER INSERT ON activities BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('activity', 'insert', new.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS activities_changes_ad AFTER DELETE ON activities BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('activity', 'delete', old.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS activities_changes_au AFTER UPDATE OF duration ON activities
+				WHEN new.duration IS NOT old.duration BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('activity', 'update', new.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS keyboard_inputs_changes_ai AFTER INSERT ON keyboard_inputs BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('keyboard_input', 'insert', new.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS keyboard_inputs_changes_ad AFTER DELETE ON keyboard_inputs BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('keyboard_input', 'delete', old.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS app_usage_changes_ai AFTER INSERT ON app_usage BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('app_usage', 'insert', new.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS app_usage_changes_ad AFTER DELETE ON app_usage BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('app_usage', 'delete', old.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS ai_summaries_changes_ai AFTER INSERT ON ai_summaries BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('summary', 'insert', new.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS ai_summaries_changes_ad AFTER DELETE ON ai_summaries BEGIN
+				INSERT INTO change_log (kind, op, record_id, changed_at)
+				VALUES ('summary', 'delete', old.id, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+			END`,
+		},
+	},
+	{
+		version:     13,
+		description: "typing segment stats on keyboard inputs",
+		statements: []string{
+			// 按键合并为输入片段后 keystrokes 为片段的按键次数，corrections 为退格和删除次数，
+			// duration 为第一次到最后一次按键的秒数；之前逐键保存的记录保持为 0
+			`ALTER TABLE keyboard_inputs ADD COLUMN corrections INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE keyboard_inputs ADD COLUMN duration INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version:     14,
+		description: "store timestamps in UTC",
+		// 之前的版本按写入时的时区偏移保存时间，按字符串比较时范围查询和删除会错开时区偏移的小时数
+		backfill: func(s *SQLiteStorage, tx *sql.Tx) error {
+			return backfillUTC(tx)
+		},
+	},
+}
+
+// utcColumns 保存时间的列。change_log.changed_at 由触发器按 UTC 写入，不需要转换
+var utcColumns = []struct{ table, column string }{
+	{"activities", "timestamp"},
+	{"keyboard_inputs", "timestamp"},
+	{"app_usage", "start_time"},
+	{"app_usage", "end_time"},
+	{"ai_summaries", "created_at"},
+	{"ai_summaries", "source_from"},
+	{"ai_summaries", "source_to"},
+	{"forget_log", "requested_at"},
+	{"forget_log", "from_time"},
+	{"forget_log", "to_time"},
+	{"sync_tombstones", "deleted_at"},
+	{"sync_peers", "last_sync_at"},
+	{"screenshots", "timestamp"},
+	{"screenshots", "created_at"},
+	{"tags", "created_at"},
+	{"projects", "created_at"},
+	{"tag_rules", "created_at"},
+	{"tag_links", "created_at"},
+	{"project_links", "created_at"},
+	{"schema_version", "applied_at"},
+}
+
+// backfillUTC 把带非零时区偏移的时间改写为同一时刻的 UTC 时间，无法解析的值保持不变
+func backfillUTC(tx *sql.Tx) error {
+	for _, col := range utcColumns {
+		// 转换为文本读取，避免驱动按列类型解析成 time.Time
+		rows, err := tx.Query(`SELECT DISTINCT CAST(` + col.column + ` AS TEXT) FROM ` + col.table +
+			` WHERE ` + col.column + ` IS NOT NULL`)
+		if err != nil {
+			return fmt.Errorf("failed to read %s.%s: %w", col.table, col.column, err)
+		}
+		var values []string
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return err
+			}
+			values = append(values, value)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			t, ok := parseStoredTime(value)
+			if !ok {
+				continue
+			}
+			utc := dbTime(t).Format(sqlite3.SQLiteTimestampFormats[0])
+			if utc == value {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE `+col.table+` SET `+col.column+` = ? WHERE `+col.column+` = ?`,
+				utc, value); err != nil {
+				return fmt.Errorf("failed to convert %s.%s: %w", col.table, col.column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseStoredTime 按驱动读取时间列的方式解析保存的文本
+func parseStoredTime(value string) (time.Time, bool) {
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// LatestSchemaVersion 当前程序支持的最新数据库结构版本
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaTooNewError 数据库结构版本高于当前程序支持的版本
+type SchemaTooNewError struct {
+	DatabaseVersion  int
+	SupportedVersion int
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the version %d supported by this binary, please upgrade yaml-backend",
+		e.DatabaseVersion, e.SupportedVersion)
+}
+
+// migrate 在一个事务中按顺序执行所有未应用的升级
+func (s *SQLiteStorage) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	if latest := LatestSchemaVersion(); current > latest {
+		return &SchemaTooNewError{DatabaseVersion: current, SupportedVersion: latest}
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			}
+		}
+		if m.backfill != nil {
+			if err := m.backfill(s, tx); err != nil {
+				return fmt.Errorf("migration %d (%s) backfill failed: %w", m.version, m.description, err)
+			}
+		}
+
+		if _, err := tx.Exec(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.description, dbTime(time.Now())); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		applied++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migrations: %w", err)
+	}
+
+	if applied > 0 {
+		fmt.Printf("Database migrated from schema version %d to %d\n", current, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// SchemaVersion 获取数据库当前的结构版本
+func (s *SQLiteStorage) SchemaVersion() (int, error) {
+	return schemaVersion(s.readDB)
+}
+
+// queryer 同时兼容 *sql.DB 和 *sql.Tx 的查询接口
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func schemaVersion(q queryer) (int, error) {
+	var version sql.NullInt64
+	if err := q.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackfillUTCConvertsLocalOffsets(t *testing.T) {
+	withLocalZone(t, shanghai)
+	s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	defer s.Close()
+
+	// 升级前的版本按本地时区偏移保存时间
+	for _, stored := range []string{"2025-09-05 14:30:00+08:00", "2025-09-05 15:30:00.25+08:00", "2025-09-05 06:45:00+00:00"} {
+		if _, err := s.db.Exec(`INSERT INTO keyboard_inputs (text, app_name, timestamp) VALUES (?, 'Code', ?)`,
+			stored, stored); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	if _, err := s.db.Exec(`DELETE FROM schema_version WHERE version = 14`); err != nil {
+		t.Fatalf("reset schema version: %v", err)
+	}
+	if err := s.migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	rows, err := s.db.Query(`SELECT text, CAST(timestamp AS TEXT) FROM keyboard_inputs ORDER BY id`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	want := map[string]string{
+		"2025-09-05 14:30:00+08:00":    "2025-09-05 06:30:00+00:00",
+		"2025-09-05 15:30:00.25+08:00": "2025-09-05 07:30:00.25+00:00",
+		"2025-09-05 06:45:00+00:00":    "2025-09-05 06:45:00+00:00",
+	}
+	for rows.Next() {
+		var original, converted string
+		if err := rows.Scan(&original, &converted); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if converted != want[original] {
+			t.Errorf("%s converted to %s, want %s", original, converted, want[original])
+		}
+	}
+
+	inputs, _, err := s.QueryKeyboardInputs(KeyboardQuery{
+		From: time.Date(2025, 9, 5, 14, 0, 0, 0, shanghai),
+		To:   time.Date(2025, 9, 5, 15, 0, 0, 0, shanghai),
+	})
+	if err != nil {
+		t.Fatalf("QueryKeyboardInputs: %v", err)
+	}
+	if len(inputs) != 2 {
+		t.Errorf("got %d inputs between 14:00 and 15:00 local, want 2", len(inputs))
+	}
+}
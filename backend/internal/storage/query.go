@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// ActivityQuery 活动记录查询条件，零值字段表示不过滤
+type ActivityQuery struct {
+	From                time.Time           // 起始时间（包含）
+	To                  time.Time           // 结束时间（不包含）
+	Type                models.ActivityType // 活动类型
+	AppName             string              // 应用名，精确匹配
+	URLContains         string              // URL 或域名子串，不区分大小写
+	WindowTitleContains string              // 窗口标题子串，不区分大小写
+	Cursor              string              // 上一页返回的 next_cursor
+	Limit               int                 // 每页条数，<= 0 时使用 DefaultPageSize
+}
+
+// KeyboardQuery 键盘输入查询条件，零值字段表示不过滤
+type KeyboardQuery struct {
+	From         time.Time // 起始时间（包含）
+	To           time.Time // 结束时间（不包含）
+	AppName      string    // 应用名，精确匹配
+	TextContains string    // 输入内容子串，不区分大小写
+	Cursor       string    // 上一页返回的 next_cursor
+	Limit        int       // 每页条数，<= 0 时使用 DefaultPageSize
+}
+
+// DefaultPageSize 查询未指定 Limit 时的默认每页条数
+const DefaultPageSize = 50
+
+// pageCursor 分页游标，指向上一页最后一条记录的 (timestamp, id)
+type pageCursor struct {
+	Timestamp time.Time
+	ID        int64
+}
+
+// encodeCursor 将 (timestamp, id) 编码为不透明的游标字符串
+func encodeCursor(timestamp time.Time, id int64) string {
+	raw := timestamp.Format(time.RFC3339Nano) + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor 解析游标，空字符串返回 nil
+func decodeCursor(cursor string) (*pageCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor timestamp: %w", err)
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor id: %w", err)
+	}
+
+	return &pageCursor{Timestamp: timestamp, ID: id}, nil
+}
+
+// after 判断 (timestamp, id) 是否排在游标之后（按时间倒序、ID倒序）
+func (c *pageCursor) after(timestamp time.Time, id int64) bool {
+	if c == nil {
+		return true
+	}
+	return timestamp.Before(c.Timestamp) || (timestamp.Equal(c.Timestamp) && id < c.ID)
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return limit
+}
+
+// likePattern 构造子串匹配的 LIKE 模式，转义通配符
+func likePattern(substr string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(substr) + "%"
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// dbTime 写入数据库或参与比较的时间统一转换为 UTC。驱动把时间保存为带时区偏移的文本，
+// SQLite 按字符串比较，偏移不同的两个时间不能直接比较
+func dbTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// whereBuilder 拼接 WHERE 子句
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (w *whereBuilder) add(condition string, args ...interface{}) {
+	w.conditions = append(w.conditions, condition)
+	w.args = append(w.args, args...)
+}
+
+func (w *whereBuilder) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+// addTimeRange 添加时间范围和游标条件
+func (w *whereBuilder) addTimeRange(column string, from, to time.Time, cursor *pageCursor) {
+	if !from.IsZero() {
+		w.add(column+" >= ?", dbTime(from))
+	}
+	if !to.IsZero() {
+		w.add(column+" < ?", dbTime(to))
+	}
+	if cursor != nil {
+		at := dbTime(cursor.Timestamp)
+		w.add("("+column+" < ? OR ("+column+" = ? AND id < ?))", at, at, cursor.ID)
+	}
+}
+
+// QueryActivities 按条件分页查询活动记录，按时间倒序排列；还有下一页时返回 nextCursor
+func (s *SQLiteStorage) QueryActivities(q ActivityQuery) ([]*models.Activity, string, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", q.From, q.To, cursor)
+	if q.Type != "" {
+		where.add("type = ?", q.Type)
+	}
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+	if s.encryptActivities && (q.URLContains != "" || q.WindowTitleContains != "") {
+		return nil, "", ErrEncryptedFilter
+	}
+	if q.URLContains != "" {
+		where.add(`url LIKE ? ESCAPE '\'`, likePattern(q.URLContains))
+	}
+	if q.WindowTitleContains != "" {
+		where.add(`window_title LIKE ? ESCAPE '\'`, likePattern(q.WindowTitleContains))
+	}
+
+	limit := pageSize(q.Limit)
+	query := `SELECT id, type, content, app_name, window_title, url, timestamp, duration, device_id
+			   FROM activities` + where.String() + ` ORDER BY timestamp DESC, id DESC LIMIT ?`
+
+	rows, err := s.readStmts.query(query, append(where.args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var activities []*models.Activity
+	for rows.Next() {
+		activity := &models.Activity{}
+		err := rows.Scan(&activity.ID, &activity.Type, &activity.Content,
+			&activity.AppName, &activity.WindowTitle, &activity.URL,
+			&activity.Timestamp, &activity.Duration, &activity.DeviceID)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := s.openActivity(activity); err != nil {
+			return nil, "", err
+		}
+		activities = append(activities, activity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return trimActivityPage(activities, limit)
+}
+
+// keyboardInputColumns 查询键盘输入时选择的列，与 scanKeyboardInput 的顺序一致
+const keyboardInputColumns = `id, text, app_name, timestamp, device_id, keystrokes, corrections, duration`
+
+// scanKeyboardInput 读取一条键盘输入，文本由调用方解密
+func scanKeyboardInput(row interface{ Scan(...interface{}) error }) (*models.KeyboardInput, error) {
+	input := &models.KeyboardInput{}
+	err := row.Scan(&input.ID, &input.Text, &input.AppName, &input.Timestamp, &input.DeviceID,
+		&input.KeyCount, &input.Corrections, &input.Duration)
+	if err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// QueryKeyboardInputs 按条件分页查询键盘输入，按时间倒序排列；还有下一页时返回 nextCursor
+func (s *SQLiteStorage) QueryKeyboardInputs(q KeyboardQuery) ([]*models.KeyboardInput, string, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", q.From, q.To, cursor)
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+	if s.vault != nil && q.TextContains != "" {
+		return nil, "", ErrEncryptedFilter
+	}
+	if q.TextContains != "" {
+		where.add(`text LIKE ? ESCAPE '\'`, likePattern(q.TextContains))
+	}
+
+	limit := pageSize(q.Limit)
+	query := `SELECT ` + keyboardInputColumns + `
+			   FROM keyboard_inputs` + where.String() + ` ORDER BY timestamp DESC, id DESC LIMIT ?`
+
+	rows, err := s.readStmts.query(query, append(where.args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var inputs []*models.KeyboardInput
+	for rows.Next() {
+		input, err := scanKeyboardInput(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := s.openKeyboardInput(input); err != nil {
+			return nil, "", err
+		}
+		inputs = append(inputs, input)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return trimKeyboardPage(inputs, limit)
+}
+
+// trimActivityPage 多查询的一条用于判断是否存在下一页
+func trimActivityPage(activities []*models.Activity, limit int) ([]*models.Activity, string, error) {
+	if len(activities) <= limit {
+		return activities, "", nil
+	}
+	activities = activities[:limit]
+	last := activities[limit-1]
+	return activities, encodeCursor(last.Timestamp, last.ID), nil
+}
+
+func trimKeyboardPage(inputs []*models.KeyboardInput, limit int) ([]*models.KeyboardInput, string, error) {
+	if len(inputs) <= limit {
+		return inputs, "", nil
+	}
+	inputs = inputs[:limit]
+	last := inputs[limit-1]
+	return inputs, encodeCursor(last.Timestamp, last.ID), nil
+}
+
+// inRange 判断时间是否在 [from, to) 范围内，零值表示不限
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// QueryActivities 与 SQLiteStorage 的过滤、排序和分页语义一致
+func (m *MemoryStorage) QueryActivities(q ActivityQuery) ([]*models.Activity, string, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mu.RLock()
+	var activities []*models.Activity
+	for _, activity := range m.activities {
+		if !inRange(activity.Timestamp, q.From, q.To) || !cursor.after(activity.Timestamp, activity.ID) {
+			continue
+		}
+		if (q.Type != "" && activity.Type != q.Type) ||
+			(q.AppName != "" && activity.AppName != q.AppName) ||
+			(q.URLContains != "" && !containsFold(activity.URL, q.URLContains)) ||
+			(q.WindowTitleContains != "" && !containsFold(activity.WindowTitle, q.WindowTitleContains)) {
+			continue
+		}
+		copied := *activity
+		activities = append(activities, &copied)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].Timestamp.Equal(activities[j].Timestamp) {
+			return activities[i].Timestamp.After(activities[j].Timestamp)
+		}
+		return activities[i].ID > activities[j].ID
+	})
+
+	return trimActivityPage(activities, pageSize(q.Limit))
+}
+
+// QueryKeyboardInputs 与 SQLiteStorage 的过滤、排序和分页语义一致
+func (m *MemoryStorage) QueryKeyboardInputs(q KeyboardQuery) ([]*models.KeyboardInput, string, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mu.RLock()
+	var inputs []*models.KeyboardInput
+	for _, input := range m.keyboardInputs {
+		if !inRange(input.Timestamp, q.From, q.To) || !cursor.after(input.Timestamp, input.ID) {
+			continue
+		}
+		if (q.AppName != "" && input.AppName != q.AppName) ||
+			(q.TextContains != "" && !containsFold(input.Text, q.TextContains)) {
+			continue
+		}
+		copied := *input
+		inputs = append(inputs, &copied)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(inputs, func(i, j int) bool {
+		if !inputs[i].Timestamp.Equal(inputs[j].Timestamp) {
+			return inputs[i].Timestamp.After(inputs[j].Timestamp)
+		}
+		return inputs[i].ID > inputs[j].ID
+	})
+
+	return trimKeyboardPage(inputs, pageSize(q.Limit))
+}
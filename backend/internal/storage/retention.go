@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// PruneBefore 删除 cutoff 所在整点之前的活动、键盘输入和应用使用记录。统计数据在写入时已经累加，
+// 清理后保留；按整点清理保证每个小时的统计要么完全来自原始记录，要么完全来自已清理的数据
+func (s *SQLiteStorage) PruneBefore(cutoff time.Time) (*PruneResult, error) {
+	cutoff = hourStart(cutoff)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin prune transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &PruneResult{Cutoff: cutoff}
+
+	res, err := tx.Exec(`DELETE FROM activities WHERE timestamp < ?`, dbTime(cutoff))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete activities: %w", err)
+	}
+	result.ActivitiesDeleted, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`DELETE FROM keyboard_inputs WHERE timestamp < ?`, dbTime(cutoff))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete keyboard inputs: %w", err)
+	}
+	result.KeyboardInputsDeleted, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`DELETE FROM app_usage WHERE start_time < ?`, dbTime(cutoff))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete app usage: %w", err)
+	}
+	result.AppUsageDeleted, _ = res.RowsAffected()
+
+	// 上面的删除写入的变更在清理时间之后，会被保留
+	if result.ChangesDeleted, err = pruneChangeLog(tx, cutoff); err != nil {
+		return nil, fmt.Errorf("failed to delete change log: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit prune: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetDailyAppStats 获取每日统计，按日期和应用名排序
+func (s *SQLiteStorage) GetDailyAppStats(fromDay, toDay string) ([]*models.DailyAppStats, error) {
+	query := `SELECT day, app_name, activity_count, keyboard_count, keystrokes, duration FROM daily_app_stats
+			   WHERE (? = '' OR day >= ?) AND (? = '' OR day <= ?)
+			   ORDER BY day ASC, app_name ASC`
+
+	rows, err := s.readStmts.query(query, fromDay, fromDay, toDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.DailyAppStats
+	for rows.Next() {
+		stat := &models.DailyAppStats{}
+		if err := rows.Scan(&stat.Day, &stat.AppName, &stat.ActivityCount, &stat.KeyboardCount,
+			&stat.Keystrokes, &stat.Duration); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+// Vacuum 回收已删除数据占用的空间，启用了增量回收时只做增量回收
+func (s *SQLiteStorage) Vacuum() error {
+	var autoVacuum int
+	if err := s.db.QueryRow(`PRAGMA auto_vacuum`).Scan(&autoVacuum); err != nil {
+		return fmt.Errorf("failed to read auto_vacuum mode: %w", err)
+	}
+
+	// 2 = INCREMENTAL
+	if autoVacuum == 2 {
+		_, err := s.db.Exec(`PRAGMA incremental_vacuum`)
+		return err
+	}
+
+	_, err := s.db.Exec(`VACUUM`)
+	return err
+}
+
+// PruneBefore 与 SQLiteStorage 相同：按整点删除原始记录，统计数据保留
+func (m *MemoryStorage) PruneBefore(cutoff time.Time) (*PruneResult, error) {
+	cutoff = hourStart(cutoff)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &PruneResult{Cutoff: cutoff}
+
+	var keptActivities []*models.Activity
+	for _, activity := range m.activities {
+		if !activity.Timestamp.Before(cutoff) {
+			keptActivities = append(keptActivities, activity)
+			continue
+		}
+		m.dropSync("activities", activity.ID, false)
+		m.dropLinks(LinkActivity, activity.ID)
+		result.ActivitiesDeleted++
+	}
+
+	var keptInputs []*models.KeyboardInput
+	for _, input := range m.keyboardInputs {
+		if !input.Timestamp.Before(cutoff) {
+			keptInputs = append(keptInputs, input)
+			continue
+		}
+		m.dropSync("keyboard_inputs", input.ID, false)
+		result.KeyboardInputsDeleted++
+	}
+
+	var keptUsage []*models.AppUsage
+	for _, usage := range m.appUsage {
+		if !usage.StartTime.Before(cutoff) {
+			keptUsage = append(keptUsage, usage)
+			continue
+		}
+		m.dropSync("app_usage", usage.ID, false)
+		m.dropLinks(LinkAppUsage, usage.ID)
+		result.AppUsageDeleted++
+	}
+
+	for key, record := range m.importKeys {
+		if record.timestamp.Before(cutoff) {
+			delete(m.importKeys, key)
+		}
+	}
+
+	m.activities = keptActivities
+	m.keyboardInputs = keptInputs
+	m.appUsage = keptUsage
+	result.ChangesDeleted = m.pruneChangeLog(cutoff)
+	return result, nil
+}
+
+// GetDailyAppStats 获取每日统计，按日期和应用名排序
+func (m *MemoryStorage) GetDailyAppStats(fromDay, toDay string) ([]*models.DailyAppStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats []*models.DailyAppStats
+	for _, stat := range m.dailyStats {
+		if (fromDay != "" && stat.Day < fromDay) || (toDay != "" && stat.Day > toDay) {
+			continue
+		}
+		copied := *stat
+		stats = append(stats, &copied)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Day != stats[j].Day {
+			return stats[i].Day < stats[j].Day
+		}
+		return stats[i].AppName < stats[j].AppName
+	})
+	return stats, nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+func TestPruneBeforeLocalHour(t *testing.T) {
+	withLocalZone(t, shanghai)
+	// 本地 10:40 的清理时间按整点截断为本地 10:00，即 02:00Z
+	cutoff := time.Date(2025, 9, 5, 10, 40, 0, 0, shanghai)
+	times := []time.Time{
+		time.Date(2025, 9, 5, 1, 59, 0, 0, time.UTC),
+		time.Date(2025, 9, 5, 2, 0, 0, 0, time.UTC),
+		time.Date(2025, 9, 5, 2, 30, 0, 0, time.UTC),
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, at := range times {
+				if err := store.SaveActivity(&models.Activity{Type: models.ActivityTypeApp, AppName: "Code", Timestamp: at}); err != nil {
+					t.Fatalf("SaveActivity: %v", err)
+				}
+				if err := store.SaveKeyboardInput(&models.KeyboardInput{Text: "a", AppName: "Code", Timestamp: at}); err != nil {
+					t.Fatalf("SaveKeyboardInput: %v", err)
+				}
+				if err := store.SaveAppUsage(&models.AppUsage{AppName: "Code", StartTime: at, EndTime: at.Add(time.Minute)}); err != nil {
+					t.Fatalf("SaveAppUsage: %v", err)
+				}
+			}
+
+			result, err := store.PruneBefore(cutoff)
+			if err != nil {
+				t.Fatalf("PruneBefore: %v", err)
+			}
+			if !result.Cutoff.Equal(times[1]) {
+				t.Errorf("cutoff = %v, want %v", result.Cutoff, times[1])
+			}
+			if result.ActivitiesDeleted != 1 || result.KeyboardInputsDeleted != 1 || result.AppUsageDeleted != 1 {
+				t.Errorf("deleted %d activities, %d keyboard inputs, %d app usage; want 1 of each",
+					result.ActivitiesDeleted, result.KeyboardInputsDeleted, result.AppUsageDeleted)
+			}
+
+			inputs, _, err := store.QueryKeyboardInputs(KeyboardQuery{})
+			if err != nil {
+				t.Fatalf("QueryKeyboardInputs: %v", err)
+			}
+			if len(inputs) != 2 || !inputs[1].Timestamp.Equal(times[1]) {
+				t.Errorf("remaining keyboard inputs = %d, oldest should be at %v", len(inputs), times[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"yaml-backend/pkg/models"
+)
+
+// 统计桶的时间格式，按本地时间划分；日期是小时的前缀，按字符串比较即可按时间排序
+const (
+	hourLayout = "2006-01-02 15:00"
+	dayLayout  = "2006-01-02"
+)
+
+// RollupRebuild 一次统计重建的结果
+type RollupRebuild struct {
+	From       time.Time `json:"from"`        // 从这个整点开始重建，之前的统计保持不变
+	RawRecords int64     `json:"raw_records"` // 参与汇总的原始记录数
+	HourlyRows int       `json:"hourly_rows"` // 重建后的小时统计行数
+	DailyRows  int       `json:"daily_rows"`  // 被修正的每日统计行数
+}
+
+const (
+	upsertHourlyStatsSQL = `INSERT INTO hourly_app_stats (hour, app_name, activity_count, keyboard_count, keystrokes, duration)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(hour, app_name) DO UPDATE SET
+			activity_count = activity_count + excluded.activity_count,
+			keyboard_count = keyboard_count + excluded.keyboard_count,
+			keystrokes = keystrokes + excluded.keystrokes,
+			duration = duration + excluded.duration`
+	upsertDailyStatsSQL = `INSERT INTO daily_app_stats (day, app_name, activity_count, keyboard_count, keystrokes, duration)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(day, app_name) DO UPDATE SET
+			activity_count = activity_count + excluded.activity_count,
+			keyboard_count = keyboard_count + excluded.keyboard_count,
+			keystrokes = keystrokes + excluded.keystrokes,
+			duration = duration + excluded.duration`
+	selectActivityRollupSQL = `SELECT COALESCE(app_name, ''), timestamp, COALESCE(duration, 0) FROM activities WHERE id = ?`
+)
+
+// HourBucket 返回 t 所在的小时统计桶，格式与 HourlyAppStats.Hour 相同
+func HourBucket(t time.Time) string {
+	return t.In(time.Local).Format(hourLayout)
+}
+
+// hourStart 返回 t 所在本地整点
+func hourStart(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.Local)
+}
+
+// keystrokes 键盘输入的字符数
+func keystrokes(text string) int64 {
+	return int64(utf8.RuneCountInString(text))
+}
+
+// inputKeystrokes 键盘输入计入统计的按键次数：合并的输入片段带有按键次数，否则按字符数计
+func inputKeystrokes(input *models.KeyboardInput) int64 {
+	if input.KeyCount > 0 {
+		return input.KeyCount
+	}
+	return keystrokes(input.Text)
+}
+
+// rollupKey 统计桶，bucket 为小时或日期
+type rollupKey struct {
+	bucket  string
+	appName string
+}
+
+// rollupDelta 一次写入对小时统计的增量，每日统计由小时增量按日期累加得到
+type rollupDelta map[rollupKey]*models.HourlyAppStats
+
+func (d rollupDelta) get(timestamp time.Time, appName string) *models.HourlyAppStats {
+	key := rollupKey{HourBucket(timestamp), appName}
+	if _, ok := d[key]; !ok {
+		d[key] = &models.HourlyAppStats{Hour: key.bucket, AppName: appName}
+	}
+	return d[key]
+}
+
+func (d rollupDelta) addActivity(activity *models.Activity) {
+	stats := d.get(activity.Timestamp, activity.AppName)
+	stats.ActivityCount++
+	stats.Duration += activity.Duration
+}
+
+func (d rollupDelta) addKeyboardInput(appName string, timestamp time.Time, count int64) {
+	stats := d.get(timestamp, appName)
+	stats.KeyboardCount++
+	stats.Keystrokes += count
+}
+
+// add 按 sign（1 或 -1）累加一行小时统计
+func (d rollupDelta) add(stats *models.HourlyAppStats, sign int64) {
+	key := rollupKey{stats.Hour, stats.AppName}
+	if _, ok := d[key]; !ok {
+		d[key] = &models.HourlyAppStats{Hour: stats.Hour, AppName: stats.AppName}
+	}
+	d[key].ActivityCount += sign * stats.ActivityCount
+	d[key].KeyboardCount += sign * stats.KeyboardCount
+	d[key].Keystrokes += sign * stats.Keystrokes
+	d[key].Duration += sign * stats.Duration
+}
+
+// compact 去掉增量为零的统计桶
+func (d rollupDelta) compact() {
+	for key, stats := range d {
+		if *stats == (models.HourlyAppStats{Hour: stats.Hour, AppName: stats.AppName}) {
+			delete(d, key)
+		}
+	}
+}
+
+// daily 按日期累加小时增量
+func (d rollupDelta) daily() map[rollupKey]*models.DailyAppStats {
+	days := make(map[rollupKey]*models.DailyAppStats)
+	for key, stats := range d {
+		day := rollupKey{key.bucket[:len(dayLayout)], key.appName}
+		if _, ok := days[day]; !ok {
+			days[day] = &models.DailyAppStats{Day: day.bucket, AppName: day.appName}
+		}
+		days[day].ActivityCount += stats.ActivityCount
+		days[day].KeyboardCount += stats.KeyboardCount
+		days[day].Keystrokes += stats.Keystrokes
+		days[day].Duration += stats.Duration
+	}
+	return days
+}
+
+// applyRollups 在写入原始记录的事务中累加小时和每日统计
+func (s *SQLiteStorage) applyRollups(tx *sql.Tx, delta rollupDelta) error {
+	if len(delta) == 0 {
+		return nil
+	}
+	if err := s.applyHourlyStats(tx, delta); err != nil {
+		return err
+	}
+	return s.applyDailyStats(tx, delta)
+}
+
+func (s *SQLiteStorage) applyHourlyStats(tx *sql.Tx, delta rollupDelta) error {
+	stmt, err := s.writeStmts.txStmt(tx, upsertHourlyStatsSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, stats := range delta {
+		if _, err := stmt.Exec(stats.Hour, stats.AppName, stats.ActivityCount, stats.KeyboardCount,
+			stats.Keystrokes, stats.Duration); err != nil {
+			return fmt.Errorf("failed to update hourly stats: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) applyDailyStats(tx *sql.Tx, delta rollupDelta) error {
+	stmt, err := s.writeStmts.txStmt(tx, upsertDailyStatsSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, stats := range delta.daily() {
+		if _, err := stmt.Exec(stats.Day, stats.AppName, stats.ActivityCount, stats.KeyboardCount,
+			stats.Keystrokes, stats.Duration); err != nil {
+			return fmt.Errorf("failed to update daily stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// activityDurationDelta 读取活动记录当前的统计桶和持续时间，返回更新为 duration 后的增量
+func activityDurationDelta(stmt *sql.Stmt, id, duration int64, delta rollupDelta) error {
+	var appName string
+	var timestamp time.Time
+	var old int64
+	if err := stmt.QueryRow(id).Scan(&appName, &timestamp, &old); err != nil {
+		return err
+	}
+	delta.get(timestamp, appName).Duration += duration - old
+	return nil
+}
+
+// RebuildRollups 根据原始记录重新计算 from 之后的小时和每日统计。
+// 早于最早一条原始记录的统计来自已清理的数据，无法重建，保持不变
+func (s *SQLiteStorage) RebuildRollups(from time.Time) (*RollupRebuild, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := s.rebuildRollups(tx, from)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *SQLiteStorage) rebuildRollups(tx *sql.Tx, from time.Time) (*RollupRebuild, error) {
+	oldest, ok, err := oldestRawRecord(tx)
+	if err != nil || !ok {
+		return &RollupRebuild{From: from}, err
+	}
+	// 清理按整点进行，最早一条原始记录所在的小时是完整的
+	if from.Before(oldest) {
+		from = oldest
+	}
+	from = hourStart(from)
+	fromHour := HourBucket(from)
+	result := &RollupRebuild{From: from}
+
+	// 每日统计可能包含没有小时统计的历史数据，只修正差值
+	delta := make(rollupDelta)
+	rows, err := tx.Query(`SELECT hour, app_name, activity_count, keyboard_count, keystrokes, duration
+		FROM hourly_app_stats WHERE hour >= ?`, fromHour)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		stats := &models.HourlyAppStats{}
+		if err := rows.Scan(&stats.Hour, &stats.AppName, &stats.ActivityCount, &stats.KeyboardCount,
+			&stats.Keystrokes, &stats.Duration); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		delta.add(stats, -1)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM hourly_app_stats WHERE hour >= ?`, fromHour); err != nil {
+		return nil, err
+	}
+
+	fresh := make(rollupDelta)
+	rows, err = tx.Query(`SELECT COALESCE(app_name, ''), timestamp, COALESCE(duration, 0) FROM activities WHERE timestamp >= ?`, dbTime(from))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan activities for rollup: %w", err)
+	}
+	for rows.Next() {
+		activity := &models.Activity{}
+		if err := rows.Scan(&activity.AppName, &activity.Timestamp, &activity.Duration); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fresh.addActivity(activity)
+		result.RawRecords++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT COALESCE(app_name, ''), timestamp, keystrokes FROM keyboard_inputs WHERE timestamp >= ?`, dbTime(from))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan keyboard inputs for rollup: %w", err)
+	}
+	for rows.Next() {
+		var appName string
+		var timestamp time.Time
+		var count int64
+		if err := rows.Scan(&appName, &timestamp, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fresh.addKeyboardInput(appName, timestamp, count)
+		result.RawRecords++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.applyHourlyStats(tx, fresh); err != nil {
+		return nil, err
+	}
+	for _, stats := range fresh {
+		delta.add(stats, 1)
+	}
+	delta.compact()
+	if err := s.applyDailyStats(tx, delta); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM daily_app_stats
+		WHERE activity_count = 0 AND keyboard_count = 0 AND keystrokes = 0 AND duration = 0`); err != nil {
+		return nil, err
+	}
+
+	result.HourlyRows = len(fresh)
+	result.DailyRows = len(delta.daily())
+	return result, nil
+}
+
+// oldestRawRecord 最早一条活动记录或键盘输入的时间
+func oldestRawRecord(tx *sql.Tx) (time.Time, bool, error) {
+	var oldest time.Time
+	found := false
+	for _, query := range []string{
+		`SELECT timestamp FROM activities ORDER BY timestamp ASC LIMIT 1`,
+		`SELECT timestamp FROM keyboard_inputs ORDER BY timestamp ASC LIMIT 1`,
+	} {
+		var timestamp time.Time
+		err := tx.QueryRow(query).Scan(&timestamp)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if !found || timestamp.Before(oldest) {
+			oldest = timestamp
+			found = true
+		}
+	}
+	return oldest, found, nil
+}
+
+// backfillKeystrokes 为升级前写入的键盘输入计算字符数，锁定时加密的记录按 0 计
+func (s *SQLiteStorage) backfillKeystrokes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, text FROM keyboard_inputs`)
+	if err != nil {
+		return err
+	}
+	counts := make(map[int64]int64)
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		if text, err = s.open(text); err == nil {
+			counts[id] = keystrokes(text)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, count := range counts {
+		if _, err := tx.Exec(`UPDATE keyboard_inputs SET keystrokes = ? WHERE id = ?`, count, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHourlyAppStats 获取小时统计，按时间和应用名排序
+func (s *SQLiteStorage) GetHourlyAppStats(fromHour, toHour string) ([]*models.HourlyAppStats, error) {
+	query := `SELECT hour, app_name, activity_count, keyboard_count, keystrokes, duration FROM hourly_app_stats
+			   WHERE (? = '' OR hour >= ?) AND (? = '' OR hour <= ?)
+			   ORDER BY hour ASC, app_name ASC`
+
+	rows, err := s.readStmts.query(query, fromHour, fromHour, toHour, toHour)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.HourlyAppStats
+	for rows.Next() {
+		stat := &models.HourlyAppStats{}
+		if err := rows.Scan(&stat.Hour, &stat.AppName, &stat.ActivityCount, &stat.KeyboardCount,
+			&stat.Keystrokes, &stat.Duration); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+// applyRollups 累加小时和每日统计（调用方需持有写锁）
+func (m *MemoryStorage) applyRollups(delta rollupDelta) {
+	for key, stats := range delta {
+		existing, ok := m.hourlyStats[key]
+		if !ok {
+			existing = &models.HourlyAppStats{Hour: stats.Hour, AppName: stats.AppName}
+			m.hourlyStats[key] = existing
+		}
+		existing.ActivityCount += stats.ActivityCount
+		existing.KeyboardCount += stats.KeyboardCount
+		existing.Keystrokes += stats.Keystrokes
+		existing.Duration += stats.Duration
+		if *existing == (models.HourlyAppStats{Hour: existing.Hour, AppName: existing.AppName}) {
+			delete(m.hourlyStats, key)
+		}
+	}
+	m.applyDailyStats(delta)
+}
+
+func (m *MemoryStorage) applyDailyStats(delta rollupDelta) {
+	for key, stats := range delta.daily() {
+		existing, ok := m.dailyStats[key]
+		if !ok {
+			m.dailyStats[key] = stats
+			continue
+		}
+		existing.ActivityCount += stats.ActivityCount
+		existing.KeyboardCount += stats.KeyboardCount
+		existing.Keystrokes += stats.Keystrokes
+		existing.Duration += stats.Duration
+		if *existing == (models.DailyAppStats{Day: existing.Day, AppName: existing.AppName}) {
+			delete(m.dailyStats, key)
+		}
+	}
+}
+
+// RebuildRollups 与 SQLiteStorage 相同：只重建最早一条原始记录之后的统计
+func (m *MemoryStorage) RebuildRollups(from time.Time) (*RollupRebuild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var oldest time.Time
+	found := false
+	for _, activity := range m.activities {
+		if !found || activity.Timestamp.Before(oldest) {
+			oldest, found = activity.Timestamp, true
+		}
+	}
+	for _, input := range m.keyboardInputs {
+		if !found || input.Timestamp.Before(oldest) {
+			oldest, found = input.Timestamp, true
+		}
+	}
+	if !found {
+		return &RollupRebuild{From: from}, nil
+	}
+	if from.Before(oldest) {
+		from = oldest
+	}
+	from = hourStart(from)
+	fromHour := HourBucket(from)
+	result := &RollupRebuild{From: from}
+
+	delta := make(rollupDelta)
+	for key, stats := range m.hourlyStats {
+		if key.bucket >= fromHour {
+			delta.add(stats, -1)
+			delete(m.hourlyStats, key)
+		}
+	}
+
+	fresh := make(rollupDelta)
+	for _, activity := range m.activities {
+		if !activity.Timestamp.Before(from) {
+			fresh.addActivity(activity)
+			result.RawRecords++
+		}
+	}
+	for _, input := range m.keyboardInputs {
+		if !input.Timestamp.Before(from) {
+			fresh.addKeyboardInput(input.AppName, input.Timestamp, inputKeystrokes(input))
+			result.RawRecords++
+		}
+	}
+
+	for key, stats := range fresh {
+		copied := *stats
+		m.hourlyStats[key] = &copied
+		delta.add(stats, 1)
+	}
+	delta.compact()
+	m.applyDailyStats(delta)
+
+	result.HourlyRows = len(fresh)
+	result.DailyRows = len(delta.daily())
+	return result, nil
+}
+
+// GetHourlyAppStats 获取小时统计，按时间和应用名排序
+func (m *MemoryStorage) GetHourlyAppStats(fromHour, toHour string) ([]*models.HourlyAppStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats []*models.HourlyAppStats
+	for _, stat := range m.hourlyStats {
+		if (fromHour != "" && stat.Hour < fromHour) || (toHour != "" && stat.Hour > toHour) {
+			continue
+		}
+		copied := *stat
+		stats = append(stats, &copied)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Hour != stats[j].Hour {
+			return stats[i].Hour < stats[j].Hour
+		}
+		return stats[i].AppName < stats[j].AppName
+	})
+	return stats, nil
+}
@@ -0,0 +1,455 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// RuleApplyResult 重新应用自动打标签规则的结果
+type RuleApplyResult struct {
+	Rules      int   `json:"rules"`      // 生效的规则数
+	Activities int64 `json:"activities"` // 检查的活动记录数
+	Removed    int64 `json:"removed"`    // 删除的规则生成的关联
+	Linked     int64 `json:"linked"`     // 重新生成的关联
+}
+
+// compiledRule 预编译的规则，写入活动记录时逐条匹配
+type compiledRule struct {
+	*models.TagRule
+	pattern *regexp.Regexp // title 规则的正则表达式
+	value   string         // app 规则的小写应用名，domain 规则规范化后的域名
+}
+
+// compileRule 校验规则并预编译匹配条件
+func compileRule(rule *models.TagRule) (*compiledRule, error) {
+	if (rule.TagID == 0) == (rule.ProjectID == 0) {
+		return nil, fmt.Errorf("%w: exactly one of tag_id and project_id is required", ErrInvalidLabel)
+	}
+	pattern := strings.TrimSpace(rule.Pattern)
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: pattern is required", ErrInvalidLabel)
+	}
+
+	compiled := &compiledRule{TagRule: rule}
+	switch rule.Field {
+	case models.RuleFieldApp:
+		compiled.value = strings.ToLower(pattern)
+	case models.RuleFieldTitle:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid title pattern: %v", ErrInvalidLabel, err)
+		}
+		compiled.pattern = re
+	case models.RuleFieldDomain:
+		if compiled.value = normalizeDomain(pattern); compiled.value == "" {
+			return nil, fmt.Errorf("%w: invalid domain", ErrInvalidLabel)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown field %q (expected app, title or domain)", ErrInvalidLabel, rule.Field)
+	}
+	rule.Pattern = pattern
+	return compiled, nil
+}
+
+// matches 判断活动记录是否匹配规则，activity 的字段需为明文
+func (r *compiledRule) matches(activity *models.Activity) bool {
+	switch r.Field {
+	case models.RuleFieldApp:
+		return strings.ToLower(activity.AppName) == r.value
+	case models.RuleFieldTitle:
+		return activity.WindowTitle != "" && r.pattern.MatchString(activity.WindowTitle)
+	case models.RuleFieldDomain:
+		return matchDomain(activity.URL, r.value)
+	}
+	return false
+}
+
+// link 规则生成的关联
+func (r *compiledRule) link(activityID int64) Link {
+	if r.TagID != 0 {
+		return Link{Label: LabelTag, LabelID: r.TagID, Target: LinkActivity, TargetID: activityID}
+	}
+	return Link{Label: LabelProject, LabelID: r.ProjectID, Target: LinkActivity, TargetID: activityID}
+}
+
+const tagRuleColumns = `r.id, r.name, r.field, r.pattern, r.tag_id, r.project_id, r.enabled, r.created_at`
+
+func scanTagRule(row interface{ Scan(...interface{}) error }) (*models.TagRule, error) {
+	rule := &models.TagRule{}
+	if err := row.Scan(&rule.ID, &rule.Name, &rule.Field, &rule.Pattern, &rule.TagID, &rule.ProjectID,
+		&rule.Enabled, &rule.CreatedAt); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// loadRules 重新加载生效的规则：已启用且目标项目未归档。打开数据库、恢复备份和修改规则后调用
+func (s *SQLiteStorage) loadRules() error {
+	rows, err := s.db.Query(`SELECT ` + tagRuleColumns + ` FROM tag_rules r
+		LEFT JOIN projects p ON p.id = r.project_id
+		WHERE r.enabled = 1 AND COALESCE(p.archived, 0) = 0 ORDER BY r.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var rules []*compiledRule
+	for rows.Next() {
+		rule, err := scanTagRule(rows)
+		if err != nil {
+			return err
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			// 保存时已校验过，这里只会在手工修改数据库后出现
+			fmt.Printf("[ERROR] Skipping invalid tagging rule %d: %v\n", rule.ID, err)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.rulesMu.Lock()
+	s.rules = rules
+	s.rulesMu.Unlock()
+	return nil
+}
+
+func (s *SQLiteStorage) activeRules() []*compiledRule {
+	s.rulesMu.RLock()
+	defer s.rulesMu.RUnlock()
+	return s.rules
+}
+
+// tagActivity 在写入活动记录的事务中按规则关联标签和项目，activity 的字段需为明文
+func (s *SQLiteStorage) tagActivity(tx *sql.Tx, id int64, activity *models.Activity) error {
+	for _, rule := range s.activeRules() {
+		if !rule.matches(activity) {
+			continue
+		}
+		if _, err := insertRuleLink(tx, rule.link(id), rule.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRuleLink 写入规则生成的关联，已有同一关联（手动或其他规则生成）时不修改
+func insertRuleLink(tx *sql.Tx, link Link, ruleID int64) (bool, error) {
+	tables := labelTables[link.Label]
+	result, err := tx.Exec(`INSERT OR IGNORE INTO `+tables.links+` (`+tables.column+`, target, target_id, rule_id, created_at)
+		VALUES (?, ?, ?, ?, ?)`, link.LabelID, link.Target, link.TargetID, ruleID, dbTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *SQLiteStorage) ListTagRules() ([]*models.TagRule, error) {
+	rows, err := s.readStmts.query(`SELECT ` + tagRuleColumns + ` FROM tag_rules r ORDER BY r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*models.TagRule{}
+	for rows.Next() {
+		rule, err := scanTagRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// SaveTagRule ID 为 0 时创建规则并回填 ID，否则更新；更新的规则不存在时返回 false。
+// 修改只对之后写入的活动记录生效，历史记录需要重新应用规则
+func (s *SQLiteStorage) SaveTagRule(rule *models.TagRule) (bool, error) {
+	if _, err := compileRule(rule); err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	label := Link{Label: LabelTag, LabelID: rule.TagID}
+	if rule.ProjectID != 0 {
+		label = Link{Label: LabelProject, LabelID: rule.ProjectID}
+	}
+	var found int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM `+labelTables[label.Label].table+` WHERE id = ?`, label.LabelID).
+		Scan(&found); err != nil {
+		return false, err
+	}
+	if found == 0 {
+		return false, fmt.Errorf("%w: %s %d does not exist", ErrInvalidLabel, label.Label, label.LabelID)
+	}
+
+	if rule.ID == 0 {
+		rule.CreatedAt = time.Now()
+		result, err := tx.Exec(`INSERT INTO tag_rules (name, field, pattern, tag_id, project_id, enabled, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rule.Name, rule.Field, rule.Pattern, rule.TagID, rule.ProjectID, rule.Enabled, dbTime(rule.CreatedAt))
+		if err != nil {
+			return false, err
+		}
+		if rule.ID, err = result.LastInsertId(); err != nil {
+			return false, err
+		}
+	} else if err := tx.QueryRow(`UPDATE tag_rules SET name = ?, field = ?, pattern = ?, tag_id = ?, project_id = ?,
+		enabled = ? WHERE id = ? RETURNING created_at`,
+		rule.Name, rule.Field, rule.Pattern, rule.TagID, rule.ProjectID, rule.Enabled, rule.ID).
+		Scan(&rule.CreatedAt); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, s.loadRules()
+}
+
+// DeleteTagRule 删除规则及其生成的关联，手动关联保留；规则不存在时返回 false
+func (s *SQLiteStorage) DeleteTagRule(id int64) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM tag_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+	for _, table := range []string{"tag_links", "project_links"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE rule_id = ?`, id); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, s.loadRules()
+}
+
+// ApplyTagRules 对 [from, to) 内的活动记录重新应用规则，零值表示不限：在一个事务中删除这些记录上
+// 规则生成的关联，再按当前生效的规则重新关联；手动关联保留
+func (s *SQLiteStorage) ApplyTagRules(from, to time.Time) (*RuleApplyResult, error) {
+	rules := s.activeRules()
+	result := &RuleApplyResult{Rules: len(rules)}
+
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", from, to, nil)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"tag_links", "project_links"} {
+		res, err := tx.Exec(`DELETE FROM `+table+` WHERE target = ? AND rule_id IS NOT NULL
+			AND target_id IN (SELECT id FROM activities`+where.String()+`)`, append([]interface{}{LinkActivity}, where.args...)...)
+		if err != nil {
+			return nil, err
+		}
+		removed, _ := res.RowsAffected()
+		result.Removed += removed
+	}
+
+	// 先收集匹配结果再写入，避免在遍历结果集时修改数据库
+	type match struct {
+		link   Link
+		ruleID int64
+	}
+	var matches []match
+	rows, err := tx.Query(`SELECT id, COALESCE(app_name, ''), COALESCE(window_title, ''), COALESCE(url, '')
+		FROM activities`+where.String()+` ORDER BY id`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		activity := &models.Activity{}
+		if err := rows.Scan(&activity.ID, &activity.AppName, &activity.WindowTitle, &activity.URL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Activities++
+		if len(rules) == 0 {
+			continue
+		}
+		if err := s.openActivity(activity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for _, rule := range rules {
+			if rule.matches(activity) {
+				matches = append(matches, match{rule.link(activity.ID), rule.ID})
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range matches {
+		inserted, err := insertRuleLink(tx, m.link, m.ruleID)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			result.Linked++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadRules 与 SQLiteStorage 相同，重新计算生效的规则（调用方需持有写锁）
+func (m *MemoryStorage) loadRules() {
+	m.rules = nil
+	for _, rule := range m.tagRules {
+		if !rule.Enabled {
+			continue
+		}
+		if project := m.findProject(rule.ProjectID); project != nil && project.Archived {
+			continue
+		}
+		copied := *rule
+		compiled, err := compileRule(&copied)
+		if err != nil {
+			continue
+		}
+		m.rules = append(m.rules, compiled)
+	}
+}
+
+// tagActivity 按规则关联新写入的活动记录（调用方需持有写锁）
+func (m *MemoryStorage) tagActivity(activity *models.Activity) int64 {
+	var linked int64
+	for _, rule := range m.rules {
+		if !rule.matches(activity) {
+			continue
+		}
+		link := rule.link(activity.ID)
+		if _, ok := m.links[link]; !ok {
+			m.links[link] = rule.ID
+			linked++
+		}
+	}
+	return linked
+}
+
+func (m *MemoryStorage) ListTagRules() ([]*models.TagRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules := []*models.TagRule{}
+	for _, rule := range m.tagRules {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	return rules, nil
+}
+
+func (m *MemoryStorage) SaveTagRule(rule *models.TagRule) (bool, error) {
+	if _, err := compileRule(rule); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	label, labelID := LabelTag, rule.TagID
+	if rule.ProjectID != 0 {
+		label, labelID = LabelProject, rule.ProjectID
+	}
+	if !m.labelExists(label, labelID) {
+		return false, fmt.Errorf("%w: %s %d does not exist", ErrInvalidLabel, label, labelID)
+	}
+
+	if rule.ID == 0 {
+		stored := *rule
+		stored.ID, stored.CreatedAt = m.allocID("tag_rules"), time.Now().Round(0)
+		m.tagRules = append(m.tagRules, &stored)
+		*rule = stored
+		m.loadRules()
+		return true, nil
+	}
+	for _, stored := range m.tagRules {
+		if stored.ID == rule.ID {
+			createdAt := stored.CreatedAt
+			*stored = *rule
+			stored.CreatedAt = createdAt
+			*rule = *stored
+			m.loadRules()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) DeleteTagRule(id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, rule := range m.tagRules {
+		if rule.ID == id {
+			m.tagRules = append(m.tagRules[:i:i], m.tagRules[i+1:]...)
+			for link, ruleID := range m.links {
+				if ruleID == id {
+					delete(m.links, link)
+				}
+			}
+			m.loadRules()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) ApplyTagRules(from, to time.Time) (*RuleApplyResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &RuleApplyResult{Rules: len(m.rules)}
+	inScope := make(map[int64]bool)
+	for _, activity := range m.activities {
+		if inRange(activity.Timestamp, from, to) {
+			inScope[activity.ID] = true
+		}
+	}
+	for link, ruleID := range m.links {
+		if ruleID != 0 && link.Target == LinkActivity && inScope[link.TargetID] {
+			delete(m.links, link)
+			result.Removed++
+		}
+	}
+	for _, activity := range m.activities {
+		if inScope[activity.ID] {
+			result.Activities++
+			result.Linked += m.tagActivity(activity)
+		}
+	}
+	return result, nil
+}
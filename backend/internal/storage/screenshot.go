@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// ScreenshotQuery 截图查询条件，按截图时间过滤，零值字段表示不过滤
+type ScreenshotQuery struct {
+	From    time.Time // 起始时间（包含）
+	To      time.Time // 结束时间（不包含）
+	AppName string    // 应用名，精确匹配
+	Limit   int       // 最多返回条数，<= 0 时使用 DefaultPageSize
+	Oldest  bool      // 按时间正序返回最早的截图，用于淘汰
+}
+
+// ScreenshotUsage 截图占用的空间，内容相同的截图只计算一次
+type ScreenshotUsage struct {
+	Screenshots int64 `json:"screenshots"`
+	Blobs       int64 `json:"blobs"` // 不同内容的图片文件数
+	Bytes       int64 `json:"bytes"`
+}
+
+const screenshotColumns = `id, hash, timestamp, app_name, window_title, analysis, format, width, height, size, device_id, created_at`
+
+func scanScreenshot(row interface{ Scan(...interface{}) error }) (*models.Screenshot, error) {
+	shot := &models.Screenshot{}
+	if err := row.Scan(&shot.ID, &shot.Hash, &shot.Timestamp, &shot.AppName, &shot.WindowTitle, &shot.Analysis,
+		&shot.Format, &shot.Width, &shot.Height, &shot.Size, &shot.DeviceID, &shot.CreatedAt); err != nil {
+		return nil, err
+	}
+	return shot, nil
+}
+
+// sealScreenshotField 与活动记录一致，encryptActivities 时加密窗口标题和分析结果
+func (s *SQLiteStorage) sealScreenshotField(value string) (string, error) {
+	if !s.encryptActivities {
+		return value, nil
+	}
+	return s.seal(value)
+}
+
+// openScreenshot 原地解密截图的加密字段
+func (s *SQLiteStorage) openScreenshot(shot *models.Screenshot) error {
+	var err error
+	for _, field := range []*string{&shot.WindowTitle, &shot.Analysis} {
+		if *field, err = s.open(*field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveScreenshot 保存截图元数据，成功后回填 ID、设备ID和创建时间
+func (s *SQLiteStorage) SaveScreenshot(shot *models.Screenshot) error {
+	windowTitle, err := s.sealScreenshotField(shot.WindowTitle)
+	if err != nil {
+		return err
+	}
+	analysis, err := s.sealScreenshotField(shot.Analysis)
+	if err != nil {
+		return err
+	}
+
+	createdAt := time.Now()
+	result, err := s.writeStmts.exec(`INSERT INTO screenshots (hash, timestamp, app_name, window_title, analysis,
+		format, width, height, size, device_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		shot.Hash, dbTime(shot.Timestamp), shot.AppName, windowTitle, analysis,
+		shot.Format, shot.Width, shot.Height, shot.Size, s.deviceID, dbTime(createdAt))
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	shot.ID, shot.DeviceID, shot.CreatedAt = id, s.deviceID, createdAt
+	return nil
+}
+
+// GetScreenshot 获取单张截图的元数据，不存在时返回 nil
+func (s *SQLiteStorage) GetScreenshot(id int64) (*models.Screenshot, error) {
+	shot, err := scanScreenshot(s.readStmts.queryRow(`SELECT `+screenshotColumns+` FROM screenshots WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openScreenshot(shot); err != nil {
+		return nil, err
+	}
+	return shot, nil
+}
+
+// QueryScreenshots 按时间倒序查询截图，q.Oldest 时按时间正序
+func (s *SQLiteStorage) QueryScreenshots(q ScreenshotQuery) ([]*models.Screenshot, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("timestamp", q.From, q.To, nil)
+	if q.AppName != "" {
+		where.add("app_name = ?", q.AppName)
+	}
+	order := " ORDER BY timestamp DESC, id DESC"
+	if q.Oldest {
+		order = " ORDER BY timestamp, id"
+	}
+
+	rows, err := s.readDB.Query(`SELECT `+screenshotColumns+` FROM screenshots`+where.String()+order+` LIMIT ?`,
+		append(where.args, pageSize(q.Limit))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shots []*models.Screenshot
+	for rows.Next() {
+		shot, err := scanScreenshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.openScreenshot(shot); err != nil {
+			return nil, err
+		}
+		shots = append(shots, shot)
+	}
+	return shots, rows.Err()
+}
+
+// UpdateScreenshotAnalysis 写入截图的分析结果，截图不存在时返回 nil
+func (s *SQLiteStorage) UpdateScreenshotAnalysis(id int64, analysis string) (*models.Screenshot, error) {
+	sealed, err := s.sealScreenshotField(analysis)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.writeStmts.exec(`UPDATE screenshots SET analysis = ? WHERE id = ?`, sealed, id)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return nil, err
+	}
+	return s.GetScreenshot(id)
+}
+
+// DeleteScreenshot 删除截图的元数据，返回被删除的截图以及图片文件是否已无其他截图引用；不存在时返回 nil
+func (s *SQLiteStorage) DeleteScreenshot(id int64) (*models.Screenshot, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	shot, err := scanScreenshot(tx.QueryRow(`DELETE FROM screenshots WHERE id = ? RETURNING `+screenshotColumns, id))
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var remaining int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM screenshots WHERE hash = ?`, shot.Hash).Scan(&remaining); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	// 元数据已删除，锁定时无法解密不影响删除结果
+	s.openScreenshot(shot)
+	return shot, remaining == 0, nil
+}
+
+// GetScreenshotUsage 统计截图数量和图片文件占用的空间
+func (s *SQLiteStorage) GetScreenshotUsage() (*ScreenshotUsage, error) {
+	usage := &ScreenshotUsage{}
+	err := s.readStmts.queryRow(`SELECT (SELECT COUNT(*) FROM screenshots), COUNT(*), COALESCE(SUM(size), 0)
+		FROM (SELECT MAX(size) AS size FROM screenshots GROUP BY hash)`).
+		Scan(&usage.Screenshots, &usage.Blobs, &usage.Bytes)
+	return usage, err
+}
+
+func (m *MemoryStorage) SaveScreenshot(shot *models.Screenshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *shot
+	stored.ID = m.allocID("screenshots")
+	stored.DeviceID = m.deviceID
+	stored.Timestamp = stored.Timestamp.Round(0)
+	stored.CreatedAt = time.Now().Round(0)
+	m.screenshots = append(m.screenshots, &stored)
+	shot.ID, shot.DeviceID, shot.CreatedAt = stored.ID, stored.DeviceID, stored.CreatedAt
+	return nil
+}
+
+func (m *MemoryStorage) GetScreenshot(id int64) (*models.Screenshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, shot := range m.screenshots {
+		if shot.ID == id {
+			copied := *shot
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStorage) QueryScreenshots(q ScreenshotQuery) ([]*models.Screenshot, error) {
+	m.mu.RLock()
+	var shots []*models.Screenshot
+	for _, shot := range m.screenshots {
+		if !inRange(shot.Timestamp, q.From, q.To) || (q.AppName != "" && shot.AppName != q.AppName) {
+			continue
+		}
+		copied := *shot
+		shots = append(shots, &copied)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(shots, func(i, j int) bool {
+		if !shots[i].Timestamp.Equal(shots[j].Timestamp) {
+			return shots[i].Timestamp.After(shots[j].Timestamp) != q.Oldest
+		}
+		return (shots[i].ID > shots[j].ID) != q.Oldest
+	})
+
+	return shots[:applyLimit(len(shots), pageSize(q.Limit))], nil
+}
+
+func (m *MemoryStorage) UpdateScreenshotAnalysis(id int64, analysis string) (*models.Screenshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, shot := range m.screenshots {
+		if shot.ID == id {
+			shot.Analysis = analysis
+			copied := *shot
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStorage) DeleteScreenshot(id int64) (*models.Screenshot, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted *models.Screenshot
+	var kept []*models.Screenshot
+	for _, shot := range m.screenshots {
+		if shot.ID == id {
+			deleted = shot
+			continue
+		}
+		kept = append(kept, shot)
+	}
+	if deleted == nil {
+		return nil, false, nil
+	}
+	m.screenshots = kept
+
+	for _, shot := range kept {
+		if shot.Hash == deleted.Hash {
+			return deleted, false, nil
+		}
+	}
+	return deleted, true, nil
+}
+
+func (m *MemoryStorage) GetScreenshotUsage() (*ScreenshotUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage := &ScreenshotUsage{Screenshots: int64(len(m.screenshots))}
+	seen := make(map[string]bool)
+	for _, shot := range m.screenshots {
+		if !seen[shot.Hash] {
+			seen[shot.Hash] = true
+			usage.Blobs++
+			usage.Bytes += shot.Size
+		}
+	}
+	return usage, nil
+}
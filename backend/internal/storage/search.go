@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 搜索来源
+const (
+	SearchSourceKeyboard   = "keyboard_inputs"
+	SearchSourceActivities = "activities"
+	SearchSourceSummaries  = "ai_summaries"
+)
+
+// 搜索模式
+const (
+	SearchModeFTS5 = "fts5" // FTS5 全文索引，按 bm25 相关度排序
+	SearchModeLike = "like" // 子串匹配，按时间倒序排列
+)
+
+// 高亮标记
+const (
+	highlightOpen   = "<mark>"
+	highlightClose  = "</mark>"
+	snippetEllipsis = "…"
+	// snippetRunes 降级模式下关键词两侧保留的字符数
+	snippetRunes = 24
+	// ftsMinQueryRunes trigram 分词器能匹配的最短查询长度
+	ftsMinQueryRunes = 3
+)
+
+// SearchQuery 全文搜索条件
+type SearchQuery struct {
+	Text    string    // 搜索内容
+	From    time.Time // 起始时间（包含）
+	To      time.Time // 结束时间（不包含）
+	Sources []string  // 搜索来源，为空时搜索全部
+	Limit   int       // 每个来源最多返回的条数，<= 0 时使用 DefaultPageSize
+}
+
+// SearchHit 一条搜索结果
+type SearchHit struct {
+	ID        int64     `json:"id"`
+	Source    string    `json:"source"`
+	AppName   string    `json:"app_name,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"` // 相关度，越小越相关；降级模式下为 0
+}
+
+// SearchResults 按来源分组的搜索结果
+type SearchResults struct {
+	Query   string                  `json:"query"`
+	Mode    string                  `json:"mode"`
+	Results map[string][]*SearchHit `json:"results"`
+	Skipped []string                `json:"skipped,omitempty"` // 因字段加密而无法搜索的来源
+}
+
+// searchSource 描述一个可搜索的表
+type searchSource struct {
+	name       string
+	ftsTable   string
+	columns    []string // 建立全文索引的列
+	timeColumn string
+	appColumn  string // 没有应用名列时为空
+}
+
+var searchSources = []searchSource{
+	{name: SearchSourceKeyboard, ftsTable: "keyboard_inputs_fts", columns: []string{"text"}, timeColumn: "timestamp", appColumn: "app_name"},
+	{name: SearchSourceActivities, ftsTable: "activities_fts", columns: []string{"content", "window_title", "url"}, timeColumn: "timestamp", appColumn: "app_name"},
+	{name: SearchSourceSummaries, ftsTable: "ai_summaries_fts", columns: []string{"summary"}, timeColumn: "created_at"},
+}
+
+// ValidSearchSource 判断搜索来源是否有效
+func ValidSearchSource(name string) bool {
+	for _, source := range searchSources {
+		if source.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedSources 根据查询条件筛选搜索来源
+func (q SearchQuery) selectedSources() []searchSource {
+	if len(q.Sources) == 0 {
+		return searchSources
+	}
+	var selected []searchSource
+	for _, source := range searchSources {
+		for _, name := range q.Sources {
+			if source.name == name {
+				selected = append(selected, source)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// ensureSearchIndex 在 SQLite 编译了 FTS5 时创建全文索引和同步触发器
+// FTS5 需要使用 -tags sqlite_fts5 编译，否则搜索降级为子串匹配
+func (s *SQLiteStorage) ensureSearchIndex() error {
+	var enabled bool
+	if err := s.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return fmt.Errorf("failed to detect FTS5 support: %w", err)
+	}
+	if !enabled {
+		// 启用 FTS5 的版本建立的索引表没有 FTS5 时无法更新也无法删除，修改和删除（保留清理、
+		// 遗忘、同步合并）的记录会以明文残留在索引中，因此拒绝打开
+		if err := checkNoSearchIndex(s.db); err != nil {
+			return err
+		}
+		fmt.Println("Warning: SQLite was built without FTS5 (build with -tags sqlite_fts5), search falls back to substring matching")
+		// 没有索引表时残留的触发器会让写入失败
+		return s.dropSearchTriggers()
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	encrypted := s.encryptedColumns()
+	for _, source := range searchSources {
+		if _, ok := encrypted[source.name]; ok {
+			continue
+		}
+
+		var tables, triggers int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, source.ftsTable).Scan(&tables); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?, ?, ?)`,
+			source.ftsTable+"_ai", source.ftsTable+"_ad", source.ftsTable+"_au").Scan(&triggers); err != nil {
+			return err
+		}
+		if tables > 0 && triggers == 3 {
+			continue
+		}
+
+		// 索引表不存在，或者触发器被没有 FTS5 的版本删除过、索引已经过期
+		statements := append(source.dropTriggerStatements(), source.triggerStatements()...)
+		if tables == 0 {
+			statements = append([]string{source.tableStatement()}, statements...)
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("failed to create search index %s: %w", source.ftsTable, err)
+			}
+		}
+		// 为已有数据建立索引
+		if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES('rebuild')`, source.ftsTable)); err != nil {
+			return fmt.Errorf("failed to rebuild search index %s: %w", source.ftsTable, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.ftsEnabled = true
+	return nil
+}
+
+// searchIndexExists 来源的全文索引表是否存在
+func searchIndexExists(db *sql.DB, source searchSource) (bool, error) {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, source.ftsTable).Scan(&tables); err != nil {
+		return false, err
+	}
+	return tables > 0, nil
+}
+
+// checkNoSearchIndex 没有 FTS5 时检查数据库中没有全文索引表
+func checkNoSearchIndex(db *sql.DB) error {
+	for _, source := range searchSources {
+		exists, err := searchIndexExists(db, source)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("search index %s was created with FTS5 and would keep deleted records; open this database with a build using -tags sqlite_fts5", source.ftsTable)
+		}
+	}
+	return nil
+}
+
+// dropSearchTriggers 删除全部来源的索引同步触发器
+func (s *SQLiteStorage) dropSearchTriggers() error {
+	for _, source := range searchSources {
+		for _, statement := range source.dropTriggerStatements() {
+			if _, err := s.db.Exec(statement); err != nil {
+				return fmt.Errorf("failed to drop search index triggers %s: %w", source.ftsTable, err)
+			}
+		}
+	}
+	return nil
+}
+
+// tableStatement 生成外部内容 FTS5 表
+func (source searchSource) tableStatement() string {
+	return fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(%s, content='%s', content_rowid='id', tokenize='trigram')`,
+		source.ftsTable, strings.Join(source.columns, ", "), source.name)
+}
+
+// triggerStatements 生成保持索引同步的触发器
+func (source searchSource) triggerStatements() []string {
+	columns := strings.Join(source.columns, ", ")
+	newValues := "new." + strings.Join(source.columns, ", new.")
+	oldValues := "old." + strings.Join(source.columns, ", old.")
+
+	return []string{
+		fmt.Sprintf(`CREATE TRIGGER %[1]s_ai AFTER INSERT ON %[2]s BEGIN
+			INSERT INTO %[1]s(rowid, %[3]s) VALUES (new.id, %[4]s);
+		END`, source.ftsTable, source.name, columns, newValues),
+		fmt.Sprintf(`CREATE TRIGGER %[1]s_ad AFTER DELETE ON %[2]s BEGIN
+			INSERT INTO %[1]s(%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+		END`, source.ftsTable, source.name, columns, oldValues),
+		fmt.Sprintf(`CREATE TRIGGER %[1]s_au AFTER UPDATE ON %[2]s BEGIN
+			INSERT INTO %[1]s(%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+			INSERT INTO %[1]s(rowid, %[3]s) VALUES (new.id, %[5]s);
+		END`, source.ftsTable, source.name, columns, oldValues, newValues),
+	}
+}
+
+// dropTriggerStatements 删除索引同步触发器
+func (source searchSource) dropTriggerStatements() []string {
+	return []string{
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %s_ai`, source.ftsTable),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %s_ad`, source.ftsTable),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %s_au`, source.ftsTable),
+	}
+}
+
+// ftsMatchExpression 将用户输入转换为 FTS5 查询：每个词作为短语，词之间为 AND
+func ftsMatchExpression(text string) string {
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		terms = append(terms, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// useFTS trigram 分词要求每个词至少 3 个字符，更短的词只能用子串匹配
+func (s *SQLiteStorage) useFTS(text string) bool {
+	if !s.ftsEnabled {
+		return false
+	}
+	for _, term := range strings.Fields(text) {
+		if utf8.RuneCountInString(term) < ftsMinQueryRunes {
+			return false
+		}
+	}
+	return true
+}
+
+// Search 全文搜索键盘输入、活动记录和AI总结，结果按来源分组
+func (s *SQLiteStorage) Search(q SearchQuery) (*SearchResults, error) {
+	text := strings.TrimSpace(q.Text)
+	if text == "" {
+		return nil, fmt.Errorf("search text cannot be empty")
+	}
+
+	results := &SearchResults{Query: text, Mode: SearchModeLike, Results: make(map[string][]*SearchHit)}
+	if s.useFTS(text) {
+		results.Mode = SearchModeFTS5
+	}
+
+	encrypted := s.encryptedColumns()
+	for _, source := range q.selectedSources() {
+		if _, ok := encrypted[source.name]; ok {
+			results.Skipped = append(results.Skipped, source.name)
+			continue
+		}
+
+		var hits []*SearchHit
+		var err error
+		if results.Mode == SearchModeFTS5 {
+			hits, err = s.searchFTS(source, text, q)
+		} else {
+			hits, err = s.searchLike(source, text, q)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %w", source.name, err)
+		}
+		results.Results[source.name] = hits
+	}
+
+	return results, nil
+}
+
+func (s *SQLiteStorage) searchFTS(source searchSource, text string, q SearchQuery) ([]*SearchHit, error) {
+	appColumn := "''"
+	if source.appColumn != "" {
+		appColumn = "COALESCE(t." + source.appColumn + ", '')"
+	}
+
+	where := &whereBuilder{}
+	where.add(source.ftsTable+" MATCH ?", ftsMatchExpression(text))
+	where.addTimeRange("t."+source.timeColumn, q.From, q.To, nil)
+
+	query := fmt.Sprintf(`SELECT t.id, %[1]s, t.%[2]s, snippet(%[3]s, -1, ?, ?, ?, 48), bm25(%[3]s)
+		FROM %[3]s JOIN %[4]s t ON t.id = %[3]s.rowid%[5]s
+		ORDER BY bm25(%[3]s) LIMIT ?`,
+		appColumn, source.timeColumn, source.ftsTable, source.name, where.String())
+
+	args := append([]interface{}{highlightOpen, highlightClose, snippetEllipsis}, where.args...)
+	rows, err := s.readStmts.query(query, append(args, pageSize(q.Limit))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*SearchHit
+	for rows.Next() {
+		hit := &SearchHit{Source: source.name}
+		if err := rows.Scan(&hit.ID, &hit.AppName, &hit.Timestamp, &hit.Snippet, &hit.Rank); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+func (s *SQLiteStorage) searchLike(source searchSource, text string, q SearchQuery) ([]*SearchHit, error) {
+	appColumn := "''"
+	if source.appColumn != "" {
+		appColumn = "COALESCE(" + source.appColumn + ", '')"
+	}
+
+	where := &whereBuilder{}
+	for _, term := range strings.Fields(text) {
+		var matches []string
+		for _, column := range source.columns {
+			matches = append(matches, column+` LIKE ? ESCAPE '\'`)
+			where.args = append(where.args, likePattern(term))
+		}
+		where.conditions = append(where.conditions, "("+strings.Join(matches, " OR ")+")")
+	}
+	where.addTimeRange(source.timeColumn, q.From, q.To, nil)
+
+	var coalesced []string
+	for _, column := range source.columns {
+		coalesced = append(coalesced, "COALESCE("+column+", '')")
+	}
+
+	query := fmt.Sprintf(`SELECT id, %s, %s, %s FROM %s%s ORDER BY %s DESC, id DESC LIMIT ?`,
+		appColumn, source.timeColumn, strings.Join(coalesced, ", "), source.name, where.String(), source.timeColumn)
+
+	rows, err := s.readStmts.query(query, append(where.args, pageSize(q.Limit))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*SearchHit
+	for rows.Next() {
+		hit := &SearchHit{Source: source.name}
+		values := make([]string, len(source.columns))
+		dest := []interface{}{&hit.ID, &hit.AppName, &hit.Timestamp}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		hit.Snippet = highlightSnippet(values, text)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// highlightSnippet 在第一个包含关键词的字段中截取关键词附近的片段并高亮所有关键词
+func highlightSnippet(values []string, text string) string {
+	terms := strings.Fields(text)
+	for _, value := range values {
+		start, end := firstMatch(value, terms)
+		if start < 0 {
+			continue
+		}
+
+		runes := []rune(value)
+		startRune := utf8.RuneCountInString(value[:start])
+		endRune := startRune + utf8.RuneCountInString(value[start:end])
+
+		from, to := startRune-snippetRunes, endRune+snippetRunes
+		prefix, suffix := snippetEllipsis, snippetEllipsis
+		if from <= 0 {
+			from, prefix = 0, ""
+		}
+		if to >= len(runes) {
+			to, suffix = len(runes), ""
+		}
+
+		return prefix + highlightTerms(string(runes[from:to]), terms) + suffix
+	}
+	return ""
+}
+
+// firstMatch 查找任一关键词第一次出现的字节区间（不区分大小写），未找到返回 -1
+func firstMatch(value string, terms []string) (int, int) {
+	haystack, fold := strings.ToLower(value), true
+	// 大小写转换改变了字节长度时按原文匹配，保证区间对应原字符串
+	if len(haystack) != len(value) {
+		haystack, fold = value, false
+	}
+
+	bestStart, bestEnd := -1, -1
+	for _, term := range terms {
+		needle := term
+		if fold {
+			needle = strings.ToLower(term)
+		}
+		if index := strings.Index(haystack, needle); index >= 0 && (bestStart < 0 || index < bestStart) {
+			bestStart, bestEnd = index, index+len(needle)
+		}
+	}
+	return bestStart, bestEnd
+}
+
+// highlightTerms 用高亮标记包裹片段中出现的所有关键词
+func highlightTerms(fragment string, terms []string) string {
+	lower := strings.ToLower(fragment)
+	if len(lower) != len(fragment) {
+		return fragment
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(fragment); {
+		matched := 0
+		for _, term := range terms {
+			if strings.HasPrefix(lower[i:], strings.ToLower(term)) && len(term) > matched {
+				matched = len(term)
+			}
+		}
+		if matched > 0 {
+			builder.WriteString(highlightOpen + fragment[i:i+matched] + highlightClose)
+			i += matched
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(fragment[i:])
+		builder.WriteString(fragment[i : i+size])
+		i += size
+	}
+	return builder.String()
+}
+
+// matchesAll 判断是否每个关键词都出现在某个字段中
+func matchesAll(values []string, text string) bool {
+	for _, term := range strings.Fields(text) {
+		found := false
+		for _, value := range values {
+			if containsFold(value, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Search 子串匹配搜索，与 SQLiteStorage 的降级模式一致
+func (m *MemoryStorage) Search(q SearchQuery) (*SearchResults, error) {
+	text := strings.TrimSpace(q.Text)
+	if text == "" {
+		return nil, fmt.Errorf("search text cannot be empty")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := &SearchResults{Query: text, Mode: SearchModeLike, Results: make(map[string][]*SearchHit)}
+	for _, source := range q.selectedSources() {
+		var hits []*SearchHit
+		add := func(id int64, appName string, timestamp time.Time, values ...string) {
+			if inRange(timestamp, q.From, q.To) && matchesAll(values, text) {
+				hits = append(hits, &SearchHit{ID: id, Source: source.name, AppName: appName,
+					Timestamp: timestamp, Snippet: highlightSnippet(values, text)})
+			}
+		}
+
+		switch source.name {
+		case SearchSourceKeyboard:
+			for _, input := range m.keyboardInputs {
+				add(input.ID, input.AppName, input.Timestamp, input.Text)
+			}
+		case SearchSourceActivities:
+			for _, activity := range m.activities {
+				add(activity.ID, activity.AppName, activity.Timestamp, activity.Content, activity.WindowTitle, activity.URL)
+			}
+		case SearchSourceSummaries:
+			for _, summary := range m.summaries {
+				add(summary.ID, "", summary.CreatedAt, summary.Summary)
+			}
+		}
+
+		sort.Slice(hits, func(i, j int) bool {
+			if !hits[i].Timestamp.Equal(hits[j].Timestamp) {
+				return hits[i].Timestamp.After(hits[j].Timestamp)
+			}
+			return hits[i].ID > hits[j].ID
+		})
+		results.Results[source.name] = hits[:applyLimit(len(hits), pageSize(q.Limit))]
+	}
+
+	return results, nil
+}
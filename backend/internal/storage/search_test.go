@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 启用 FTS5 的版本打开过的数据库带有索引同步触发器，没有 FTS5 的版本打开后仍然可以写入和搜索
+func TestOpenWithoutFTS5AfterIndexTriggers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	if s.ftsEnabled {
+		s.Close()
+		t.Skip("SQLite is built with FTS5")
+	}
+	// 没有 FTS5 时无法创建索引表，触发器引用的表不存在，执行时的失败方式相同
+	for _, source := range searchSources {
+		for _, statement := range source.triggerStatements() {
+			if _, err := s.db.Exec(statement); err != nil {
+				t.Fatalf("create trigger: %v", err)
+			}
+		}
+	}
+	s.Close()
+
+	s, err = NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.SaveKeyboardInput(&models.KeyboardInput{Text: "hello world", AppName: "Code", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("SaveKeyboardInput: %v", err)
+	}
+	results, err := s.Search(SearchQuery{Text: "hello"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if results.Mode != SearchModeLike || len(results.Results[SearchSourceKeyboard]) != 1 {
+		t.Errorf("search mode %s found %d keyboard inputs, want like mode with 1", results.Mode, len(results.Results[SearchSourceKeyboard]))
+	}
+}
+
+// fakeSearchIndex 没有 FTS5 时无法建立虚拟表，用同名的普通表模拟启用 FTS5 的版本留下的索引表
+func fakeSearchIndex(t *testing.T, s *SQLiteStorage) {
+	t.Helper()
+	if _, err := s.db.Exec(`CREATE TABLE ` + searchSources[0].ftsTable + ` (text)`); err != nil {
+		t.Fatalf("create index table: %v", err)
+	}
+}
+
+// 没有 FTS5 的版本无法更新全文索引，修改和删除的记录会以明文残留在索引中，因此拒绝打开带索引表的数据库
+func TestOpenWithoutFTS5RefusesSearchIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	if s.ftsEnabled {
+		s.Close()
+		t.Skip("SQLite is built with FTS5")
+	}
+	fakeSearchIndex(t, s)
+	s.Close()
+
+	s, err = NewSQLiteStorage(path)
+	if err == nil {
+		s.Close()
+		t.Fatal("opened a database with a full-text index without FTS5")
+	}
+	if !strings.Contains(err.Error(), searchSources[0].ftsTable) {
+		t.Errorf("error %q does not name the index", err)
+	}
+}
+
+// 恢复带全文索引的快照同样会被拒绝，当前数据保持不变
+func TestRestoreWithoutFTS5RefusesSearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	source, err := NewSQLiteStorage(filepath.Join(dir, "source.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	defer source.Close()
+	if source.ftsEnabled {
+		t.Skip("SQLite is built with FTS5")
+	}
+	fakeSearchIndex(t, source)
+	snapshot := filepath.Join(dir, "snapshot.db")
+	if err := source.Backup(snapshot); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	s, err := NewSQLiteStorage(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	defer s.Close()
+	if err := s.SaveKeyboardInput(&models.KeyboardInput{Text: "kept", AppName: "Code", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("SaveKeyboardInput: %v", err)
+	}
+
+	if err := s.Restore(snapshot); err == nil {
+		t.Fatal("restored a snapshot with a full-text index without FTS5")
+	}
+	inputs, err := s.GetRecentKeyboardInputs(10)
+	if err != nil {
+		t.Fatalf("GetRecentKeyboardInputs: %v", err)
+	}
+	if len(inputs) != 1 || inputs[0].Text != "kept" {
+		t.Errorf("keyboard inputs after the refused restore = %d, want the current one", len(inputs))
+	}
+}
@@ -3,107 +3,188 @@ package storage
 import (
 	"database/sql"
 	"fmt"
-	"time"
+	"sync"
 
+	"yaml-backend/internal/vault"
 	"yaml-backend/pkg/models"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// SummaryResult AI总结结果（为了避免循环导入）
-type SummaryResult struct {
-	ID        int64     `json:"id" db:"id"`
-	Type      string    `json:"type" db:"type"`
-	Summary   string    `json:"summary" db:"summary"`
-	DataCount int       `json:"data_count" db:"data_count"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-}
-
 type SQLiteStorage struct {
-	db *sql.DB
+	db                *sql.DB      // 写连接池（单连接），迁移和事务都在这里执行
+	readDB            *sql.DB      // 只读连接池，内存数据库时与 db 相同
+	writeStmts        *stmtCache   // 写连接上缓存的预编译语句
+	readStmts         *stmtCache   // 读连接上缓存的预编译语句
+	ftsEnabled        bool         // 是否启用了 FTS5 全文索引
+	vault             *vault.Vault // 字段加密，未启用时为 nil
+	encryptActivities bool         // 是否同时加密活动记录的内容、标题和URL
+	deviceID          string       // 本机设备ID，写入每条本机采集的记录
+
+	rulesMu sync.RWMutex
+	rules   []*compiledRule // 生效的自动打标签规则
 }
 
-func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// Option SQLiteStorage 的可选配置
+type Option func(*SQLiteStorage)
+
+// NewSQLiteStorage 打开数据库：WAL 模式、busy_timeout、读写分离的连接池和预编译语句缓存
+func NewSQLiteStorage(dbPath string, opts ...Option) (*SQLiteStorage, error) {
+	db, readDB, err := openPools(dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := readDB.Ping(); err != nil {
+		db.Close()
+		readDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	storage := &SQLiteStorage{db: db}
-	if err := storage.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	storage := &SQLiteStorage{
+		db:         db,
+		readDB:     readDB,
+		writeStmts: newStmtCache(db),
+		readStmts:  newStmtCache(readDB),
+	}
+	for _, opt := range opts {
+		opt(storage)
 	}
 
-	return storage, nil
-}
+	if err := storage.migrate(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
 
-func (s *SQLiteStorage) createTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS activities (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			type TEXT NOT NULL,
-			content TEXT,
-			app_name TEXT,
-			window_title TEXT,
-			url TEXT,
-			timestamp DATETIME NOT NULL,
-			duration INTEGER DEFAULT 0
-		)`,
-		`CREATE TABLE IF NOT EXISTS keyboard_inputs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			text TEXT NOT NULL,
-			app_name TEXT,
-			timestamp DATETIME NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS app_usage (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			app_name TEXT NOT NULL,
-			start_time DATETIME NOT NULL,
-			end_time DATETIME,
-			duration INTEGER DEFAULT 0
-		)`,
-		`CREATE TABLE IF NOT EXISTS ai_summaries (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			type TEXT NOT NULL,
-			summary TEXT NOT NULL,
-			data_count INTEGER DEFAULT 0,
-			created_at DATETIME NOT NULL
-		)`,
-	}
-
-	for _, query := range queries {
-		if _, err := s.db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query %s: %w", query, err)
-		}
+	if err := storage.loadDeviceID(false); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to load device id: %w", err)
 	}
 
-	return nil
+	if err := storage.loadRules(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to load tagging rules: %w", err)
+	}
+
+	if err := storage.ensureSearchIndex(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to set up search index: %w", err)
+	}
+
+	if err := storage.setupEncryption(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to set up encryption: %w", err)
+	}
+
+	if err := storage.writeStmts.warm(insertActivitySQL, insertKeyboardInputSQL,
+		insertAppUsageSQL, updateActivityDurationSQL, selectActivityRollupSQL,
+		upsertHourlyStatsSQL, upsertDailyStatsSQL, reserveSyncSeqSQL); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	return storage, nil
 }
 
 func (s *SQLiteStorage) SaveActivity(activity *models.Activity) error {
-	query := `INSERT INTO activities (type, content, app_name, window_title, url, timestamp, duration) 
-			   VALUES (?, ?, ?, ?, ?, ?, ?)`
-	
-	_, err := s.db.Exec(query, activity.Type, activity.Content, activity.AppName, 
-		activity.WindowTitle, activity.URL, activity.Timestamp, activity.Duration)
-	return err
+	content, windowTitle, url, err := s.sealActivity(activity)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seq, err := s.reserveSyncSeq(tx, 1)
+	if err != nil {
+		return err
+	}
+	stmt, err := s.writeStmts.txStmt(tx, insertActivitySQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(activity.Type, content, activity.AppName,
+		windowTitle, url, dbTime(activity.Timestamp), activity.Duration, s.deviceID, seq)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := s.tagActivity(tx, id, activity); err != nil {
+		return err
+	}
+
+	delta := make(rollupDelta)
+	delta.addActivity(activity)
+	if err := s.applyRollups(tx, delta); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	activity.ID = id
+	activity.DeviceID = s.deviceID
+	return nil
 }
 
 func (s *SQLiteStorage) SaveKeyboardInput(input *models.KeyboardInput) error {
-	query := `INSERT INTO keyboard_inputs (text, app_name, timestamp) VALUES (?, ?, ?)`
-	_, err := s.db.Exec(query, input.Text, input.AppName, input.Timestamp)
-	return err
+	text, err := s.seal(input.Text)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seq, err := s.reserveSyncSeq(tx, 1)
+	if err != nil {
+		return err
+	}
+	stmt, err := s.writeStmts.txStmt(tx, insertKeyboardInputSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	count := inputKeystrokes(input)
+	result, err := stmt.Exec(text, input.AppName, dbTime(input.Timestamp), count, input.Corrections, input.Duration,
+		s.deviceID, seq)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	delta := make(rollupDelta)
+	delta.addKeyboardInput(input.AppName, input.Timestamp, count)
+	if err := s.applyRollups(tx, delta); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	input.ID = id
+	input.DeviceID = s.deviceID
+	return nil
 }
 
 func (s *SQLiteStorage) GetRecentActivities(limit int) ([]*models.Activity, error) {
-	query := `SELECT id, type, content, app_name, window_title, url, timestamp, duration 
+	query := `SELECT id, type, content, app_name, window_title, url, timestamp, duration, device_id
 			   FROM activities ORDER BY timestamp DESC LIMIT ?`
 	
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.readStmts.query(query, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -114,10 +195,13 @@ func (s *SQLiteStorage) GetRecentActivities(limit int) ([]*models.Activity, erro
 		activity := &models.Activity{}
 		err := rows.Scan(&activity.ID, &activity.Type, &activity.Content, 
 			&activity.AppName, &activity.WindowTitle, &activity.URL, 
-			&activity.Timestamp, &activity.Duration)
+			&activity.Timestamp, &activity.Duration, &activity.DeviceID)
 		if err != nil {
 			return nil, err
 		}
+		if err := s.openActivity(activity); err != nil {
+			return nil, err
+		}
 		activities = append(activities, activity)
 	}
 
@@ -125,10 +209,10 @@ func (s *SQLiteStorage) GetRecentActivities(limit int) ([]*models.Activity, erro
 }
 
 func (s *SQLiteStorage) GetRecentKeyboardInputs(limit int) ([]*models.KeyboardInput, error) {
-	query := `SELECT id, text, app_name, timestamp 
+	query := `SELECT ` + keyboardInputColumns + `
 			   FROM keyboard_inputs ORDER BY timestamp DESC LIMIT ?`
 	
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.readStmts.query(query, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -136,74 +220,52 @@ func (s *SQLiteStorage) GetRecentKeyboardInputs(limit int) ([]*models.KeyboardIn
 
 	var inputs []*models.KeyboardInput
 	for rows.Next() {
-		input := &models.KeyboardInput{}
-		err := rows.Scan(&input.ID, &input.Text, &input.AppName, &input.Timestamp)
+		input, err := scanKeyboardInput(rows)
 		if err != nil {
 			return nil, err
 		}
-		inputs = append(inputs, input)
-	}
-
-	return inputs, nil
-}
-
-func (s *SQLiteStorage) SaveSummary(summary *SummaryResult) error {
-	query := `INSERT INTO ai_summaries (type, summary, data_count, created_at) VALUES (?, ?, ?, ?)`
-	_, err := s.db.Exec(query, summary.Type, summary.Summary, summary.DataCount, summary.CreatedAt)
-	return err
-}
-
-func (s *SQLiteStorage) GetRecentSummaries(limit int) ([]*SummaryResult, error) {
-	query := `SELECT id, type, summary, data_count, created_at 
-			   FROM ai_summaries ORDER BY created_at DESC LIMIT ?`
-	
-	rows, err := s.db.Query(query, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var summaries []*SummaryResult
-	for rows.Next() {
-		summary := &SummaryResult{}
-		err := rows.Scan(&summary.ID, &summary.Type, &summary.Summary, 
-			&summary.DataCount, &summary.CreatedAt)
-		if err != nil {
+		if err := s.openKeyboardInput(input); err != nil {
 			return nil, err
 		}
-		summaries = append(summaries, summary)
+		inputs = append(inputs, input)
 	}
 
-	return summaries, nil
+	return inputs, nil
 }
 
 func (s *SQLiteStorage) Close() error {
+	s.readStmts.close()
+	s.writeStmts.close()
+	if s.readDB != s.db {
+		s.readDB.Close()
+	}
 	return s.db.Close()
 }
 
-// GetActivityCount 获取活动记录总数
+// GetActivityCount 从每日统计获取活动记录总数，不扫描原始记录
 func (s *SQLiteStorage) GetActivityCount() (int, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM activities").Scan(&count)
+	err := s.readStmts.queryRow("SELECT COALESCE(SUM(activity_count), 0) FROM daily_app_stats").Scan(&count)
 	return count, err
 }
 
-// GetKeyboardInputCount 获取键盘输入总数
+// GetKeyboardInputCount 从每日统计获取键盘输入总数
 func (s *SQLiteStorage) GetKeyboardInputCount() (int, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM keyboard_inputs").Scan(&count)
+	err := s.readStmts.queryRow("SELECT COALESCE(SUM(keyboard_count), 0) FROM daily_app_stats").Scan(&count)
 	return count, err
 }
 
-// GetMostActiveApp 获取最活跃的应用
+// GetMostActiveApp 从每日统计获取最活跃的应用
 func (s *SQLiteStorage) GetMostActiveApp() (string, error) {
 	var appName string
-	err := s.db.QueryRow(`
+	err := s.readStmts.queryRow(`
 		SELECT app_name 
-		FROM activities 
-		WHERE app_name IS NOT NULL AND app_name != '' 
+		FROM daily_app_stats 
+		WHERE app_name != '' 
 		GROUP BY app_name 
-		ORDER BY COUNT(*) DESC 
+		HAVING SUM(activity_count) > 0
+		ORDER BY SUM(activity_count) DESC, app_name ASC
 		LIMIT 1
 	`).Scan(&appName)
 	
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// Store 存储后端接口，SQLiteStorage 和 MemoryStorage 都实现了该接口
+type Store interface {
+	// SaveActivity 保存活动记录，成功后回填 activity.ID
+	SaveActivity(activity *models.Activity) error
+	// SaveKeyboardInput 保存键盘输入，成功后回填 input.ID
+	SaveKeyboardInput(input *models.KeyboardInput) error
+	// GetRecentActivities 按时间倒序获取最近的活动记录
+	GetRecentActivities(limit int) ([]*models.Activity, error)
+	// GetRecentKeyboardInputs 按时间倒序获取最近的键盘输入
+	GetRecentKeyboardInputs(limit int) ([]*models.KeyboardInput, error)
+	// SaveBatch 在一个事务中批量写入，成功后回填各记录的 ID
+	SaveBatch(batch *Batch) error
+	// SaveImport 写入从其他工具导入的记录，同一来源中已导入过的记录会被跳过
+	SaveImport(batch *ImportBatch) (*ImportResult, error)
+	// QueryActivities 按时间范围和过滤条件分页查询活动记录
+	QueryActivities(q ActivityQuery) ([]*models.Activity, string, error)
+	// QueryKeyboardInputs 按时间范围和过滤条件分页查询键盘输入
+	QueryKeyboardInputs(q KeyboardQuery) ([]*models.KeyboardInput, string, error)
+
+	// SaveAppUsage 保存一段应用前台使用记录，成功后回填 usage.ID
+	SaveAppUsage(usage *models.AppUsage) error
+	// UpdateActivityDuration 回填活动记录的持续时间（秒）
+	UpdateActivityDuration(id int64, duration int64) error
+	// QueryAppUsage 按开始时间倒序查询应用使用记录
+	QueryAppUsage(q AppUsageQuery) ([]*models.AppUsage, error)
+	// GetAppUsageTotals 按应用汇总 [from, to) 内开始的使用记录时长，零值表示不限
+	GetAppUsageTotals(from, to time.Time) ([]*models.AppUsageTotal, error)
+
+	// SaveSummary 保存AI总结，成功后回填 summary.ID
+	SaveSummary(summary *SummaryResult) error
+	// GetRecentSummaries 按创建时间倒序获取最近的AI总结
+	GetRecentSummaries(limit int) ([]*SummaryResult, error)
+	// QuerySummaries 按类型和创建时间范围查询AI总结，按创建时间倒序排列
+	QuerySummaries(q SummaryQuery) ([]*SummaryResult, error)
+	// GetSummaryRecords 获取总结及生成时使用的来源记录，总结不存在时返回 nil
+	GetSummaryRecords(id int64) (*SummaryRecords, error)
+
+	// GetActivityCount 从每日统计获取活动记录总数（包含已清理的记录）
+	GetActivityCount() (int, error)
+	// GetKeyboardInputCount 从每日统计获取键盘输入总数（包含已清理的记录）
+	GetKeyboardInputCount() (int, error)
+	// GetMostActiveApp 从每日统计获取活动记录最多的应用，没有数据时返回 "-"
+	GetMostActiveApp() (string, error)
+
+	// Search 全文搜索键盘输入、活动记录和AI总结
+	Search(q SearchQuery) (*SearchResults, error)
+
+	// EachActivity 按时间正序逐条遍历 [from, to) 内的活动记录，用于流式导出
+	EachActivity(from, to time.Time, fn func(*models.Activity) error) error
+	// EachKeyboardInput 按时间正序逐条遍历 [from, to) 内的键盘输入
+	EachKeyboardInput(from, to time.Time, fn func(*models.KeyboardInput) error) error
+	// EachAppUsage 按开始时间正序逐条遍历 [from, to) 内开始的应用使用记录
+	EachAppUsage(from, to time.Time, fn func(*models.AppUsage) error) error
+	// EachSummary 按创建时间正序逐条遍历 [from, to) 内创建的AI总结
+	EachSummary(from, to time.Time, fn func(*SummaryResult) error) error
+
+	// PruneBefore 删除 cutoff 所在整点之前的原始记录，小时和每日统计保留
+	PruneBefore(cutoff time.Time) (*PruneResult, error)
+	// GetDailyAppStats 获取 [fromDay, toDay] 范围内的每日统计，日期格式 2006-01-02，空字符串表示不限
+	GetDailyAppStats(fromDay, toDay string) ([]*models.DailyAppStats, error)
+	// GetHourlyAppStats 获取 [fromHour, toHour] 范围内的小时统计，格式 2006-01-02 15:00，空字符串表示不限
+	GetHourlyAppStats(fromHour, toHour string) ([]*models.HourlyAppStats, error)
+	// RebuildRollups 根据原始记录重新计算 from 所在整点之后的小时和每日统计
+	RebuildRollups(from time.Time) (*RollupRebuild, error)
+
+	// Forget 删除匹配的活动、键盘输入和应用使用记录，同步更新全文索引和统计，并记录不含内容的审计日志
+	Forget(q ForgetQuery) (*ForgetResult, error)
+	// GetForgetLog 按时间倒序获取删除审计记录
+	GetForgetLog(limit int) ([]*ForgetAudit, error)
+
+	// SaveScreenshot 保存截图元数据，成功后回填 ID；图片文件由调用方按 Hash 保存
+	SaveScreenshot(shot *models.Screenshot) error
+	// GetScreenshot 获取单张截图的元数据，不存在时返回 nil
+	GetScreenshot(id int64) (*models.Screenshot, error)
+	// QueryScreenshots 按时间范围和应用查询截图，默认按时间倒序
+	QueryScreenshots(q ScreenshotQuery) ([]*models.Screenshot, error)
+	// UpdateScreenshotAnalysis 写入截图的AI分析结果，截图不存在时返回 nil
+	UpdateScreenshotAnalysis(id int64, analysis string) (*models.Screenshot, error)
+	// DeleteScreenshot 删除截图的元数据，返回被删除的截图以及图片文件是否已无其他截图引用
+	DeleteScreenshot(id int64) (*models.Screenshot, bool, error)
+	// GetScreenshotUsage 统计截图数量和图片文件占用的空间
+	GetScreenshotUsage() (*ScreenshotUsage, error)
+
+	// ListTags 按名称获取全部标签
+	ListTags() ([]*models.Tag, error)
+	// SaveTag ID 为 0 时创建标签，否则更新；同名返回 ErrDuplicateLabel，更新的标签不存在时返回 false
+	SaveTag(tag *models.Tag) (bool, error)
+	// DeleteTag 删除标签及其关联和规则，不存在时返回 false
+	DeleteTag(id int64) (bool, error)
+	// ListProjects 获取全部项目，未归档的在前
+	ListProjects() ([]*models.Project, error)
+	// SaveProject ID 为 0 时创建项目，否则更新；同名返回 ErrDuplicateLabel，更新的项目不存在时返回 false
+	SaveProject(project *models.Project) (bool, error)
+	// DeleteProject 删除项目及其关联和规则，不存在时返回 false
+	DeleteProject(id int64) (bool, error)
+	// AddLink 手动关联标签或项目与一条记录，标签、项目或记录不存在时返回 false
+	AddLink(link Link) (bool, error)
+	// RemoveLink 删除关联，不存在时返回 false
+	RemoveLink(link Link) (bool, error)
+	// GetLabels 获取一条记录关联的标签和项目
+	GetLabels(target string, targetID int64) (*models.Labels, error)
+	// GetProjectTotals 按项目汇总 [from, to) 内关联的活动和应用使用时长
+	GetProjectTotals(from, to time.Time) ([]*models.ProjectTotal, error)
+	// ListTagRules 获取全部自动打标签规则
+	ListTagRules() ([]*models.TagRule, error)
+	// SaveTagRule ID 为 0 时创建规则，否则更新；规则无效返回 ErrInvalidLabel，更新的规则不存在时返回 false
+	SaveTagRule(rule *models.TagRule) (bool, error)
+	// DeleteTagRule 删除规则及其生成的关联，不存在时返回 false
+	DeleteTagRule(id int64) (bool, error)
+	// ApplyTagRules 对 [from, to) 内的活动记录重新应用规则，替换规则生成的关联，保留手动关联
+	ApplyTagRules(from, to time.Time) (*RuleApplyResult, error)
+
+	// DeviceID 本机设备ID，与记录的 device_id 一起在多台设备间唯一标识记录
+	DeviceID() string
+	// GetChanges 按变更序号获取 since 之后新增、修改和删除的记录，内容为明文
+	GetChanges(since int64, limit int) (*SyncChanges, error)
+	// MergeChanges 在一个事务中合并对端的变更，重复合并同一批变更不会产生重复记录
+	MergeChanges(records []*SyncRecord) (*SyncMergeResult, error)
+	// GetSyncPeers 获取所有对端的水位和同步状态
+	GetSyncPeers() ([]*SyncPeer, error)
+	// SaveSyncPeer 保存对端的水位和同步状态
+	SaveSyncPeer(peer *SyncPeer) error
+
+	// GetChangeLog 按变更序号获取 since 之后的变更，新增和修改附带记录的当前内容（明文）
+	GetChangeLog(since int64, limit int) (*ChangeLog, error)
+	// WaitForChange 阻塞到 since 之后出现新的变更或 ctx 结束
+	WaitForChange(ctx context.Context, since int64) error
+
+	Close() error
+}
+
+// PruneResult 一次数据清理的结果
+type PruneResult struct {
+	Cutoff                time.Time `json:"cutoff"`
+	ActivitiesDeleted     int64     `json:"activities_deleted"`
+	KeyboardInputsDeleted int64     `json:"keyboard_inputs_deleted"`
+	AppUsageDeleted       int64     `json:"app_usage_deleted"`
+	ChangesDeleted        int64     `json:"changes_deleted"` // 清理时间之前写入的变更日志
+}
+
+// 编译期检查两种实现都满足 Store 接口
+var (
+	_ Store = (*SQLiteStorage)(nil)
+	_ Store = (*MemoryStorage)(nil)
+)
+
+// NewStore 根据数据库类型创建存储后端，opts 只对 SQLite 生效
+func NewStore(dbType, dbPath string, opts ...Option) (Store, error) {
+	switch dbType {
+	case "memory":
+		return NewMemoryStorage(), nil
+	case "", "sqlite":
+		return NewSQLiteStorage(dbPath, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
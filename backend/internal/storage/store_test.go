@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// parityTimes 同一批记录的时间使用不同的时区偏移
+var parityTimes = []time.Time{
+	time.Date(2025, 9, 5, 5, 50, 0, 0, time.UTC),
+	time.Date(2025, 9, 5, 14, 10, 0, 0, shanghai), // 06:10Z
+	time.Date(2025, 9, 5, 6, 30, 0, 0, time.UTC),
+	time.Date(2025, 9, 5, 1, 45, 0, 500_000_000, time.FixedZone("EST", -5*3600)), // 06:45:00.5Z
+	time.Date(2025, 9, 5, 6, 45, 0, 0, time.UTC),
+	time.Date(2025, 9, 5, 15, 5, 0, 0, shanghai), // 07:05Z
+}
+
+func seedParity(t *testing.T, store Store) {
+	t.Helper()
+	for i, at := range parityTimes {
+		app := "Code"
+		if i%2 == 1 {
+			app = "Safari"
+		}
+		if err := store.SaveActivity(&models.Activity{
+			Type: models.ActivityTypeApp, Content: "activity " + at.UTC().Format(time.RFC3339Nano),
+			AppName: app, Timestamp: at,
+		}); err != nil {
+			t.Fatalf("SaveActivity: %v", err)
+		}
+	}
+	// 键盘输入经批量写入，覆盖 SaveBatch 的写入路径
+	batch := &Batch{}
+	for i, at := range parityTimes {
+		app := "Code"
+		if i%2 == 1 {
+			app = "Safari"
+		}
+		batch.KeyboardInputs = append(batch.KeyboardInputs, &models.KeyboardInput{
+			Text: "input " + at.UTC().Format(time.RFC3339Nano), AppName: app, Timestamp: at,
+		})
+	}
+	if err := store.SaveBatch(batch); err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+}
+
+// queryAllActivities 按游标翻页读取全部结果，返回内容
+func queryAllActivities(t *testing.T, store Store, q ActivityQuery) []string {
+	t.Helper()
+	var contents []string
+	for {
+		page, next, err := store.QueryActivities(q)
+		if err != nil {
+			t.Fatalf("QueryActivities: %v", err)
+		}
+		for _, activity := range page {
+			contents = append(contents, activity.Content)
+		}
+		if next == "" {
+			return contents
+		}
+		q.Cursor = next
+	}
+}
+
+func queryAllKeyboardInputs(t *testing.T, store Store, q KeyboardQuery) []string {
+	t.Helper()
+	var texts []string
+	for {
+		page, next, err := store.QueryKeyboardInputs(q)
+		if err != nil {
+			t.Fatalf("QueryKeyboardInputs: %v", err)
+		}
+		for _, input := range page {
+			texts = append(texts, input.Text)
+		}
+		if next == "" {
+			return texts
+		}
+		q.Cursor = next
+	}
+}
+
+func TestQueryParityAcrossTimeZones(t *testing.T) {
+	withLocalZone(t, shanghai)
+	stores := testStores(t)
+	for _, store := range stores {
+		seedParity(t, store)
+	}
+
+	cases := []struct {
+		name     string
+		from, to time.Time
+		limit    int
+		want     []string // 按时间倒序的 UTC 时间
+	}{
+		{
+			name: "local range",
+			from: time.Date(2025, 9, 5, 14, 0, 0, 0, shanghai),
+			to:   time.Date(2025, 9, 5, 15, 0, 0, 0, shanghai),
+			want: []string{"2025-09-05T06:45:00.5Z", "2025-09-05T06:45:00Z", "2025-09-05T06:30:00Z", "2025-09-05T06:10:00Z"},
+		},
+		{
+			name:  "utc range with pagination",
+			from:  time.Date(2025, 9, 5, 6, 10, 0, 0, time.UTC),
+			to:    time.Date(2025, 9, 5, 7, 5, 0, 0, time.UTC),
+			limit: 1,
+			want:  []string{"2025-09-05T06:45:00.5Z", "2025-09-05T06:45:00Z", "2025-09-05T06:30:00Z", "2025-09-05T06:10:00Z"},
+		},
+		{
+			name:  "negative offset bounds",
+			from:  time.Date(2025, 9, 5, 1, 45, 0, 0, time.FixedZone("EST", -5*3600)),
+			limit: 2,
+			want:  []string{"2025-09-05T07:05:00Z", "2025-09-05T06:45:00.5Z", "2025-09-05T06:45:00Z"},
+		},
+		{
+			name: "open start",
+			to:   time.Date(2025, 9, 5, 14, 10, 0, 0, shanghai),
+			want: []string{"2025-09-05T05:50:00Z"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, store := range stores {
+				activities := queryAllActivities(t, store, ActivityQuery{From: tc.from, To: tc.to, Limit: tc.limit})
+				inputs := queryAllKeyboardInputs(t, store, KeyboardQuery{From: tc.from, To: tc.to, Limit: tc.limit})
+
+				var wantActivities, wantInputs []string
+				for _, at := range tc.want {
+					wantActivities = append(wantActivities, "activity "+at)
+					wantInputs = append(wantInputs, "input "+at)
+				}
+				if !reflect.DeepEqual(activities, wantActivities) {
+					t.Errorf("%s activities = %q, want %q", name, activities, wantActivities)
+				}
+				if !reflect.DeepEqual(inputs, wantInputs) {
+					t.Errorf("%s keyboard inputs = %q, want %q", name, inputs, wantInputs)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryParityFilters(t *testing.T) {
+	withLocalZone(t, shanghai)
+	stores := testStores(t)
+	for _, store := range stores {
+		seedParity(t, store)
+	}
+
+	results := make(map[string][][]string)
+	for name, store := range stores {
+		results[name] = [][]string{
+			queryAllActivities(t, store, ActivityQuery{AppName: "Safari", Limit: 2}),
+			queryAllActivities(t, store, ActivityQuery{Type: models.ActivityTypeWeb}),
+			queryAllKeyboardInputs(t, store, KeyboardQuery{AppName: "Code", TextContains: "T06"}),
+		}
+	}
+	if !reflect.DeepEqual(results["sqlite"], results["memory"]) {
+		t.Errorf("sqlite results %q differ from memory results %q", results["sqlite"], results["memory"])
+	}
+	if got := len(results["sqlite"][0]); got != 3 {
+		t.Errorf("Safari activities = %d, want 3", got)
+	}
+}
+
+// batchResult 一次批量写入后可比较的结果
+type batchResult struct {
+	IDs        []int64 // 活动记录、键盘输入、应用使用记录回填的 ID
+	Activities []string
+	Inputs     []string
+	Usage      []string
+	Changes    int
+}
+
+func readBatchResult(t *testing.T, store Store, ids []int64) batchResult {
+	t.Helper()
+	result := batchResult{IDs: ids}
+	activities, err := store.GetRecentActivities(10)
+	if err != nil {
+		t.Fatalf("GetRecentActivities: %v", err)
+	}
+	for _, activity := range activities {
+		result.Activities = append(result.Activities, fmt.Sprintf("%d %s %ds", activity.ID, activity.AppName, activity.Duration))
+	}
+	inputs, err := store.GetRecentKeyboardInputs(10)
+	if err != nil {
+		t.Fatalf("GetRecentKeyboardInputs: %v", err)
+	}
+	for _, input := range inputs {
+		result.Inputs = append(result.Inputs, fmt.Sprintf("%d %s", input.ID, input.Text))
+	}
+	usages, err := store.QueryAppUsage(AppUsageQuery{})
+	if err != nil {
+		t.Fatalf("QueryAppUsage: %v", err)
+	}
+	for _, usage := range usages {
+		result.Usage = append(result.Usage, fmt.Sprintf("%d %s %ds", usage.ID, usage.AppName, usage.Duration))
+	}
+	changes, err := store.GetChangeLog(0, 100)
+	if err != nil {
+		t.Fatalf("GetChangeLog: %v", err)
+	}
+	result.Changes = len(changes.Changes)
+	return result
+}
+
+// 无效的批次在两种存储中都整体失败，不写入任何记录也不回填 ID；之后的有效批次结果相同
+func TestSaveBatchParity(t *testing.T) {
+	at := time.Date(2025, 9, 5, 9, 0, 0, 0, time.UTC)
+	results := make(map[string][]batchResult)
+	for name, store := range testStores(t) {
+		activity := &models.Activity{Type: models.ActivityTypeApp, Content: "app_activation: Code", AppName: "Code", Timestamp: at}
+		input := &models.KeyboardInput{Text: "hello", AppName: "Code", Timestamp: at}
+		usage := &models.AppUsage{AppName: "Code", StartTime: at, EndTime: at.Add(-time.Minute)}
+		err := store.SaveBatch(&Batch{
+			Activities:        []*models.Activity{activity},
+			KeyboardInputs:    []*models.KeyboardInput{input},
+			AppUsage:          []*models.AppUsage{usage},
+			ActivityDurations: []ActivityDuration{{Activity: activity, Duration: 60}},
+		})
+		if !errors.Is(err, ErrInvalidBatch) {
+			t.Fatalf("%s: SaveBatch with an invalid record = %v, want ErrInvalidBatch", name, err)
+		}
+		if activity.ID != 0 || input.ID != 0 || usage.ID != 0 || activity.Duration != 0 {
+			t.Errorf("%s: failed batch filled in ids %d/%d/%d and duration %d", name, activity.ID, input.ID, usage.ID, activity.Duration)
+		}
+		failed := readBatchResult(t, store, nil)
+
+		usage.EndTime = at.Add(time.Minute)
+		usage.Duration = 60
+		if err := store.SaveBatch(&Batch{
+			Activities:        []*models.Activity{activity},
+			KeyboardInputs:    []*models.KeyboardInput{input},
+			AppUsage:          []*models.AppUsage{usage},
+			ActivityDurations: []ActivityDuration{{Activity: activity, Duration: 60}},
+		}); err != nil {
+			t.Fatalf("%s: SaveBatch: %v", name, err)
+		}
+		results[name] = []batchResult{failed, readBatchResult(t, store, []int64{activity.ID, input.ID, usage.ID})}
+	}
+
+	want := []batchResult{
+		{},
+		{
+			IDs:        []int64{1, 1, 1},
+			Activities: []string{"1 Code 60s"},
+			Inputs:     []string{"1 hello"},
+			Usage:      []string{"1 Code 60s"},
+			Changes:    4, // 三条新增和一次持续时间修改
+		},
+	}
+	for name, got := range results {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: batch results\n got %+v\nwant %+v", name, got, want)
+		}
+	}
+}
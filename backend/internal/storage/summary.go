@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// AI总结的类型，决定来源记录所在的表
+const (
+	SummaryTypeActivity = "activity"
+	SummaryTypeKeyboard = "keyboard"
+)
+
+// SummaryResult AI总结结果（为了避免循环导入）
+type SummaryResult struct {
+	ID        int64     `json:"id" db:"id"`
+	Type      string    `json:"type" db:"type"`
+	Summary   string    `json:"summary" db:"summary"`
+	DataCount int       `json:"data_count" db:"data_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	DeviceID  string    `json:"device_id,omitempty" db:"device_id"` // 生成总结的设备
+
+	// 来源和生成信息，升级前生成的总结这些字段为空
+	SourceFrom       *time.Time `json:"source_from,omitempty" db:"source_from"` // 来源记录中最早的时间
+	SourceTo         *time.Time `json:"source_to,omitempty" db:"source_to"`     // 来源记录中最晚的时间
+	FirstRecordID    int64      `json:"first_record_id,omitempty" db:"first_record_id"`
+	LastRecordID     int64      `json:"last_record_id,omitempty" db:"last_record_id"`
+	Model            string     `json:"model,omitempty" db:"model"`
+	PromptVersion    string     `json:"prompt_version,omitempty" db:"prompt_version"`
+	FinishReason     string     `json:"finish_reason,omitempty" db:"finish_reason"`
+	PromptTokens     int        `json:"prompt_tokens,omitempty" db:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens,omitempty" db:"completion_tokens"`
+	TotalTokens      int        `json:"total_tokens,omitempty" db:"total_tokens"`
+
+	// RecordIDs 写入提示词的来源记录ID，保存时写入 ai_summary_records，查询时不回填
+	RecordIDs []int64 `json:"-" db:"-"`
+}
+
+// SummaryQuery AI总结查询条件，零值字段表示不过滤
+type SummaryQuery struct {
+	Type  string    // 总结类型：activity 或 keyboard
+	From  time.Time // 创建时间起点（包含）
+	To    time.Time // 创建时间终点（不包含）
+	Limit int       // 最多返回的条数，<= 0 表示不限
+}
+
+// SummaryRecords 生成一条总结时使用的来源记录，按类型只填充其中一种
+type SummaryRecords struct {
+	Summary        *SummaryResult          `json:"summary"`
+	Activities     []*models.Activity      `json:"activities,omitempty"`
+	KeyboardInputs []*models.KeyboardInput `json:"keyboard_inputs,omitempty"`
+}
+
+// SetSource 根据来源记录的ID和时间填充记录范围
+func (r *SummaryResult) SetSource(ids []int64, timestamps []time.Time) {
+	r.RecordIDs = append([]int64(nil), ids...)
+	r.FirstRecordID, r.LastRecordID = 0, 0
+	for _, id := range ids {
+		if r.FirstRecordID == 0 || id < r.FirstRecordID {
+			r.FirstRecordID = id
+		}
+		if id > r.LastRecordID {
+			r.LastRecordID = id
+		}
+	}
+
+	r.SourceFrom, r.SourceTo = nil, nil
+	for _, t := range timestamps {
+		t := t
+		if r.SourceFrom == nil || t.Before(*r.SourceFrom) {
+			r.SourceFrom = &t
+		}
+		if r.SourceTo == nil || t.After(*r.SourceTo) {
+			r.SourceTo = &t
+		}
+	}
+}
+
+// summaryColumns 查询总结时选择的列，与 scanSummary 的顺序一致
+const summaryColumns = `id, type, summary, data_count, created_at, device_id, source_from, source_to,
+	first_record_id, last_record_id, model, prompt_version, finish_reason,
+	prompt_tokens, completion_tokens, total_tokens`
+
+func scanSummary(rows *sql.Rows) (*SummaryResult, error) {
+	summary := &SummaryResult{}
+	var sourceFrom, sourceTo sql.NullTime
+	err := rows.Scan(&summary.ID, &summary.Type, &summary.Summary, &summary.DataCount,
+		&summary.CreatedAt, &summary.DeviceID, &sourceFrom, &sourceTo, &summary.FirstRecordID, &summary.LastRecordID,
+		&summary.Model, &summary.PromptVersion, &summary.FinishReason,
+		&summary.PromptTokens, &summary.CompletionTokens, &summary.TotalTokens)
+	if err != nil {
+		return nil, err
+	}
+	if sourceFrom.Valid {
+		summary.SourceFrom = &sourceFrom.Time
+	}
+	if sourceTo.Valid {
+		summary.SourceTo = &sourceTo.Time
+	}
+	return summary, nil
+}
+
+// SaveSummary 在一个事务中保存总结及其来源记录的关联
+func (s *SQLiteStorage) SaveSummary(summary *SummaryResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sourceFrom, sourceTo interface{}
+	if summary.SourceFrom != nil {
+		sourceFrom = dbTime(*summary.SourceFrom)
+	}
+	if summary.SourceTo != nil {
+		sourceTo = dbTime(*summary.SourceTo)
+	}
+
+	result, err := tx.Exec(`INSERT INTO ai_summaries (type, summary, data_count, created_at, device_id,
+		source_from, source_to, first_record_id, last_record_id, model, prompt_version,
+		finish_reason, prompt_tokens, completion_tokens, total_tokens)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		summary.Type, summary.Summary, summary.DataCount, dbTime(summary.CreatedAt), s.deviceID,
+		sourceFrom, sourceTo, summary.FirstRecordID, summary.LastRecordID, summary.Model,
+		summary.PromptVersion, summary.FinishReason,
+		summary.PromptTokens, summary.CompletionTokens, summary.TotalTokens)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if len(summary.RecordIDs) > 0 {
+		stmt, err := tx.Prepare(`INSERT OR IGNORE INTO ai_summary_records (summary_id, record_id) VALUES (?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, recordID := range summary.RecordIDs {
+			if _, err := stmt.Exec(id, recordID); err != nil {
+				return fmt.Errorf("failed to link summary record %d: %w", recordID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	summary.ID = id
+	summary.DeviceID = s.deviceID
+	return nil
+}
+
+func (s *SQLiteStorage) GetRecentSummaries(limit int) ([]*SummaryResult, error) {
+	return s.QuerySummaries(SummaryQuery{Limit: limit})
+}
+
+// QuerySummaries 按类型和创建时间查询AI总结，按创建时间倒序排列
+func (s *SQLiteStorage) QuerySummaries(q SummaryQuery) ([]*SummaryResult, error) {
+	where := &whereBuilder{}
+	where.addTimeRange("created_at", q.From, q.To, nil)
+	if q.Type != "" {
+		where.add("type = ?", q.Type)
+	}
+
+	query := `SELECT ` + summaryColumns + ` FROM ai_summaries` + where.String() +
+		` ORDER BY created_at DESC, id DESC`
+	args := where.args
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.readStmts.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*SummaryResult
+	for rows.Next() {
+		summary, err := scanSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// GetSummaryRecords 获取总结及生成时使用的来源记录（按时间倒序），总结不存在时返回 nil；
+// 已被清理或删除的记录不再返回
+func (s *SQLiteStorage) GetSummaryRecords(id int64) (*SummaryRecords, error) {
+	rows, err := s.readStmts.query(`SELECT `+summaryColumns+` FROM ai_summaries WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	var summary *SummaryResult
+	if rows.Next() {
+		summary, err = scanSummary(rows)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil || summary == nil {
+		return nil, err
+	}
+
+	records := &SummaryRecords{Summary: summary}
+	switch summary.Type {
+	case SummaryTypeActivity:
+		records.Activities, err = s.summaryActivities(id)
+	case SummaryTypeKeyboard:
+		records.KeyboardInputs, err = s.summaryKeyboardInputs(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *SQLiteStorage) summaryActivities(summaryID int64) ([]*models.Activity, error) {
+	rows, err := s.readStmts.query(`SELECT a.id, a.type, a.content, a.app_name, a.window_title, a.url, a.timestamp, a.duration, a.device_id
+		FROM ai_summary_records r JOIN activities a ON a.id = r.record_id
+		WHERE r.summary_id = ? ORDER BY a.timestamp DESC, a.id DESC`, summaryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []*models.Activity
+	for rows.Next() {
+		activity := &models.Activity{}
+		err := rows.Scan(&activity.ID, &activity.Type, &activity.Content,
+			&activity.AppName, &activity.WindowTitle, &activity.URL,
+			&activity.Timestamp, &activity.Duration, &activity.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.openActivity(activity); err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
+func (s *SQLiteStorage) summaryKeyboardInputs(summaryID int64) ([]*models.KeyboardInput, error) {
+	rows, err := s.readStmts.query(`SELECT k.id, k.text, k.app_name, k.timestamp, k.device_id,
+		k.keystrokes, k.corrections, k.duration
+		FROM ai_summary_records r JOIN keyboard_inputs k ON k.id = r.record_id
+		WHERE r.summary_id = ? ORDER BY k.timestamp DESC, k.id DESC`, summaryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inputs []*models.KeyboardInput
+	for rows.Next() {
+		input, err := scanKeyboardInput(rows)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.openKeyboardInput(input); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, rows.Err()
+}
+
+func (m *MemoryStorage) SaveSummary(summary *SummaryResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *summary
+	stored.ID = m.allocID("ai_summaries")
+	stored.DeviceID = m.deviceID
+	stored.CreatedAt = stored.CreatedAt.Round(0)
+	stored.SourceFrom = roundTime(summary.SourceFrom)
+	stored.SourceTo = roundTime(summary.SourceTo)
+	stored.RecordIDs = append([]int64(nil), summary.RecordIDs...)
+	m.summaries = append(m.summaries, &stored)
+	m.logChange("ai_summaries", ChangeInsert, stored.ID)
+	summary.ID = stored.ID
+	summary.DeviceID = stored.DeviceID
+	return nil
+}
+
+func (m *MemoryStorage) GetRecentSummaries(limit int) ([]*SummaryResult, error) {
+	return m.QuerySummaries(SummaryQuery{Limit: limit})
+}
+
+func (m *MemoryStorage) QuerySummaries(q SummaryQuery) ([]*SummaryResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var summaries []*SummaryResult
+	for _, summary := range m.summaries {
+		if (q.Type == "" || summary.Type == q.Type) && inRange(summary.CreatedAt, q.From, q.To) {
+			summaries = append(summaries, copySummary(summary))
+		}
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if !summaries[i].CreatedAt.Equal(summaries[j].CreatedAt) {
+			return summaries[i].CreatedAt.After(summaries[j].CreatedAt)
+		}
+		return summaries[i].ID > summaries[j].ID
+	})
+	if q.Limit > 0 && len(summaries) > q.Limit {
+		summaries = summaries[:q.Limit]
+	}
+	return summaries, nil
+}
+
+func (m *MemoryStorage) GetSummaryRecords(id int64) (*SummaryRecords, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stored *SummaryResult
+	for _, summary := range m.summaries {
+		if summary.ID == id {
+			stored = summary
+			break
+		}
+	}
+	if stored == nil {
+		return nil, nil
+	}
+
+	linked := make(map[int64]bool, len(stored.RecordIDs))
+	for _, recordID := range stored.RecordIDs {
+		linked[recordID] = true
+	}
+
+	records := &SummaryRecords{Summary: copySummary(stored)}
+	switch stored.Type {
+	case SummaryTypeActivity:
+		for _, activity := range m.activities {
+			if linked[activity.ID] {
+				copied := *activity
+				records.Activities = append(records.Activities, &copied)
+			}
+		}
+		sort.SliceStable(records.Activities, func(i, j int) bool {
+			a, b := records.Activities[i], records.Activities[j]
+			if !a.Timestamp.Equal(b.Timestamp) {
+				return a.Timestamp.After(b.Timestamp)
+			}
+			return a.ID > b.ID
+		})
+	case SummaryTypeKeyboard:
+		for _, input := range m.keyboardInputs {
+			if linked[input.ID] {
+				copied := *input
+				records.KeyboardInputs = append(records.KeyboardInputs, &copied)
+			}
+		}
+		sort.SliceStable(records.KeyboardInputs, func(i, j int) bool {
+			a, b := records.KeyboardInputs[i], records.KeyboardInputs[j]
+			if !a.Timestamp.Equal(b.Timestamp) {
+				return a.Timestamp.After(b.Timestamp)
+			}
+			return a.ID > b.ID
+		})
+	}
+	return records, nil
+}
+
+// copySummary 复制总结，不包含只在内部保存的 RecordIDs，与 SQLite 查询结果一致
+func copySummary(summary *SummaryResult) *SummaryResult {
+	copied := *summary
+	copied.RecordIDs = nil
+	return &copied
+}
+
+// roundTime 复制时间并去掉单调时钟读数
+func roundTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	rounded := t.Round(0)
+	return &rounded
+}
+
+// ParseSummaryType 校验总结类型，空字符串表示不过滤
+func ParseSummaryType(value string) (string, error) {
+	switch summaryType := strings.ToLower(strings.TrimSpace(value)); summaryType {
+	case "", SummaryTypeActivity, SummaryTypeKeyboard:
+		return summaryType, nil
+	default:
+		return "", fmt.Errorf("unknown summary type: %s", value)
+	}
+}
@@ -0,0 +1,950 @@
+package storage
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 参与同步的记录类型
+const (
+	SyncKindActivity      = "activity"
+	SyncKindKeyboardInput = "keyboard_input"
+	SyncKindAppUsage      = "app_usage"
+)
+
+// 变更流分页大小
+const (
+	DefaultSyncPageSize = 500
+	MaxSyncPageSize     = 5000
+)
+
+// ErrInvalidSync 对端发来的变更记录不完整
+var ErrInvalidSync = errors.New("invalid sync record")
+
+// syncTables 记录类型对应的表
+var syncTables = map[string]string{
+	SyncKindActivity:      "activities",
+	SyncKindKeyboardInput: "keyboard_inputs",
+	SyncKindAppUsage:      "app_usage",
+}
+
+// SyncRecord 变更流中的一条记录：新增或修改后的完整记录，或者删除标记。
+// (Kind, DeviceID, OriginID) 在所有设备上唯一标识一条记录，OriginID 是记录在采集设备上的 ID
+type SyncRecord struct {
+	Seq           int64                 `json:"seq"` // 在发送方的变更序号
+	Kind          string                `json:"kind"`
+	DeviceID      string                `json:"device_id"`
+	OriginID      int64                 `json:"origin_id"`
+	Deleted       bool                  `json:"deleted,omitempty"`
+	Revision      int64                 `json:"revision,omitempty"` // 活动记录在采集设备上被修改的次数
+	ImportSource  string                `json:"import_source,omitempty"`
+	ImportKey     string                `json:"import_key,omitempty"`
+	Activity      *models.Activity      `json:"activity,omitempty"`
+	KeyboardInput *models.KeyboardInput `json:"keyboard_input,omitempty"`
+	AppUsage      *models.AppUsage      `json:"app_usage,omitempty"`
+}
+
+// SyncChanges 一页变更，Next 是下一页请求的 since，也是拉取方保存的水位
+type SyncChanges struct {
+	DeviceID string        `json:"device_id"`
+	Records  []*SyncRecord `json:"records"`
+	Next     int64         `json:"next"`
+	HasMore  bool          `json:"has_more"`
+}
+
+// SyncMergeResult 合并一批变更的结果
+type SyncMergeResult struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Deleted  int `json:"deleted"`
+	Skipped  int `json:"skipped"` // 已存在、已被删除或在冲突中落选的记录
+}
+
+// SyncPeer 一个同步对端及其水位：已合并对端变更序号不超过 Watermark 的全部记录
+type SyncPeer struct {
+	URL        string     `json:"url"`
+	DeviceID   string     `json:"device_id,omitempty"`
+	Watermark  int64      `json:"watermark"`
+	LastSyncAt *time.Time `json:"last_sync_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// syncIdentity 记录在所有设备上的唯一标识
+type syncIdentity struct {
+	kind     string
+	deviceID string
+	originID int64
+}
+
+func (r *SyncRecord) identity() syncIdentity {
+	return syncIdentity{r.Kind, r.DeviceID, r.OriginID}
+}
+
+// validate 检查记录类型、标识和内容
+func (r *SyncRecord) validate() error {
+	if _, ok := syncTables[r.Kind]; !ok {
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidSync, r.Kind)
+	}
+	if r.DeviceID == "" || r.OriginID <= 0 {
+		return fmt.Errorf("%w: missing device or origin id", ErrInvalidSync)
+	}
+	if r.Deleted {
+		return nil
+	}
+	if (r.Kind == SyncKindActivity && r.Activity == nil) ||
+		(r.Kind == SyncKindKeyboardInput && r.KeyboardInput == nil) ||
+		(r.Kind == SyncKindAppUsage && r.AppUsage == nil) {
+		return fmt.Errorf("%w: %s %s/%d has no content", ErrInvalidSync, r.Kind, r.DeviceID, r.OriginID)
+	}
+	return nil
+}
+
+// supersedes 同一条活动记录的两个版本中，修订号较大的生效，修订号相同时持续时间较长的生效
+func (r *SyncRecord) supersedes(revision, duration int64) bool {
+	if r.Revision != revision {
+		return r.Revision > revision
+	}
+	return r.Activity.Duration > duration
+}
+
+// identityLess 同一条导入记录在多台设备上各导入一次时，保留标识较小的一条
+func identityLess(a, b syncIdentity) bool {
+	if a.deviceID != b.deviceID {
+		return a.deviceID < b.deviceID
+	}
+	return a.originID < b.originID
+}
+
+// newDeviceID 生成随机的设备ID
+func newDeviceID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// sortSyncRecords 按变更序号排序并截取一页
+func sortSyncRecords(since int64, records []*SyncRecord, limit int) *SyncChanges {
+	sort.Slice(records, func(i, j int) bool { return records[i].Seq < records[j].Seq })
+	changes := &SyncChanges{Records: records, Next: since}
+	if len(records) > limit {
+		changes.Records, changes.HasMore = records[:limit], true
+	}
+	if len(changes.Records) > 0 {
+		changes.Next = changes.Records[len(changes.Records)-1].Seq
+	}
+	return changes
+}
+
+func syncPageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultSyncPageSize
+	}
+	return min(limit, MaxSyncPageSize)
+}
+
+const reserveSyncSeqSQL = `UPDATE sync_state SET seq = seq + ? WHERE id = 1 RETURNING seq`
+
+// reserveSyncSeq 在写事务中预留 n 个连续的变更序号，返回第一个。
+// 写连接只有一个，序号按提交顺序递增，读取方看到某个序号时更小的序号都已提交
+func (s *SQLiteStorage) reserveSyncSeq(tx *sql.Tx, n int) (int64, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+	stmt, err := s.writeStmts.txStmt(tx, reserveSyncSeqSQL)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var last int64
+	if err := stmt.QueryRow(n).Scan(&last); err != nil {
+		return 0, err
+	}
+	return last - int64(n) + 1, nil
+}
+
+// backfillSync 为升级前的记录写入本机设备ID，并按表依次分配变更序号
+func backfillSync(tx *sql.Tx) error {
+	deviceID, err := newDeviceID()
+	if err != nil {
+		return err
+	}
+
+	var seq int64
+	for _, table := range []string{"activities", "keyboard_inputs", "app_usage"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET device_id = ?, sync_seq = id + ?`, deviceID, seq); err != nil {
+			return err
+		}
+		var last sql.NullInt64
+		if err := tx.QueryRow(`SELECT MAX(sync_seq) FROM ` + table).Scan(&last); err != nil {
+			return err
+		}
+		if last.Valid {
+			seq = last.Int64
+		}
+	}
+	if _, err := tx.Exec(`UPDATE ai_summaries SET device_id = ?`, deviceID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO sync_state (id, device_id, seq) VALUES (1, ?, ?)`, deviceID, seq)
+	return err
+}
+
+// loadDeviceID 读取本机设备ID。rotate 为 true 时先生成新的设备ID：
+// 从备份恢复后自增 ID 和变更序号会回退，继续使用原来的标识会与对端已有的记录冲突
+func (s *SQLiteStorage) loadDeviceID(rotate bool) error {
+	if rotate {
+		deviceID, err := newDeviceID()
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(`UPDATE sync_state SET device_id = ? WHERE id = 1`, deviceID); err != nil {
+			return err
+		}
+	}
+	return s.db.QueryRow(`SELECT device_id FROM sync_state WHERE id = 1`).Scan(&s.deviceID)
+}
+
+// DeviceID 本机设备ID
+func (s *SQLiteStorage) DeviceID() string {
+	return s.deviceID
+}
+
+// GetChanges 按变更序号获取 since 之后新增、修改和删除的记录，记录内容为明文。
+// 所有查询在同一个读事务中执行，看到的是同一个快照
+func (s *SQLiteStorage) GetChanges(since int64, limit int) (*SyncChanges, error) {
+	limit = syncPageSize(limit)
+
+	tx, err := s.readDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var records []*SyncRecord
+	rows, err := tx.Query(`SELECT id, type, content, app_name, window_title, url, timestamp, duration, device_id,
+		COALESCE(origin_id, id), revision, COALESCE(import_source, ''), COALESCE(import_key, ''), sync_seq
+		FROM activities WHERE sync_seq > ? ORDER BY sync_seq LIMIT ?`, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		activity := &models.Activity{}
+		record := &SyncRecord{Kind: SyncKindActivity, Activity: activity}
+		if err := rows.Scan(&activity.ID, &activity.Type, &activity.Content, &activity.AppName,
+			&activity.WindowTitle, &activity.URL, &activity.Timestamp, &activity.Duration, &activity.DeviceID,
+			&record.OriginID, &record.Revision, &record.ImportSource, &record.ImportKey, &record.Seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := s.openActivity(activity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		record.DeviceID = activity.DeviceID
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT id, text, app_name, timestamp, device_id, keystrokes, corrections, duration,
+		COALESCE(origin_id, id), sync_seq FROM keyboard_inputs WHERE sync_seq > ? ORDER BY sync_seq LIMIT ?`, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		input := &models.KeyboardInput{}
+		record := &SyncRecord{Kind: SyncKindKeyboardInput, KeyboardInput: input}
+		if err := rows.Scan(&input.ID, &input.Text, &input.AppName, &input.Timestamp, &input.DeviceID,
+			&input.KeyCount, &input.Corrections, &input.Duration, &record.OriginID, &record.Seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := s.openKeyboardInput(input); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		record.DeviceID = input.DeviceID
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT id, app_name, start_time, end_time, duration, device_id, COALESCE(origin_id, id),
+		COALESCE(import_source, ''), COALESCE(import_key, ''), sync_seq
+		FROM app_usage WHERE sync_seq > ? ORDER BY sync_seq LIMIT ?`, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		usage := &models.AppUsage{}
+		record := &SyncRecord{Kind: SyncKindAppUsage, AppUsage: usage}
+		var endTime sql.NullTime
+		if err := rows.Scan(&usage.ID, &usage.AppName, &usage.StartTime, &endTime, &usage.Duration, &usage.DeviceID,
+			&record.OriginID, &record.ImportSource, &record.ImportKey, &record.Seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		usage.EndTime = endTime.Time
+		record.DeviceID = usage.DeviceID
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT seq, kind, device_id, origin_id FROM sync_tombstones
+		WHERE seq > ? ORDER BY seq LIMIT ?`, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		record := &SyncRecord{Deleted: true}
+		if err := rows.Scan(&record.Seq, &record.Kind, &record.DeviceID, &record.OriginID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	changes := sortSyncRecords(since, records, limit)
+	changes.DeviceID = s.deviceID
+	return changes, nil
+}
+
+// MergeChanges 在一个事务中按顺序合并对端的变更，同步更新统计和全文索引。冲突按固定规则解决，
+// 与合并顺序无关：删除标记优先于记录内容；同一条活动记录取修订号较大的版本；
+// 同一条外部记录在多台设备上各导入一次时保留标识较小的一条，另一条按删除处理
+func (s *SQLiteStorage) MergeChanges(records []*SyncRecord) (*SyncMergeResult, error) {
+	for _, record := range records {
+		if err := record.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &SyncMergeResult{}
+	delta := make(rollupDelta)
+	for _, record := range records {
+		if err := s.mergeRecord(tx, record, delta, result); err != nil {
+			return nil, fmt.Errorf("failed to merge %s %s/%d: %w", record.Kind, record.DeviceID, record.OriginID, err)
+		}
+	}
+
+	if err := s.applyRollups(tx, delta); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *SQLiteStorage) mergeRecord(tx *sql.Tx, record *SyncRecord, delta rollupDelta, result *SyncMergeResult) error {
+	identity := record.identity()
+	if deleted, err := hasTombstone(tx, identity); err != nil || deleted {
+		result.Skipped++
+		return err
+	}
+
+	table := syncTables[record.Kind]
+	id, err := findSynced(tx, table, identity)
+	if err != nil {
+		return err
+	}
+
+	if record.Deleted {
+		if id != 0 {
+			if err := deleteSynced(tx, record.Kind, id, delta); err != nil {
+				return err
+			}
+			result.Deleted++
+		} else {
+			result.Skipped++
+		}
+		return s.addTombstones(tx, []syncIdentity{identity})
+	}
+
+	if id != 0 {
+		if record.Kind != SyncKindActivity {
+			result.Skipped++ // 键盘输入和应用使用记录写入后不再修改
+			return nil
+		}
+		updated, err := s.mergeActivityRevision(tx, id, record, delta)
+		if err != nil {
+			return err
+		}
+		if updated {
+			result.Updated++
+		} else {
+			result.Skipped++
+		}
+		return nil
+	}
+
+	if record.ImportSource != "" {
+		var existingID int64
+		var existing syncIdentity
+		err := tx.QueryRow(`SELECT id, device_id, COALESCE(origin_id, id) FROM `+table+`
+			WHERE import_source = ? AND import_key = ?`, record.ImportSource, record.ImportKey).
+			Scan(&existingID, &existing.deviceID, &existing.originID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			existing.kind = record.Kind
+			if !identityLess(identity, existing) {
+				result.Skipped++
+				return nil
+			}
+			if err := deleteSynced(tx, record.Kind, existingID, delta); err != nil {
+				return err
+			}
+			if err := s.addTombstones(tx, []syncIdentity{existing}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.insertSynced(tx, record, delta); err != nil {
+		return err
+	}
+	result.Inserted++
+	return nil
+}
+
+// mergeActivityRevision 对端的版本较新时更新持续时间和修订号
+func (s *SQLiteStorage) mergeActivityRevision(tx *sql.Tx, id int64, record *SyncRecord, delta rollupDelta) (bool, error) {
+	var appName string
+	var timestamp time.Time
+	var duration, revision int64
+	if err := tx.QueryRow(`SELECT COALESCE(app_name, ''), timestamp, COALESCE(duration, 0), revision
+		FROM activities WHERE id = ?`, id).Scan(&appName, &timestamp, &duration, &revision); err != nil {
+		return false, err
+	}
+	if !record.supersedes(revision, duration) {
+		return false, nil
+	}
+
+	seq, err := s.reserveSyncSeq(tx, 1)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE activities SET duration = ?, revision = ?, sync_seq = ? WHERE id = ?`,
+		record.Activity.Duration, record.Revision, seq, id); err != nil {
+		return false, err
+	}
+	delta.get(timestamp, appName).Duration += record.Activity.Duration - duration
+	return true, nil
+}
+
+// insertSynced 写入对端的记录，保留来源设备和来源 ID，分配本机的变更序号以便继续同步给其他设备
+func (s *SQLiteStorage) insertSynced(tx *sql.Tx, record *SyncRecord, delta rollupDelta) error {
+	seq, err := s.reserveSyncSeq(tx, 1)
+	if err != nil {
+		return err
+	}
+
+	switch record.Kind {
+	case SyncKindActivity:
+		activity := *record.Activity
+		content, windowTitle, url, err := s.sealActivity(&activity)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`INSERT INTO activities (type, content, app_name, window_title, url, timestamp, duration,
+			device_id, origin_id, revision, sync_seq, import_source, import_key)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			activity.Type, content, activity.AppName, windowTitle, url, dbTime(activity.Timestamp), activity.Duration,
+			record.DeviceID, record.OriginID, record.Revision, seq,
+			nullString(record.ImportSource), nullString(record.ImportKey))
+		if err != nil {
+			return err
+		}
+		// 标签和项目只保存在本机，合并的记录按本机的规则关联
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := s.tagActivity(tx, id, &activity); err != nil {
+			return err
+		}
+		delta.addActivity(&activity)
+
+	case SyncKindKeyboardInput:
+		input := record.KeyboardInput
+		text, err := s.seal(input.Text)
+		if err != nil {
+			return err
+		}
+		count := inputKeystrokes(input)
+		if _, err := tx.Exec(`INSERT INTO keyboard_inputs (text, app_name, timestamp, keystrokes, corrections, duration,
+			device_id, origin_id, sync_seq) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			text, input.AppName, dbTime(input.Timestamp), count, input.Corrections, input.Duration,
+			record.DeviceID, record.OriginID, seq); err != nil {
+			return err
+		}
+		delta.addKeyboardInput(input.AppName, input.Timestamp, count)
+
+	case SyncKindAppUsage:
+		usage := record.AppUsage
+		if _, err := tx.Exec(`INSERT INTO app_usage (app_name, start_time, end_time, duration,
+			device_id, origin_id, sync_seq, import_source, import_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			usage.AppName, dbTime(usage.StartTime), dbTime(usage.EndTime), usage.Duration,
+			record.DeviceID, record.OriginID, seq,
+			nullString(record.ImportSource), nullString(record.ImportKey)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSynced 按全局标识查找本机的记录 ID，不存在时返回 0
+func findSynced(tx *sql.Tx, table string, identity syncIdentity) (int64, error) {
+	var id int64
+	// 采集设备上的记录 origin_id 为 NULL，标识就是自己的 ID
+	err := tx.QueryRow(`SELECT id FROM `+table+` WHERE id = ? AND device_id = ? AND origin_id IS NULL`,
+		identity.originID, identity.deviceID).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`SELECT id FROM `+table+` WHERE device_id = ? AND origin_id = ?`,
+			identity.deviceID, identity.originID).Scan(&id)
+	}
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// deleteSynced 删除一条记录并扣减统计
+func deleteSynced(tx *sql.Tx, kind string, id int64, delta rollupDelta) error {
+	switch kind {
+	case SyncKindActivity:
+		var appName string
+		var timestamp time.Time
+		var duration int64
+		if err := tx.QueryRow(`SELECT COALESCE(app_name, ''), timestamp, COALESCE(duration, 0) FROM activities WHERE id = ?`,
+			id).Scan(&appName, &timestamp, &duration); err != nil {
+			return err
+		}
+		delta.add(&models.HourlyAppStats{Hour: HourBucket(timestamp), AppName: appName,
+			ActivityCount: 1, Duration: duration}, -1)
+	case SyncKindKeyboardInput:
+		var appName string
+		var timestamp time.Time
+		var count int64
+		if err := tx.QueryRow(`SELECT COALESCE(app_name, ''), timestamp, keystrokes FROM keyboard_inputs WHERE id = ?`,
+			id).Scan(&appName, &timestamp, &count); err != nil {
+			return err
+		}
+		delta.add(&models.HourlyAppStats{Hour: HourBucket(timestamp), AppName: appName,
+			KeyboardCount: 1, Keystrokes: count}, -1)
+	}
+	_, err := tx.Exec(`DELETE FROM `+syncTables[kind]+` WHERE id = ?`, id)
+	return err
+}
+
+func hasTombstone(tx *sql.Tx, identity syncIdentity) (bool, error) {
+	var found int
+	err := tx.QueryRow(`SELECT 1 FROM sync_tombstones WHERE kind = ? AND device_id = ? AND origin_id = ?`,
+		identity.kind, identity.deviceID, identity.originID).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// addTombstones 记录被删除的记录，删除标记同步给对端，并阻止对端把记录同步回来
+func (s *SQLiteStorage) addTombstones(tx *sql.Tx, identities []syncIdentity) error {
+	if len(identities) == 0 {
+		return nil
+	}
+	seq, err := s.reserveSyncSeq(tx, len(identities))
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO sync_tombstones (seq, kind, device_id, origin_id, deleted_at)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := dbTime(time.Now())
+	for i, identity := range identities {
+		if _, err := stmt.Exec(seq+int64(i), identity.kind, identity.deviceID, identity.originID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// GetSyncPeers 获取所有对端的水位和最近一次同步的状态
+func (s *SQLiteStorage) GetSyncPeers() ([]*SyncPeer, error) {
+	rows, err := s.readStmts.query(`SELECT url, device_id, watermark, last_sync_at, last_error
+		FROM sync_peers ORDER BY url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var peers []*SyncPeer
+	for rows.Next() {
+		peer := &SyncPeer{}
+		var lastSyncAt sql.NullTime
+		if err := rows.Scan(&peer.URL, &peer.DeviceID, &peer.Watermark, &lastSyncAt, &peer.LastError); err != nil {
+			return nil, err
+		}
+		if lastSyncAt.Valid {
+			peer.LastSyncAt = &lastSyncAt.Time
+		}
+		peers = append(peers, peer)
+	}
+	return peers, rows.Err()
+}
+
+// SaveSyncPeer 保存对端的水位和同步状态
+func (s *SQLiteStorage) SaveSyncPeer(peer *SyncPeer) error {
+	var lastSyncAt sql.NullTime
+	if peer.LastSyncAt != nil {
+		lastSyncAt = sql.NullTime{Time: dbTime(*peer.LastSyncAt), Valid: true}
+	}
+	_, err := s.writeStmts.exec(`INSERT INTO sync_peers (url, device_id, watermark, last_sync_at, last_error)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(url) DO UPDATE SET device_id = excluded.device_id, watermark = excluded.watermark,
+			last_sync_at = excluded.last_sync_at, last_error = excluded.last_error`,
+		peer.URL, peer.DeviceID, peer.Watermark, lastSyncAt, peer.LastError)
+	return err
+}
+
+// syncKey 内存存储中一条记录的表和 ID
+type syncKey struct {
+	table string
+	id    int64
+}
+
+// syncMeta 内存存储中记录的同步信息，对应 SQLite 中的 device_id、origin_id、revision、sync_seq 和导入键
+type syncMeta struct {
+	deviceID     string
+	originID     int64 // 本机采集的记录为 0
+	seq          int64
+	revision     int64
+	importSource string
+	importKey    string
+}
+
+// stampSync 为新写入的记录分配变更序号（调用方需持有写锁）
+func (m *MemoryStorage) stampSync(table string, id int64, deviceID string, originID int64) *syncMeta {
+	m.syncSeq++
+	meta := &syncMeta{deviceID: deviceID, originID: originID, seq: m.syncSeq}
+	m.syncMeta[syncKey{table, id}] = meta
+	m.syncIndex[m.syncIdentity(table, id)] = id
+	m.logChange(table, ChangeInsert, id)
+	return meta
+}
+
+// touchSync 记录被修改时分配新的变更序号（调用方需持有写锁）
+func (m *MemoryStorage) touchSync(table string, id int64) {
+	if meta := m.syncMeta[syncKey{table, id}]; meta != nil {
+		m.syncSeq++
+		meta.seq = m.syncSeq
+		meta.revision++
+	}
+}
+
+// syncIdentity 记录的全局标识（调用方需持有锁）
+func (m *MemoryStorage) syncIdentity(table string, id int64) syncIdentity {
+	meta := m.syncMeta[syncKey{table, id}]
+	identity := syncIdentity{deviceID: meta.deviceID, originID: meta.originID}
+	if identity.originID == 0 {
+		identity.originID = id
+	}
+	for kind, t := range syncTables {
+		if t == table {
+			identity.kind = kind
+		}
+	}
+	return identity
+}
+
+// dropSync 删除记录的同步信息，tombstone 为 true 时记录删除标记（调用方需持有写锁）
+func (m *MemoryStorage) dropSync(table string, id int64, tombstone bool) {
+	key := syncKey{table, id}
+	if m.syncMeta[key] == nil {
+		return
+	}
+	identity := m.syncIdentity(table, id)
+	delete(m.syncIndex, identity)
+	delete(m.syncMeta, key)
+	m.logChange(table, ChangeDelete, id)
+	if tombstone {
+		m.addTombstone(identity)
+	}
+}
+
+func (m *MemoryStorage) addTombstone(identity syncIdentity) {
+	if _, ok := m.tombstones[identity]; ok {
+		return
+	}
+	m.syncSeq++
+	m.tombstones[identity] = m.syncSeq
+}
+
+func (m *MemoryStorage) DeviceID() string {
+	return m.deviceID
+}
+
+// GetChanges 与 SQLiteStorage 相同：按变更序号获取 since 之后的记录和删除标记
+func (m *MemoryStorage) GetChanges(since int64, limit int) (*SyncChanges, error) {
+	limit = syncPageSize(limit)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var records []*SyncRecord
+	newRecord := func(table string, id int64) *SyncRecord {
+		meta := m.syncMeta[syncKey{table, id}]
+		if meta == nil || meta.seq <= since {
+			return nil
+		}
+		identity := m.syncIdentity(table, id)
+		record := &SyncRecord{Seq: meta.seq, Kind: identity.kind, DeviceID: identity.deviceID,
+			OriginID: identity.originID, Revision: meta.revision,
+			ImportSource: meta.importSource, ImportKey: meta.importKey}
+		records = append(records, record)
+		return record
+	}
+
+	for _, activity := range m.activities {
+		if record := newRecord("activities", activity.ID); record != nil {
+			copied := *activity
+			record.Activity = &copied
+		}
+	}
+	for _, input := range m.keyboardInputs {
+		if record := newRecord("keyboard_inputs", input.ID); record != nil {
+			copied := *input
+			record.KeyboardInput = &copied
+		}
+	}
+	for _, usage := range m.appUsage {
+		if record := newRecord("app_usage", usage.ID); record != nil {
+			copied := *usage
+			record.AppUsage = &copied
+		}
+	}
+	for identity, seq := range m.tombstones {
+		if seq > since {
+			records = append(records, &SyncRecord{Seq: seq, Kind: identity.kind, DeviceID: identity.deviceID,
+				OriginID: identity.originID, Deleted: true})
+		}
+	}
+
+	changes := sortSyncRecords(since, records, limit)
+	changes.DeviceID = m.deviceID
+	return changes, nil
+}
+
+// MergeChanges 与 SQLiteStorage 的合并规则一致
+func (m *MemoryStorage) MergeChanges(records []*SyncRecord) (*SyncMergeResult, error) {
+	for _, record := range records {
+		if err := record.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &SyncMergeResult{}
+	delta := make(rollupDelta)
+	for _, record := range records {
+		m.mergeRecord(record, delta, result)
+	}
+	m.applyRollups(delta)
+	return result, nil
+}
+
+func (m *MemoryStorage) mergeRecord(record *SyncRecord, delta rollupDelta, result *SyncMergeResult) {
+	identity := record.identity()
+	if _, deleted := m.tombstones[identity]; deleted {
+		result.Skipped++
+		return
+	}
+
+	table := syncTables[record.Kind]
+	id, exists := m.syncIndex[identity]
+
+	if record.Deleted {
+		if exists {
+			m.removeSynced(table, id, delta)
+			result.Deleted++
+		} else {
+			result.Skipped++
+		}
+		m.addTombstone(identity)
+		return
+	}
+
+	if exists {
+		if record.Kind != SyncKindActivity {
+			result.Skipped++
+			return
+		}
+		meta := m.syncMeta[syncKey{table, id}]
+		for _, activity := range m.activities {
+			if activity.ID == id && record.supersedes(meta.revision, activity.Duration) {
+				delta.get(activity.Timestamp, activity.AppName).Duration += record.Activity.Duration - activity.Duration
+				if activity.Duration != record.Activity.Duration {
+					m.logChange(table, ChangeUpdate, id)
+				}
+				activity.Duration = record.Activity.Duration
+				m.syncSeq++
+				meta.seq, meta.revision = m.syncSeq, record.Revision
+				result.Updated++
+				return
+			}
+		}
+		result.Skipped++
+		return
+	}
+
+	k := importKey(table, record.ImportSource, record.ImportKey)
+	if record.ImportSource != "" {
+		if existing := m.importKeys[k]; existing != nil {
+			other := m.syncIdentity(table, existing.id)
+			if !identityLess(identity, other) {
+				result.Skipped++
+				return
+			}
+			m.removeSynced(table, existing.id, delta)
+			m.addTombstone(other)
+		}
+	}
+
+	id = m.allocID(table)
+	var timestamp time.Time
+	switch record.Kind {
+	case SyncKindActivity:
+		stored := *record.Activity
+		stored.ID, stored.DeviceID = id, record.DeviceID
+		stored.Timestamp = stored.Timestamp.Round(0)
+		m.activities = append(m.activities, &stored)
+		m.tagActivity(&stored)
+		delta.addActivity(&stored)
+		timestamp = stored.Timestamp
+	case SyncKindKeyboardInput:
+		stored := *record.KeyboardInput
+		stored.ID, stored.DeviceID = id, record.DeviceID
+		stored.Timestamp = stored.Timestamp.Round(0)
+		stored.KeyCount = inputKeystrokes(&stored)
+		m.keyboardInputs = append(m.keyboardInputs, &stored)
+		delta.addKeyboardInput(stored.AppName, stored.Timestamp, stored.KeyCount)
+	case SyncKindAppUsage:
+		stored := *record.AppUsage
+		stored.ID, stored.DeviceID = id, record.DeviceID
+		stored.StartTime = stored.StartTime.Round(0)
+		stored.EndTime = stored.EndTime.Round(0)
+		m.appUsage = append(m.appUsage, &stored)
+		timestamp = stored.StartTime
+	}
+
+	meta := m.stampSync(table, id, record.DeviceID, record.OriginID)
+	meta.revision = record.Revision
+	if record.ImportSource != "" {
+		meta.importSource, meta.importKey = record.ImportSource, record.ImportKey
+		m.importKeys[k] = &importedRecord{table: table, id: id, timestamp: timestamp}
+	}
+	result.Inserted++
+}
+
+// removeSynced 删除一条记录、扣减统计并删除其导入键（调用方需持有写锁）
+func (m *MemoryStorage) removeSynced(table string, id int64, delta rollupDelta) {
+	switch table {
+	case "activities":
+		for i, activity := range m.activities {
+			if activity.ID == id {
+				delta.add(&models.HourlyAppStats{Hour: HourBucket(activity.Timestamp), AppName: activity.AppName,
+					ActivityCount: 1, Duration: activity.Duration}, -1)
+				m.activities = append(m.activities[:i:i], m.activities[i+1:]...)
+				break
+			}
+		}
+	case "keyboard_inputs":
+		for i, input := range m.keyboardInputs {
+			if input.ID == id {
+				delta.add(&models.HourlyAppStats{Hour: HourBucket(input.Timestamp), AppName: input.AppName,
+					KeyboardCount: 1, Keystrokes: inputKeystrokes(input)}, -1)
+				m.keyboardInputs = append(m.keyboardInputs[:i:i], m.keyboardInputs[i+1:]...)
+				break
+			}
+		}
+	case "app_usage":
+		for i, usage := range m.appUsage {
+			if usage.ID == id {
+				m.appUsage = append(m.appUsage[:i:i], m.appUsage[i+1:]...)
+				break
+			}
+		}
+	}
+	for key, record := range m.importKeys {
+		if record.table == table && record.id == id {
+			delete(m.importKeys, key)
+		}
+	}
+	m.dropSync(table, id, false)
+	switch table {
+	case "activities":
+		m.dropLinks(LinkActivity, id)
+	case "app_usage":
+		m.dropLinks(LinkAppUsage, id)
+	}
+}
+
+func (m *MemoryStorage) GetSyncPeers() ([]*SyncPeer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var peers []*SyncPeer
+	for _, peer := range m.syncPeers {
+		copied := *peer
+		peers = append(peers, &copied)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].URL < peers[j].URL })
+	return peers, nil
+}
+
+func (m *MemoryStorage) SaveSyncPeer(peer *SyncPeer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copied := *peer
+	m.syncPeers[peer.URL] = &copied
+	return nil
+}
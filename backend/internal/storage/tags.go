@@ -0,0 +1,701 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"yaml-backend/pkg/models"
+)
+
+// 可以关联标签和项目的记录类型
+const (
+	LinkActivity = "activity"
+	LinkAppUsage = "app_usage"
+	LinkSummary  = "summary"
+)
+
+// 关联的种类
+const (
+	LabelTag     = "tag"
+	LabelProject = "project"
+)
+
+// linkTargets 记录类型对应的表
+var linkTargets = map[string]string{
+	LinkActivity: "activities",
+	LinkAppUsage: "app_usage",
+	LinkSummary:  "ai_summaries",
+}
+
+// labelTables 关联种类对应的实体表、关联表和关联表中的ID列
+var labelTables = map[string]struct{ table, links, column string }{
+	LabelTag:     {"tags", "tag_links", "tag_id"},
+	LabelProject: {"projects", "project_links", "project_id"},
+}
+
+var (
+	// ErrInvalidLabel 标签、项目、关联或规则的参数无效
+	ErrInvalidLabel = errors.New("invalid tag, project or rule")
+	// ErrDuplicateLabel 已有同名（忽略大小写）的标签或项目
+	ErrDuplicateLabel = errors.New("name already exists")
+)
+
+// Link 标签或项目与一条记录的关联
+type Link struct {
+	Label    string // LabelTag 或 LabelProject
+	LabelID  int64
+	Target   string // LinkActivity、LinkAppUsage 或 LinkSummary
+	TargetID int64
+}
+
+func (l *Link) validate() error {
+	if _, ok := labelTables[l.Label]; !ok {
+		return fmt.Errorf("%w: unknown label kind %q", ErrInvalidLabel, l.Label)
+	}
+	if _, ok := linkTargets[l.Target]; !ok {
+		return fmt.Errorf("%w: unknown target %q (expected activity, app_usage or summary)", ErrInvalidLabel, l.Target)
+	}
+	return nil
+}
+
+// labelName 校验并规范化标签或项目的名称
+func labelName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrInvalidLabel)
+	}
+	return name, nil
+}
+
+// checkLabelName 检查名称是否已被同类的其他标签或项目使用
+func checkLabelName(tx *sql.Tx, table string, id int64, name string) error {
+	var existing int64
+	err := tx.QueryRow(`SELECT id FROM `+table+` WHERE name = ? COLLATE NOCASE AND id != ?`, name, id).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrDuplicateLabel, name)
+}
+
+func (s *SQLiteStorage) ListTags() ([]*models.Tag, error) {
+	rows, err := s.readStmts.query(`SELECT id, name, color, created_at FROM tags ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.Tag{}
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// SaveTag ID 为 0 时创建标签并回填 ID，否则更新名称和颜色；更新的标签不存在时返回 false
+func (s *SQLiteStorage) SaveTag(tag *models.Tag) (bool, error) {
+	name, err := labelName(tag.Name)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := checkLabelName(tx, "tags", tag.ID, name); err != nil {
+		return false, err
+	}
+	if tag.ID == 0 {
+		tag.CreatedAt = time.Now()
+		result, err := tx.Exec(`INSERT INTO tags (name, color, created_at) VALUES (?, ?, ?)`, name, tag.Color, dbTime(tag.CreatedAt))
+		if err != nil {
+			return false, err
+		}
+		if tag.ID, err = result.LastInsertId(); err != nil {
+			return false, err
+		}
+	} else if err := tx.QueryRow(`UPDATE tags SET name = ?, color = ? WHERE id = ? RETURNING created_at`,
+		name, tag.Color, tag.ID).Scan(&tag.CreatedAt); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	tag.Name = name
+	return true, tx.Commit()
+}
+
+func (s *SQLiteStorage) ListProjects() ([]*models.Project, error) {
+	rows, err := s.readStmts.query(`SELECT id, name, description, color, archived, created_at FROM projects
+		ORDER BY archived, name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []*models.Project{}
+	for rows.Next() {
+		project := &models.Project{}
+		if err := rows.Scan(&project.ID, &project.Name, &project.Description, &project.Color,
+			&project.Archived, &project.CreatedAt); err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// SaveProject ID 为 0 时创建项目并回填 ID，否则更新；更新的项目不存在时返回 false
+func (s *SQLiteStorage) SaveProject(project *models.Project) (bool, error) {
+	name, err := labelName(project.Name)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := checkLabelName(tx, "projects", project.ID, name); err != nil {
+		return false, err
+	}
+	if project.ID == 0 {
+		project.CreatedAt = time.Now()
+		result, err := tx.Exec(`INSERT INTO projects (name, description, color, archived, created_at) VALUES (?, ?, ?, ?, ?)`,
+			name, project.Description, project.Color, project.Archived, dbTime(project.CreatedAt))
+		if err != nil {
+			return false, err
+		}
+		if project.ID, err = result.LastInsertId(); err != nil {
+			return false, err
+		}
+	} else if err := tx.QueryRow(`UPDATE projects SET name = ?, description = ?, color = ?, archived = ? WHERE id = ?
+		RETURNING created_at`, name, project.Description, project.Color, project.Archived, project.ID).
+		Scan(&project.CreatedAt); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	project.Name = name
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	// 归档状态影响规则是否生效
+	return true, s.loadRules()
+}
+
+func (s *SQLiteStorage) DeleteTag(id int64) (bool, error) {
+	return s.deleteLabel(LabelTag, id)
+}
+
+func (s *SQLiteStorage) DeleteProject(id int64) (bool, error) {
+	return s.deleteLabel(LabelProject, id)
+}
+
+// deleteLabel 删除标签或项目，以及它的全部关联和指向它的规则
+func (s *SQLiteStorage) deleteLabel(label string, id int64) (bool, error) {
+	tables := labelTables[label]
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM `+tables.table+` WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM `+tables.links+` WHERE `+tables.column+` = ?`, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM tag_rules WHERE `+tables.column+` = ?`, id); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, s.loadRules()
+}
+
+// AddLink 手动关联记录，已有规则生成的同一关联时改为手动关联；标签、项目或记录不存在时返回 false
+func (s *SQLiteStorage) AddLink(link Link) (bool, error) {
+	if err := link.validate(); err != nil {
+		return false, err
+	}
+	tables := labelTables[link.Label]
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM `+tables.table+` WHERE id = ?) *
+		(SELECT COUNT(*) FROM `+linkTargets[link.Target]+` WHERE id = ?)`, link.LabelID, link.TargetID).Scan(&found)
+	if err != nil || found == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(`INSERT INTO `+tables.links+` (`+tables.column+`, target, target_id, rule_id, created_at)
+		VALUES (?, ?, ?, NULL, ?) ON CONFLICT DO UPDATE SET rule_id = NULL`,
+		link.LabelID, link.Target, link.TargetID, dbTime(time.Now())); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RemoveLink 删除关联，关联不存在时返回 false。规则生成的关联在重新应用规则时会再次生成
+func (s *SQLiteStorage) RemoveLink(link Link) (bool, error) {
+	if err := link.validate(); err != nil {
+		return false, err
+	}
+	tables := labelTables[link.Label]
+
+	result, err := s.writeStmts.exec(`DELETE FROM `+tables.links+` WHERE `+tables.column+` = ? AND target = ? AND target_id = ?`,
+		link.LabelID, link.Target, link.TargetID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetLabels 获取一条记录关联的标签和项目
+func (s *SQLiteStorage) GetLabels(target string, targetID int64) (*models.Labels, error) {
+	if _, ok := linkTargets[target]; !ok {
+		return nil, fmt.Errorf("%w: unknown target %q (expected activity, app_usage or summary)", ErrInvalidLabel, target)
+	}
+	labels := &models.Labels{Tags: []*models.Tag{}, Projects: []*models.Project{}}
+
+	rows, err := s.readStmts.query(`SELECT t.id, t.name, t.color, t.created_at FROM tag_links l
+		JOIN tags t ON t.id = l.tag_id WHERE l.target = ? AND l.target_id = ? ORDER BY t.name COLLATE NOCASE`, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		labels.Tags = append(labels.Tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.readStmts.query(`SELECT p.id, p.name, p.description, p.color, p.archived, p.created_at FROM project_links l
+		JOIN projects p ON p.id = l.project_id WHERE l.target = ? AND l.target_id = ? ORDER BY p.name COLLATE NOCASE`, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		project := &models.Project{}
+		if err := rows.Scan(&project.ID, &project.Name, &project.Description, &project.Color,
+			&project.Archived, &project.CreatedAt); err != nil {
+			return nil, err
+		}
+		labels.Projects = append(labels.Projects, project)
+	}
+	return labels, rows.Err()
+}
+
+// GetProjectTotals 按项目汇总 [from, to) 内关联的活动记录和应用使用记录，零值表示不限，按总时长倒序排列
+func (s *SQLiteStorage) GetProjectTotals(from, to time.Time) ([]*models.ProjectTotal, error) {
+	byProject := make(map[int64]*models.ProjectTotal)
+	get := func(id int64, name string) *models.ProjectTotal {
+		if byProject[id] == nil {
+			byProject[id] = &models.ProjectTotal{ProjectID: id, Name: name}
+		}
+		return byProject[id]
+	}
+
+	if err := s.sumProjectLinks(LinkActivity, "activities", "timestamp", from, to,
+		func(id int64, name string, count, duration int64) {
+			total := get(id, name)
+			total.Activities, total.ActivityDuration = count, duration
+		}); err != nil {
+		return nil, err
+	}
+	if err := s.sumProjectLinks(LinkAppUsage, "app_usage", "start_time", from, to,
+		func(id int64, name string, count, duration int64) {
+			total := get(id, name)
+			total.Sessions, total.SessionDuration = count, duration
+		}); err != nil {
+		return nil, err
+	}
+	return sortProjectTotals(byProject), nil
+}
+
+// sumProjectLinks 按项目汇总关联到 table 中的记录数和持续时间，column 是过滤时间范围的列
+func (s *SQLiteStorage) sumProjectLinks(target, table, column string, from, to time.Time,
+	fn func(id int64, name string, count, duration int64)) error {
+	where := &whereBuilder{}
+	where.add("l.target = ?", target)
+	where.addTimeRange("r."+column, from, to, nil)
+
+	rows, err := s.readDB.Query(`SELECT p.id, p.name, COUNT(*), COALESCE(SUM(r.duration), 0) FROM project_links l
+		JOIN projects p ON p.id = l.project_id JOIN `+table+` r ON r.id = l.target_id`+
+		where.String()+` GROUP BY p.id`, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count, duration int64
+		var name string
+		if err := rows.Scan(&id, &name, &count, &duration); err != nil {
+			return err
+		}
+		fn(id, name, count, duration)
+	}
+	return rows.Err()
+}
+
+// sortProjectTotals 按活动和应用使用总时长倒序、项目名正序排列
+func sortProjectTotals(byProject map[int64]*models.ProjectTotal) []*models.ProjectTotal {
+	totals := make([]*models.ProjectTotal, 0, len(byProject))
+	for _, total := range byProject {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		di := totals[i].ActivityDuration + totals[i].SessionDuration
+		dj := totals[j].ActivityDuration + totals[j].SessionDuration
+		if di != dj {
+			return di > dj
+		}
+		return totals[i].Name < totals[j].Name
+	})
+	return totals
+}
+
+// sortByName 按名称忽略大小写排序
+func sortByName[T any](items []T, name func(T) string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return strings.ToLower(name(items[i])) < strings.ToLower(name(items[j]))
+	})
+}
+
+// memoryLabelName 与 checkLabelName 相同，检查名称是否已被其他标签或项目使用（调用方需持有锁）
+func memoryLabelName[T any](items []T, id int64, name string, get func(T) (int64, string)) error {
+	for _, item := range items {
+		if otherID, otherName := get(item); otherID != id && strings.EqualFold(otherName, name) {
+			return fmt.Errorf("%w: %s", ErrDuplicateLabel, name)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) ListTags() ([]*models.Tag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tags := []*models.Tag{}
+	for _, tag := range m.tags {
+		copied := *tag
+		tags = append(tags, &copied)
+	}
+	sortByName(tags, func(tag *models.Tag) string { return tag.Name })
+	return tags, nil
+}
+
+func (m *MemoryStorage) SaveTag(tag *models.Tag) (bool, error) {
+	name, err := labelName(tag.Name)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := memoryLabelName(m.tags, tag.ID, name, func(t *models.Tag) (int64, string) { return t.ID, t.Name }); err != nil {
+		return false, err
+	}
+	if tag.ID == 0 {
+		stored := *tag
+		stored.ID, stored.Name, stored.CreatedAt = m.allocID("tags"), name, time.Now().Round(0)
+		m.tags = append(m.tags, &stored)
+		*tag = stored
+		return true, nil
+	}
+	for _, stored := range m.tags {
+		if stored.ID == tag.ID {
+			stored.Name, stored.Color = name, tag.Color
+			*tag = *stored
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) ListProjects() ([]*models.Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	projects := []*models.Project{}
+	for _, project := range m.projects {
+		copied := *project
+		projects = append(projects, &copied)
+	}
+	sortByName(projects, func(project *models.Project) string { return project.Name })
+	sort.SliceStable(projects, func(i, j int) bool { return !projects[i].Archived && projects[j].Archived })
+	return projects, nil
+}
+
+func (m *MemoryStorage) SaveProject(project *models.Project) (bool, error) {
+	name, err := labelName(project.Name)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := memoryLabelName(m.projects, project.ID, name,
+		func(p *models.Project) (int64, string) { return p.ID, p.Name }); err != nil {
+		return false, err
+	}
+	if project.ID == 0 {
+		stored := *project
+		stored.ID, stored.Name, stored.CreatedAt = m.allocID("projects"), name, time.Now().Round(0)
+		m.projects = append(m.projects, &stored)
+		*project = stored
+		return true, nil
+	}
+	for _, stored := range m.projects {
+		if stored.ID == project.ID {
+			stored.Name, stored.Description, stored.Color, stored.Archived =
+				name, project.Description, project.Color, project.Archived
+			*project = *stored
+			m.loadRules()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) DeleteTag(id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, tag := range m.tags {
+		if tag.ID == id {
+			m.tags = append(m.tags[:i:i], m.tags[i+1:]...)
+			m.deleteLabel(LabelTag, id)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) DeleteProject(id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, project := range m.projects {
+		if project.ID == id {
+			m.projects = append(m.projects[:i:i], m.projects[i+1:]...)
+			m.deleteLabel(LabelProject, id)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteLabel 删除标签或项目的全部关联和指向它的规则（调用方需持有写锁）
+func (m *MemoryStorage) deleteLabel(label string, id int64) {
+	for link := range m.links {
+		if link.Label == label && link.LabelID == id {
+			delete(m.links, link)
+		}
+	}
+	var kept []*models.TagRule
+	for _, rule := range m.tagRules {
+		if (label == LabelTag && rule.TagID == id) || (label == LabelProject && rule.ProjectID == id) {
+			continue
+		}
+		kept = append(kept, rule)
+	}
+	m.tagRules = kept
+	m.loadRules()
+}
+
+// labelExists 标签或项目是否存在（调用方需持有锁）
+func (m *MemoryStorage) labelExists(label string, id int64) bool {
+	if label == LabelTag {
+		return m.findTag(id) != nil
+	}
+	return m.findProject(id) != nil
+}
+
+func (m *MemoryStorage) findTag(id int64) *models.Tag {
+	for _, tag := range m.tags {
+		if tag.ID == id {
+			return tag
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) findProject(id int64) *models.Project {
+	for _, project := range m.projects {
+		if project.ID == id {
+			return project
+		}
+	}
+	return nil
+}
+
+// recordExists 关联的目标记录是否存在（调用方需持有锁）
+func (m *MemoryStorage) recordExists(target string, id int64) bool {
+	switch target {
+	case LinkActivity:
+		for _, activity := range m.activities {
+			if activity.ID == id {
+				return true
+			}
+		}
+	case LinkAppUsage:
+		for _, usage := range m.appUsage {
+			if usage.ID == id {
+				return true
+			}
+		}
+	case LinkSummary:
+		for _, summary := range m.summaries {
+			if summary.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *MemoryStorage) AddLink(link Link) (bool, error) {
+	if err := link.validate(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.labelExists(link.Label, link.LabelID) || !m.recordExists(link.Target, link.TargetID) {
+		return false, nil
+	}
+	m.links[link] = 0
+	return true, nil
+}
+
+func (m *MemoryStorage) RemoveLink(link Link) (bool, error) {
+	if err := link.validate(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.links[link]; !ok {
+		return false, nil
+	}
+	delete(m.links, link)
+	return true, nil
+}
+
+// dropLinks 删除记录的全部关联，记录被清理或删除时调用（调用方需持有写锁）
+func (m *MemoryStorage) dropLinks(target string, id int64) {
+	for link := range m.links {
+		if link.Target == target && link.TargetID == id {
+			delete(m.links, link)
+		}
+	}
+}
+
+func (m *MemoryStorage) GetLabels(target string, targetID int64) (*models.Labels, error) {
+	if _, ok := linkTargets[target]; !ok {
+		return nil, fmt.Errorf("%w: unknown target %q (expected activity, app_usage or summary)", ErrInvalidLabel, target)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	labels := &models.Labels{Tags: []*models.Tag{}, Projects: []*models.Project{}}
+	for link := range m.links {
+		if link.Target != target || link.TargetID != targetID {
+			continue
+		}
+		if link.Label == LabelTag {
+			copied := *m.findTag(link.LabelID)
+			labels.Tags = append(labels.Tags, &copied)
+		} else {
+			copied := *m.findProject(link.LabelID)
+			labels.Projects = append(labels.Projects, &copied)
+		}
+	}
+	sortByName(labels.Tags, func(tag *models.Tag) string { return tag.Name })
+	sortByName(labels.Projects, func(project *models.Project) string { return project.Name })
+	return labels, nil
+}
+
+func (m *MemoryStorage) GetProjectTotals(from, to time.Time) ([]*models.ProjectTotal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byProject := make(map[int64]*models.ProjectTotal)
+	get := func(id int64) *models.ProjectTotal {
+		if byProject[id] == nil {
+			byProject[id] = &models.ProjectTotal{ProjectID: id, Name: m.findProject(id).Name}
+		}
+		return byProject[id]
+	}
+
+	// 记录类型和 ID 到关联的项目
+	projects := make(map[Link][]int64)
+	for link := range m.links {
+		if link.Label == LabelProject {
+			key := Link{Target: link.Target, TargetID: link.TargetID}
+			projects[key] = append(projects[key], link.LabelID)
+		}
+	}
+	for _, activity := range m.activities {
+		if !inRange(activity.Timestamp, from, to) {
+			continue
+		}
+		for _, id := range projects[Link{Target: LinkActivity, TargetID: activity.ID}] {
+			total := get(id)
+			total.Activities++
+			total.ActivityDuration += activity.Duration
+		}
+	}
+	for _, usage := range m.appUsage {
+		if !inRange(usage.StartTime, from, to) {
+			continue
+		}
+		for _, id := range projects[Link{Target: LinkAppUsage, TargetID: usage.ID}] {
+			total := get(id)
+			total.Sessions++
+			total.SessionDuration += usage.Duration
+		}
+	}
+	return sortProjectTotals(byProject), nil
+}
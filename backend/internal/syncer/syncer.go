@@ -0,0 +1,288 @@
+package syncer
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yaml-backend/internal/storage"
+)
+
+const (
+	requestTimeout = 60 * time.Second
+	changesPath    = "/api/v1/sync/changes"
+)
+
+// Report 从一个对端拉取变更的结果
+type Report struct {
+	Peer       string    `json:"peer"`
+	DeviceID   string    `json:"device_id,omitempty"`
+	Pages      int       `json:"pages"`
+	Watermark  int64     `json:"watermark"`
+	Reset      bool      `json:"reset,omitempty"` // 对端设备ID变化（例如从备份恢复），水位已重置
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	storage.SyncMergeResult
+}
+
+// Manager 定期从对端拉取水位之后的变更并合并到本机。同步是单向拉取的，
+// 两台设备互相配置为对端后各自拉取，最终得到相同的合并结果
+type Manager struct {
+	storage  storage.Store
+	peers    []string
+	token    string
+	interval time.Duration
+	client   *http.Client
+
+	mu          sync.RWMutex
+	runMu       sync.Mutex
+	lastReports []*Report
+	stopCh      chan struct{}
+	doneCh      chan struct{}
+}
+
+// NewManager 创建同步管理器。peers 是对端后端的地址（例如 http://desktop:8080），
+// token 非空时拉取请求携带 Authorization: Bearer token，并要求对端的请求同样携带；interval <= 0 时不定时同步
+func NewManager(store storage.Store, peers []string, token string, interval time.Duration) *Manager {
+	normalized := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if peer = strings.TrimRight(strings.TrimSpace(peer), "/"); peer != "" {
+			normalized = append(normalized, peer)
+		}
+	}
+	return &Manager{
+		storage:  store,
+		peers:    normalized,
+		token:    token,
+		interval: interval,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Enabled 是否配置了对端
+func (m *Manager) Enabled() bool {
+	return len(m.peers) > 0
+}
+
+// Peers 配置的对端地址
+func (m *Manager) Peers() []string {
+	return m.peers
+}
+
+// Interval 定时同步间隔，0 表示不定时同步
+func (m *Manager) Interval() time.Duration {
+	return m.interval
+}
+
+// Authorized 检查对端拉取请求的 Authorization 头。未配置 token 时只允许本机的请求，
+// 配置了对端却没有 token 时拒绝所有请求
+func (m *Manager) Authorized(r *http.Request) bool {
+	if m.token == "" {
+		return !m.Enabled() && isLoopback(r.RemoteAddr)
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+m.token)) == 1
+}
+
+// isLoopback 请求是否来自本机。使用连接的地址，不信任 X-Forwarded-For 等请求头
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Start 启动定时同步，启动时立即执行一次
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.Enabled() || m.interval <= 0 || m.stopCh != nil {
+		return
+	}
+
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+	go m.loop(m.stopCh, m.doneCh)
+
+	fmt.Printf("Sync started: device %s pulling from %d peers every %s\n", m.storage.DeviceID(), len(m.peers), m.interval)
+}
+
+// Stop 停止定时同步并等待正在执行的同步结束
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	stopCh, doneCh := m.stopCh, m.doneCh
+	m.stopCh, m.doneCh = nil, nil
+	m.mu.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func (m *Manager) loop(stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.RunOnce(); err != nil {
+			fmt.Printf("[ERROR] Sync failed: %v\n", err)
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 依次从每个对端拉取变更，返回每个对端的结果和第一个错误
+func (m *Manager) RunOnce() ([]*Report, error) {
+	if !m.Enabled() {
+		return nil, fmt.Errorf("sync is disabled (no sync.peers configured)")
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	saved, err := m.storage.GetSyncPeers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync peers: %w", err)
+	}
+	states := make(map[string]*storage.SyncPeer)
+	for _, peer := range saved {
+		states[peer.URL] = peer
+	}
+
+	var reports []*Report
+	var firstErr error
+	for _, peerURL := range m.peers {
+		peer := states[peerURL]
+		if peer == nil {
+			peer = &storage.SyncPeer{URL: peerURL}
+		}
+		report, err := m.pull(peer)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("peer %s: %w", peerURL, err)
+		}
+		reports = append(reports, report)
+	}
+
+	m.mu.Lock()
+	m.lastReports = reports
+	m.mu.Unlock()
+
+	return reports, firstErr
+}
+
+// pull 从水位开始逐页拉取并合并，每合并一页保存一次水位，中断后从已合并的位置继续
+func (m *Manager) pull(peer *storage.SyncPeer) (*Report, error) {
+	report := &Report{Peer: peer.URL, StartedAt: time.Now()}
+
+	err := func() error {
+		for {
+			changes, err := m.fetch(peer.URL, peer.Watermark)
+			if err != nil {
+				return err
+			}
+			if changes.DeviceID == m.storage.DeviceID() {
+				return fmt.Errorf("peer has the same device id as this backend")
+			}
+			if peer.DeviceID != "" && changes.DeviceID != peer.DeviceID && peer.Watermark > 0 {
+				// 对端换了设备ID，原来的变更序号不再有效，从头拉取；已合并的记录会被跳过
+				peer.DeviceID, peer.Watermark, report.Reset = changes.DeviceID, 0, true
+				continue
+			}
+			peer.DeviceID = changes.DeviceID
+
+			result, err := m.storage.MergeChanges(changes.Records)
+			if err != nil {
+				return err
+			}
+			report.Pages++
+			report.Inserted += result.Inserted
+			report.Updated += result.Updated
+			report.Deleted += result.Deleted
+			report.Skipped += result.Skipped
+
+			peer.Watermark = changes.Next
+			if err := m.storage.SaveSyncPeer(peer); err != nil {
+				return err
+			}
+			if !changes.HasMore {
+				return nil
+			}
+		}
+	}()
+
+	report.FinishedAt = time.Now()
+	report.DeviceID, report.Watermark = peer.DeviceID, peer.Watermark
+	peer.LastSyncAt = &report.FinishedAt
+	peer.LastError = ""
+	if err != nil {
+		report.Error = err.Error()
+		peer.LastError = report.Error
+	}
+	if saveErr := m.storage.SaveSyncPeer(peer); saveErr != nil && err == nil {
+		err = saveErr
+		report.Error = err.Error()
+	}
+	return report, err
+}
+
+// fetch 请求对端的一页变更
+func (m *Manager) fetch(peerURL string, since int64) (*storage.SyncChanges, error) {
+	query := url.Values{}
+	query.Set("since", strconv.FormatInt(since, 10))
+	query.Set("limit", strconv.Itoa(storage.DefaultSyncPageSize))
+
+	req, err := http.NewRequest(http.MethodGet, peerURL+changesPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var changes storage.SyncChanges
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return nil, fmt.Errorf("failed to decode changes: %w", err)
+	}
+	if changes.DeviceID == "" {
+		return nil, fmt.Errorf("response has no device id")
+	}
+	return &changes, nil
+}
+
+// LastReports 获取最近一次同步的结果，尚未执行过时返回 nil
+func (m *Manager) LastReports() []*Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastReports
+}
@@ -0,0 +1,40 @@
+package syncer
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name       string
+		peers      []string
+		token      string
+		remoteAddr string
+		header     string
+		want       bool
+	}{
+		{name: "no token from loopback", remoteAddr: "127.0.0.1:50000", want: true},
+		{name: "no token from ipv6 loopback", remoteAddr: "[::1]:50000", want: true},
+		{name: "no token from the network", remoteAddr: "192.168.1.20:50000", want: false},
+		{name: "no token with peers", peers: []string{"http://desktop:8080"}, remoteAddr: "127.0.0.1:50000", want: false},
+		{name: "token matches", token: "secret", remoteAddr: "192.168.1.20:50000", header: "Bearer secret", want: true},
+		{name: "token mismatch", token: "secret", remoteAddr: "127.0.0.1:50000", header: "Bearer other", want: false},
+		{name: "token missing", token: "secret", remoteAddr: "127.0.0.1:50000", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(nil, tt.peers, tt.token, 0)
+			r := httptest.NewRequest("GET", changesPath, nil)
+			r.RemoteAddr = tt.remoteAddr
+			// 转发头不能让远程请求冒充本机
+			r.Header.Set("X-Forwarded-For", "127.0.0.1")
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := m.Authorized(r); got != tt.want {
+				t.Errorf("Authorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
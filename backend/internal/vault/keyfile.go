@@ -0,0 +1,236 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt 参数（交互式登录推荐值）
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	keyFileMode  = 0600
+	keyFileV1    = 1
+	saltSize     = 16
+	secretKeyLen = 32
+)
+
+// ErrWrongPassphrase 口令错误
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// KeyFile 口令保护的密钥文件：私钥用 scrypt 派生的密钥经 secretbox 加密保存，公钥明文保存
+type KeyFile struct {
+	Version             int       `json:"version"`
+	KDF                 string    `json:"kdf"`
+	Salt                string    `json:"salt"`
+	N                   int       `json:"n"`
+	R                   int       `json:"r"`
+	P                   int       `json:"p"`
+	PublicKeyB64        string    `json:"public_key"`
+	EncryptedPrivateKey string    `json:"encrypted_private_key"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// NewKeyFile 生成新的密钥对并用口令保护私钥
+func NewKeyFile(passphrase string) (*KeyFile, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return sealKeyFile(*publicKey, *privateKey, passphrase)
+}
+
+func sealKeyFile(publicKey, privateKey [32]byte, passphrase string) (*KeyFile, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyFile := &KeyFile{
+		Version:      keyFileV1,
+		KDF:          "scrypt",
+		Salt:         base64.StdEncoding.EncodeToString(salt),
+		N:            scryptN,
+		R:            scryptR,
+		P:            scryptP,
+		PublicKeyB64: base64.StdEncoding.EncodeToString(publicKey[:]),
+		CreatedAt:    time.Now(),
+	}
+
+	secretKey, err := keyFile.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	sealed := secretbox.Seal(nonce[:], privateKey[:], &nonce, &secretKey)
+	keyFile.EncryptedPrivateKey = base64.StdEncoding.EncodeToString(sealed)
+
+	return keyFile, nil
+}
+
+// LoadKeyFile 读取密钥文件
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyFile KeyFile
+	if err := json.Unmarshal(data, &keyFile); err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+	if keyFile.Version != keyFileV1 || keyFile.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key file version %d (%s)", keyFile.Version, keyFile.KDF)
+	}
+
+	return &keyFile, nil
+}
+
+// Save 原子地写入密钥文件（先写临时文件再重命名），权限为 0600
+func (k *KeyFile) Save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, keyFileMode); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace key file: %w", err)
+	}
+	return nil
+}
+
+// PublicKey 解析公钥
+func (k *KeyFile) PublicKey() ([32]byte, error) {
+	return decodeKey(k.PublicKeyB64)
+}
+
+// KeyID 密钥标识
+func (k *KeyFile) KeyID() string {
+	publicKey, err := k.PublicKey()
+	if err != nil {
+		return ""
+	}
+	return keyID(publicKey)
+}
+
+// Decrypt 用口令解出私钥
+func (k *KeyFile) Decrypt(passphrase string) ([32]byte, error) {
+	var privateKey [32]byte
+
+	secretKey, err := k.deriveKey(passphrase)
+	if err != nil {
+		return privateKey, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(k.EncryptedPrivateKey)
+	if err != nil || len(sealed) < 24 {
+		return privateKey, fmt.Errorf("malformed encrypted private key")
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed[:24])
+	opened, ok := secretbox.Open(nil, sealed[24:], &nonce, &secretKey)
+	if !ok || len(opened) != len(privateKey) {
+		return privateKey, ErrWrongPassphrase
+	}
+	copy(privateKey[:], opened)
+
+	// 确认私钥与文件中的公钥匹配
+	publicKey, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return privateKey, err
+	}
+	if base64.StdEncoding.EncodeToString(publicKey) != k.PublicKeyB64 {
+		return privateKey, fmt.Errorf("key file is corrupted: private key does not match public key")
+	}
+
+	return privateKey, nil
+}
+
+func (k *KeyFile) deriveKey(passphrase string) ([secretKeyLen]byte, error) {
+	var secretKey [secretKeyLen]byte
+
+	salt, err := base64.StdEncoding.DecodeString(k.Salt)
+	if err != nil {
+		return secretKey, fmt.Errorf("malformed key file salt: %w", err)
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, k.N, k.R, k.P, secretKeyLen)
+	if err != nil {
+		return secretKey, fmt.Errorf("failed to derive key: %w", err)
+	}
+	copy(secretKey[:], derived)
+	return secretKey, nil
+}
+
+// 环境变量
+const (
+	// EnvPrivateKey base64 编码的私钥，设置后无需密钥文件且启动即解锁
+	EnvPrivateKey = "YAML_ENCRYPTION_KEY"
+	// EnvPassphrase 密钥文件口令，设置后启动即解锁；密钥文件不存在时用它创建
+	EnvPassphrase = "YAML_ENCRYPTION_PASSPHRASE"
+)
+
+// Load 按 YAML_ENCRYPTION_KEY、密钥文件的顺序加载保险库。
+// 密钥文件不存在且设置了 YAML_ENCRYPTION_PASSPHRASE 时自动创建；没有口令时以锁定状态启动
+func Load(keyFilePath string) (*Vault, error) {
+	if encoded := os.Getenv(EnvPrivateKey); encoded != "" {
+		return NewFromPrivateKey(encoded)
+	}
+
+	passphrase := os.Getenv(EnvPassphrase)
+
+	keyFile, err := LoadKeyFile(keyFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("key file %s not found, set %s to create one or %s to use a raw key",
+				keyFilePath, EnvPassphrase, EnvPrivateKey)
+		}
+		keyFile, err = NewKeyFile(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if err := keyFile.Save(keyFilePath); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Created encryption key file %s (key %s)\n", keyFilePath, keyFile.KeyID())
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load key file: %w", err)
+	}
+
+	v, err := NewFromKeyFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase != "" {
+		if err := v.Unlock(passphrase); err != nil {
+			return nil, fmt.Errorf("failed to unlock key file: %w", err)
+		}
+	}
+	return v, nil
+}
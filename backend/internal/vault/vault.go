@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// ciphertextPrefix 加密字段的前缀，格式为 enc1:<keyID>:<base64密文>
+const ciphertextPrefix = "enc1:"
+
+var (
+	// ErrLocked 保险库处于锁定状态，无法解密
+	ErrLocked = errors.New("encrypted store is locked")
+	// ErrWrongKey 密文不是用当前密钥加密的
+	ErrWrongKey = errors.New("ciphertext was encrypted with a different key")
+)
+
+// Vault 字段级加密：使用公钥匿名加密（X25519 + XSalsa20-Poly1305），
+// 写入只需要公钥，因此锁定状态下仍可记录数据，只有解锁后才能读取明文
+type Vault struct {
+	mu         sync.RWMutex
+	publicKey  [32]byte
+	privateKey *[32]byte // 锁定时为 nil
+	keyFile    *KeyFile  // 从环境变量直接加载私钥时为 nil
+}
+
+// NewFromKeyFile 使用密钥文件创建处于锁定状态的保险库
+func NewFromKeyFile(keyFile *KeyFile) (*Vault, error) {
+	publicKey, err := keyFile.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{publicKey: publicKey, keyFile: keyFile}, nil
+}
+
+// NewFromPrivateKey 使用 base64 编码的私钥创建已解锁的保险库
+func NewFromPrivateKey(encoded string) (*Vault, error) {
+	privateKey, err := decodeKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	v := &Vault{}
+	if err := v.setPrivateKey(privateKey); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GenerateKey 生成新的 X25519 密钥对，返回 base64 编码的私钥
+func GenerateKey() (string, error) {
+	_, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(privateKey[:]), nil
+}
+
+func (v *Vault) setPrivateKey(privateKey [32]byte) error {
+	publicKey, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// 已有公钥时私钥必须与之匹配
+	if v.publicKey != [32]byte{} && string(publicKey) != string(v.publicKey[:]) {
+		return ErrWrongKey
+	}
+	copy(v.publicKey[:], publicKey)
+	v.privateKey = &privateKey
+	return nil
+}
+
+// KeyID 当前密钥的标识（公钥 SHA-256 的前 8 个十六进制字符）
+func (v *Vault) KeyID() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return keyID(v.publicKey)
+}
+
+func keyID(publicKey [32]byte) string {
+	sum := sha256.Sum256(publicKey[:])
+	return hex.EncodeToString(sum[:4])
+}
+
+// Locked 是否处于锁定状态
+func (v *Vault) Locked() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.privateKey == nil
+}
+
+// Unlock 使用口令解锁密钥文件
+func (v *Vault) Unlock(passphrase string) error {
+	if v.keyFile == nil {
+		return fmt.Errorf("vault has no key file, unlock with the private key instead")
+	}
+
+	privateKey, err := v.keyFile.Decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	return v.setPrivateKey(privateKey)
+}
+
+// UnlockWithKey 使用 base64 编码的私钥解锁
+func (v *Vault) UnlockWithKey(encoded string) error {
+	privateKey, err := decodeKey(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	return v.setPrivateKey(privateKey)
+}
+
+// Lock 从内存中清除私钥
+func (v *Vault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.privateKey != nil {
+		*v.privateKey = [32]byte{}
+		v.privateKey = nil
+	}
+}
+
+// Encrypt 加密字段，空字符串保持不变
+func (v *Vault) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	v.mu.RLock()
+	publicKey := v.publicKey
+	v.mu.RUnlock()
+
+	sealed, err := box.SealAnonymous(nil, []byte(plaintext), &publicKey, rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt field: %w", err)
+	}
+	return ciphertextPrefix + keyID(publicKey) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密字段，未加密的值原样返回
+func (v *Vault) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.privateKey == nil {
+		return "", ErrLocked
+	}
+
+	id, payload, err := splitCiphertext(value)
+	if err != nil {
+		return "", err
+	}
+	if id != keyID(v.publicKey) {
+		return "", fmt.Errorf("%w (key %s)", ErrWrongKey, id)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext encoding: %w", err)
+	}
+
+	plaintext, ok := box.OpenAnonymous(nil, sealed, &v.publicKey, v.privateKey)
+	if !ok {
+		return "", fmt.Errorf("ciphertext authentication failed")
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted 判断字段值是否为密文
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
+
+// CiphertextKeyID 返回密文使用的密钥标识，明文返回空字符串
+func CiphertextKeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, err := splitCiphertext(value)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+func splitCiphertext(value string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(value, ciphertextPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed ciphertext")
+	}
+	return parts[0], parts[1], nil
+}
+
+func decodeKey(encoded string) ([32]byte, error) {
+	var key [32]byte
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return key, err
+	}
+	if len(raw) != len(key) {
+		return key, fmt.Errorf("key must be %d bytes, got %d", len(key), len(raw))
+	}
+	copy(key[:], raw)
+	return key, nil
+}
@@ -11,13 +11,15 @@ import (
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	AI       AIConfig       `yaml:"ai"`
-	Monitor  MonitorConfig  `yaml:"monitor"`
-	API      APIConfig      `yaml:"api"`
-	Logging  LoggingConfig  `yaml:"logging"`
-	Frontend FrontendConfig `yaml:"frontend"`
+	Server      ServerConfig     `yaml:"server"`
+	Database    DatabaseConfig   `yaml:"database"`
+	AI          AIConfig         `yaml:"ai"`
+	Monitor     MonitorConfig    `yaml:"monitor"`
+	API         APIConfig        `yaml:"api"`
+	Logging     LoggingConfig    `yaml:"logging"`
+	Frontend    FrontendConfig   `yaml:"frontend"`
+	Sync        SyncConfig       `yaml:"sync"`
+	Screenshots ScreenshotConfig `yaml:"screenshots"`
 }
 
 // ServerConfig 服务器配置
@@ -28,10 +30,27 @@ type ServerConfig struct {
 
 // DatabaseConfig 数据库配置
 type DatabaseConfig struct {
-	Type          string `yaml:"type"`
-	Filename      string `yaml:"filename"`
-	DataDir       string `yaml:"data_dir"`
-	RetentionDays int    `yaml:"retention_days"`
+	Type          string           `yaml:"type"`
+	Filename      string           `yaml:"filename"`
+	DataDir       string           `yaml:"data_dir"`
+	RetentionDays int              `yaml:"retention_days"`
+	Encryption    EncryptionConfig `yaml:"encryption"`
+	Backup        BackupConfig     `yaml:"backup"`
+}
+
+// EncryptionConfig 静态数据加密配置
+type EncryptionConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	KeyFile           string `yaml:"key_file"`
+	EncryptActivities bool   `yaml:"encrypt_activities"`
+}
+
+// BackupConfig 数据库备份配置
+type BackupConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // 是否定时备份，关闭时仍可通过 API 手动备份
+	IntervalHours int    `yaml:"interval_hours"` // 定时备份间隔（小时）
+	Keep          int    `yaml:"keep"`           // 保留的备份份数
+	Dir           string `yaml:"dir"`            // 备份目录
 }
 
 // AIConfig AI服务配置
@@ -57,9 +76,19 @@ type GenerationConfig struct {
 
 // MonitorConfig 监控配置
 type MonitorConfig struct {
-	CollectionInterval int `yaml:"collection_interval"`
-	KeyboardBufferSize int `yaml:"keyboard_buffer_size"`
-	AppSwitchInterval  int `yaml:"app_switch_interval"`
+	CollectionInterval int      `yaml:"collection_interval"`
+	KeyboardBufferSize int      `yaml:"keyboard_buffer_size"`
+	AppSwitchInterval  int      `yaml:"app_switch_interval"`
+	IdleTimeout        int      `yaml:"idle_timeout"`
+	FlushInterval      int      `yaml:"flush_interval"`
+	FlushBatchSize     int      `yaml:"flush_batch_size"`
+	TypingIdleTimeout  int      `yaml:"typing_idle_timeout"`
+	TypingMaxLength    int      `yaml:"typing_max_length"`
+	Sources            []string `yaml:"sources"`
+	SocketPath         string   `yaml:"socket_path"`
+	RecordingsDir      string   `yaml:"recordings_dir"`
+	SwiftBinary        string   `yaml:"swift_binary"`
+	HeartbeatTimeout   int      `yaml:"heartbeat_timeout"`
 }
 
 // APIConfig API配置
@@ -82,6 +111,22 @@ type FrontendConfig struct {
 	APIBaseURL string `yaml:"api_base_url"`
 }
 
+// SyncConfig 多设备同步配置
+type SyncConfig struct {
+	Enabled         bool     `yaml:"enabled"`          // 是否定时从对端拉取变更，关闭时仍可通过 API 手动同步
+	IntervalSeconds int      `yaml:"interval_seconds"` // 定时同步间隔（秒）
+	Token           string   `yaml:"token"`            // 对端之间共享的令牌，为空时不校验
+	Peers           []string `yaml:"peers"`            // 对端后端地址，例如 http://desktop:8080
+}
+
+// ScreenshotConfig 截图存储配置
+type ScreenshotConfig struct {
+	Dir           string `yaml:"dir"`            // 图片目录
+	MaxSizeMB     int    `yaml:"max_size_mb"`    // 图片文件总大小上限（MB），0 表示不限
+	RetentionDays int    `yaml:"retention_days"` // 截图保留天数，0 表示永久保留
+	MaxUploadMB   int    `yaml:"max_upload_mb"`  // 单张截图大小上限（MB）
+}
+
 // LoadConfig 加载配置文件
 func LoadConfig(configPath string) (*Config, error) {
 	// 如果没有指定配置文件路径，使用默认路径
@@ -131,6 +176,11 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("AI base URL cannot be empty")
 	}
 
+	// 同步接口返回明文记录，配置了对端时必须用令牌校验
+	if len(c.Sync.Peers) > 0 && c.Sync.Token == "" {
+		return fmt.Errorf("sync token cannot be empty when sync peers are configured")
+	}
+
 	return nil
 }
 
@@ -149,6 +199,76 @@ func (c *Config) GetDatabasePath() (string, error) {
 	return filepath.Join(dataDir, c.Database.Filename), nil
 }
 
+// GetKeyFilePath 获取加密密钥文件路径，相对路径以数据库所在目录为基准
+func (c *Config) GetKeyFilePath(dbPath string) string {
+	keyFile := c.Database.Encryption.KeyFile
+	if keyFile == "" {
+		keyFile = "yaml.key"
+	}
+	if filepath.IsAbs(keyFile) {
+		return keyFile
+	}
+	return filepath.Join(filepath.Dir(dbPath), keyFile)
+}
+
+// GetBackupDir 获取备份目录，相对路径以数据库所在目录为基准
+func (c *Config) GetBackupDir(dbPath string) string {
+	dir := c.Database.Backup.Dir
+	if dir == "" {
+		dir = "backups"
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(dbPath), dir)
+}
+
+// GetBackupInterval 获取定时备份间隔，未启用定时备份时返回 0
+func (c *Config) GetBackupInterval() time.Duration {
+	if !c.Database.Backup.Enabled {
+		return 0
+	}
+	hours := c.Database.Backup.IntervalHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// GetScreenshotDir 获取截图目录，相对路径以数据库所在目录为基准
+func (c *Config) GetScreenshotDir(dbPath string) string {
+	dir := c.Screenshots.Dir
+	if dir == "" {
+		dir = "screenshots"
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(dbPath), dir)
+}
+
+// GetScreenshotMaxBytes 获取截图总大小上限（字节），0 表示不限
+func (c *Config) GetScreenshotMaxBytes() int64 {
+	return int64(c.Screenshots.MaxSizeMB) << 20
+}
+
+// GetScreenshotMaxUpload 获取单张截图大小上限（字节），0 表示使用默认值
+func (c *Config) GetScreenshotMaxUpload() int64 {
+	return int64(c.Screenshots.MaxUploadMB) << 20
+}
+
+// GetSyncInterval 获取定时同步间隔，未启用定时同步时返回 0
+func (c *Config) GetSyncInterval() time.Duration {
+	if !c.Sync.Enabled {
+		return 0
+	}
+	seconds := c.Sync.IntervalSeconds
+	if seconds <= 0 {
+		seconds = 300
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 // GetServerAddress 获取服务器地址
 func (c *Config) GetServerAddress() string {
 	return c.Server.Host + ":" + c.Server.Port
@@ -164,6 +284,58 @@ func (c *Config) GetMonitorInterval() time.Duration {
 	return time.Duration(c.Monitor.CollectionInterval) * time.Second
 }
 
+// GetIdleTimeout 获取空闲阈值，未配置时返回 0（使用默认值）
+func (c *Config) GetIdleTimeout() time.Duration {
+	return time.Duration(c.Monitor.IdleTimeout) * time.Second
+}
+
+// GetTypingIdleTimeout 获取输入片段的空闲阈值，未配置时返回 0（使用默认值）
+func (c *Config) GetTypingIdleTimeout() time.Duration {
+	return time.Duration(c.Monitor.TypingIdleTimeout) * time.Second
+}
+
+// GetMonitorSources 获取启用的事件来源，未配置时只使用 macOS Swift 监控程序
+func (c *Config) GetMonitorSources() []string {
+	if len(c.Monitor.Sources) == 0 {
+		return []string{"swift"}
+	}
+	return c.Monitor.Sources
+}
+
+// GetSocketPath 获取采集程序套接字路径，相对路径以数据库所在目录为基准
+func (c *Config) GetSocketPath(dbPath string) string {
+	path := c.Monitor.SocketPath
+	if path == "" {
+		path = "collector.sock"
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(dbPath), path)
+}
+
+// GetRecordingsDir 获取事件录制目录，相对路径以数据库所在目录为基准
+func (c *Config) GetRecordingsDir(dbPath string) string {
+	dir := c.Monitor.RecordingsDir
+	if dir == "" {
+		dir = "recordings"
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(dbPath), dir)
+}
+
+// GetHeartbeatTimeout 获取 Swift 监控进程的心跳超时，未配置时返回 0（使用默认值）
+func (c *Config) GetHeartbeatTimeout() time.Duration {
+	return time.Duration(c.Monitor.HeartbeatTimeout) * time.Second
+}
+
+// GetFlushInterval 获取事件批量写入间隔
+func (c *Config) GetFlushInterval() time.Duration {
+	return time.Duration(c.Monitor.FlushInterval) * time.Millisecond
+}
+
 // GetAppSwitchInterval 获取应用切换检测间隔
 func (c *Config) GetAppSwitchInterval() time.Duration {
 	return time.Duration(c.Monitor.AppSwitchInterval) * time.Millisecond
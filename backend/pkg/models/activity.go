@@ -23,22 +23,126 @@ type Activity struct {
 	WindowTitle string       `json:"window_title" db:"window_title"`
 	URL         string       `json:"url" db:"url"`
 	Timestamp   time.Time    `json:"timestamp" db:"timestamp"`
-	Duration    int64        `json:"duration" db:"duration"` // 持续时间（秒）
+	Duration    int64        `json:"duration" db:"duration"`             // 持续时间（秒）
+	DeviceID    string       `json:"device_id,omitempty" db:"device_id"` // 采集该记录的设备
 }
 
-// KeyboardInput 键盘输入记录
+// KeyboardInput 键盘输入记录，一条记录是在同一个应用中连续输入的一段文本，Timestamp 为第一次按键的时间
 type KeyboardInput struct {
-	ID        int64     `json:"id" db:"id"`
-	Text      string    `json:"text" db:"text"`
-	AppName   string    `json:"app_name" db:"app_name"`
-	Timestamp time.Time `json:"timestamp" db:"timestamp"`
+	ID          int64     `json:"id" db:"id"`
+	Text        string    `json:"text" db:"text"`
+	AppName     string    `json:"app_name" db:"app_name"`
+	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
+	DeviceID    string    `json:"device_id,omitempty" db:"device_id"`
+	KeyCount    int64     `json:"key_count" db:"keystrokes"`    // 按键次数，包含退格和删除；为 0 时按文本字符数计
+	Corrections int64     `json:"corrections" db:"corrections"` // 退格和删除的次数
+	Duration    int64     `json:"duration" db:"duration"`       // 从第一次到最后一次按键的时长（秒）
 }
 
-// AppUsage 应用使用记录
+// AppUsage 应用使用记录，一条记录是一段连续的前台使用时间，不跨越午夜
 type AppUsage struct {
 	ID        int64     `json:"id" db:"id"`
 	AppName   string    `json:"app_name" db:"app_name"`
 	StartTime time.Time `json:"start_time" db:"start_time"`
 	EndTime   time.Time `json:"end_time" db:"end_time"`
-	Duration  int64     `json:"duration" db:"duration"`
-}
\ No newline at end of file
+	Duration  int64     `json:"duration" db:"duration"` // 持续时间（秒）
+	DeviceID  string    `json:"device_id,omitempty" db:"device_id"`
+}
+
+// Screenshot 一张截图的元数据，图片文件按内容哈希保存，内容相同的截图共用一个文件
+type Screenshot struct {
+	ID          int64     `json:"id" db:"id"`
+	Hash        string    `json:"hash" db:"hash"` // 图片内容的 SHA-256
+	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
+	AppName     string    `json:"app_name" db:"app_name"`
+	WindowTitle string    `json:"window_title" db:"window_title"`
+	Analysis    string    `json:"analysis,omitempty" db:"analysis"` // AI 对截图内容的分析结果
+	Format      string    `json:"format" db:"format"`               // png 或 jpeg
+	Width       int       `json:"width" db:"width"`
+	Height      int       `json:"height" db:"height"`
+	Size        int64     `json:"size" db:"size"` // 图片文件字节数
+	DeviceID    string    `json:"device_id,omitempty" db:"device_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// DailyAppStats 按天按应用汇总的统计数据，写入时增量维护，原始记录被清理后仍然保留
+type DailyAppStats struct {
+	Day           string `json:"day" db:"day"` // 本地日期，格式 2006-01-02
+	AppName       string `json:"app_name" db:"app_name"`
+	ActivityCount int64  `json:"activity_count" db:"activity_count"`
+	KeyboardCount int64  `json:"keyboard_count" db:"keyboard_count"`
+	Keystrokes    int64  `json:"keystrokes" db:"keystrokes"` // 键盘输入的字符数
+	Duration      int64  `json:"duration" db:"duration"`     // 累计持续时间（秒）
+}
+
+// HourlyAppStats 按小时按应用汇总的统计数据，与 DailyAppStats 同时维护
+type HourlyAppStats struct {
+	Hour          string `json:"hour" db:"hour"` // 本地时间的整点，格式 2006-01-02 15:00
+	AppName       string `json:"app_name" db:"app_name"`
+	ActivityCount int64  `json:"activity_count" db:"activity_count"`
+	KeyboardCount int64  `json:"keyboard_count" db:"keyboard_count"`
+	Keystrokes    int64  `json:"keystrokes" db:"keystrokes"`
+	Duration      int64  `json:"duration" db:"duration"`
+}
+
+// AppUsageTotal 时间段内某个应用的累计前台使用时长
+type AppUsageTotal struct {
+	AppName  string `json:"app_name" db:"app_name"`
+	Sessions int64  `json:"sessions" db:"sessions"`
+	Duration int64  `json:"duration" db:"duration"` // 累计使用时长（秒）
+}
+
+// Tag 用户定义的标签，可以关联到活动记录、应用使用记录和AI总结
+type Tag struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Color     string    `json:"color,omitempty" db:"color"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Project 用户定义的项目（例如某个客户或内部工具），关联的记录的时间归属到该项目
+type Project struct {
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description,omitempty" db:"description"`
+	Color       string    `json:"color,omitempty" db:"color"`
+	Archived    bool      `json:"archived" db:"archived"` // 已归档的项目不再被规则关联，已有的关联保留
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// RuleField 自动打标签规则匹配的字段
+type RuleField string
+
+const (
+	RuleFieldApp    RuleField = "app"    // 应用名，忽略大小写精确匹配
+	RuleFieldTitle  RuleField = "title"  // 窗口标题，正则表达式
+	RuleFieldDomain RuleField = "domain" // 网址域名，同时匹配子域名
+)
+
+// TagRule 自动打标签规则，新写入的活动记录匹配时关联到 TagID 或 ProjectID（二选一）
+type TagRule struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name,omitempty" db:"name"`
+	Field     RuleField `json:"field" db:"field"`
+	Pattern   string    `json:"pattern" db:"pattern"`
+	TagID     int64     `json:"tag_id,omitempty" db:"tag_id"`
+	ProjectID int64     `json:"project_id,omitempty" db:"project_id"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Labels 一条记录关联的标签和项目
+type Labels struct {
+	Tags     []*Tag     `json:"tags"`
+	Projects []*Project `json:"projects"`
+}
+
+// ProjectTotal 时间段内关联到某个项目的记录数和时长
+type ProjectTotal struct {
+	ProjectID        int64  `json:"project_id"`
+	Name             string `json:"name"`
+	Activities       int64  `json:"activities"`
+	ActivityDuration int64  `json:"activity_duration"` // 关联的活动记录累计持续时间（秒）
+	Sessions         int64  `json:"sessions"`
+	SessionDuration  int64  `json:"session_duration"` // 关联的应用使用记录累计时长（秒）
+}